@@ -0,0 +1,263 @@
+// Package apierror is the error model shared by the HTTP handlers and
+// middleware. Every error response has the same JSON shape:
+//
+//	{"error": "Tenant not found", "code": "TENANT_NOT_FOUND", "request_id": "...", "details": {...}}
+//
+// The error message is for people and may change. Clients should branch on
+// the code, which is stable.
+package apierror
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Code is a stable, machine-readable error code
+type Code string
+
+// Request errors
+const (
+	InvalidRequest       Code = "INVALID_REQUEST"        // a field or query parameter is missing or invalid
+	MalformedBody        Code = "MALFORMED_BODY"         // the body could not be decoded
+	PayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"      // the body or batch is over the server's limit
+	UnsupportedMediaType Code = "UNSUPPORTED_MEDIA_TYPE" // unknown Content-Encoding
+	RouteNotFound        Code = "ROUTE_NOT_FOUND"
+	MethodNotAllowed     Code = "METHOD_NOT_ALLOWED"
+)
+
+// Authentication errors
+const (
+	Unauthorized           Code = "UNAUTHORIZED"             // missing or malformed Authorization header
+	InvalidAPIKey          Code = "INVALID_API_KEY"          // no tenant or admin has this key
+	TenantInactive         Code = "TENANT_INACTIVE"          // the tenant is suspended or cancelled
+	TenantAccessDenied     Code = "TENANT_ACCESS_DENIED"     // the key may not act for the requested tenant
+	PermissionDenied       Code = "PERMISSION_DENIED"        // the admin's roles don't allow the route
+	InvalidSignature       Code = "INVALID_SIGNATURE"        // a device signature is missing, stale, replayed or wrong
+	DeviceNotEnrolled      Code = "DEVICE_NOT_ENROLLED"      // the device has no credentials
+	DeviceAccessDenied     Code = "DEVICE_ACCESS_DENIED"     // the device is suspended, or the request names another device or tenant
+	CertificateRevoked     Code = "CERTIFICATE_REVOKED"      // the client certificate was revoked or is unknown
+	InvalidEnrollmentToken Code = "INVALID_ENROLLMENT_TOKEN" // the enrollment token is unknown, expired or already used
+)
+
+// Missing resources
+const (
+	TenantNotFound        Code = "TENANT_NOT_FOUND"
+	SubscriptionNotFound  Code = "SUBSCRIPTION_NOT_FOUND"
+	PaymentNotFound       Code = "PAYMENT_NOT_FOUND"
+	CreditNoteNotFound    Code = "CREDIT_NOTE_NOT_FOUND"
+	BillingPeriodNotFound Code = "BILLING_PERIOD_NOT_FOUND"
+	HeldUsageNotFound     Code = "HELD_USAGE_NOT_FOUND"
+	WalletNotFound        Code = "WALLET_NOT_FOUND"
+	AdminNotFound         Code = "ADMIN_NOT_FOUND"
+	DeviceNotFound        Code = "DEVICE_NOT_FOUND"
+	CertificateNotFound   Code = "CERTIFICATE_NOT_FOUND"
+)
+
+// State conflicts
+const (
+	BillingCycleUnchanged Code = "BILLING_CYCLE_UNCHANGED" // already on the requested cycle
+	PeriodAlreadyClosed   Code = "PERIOD_ALREADY_CLOSED"   // the billing period overlaps a closed one
+	PeriodNotEnded        Code = "PERIOD_NOT_ENDED"        // the billing period is still open for usage
+	AlreadyReviewed       Code = "ALREADY_REVIEWED"        // held usage was already released or rejected
+	TrialNotRevocable     Code = "TRIAL_NOT_REVOCABLE"
+)
+
+// Licensing outcomes. These are also reported as the reason alongside
+// is_valid=false in license validation responses.
+const (
+	Unlicensed                Code = "UNLICENSED"                   // the tenant has no subscription
+	LicenseExpired            Code = "LICENSE_EXPIRED"              // the trial or subscription has ended
+	SubscriptionInactive      Code = "SUBSCRIPTION_INACTIVE"        // cancelled, or past due beyond the grace window
+	TrialLimitExceeded        Code = "TRIAL_LIMIT_EXCEEDED"         // the trial's camera allowance is used up
+	DeviceCameraLimitExceeded Code = "DEVICE_CAMERA_LIMIT_EXCEEDED" // the device's camera quota is used up
+)
+
+// Payment errors
+const (
+	NoPaymentMethod       Code = "NO_PAYMENT_METHOD"       // the tenant has no payment method to charge
+	PaymentMethodRejected Code = "PAYMENT_METHOD_REJECTED" // the provider would not attach the payment method
+	PaymentProviderError  Code = "PAYMENT_PROVIDER_ERROR"  // the payment provider failed the call
+	PaymentDeclined       Code = "PAYMENT_DECLINED"        // the provider declined the charge
+)
+
+// Server errors
+const (
+	Internal        Code = "INTERNAL_ERROR"
+	NotImplemented  Code = "NOT_IMPLEMENTED"
+	FeatureDisabled Code = "FEATURE_DISABLED" // the feature isn't enabled on this server
+)
+
+var statuses = map[Code]int{
+	InvalidRequest:       http.StatusBadRequest,
+	MalformedBody:        http.StatusBadRequest,
+	PayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	RouteNotFound:        http.StatusNotFound,
+	MethodNotAllowed:     http.StatusMethodNotAllowed,
+
+	Unauthorized:           http.StatusUnauthorized,
+	InvalidAPIKey:          http.StatusUnauthorized,
+	TenantInactive:         http.StatusForbidden,
+	TenantAccessDenied:     http.StatusForbidden,
+	PermissionDenied:       http.StatusForbidden,
+	InvalidSignature:       http.StatusUnauthorized,
+	DeviceNotEnrolled:      http.StatusForbidden,
+	DeviceAccessDenied:     http.StatusForbidden,
+	CertificateRevoked:     http.StatusUnauthorized,
+	InvalidEnrollmentToken: http.StatusUnauthorized,
+
+	TenantNotFound:        http.StatusNotFound,
+	SubscriptionNotFound:  http.StatusNotFound,
+	PaymentNotFound:       http.StatusNotFound,
+	CreditNoteNotFound:    http.StatusNotFound,
+	BillingPeriodNotFound: http.StatusNotFound,
+	HeldUsageNotFound:     http.StatusNotFound,
+	WalletNotFound:        http.StatusNotFound,
+	AdminNotFound:         http.StatusNotFound,
+	DeviceNotFound:        http.StatusNotFound,
+	CertificateNotFound:   http.StatusNotFound,
+
+	BillingCycleUnchanged: http.StatusConflict,
+	PeriodAlreadyClosed:   http.StatusConflict,
+	PeriodNotEnded:        http.StatusBadRequest,
+	AlreadyReviewed:       http.StatusConflict,
+	TrialNotRevocable:     http.StatusBadRequest,
+
+	Unlicensed:                http.StatusForbidden,
+	LicenseExpired:            http.StatusForbidden,
+	SubscriptionInactive:      http.StatusForbidden,
+	TrialLimitExceeded:        http.StatusForbidden,
+	DeviceCameraLimitExceeded: http.StatusForbidden,
+
+	NoPaymentMethod:       http.StatusBadRequest,
+	PaymentMethodRejected: http.StatusBadRequest,
+	PaymentProviderError:  http.StatusBadGateway,
+	PaymentDeclined:       http.StatusPaymentRequired,
+
+	Internal:        http.StatusInternalServerError,
+	NotImplemented:  http.StatusNotImplemented,
+	FeatureDisabled: http.StatusServiceUnavailable,
+}
+
+// Status returns the HTTP status a code is sent with
+func (c Code) Status() int {
+	if status, ok := statuses[c]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// Error is an API error with a stable code
+type Error struct {
+	Code    Code
+	Message string
+	Details map[string]interface{}
+	Err     error // underlying cause; logged, never sent to clients
+}
+
+// New creates an error
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Newf creates an error with a formatted message
+func Newf(code Code, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// Wrap creates an error caused by err
+func Wrap(code Code, err error, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+// InvalidBody reports a request body that failed to decode, or that was over
+// the server's size limit
+func InvalidBody(err error) *Error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return Wrap(PayloadTooLarge, err, fmt.Sprintf("Request body exceeds %d bytes", tooLarge.Limit)).
+			WithDetail("limit_bytes", tooLarge.Limit)
+	}
+	return Wrap(MalformedBody, err, "Invalid request body: "+err.Error())
+}
+
+// WithDetail adds a machine-readable detail to the error
+func (e *Error) WithDetail(key string, value interface{}) *Error {
+	if e.Details == nil {
+		e.Details = make(map[string]interface{})
+	}
+	e.Details[key] = value
+	return e
+}
+
+// Status returns the HTTP status the error is sent with
+func (e *Error) Status() int {
+	return e.Code.Status()
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// From returns err as an API error. Errors without a code are internal, and
+// their text is not sent to clients.
+func From(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	return Wrap(Internal, err, "Internal server error")
+}
+
+// Body is the JSON body of an error response
+type Body struct {
+	Error     string                 `json:"error"`
+	Code      Code                   `json:"code"`
+	RequestID string                 `json:"request_id,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+// Write sends err as a JSON error response. Server errors are logged with
+// their cause and the request ID.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := From(err)
+	requestID := RequestIDFromContext(r.Context())
+	status := apiErr.Status()
+
+	if status >= http.StatusInternalServerError {
+		log.Printf("[ERROR] %s %s (request %s): %v", r.Method, r.URL.Path, requestID, apiErr)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Body{
+		Error:     apiErr.Message,
+		Code:      apiErr.Code,
+		RequestID: requestID,
+		Details:   apiErr.Details,
+	})
+}
+
+type contextKey struct{}
+
+// WithRequestID attaches a request ID to a context
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, requestID)
+}
+
+// RequestIDFromContext returns the request ID attached to a context, if any
+func RequestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(contextKey{}).(string)
+	return requestID
+}
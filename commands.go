@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"brinkbyte-billing-server/handlers"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/oidc"
+	"brinkbyte-billing-server/retention"
+)
+
+// runRebuildRollups implements the rebuild-rollups command, which recomputes
+// usage rollups from raw events after a backfill:
+//
+//	bbBilling rebuild-rollups [-tenant ID] [-from RFC3339] [-to RFC3339]
+//
+// Archived months in USAGE_ARCHIVE_DIR keep their rollups; restore them
+// first to rebuild them.
+func runRebuildRollups(ctx context.Context, store handlers.Storage, args []string) {
+	fs := flag.NewFlagSet("rebuild-rollups", flag.ExitOnError)
+	tenantID := fs.String("tenant", "", "only rebuild this tenant (default all tenants)")
+	from := fs.String("from", "", "start of the range to rebuild, RFC3339 (default unbounded)")
+	to := fs.String("to", "", "end of the range to rebuild, RFC3339 (default unbounded)")
+	fs.Parse(args)
+
+	var start, end time.Time
+	var err error
+	if *from != "" {
+		if start, err = time.Parse(time.RFC3339, *from); err != nil {
+			log.Fatalf("Invalid -from: %v", err)
+		}
+	}
+	if *to != "" {
+		if end, err = time.Parse(time.RFC3339, *to); err != nil {
+			log.Fatalf("Invalid -to: %v", err)
+		}
+	}
+
+	began := time.Now()
+	manager := retention.NewManager(retention.LoadConfigFromEnv(), store)
+	rebuilt, skipped, err := manager.RebuildRollups(ctx, *tenantID, start, end)
+	if err != nil {
+		log.Fatalf("Failed to rebuild usage rollups: %v", err)
+	}
+
+	log.Printf("✅ Rebuilt %d usage rollups in %v (archived months skipped: %v)", rebuilt, time.Since(began).Round(time.Millisecond), skipped)
+}
+
+// runRestoreUsage implements the restore-usage command, which re-imports
+// archived months of usage events from USAGE_ARCHIVE_DIR:
+//
+//	bbBilling restore-usage -from YYYY-MM [-to YYYY-MM]
+func runRestoreUsage(ctx context.Context, store handlers.Storage, args []string) {
+	fs := flag.NewFlagSet("restore-usage", flag.ExitOnError)
+	from := fs.String("from", "", "first month to restore, YYYY-MM")
+	to := fs.String("to", "", "last month to restore, YYYY-MM (default -from)")
+	fs.Parse(args)
+
+	if *to == "" {
+		*to = *from
+	}
+	start, err := retention.ParseMonth(*from)
+	if err != nil {
+		log.Fatalf("Invalid -from: %v", err)
+	}
+	end, err := retention.ParseMonth(*to)
+	if err != nil {
+		log.Fatalf("Invalid -to: %v", err)
+	}
+
+	manager := retention.NewManager(retention.LoadConfigFromEnv(), store)
+	result, err := manager.Restore(ctx, start, end)
+	if err != nil {
+		log.Fatalf("Failed to restore usage: %v", err)
+	}
+
+	log.Printf("✅ Restored %d usage events (months restored: %v, skipped: %v)",
+		result.Events, result.Restored, result.Skipped)
+}
+
+// runCreateAdmin implements the create-admin command, which creates a named
+// admin and prints its API key, e.g. to bootstrap the first admin of a server
+// that requires admin auth without setting ADMIN_API_KEY:
+//
+//	bbBilling create-admin -name NAME [-email EMAIL] [-roles super-admin,...]
+func runCreateAdmin(ctx context.Context, store handlers.Storage, args []string) {
+	fs := flag.NewFlagSet("create-admin", flag.ExitOnError)
+	name := fs.String("name", "", "admin name")
+	email := fs.String("email", "", "admin email (optional)")
+	roles := fs.String("roles", models.AdminRoleSuperAdmin, "comma-separated admin roles")
+	fs.Parse(args)
+
+	if strings.TrimSpace(*name) == "" {
+		log.Fatalf("-name is required")
+	}
+	roleList := strings.Split(*roles, ",")
+	for _, role := range roleList {
+		if !models.ValidAdminRole(role) {
+			log.Fatalf("Unknown admin role: %s", role)
+		}
+	}
+	var emailPtr *string
+	if *email != "" {
+		emailPtr = email
+	}
+
+	admin, key, err := handlers.NewAdminPrincipal(*name, emailPtr, roleList)
+	if err != nil {
+		log.Fatalf("Failed to generate admin key: %v", err)
+	}
+	if err := store.CreateAdminPrincipal(ctx, admin); err != nil {
+		log.Fatalf("Failed to create admin: %v", err)
+	}
+
+	log.Printf("✅ Created admin %s with roles %v", admin, admin.Roles)
+	fmt.Println(key)
+}
+
+// runDevAdminToken implements the dev-admin-token command, which signs an
+// admin SSO token with a local key so SSO can be tried without an identity
+// provider. It creates the key on first use and writes its JWKS for
+// ADMIN_OIDC_JWKS_FILE:
+//
+//	bbBilling dev-admin-token -roles viewer [-sub ID] [-name NAME] [-ttl 1h]
+//
+// The token is printed to stdout. The issuer and audience default to
+// ADMIN_OIDC_ISSUER and ADMIN_OIDC_AUDIENCE. Roles are sent as given, so the
+// server needs ADMIN_OIDC_ROLE_MAP entries or ADMIN_OIDC_ROLES_PASSTHROUGH=true
+// to accept them.
+func runDevAdminToken(args []string) {
+	fs := flag.NewFlagSet("dev-admin-token", flag.ExitOnError)
+	keyPath := fs.String("key", "dev-admin-sso-key.pem", "PEM private key, created if missing")
+	jwksPath := fs.String("jwks", "dev-admin-sso-jwks.json", "where to write the public JWKS")
+	issuer := fs.String("iss", getEnvOrDefault("ADMIN_OIDC_ISSUER", "http://localhost/dev-sso"), "token issuer")
+	audience := fs.String("aud", getEnvOrDefault("ADMIN_OIDC_AUDIENCE", "dev-admin"), "token audience")
+	subject := fs.String("sub", "dev-admin", "token subject")
+	name := fs.String("name", "Dev Admin", "admin display name")
+	email := fs.String("email", "", "admin email")
+	roles := fs.String("roles", "viewer", "comma-separated roles claim values")
+	ttl := fs.Duration("ttl", time.Hour, "token lifetime")
+	fs.Parse(args)
+
+	key, err := loadOrCreateDevKey(*keyPath)
+	if err != nil {
+		log.Fatalf("Failed to load signing key: %v", err)
+	}
+
+	kid := "dev-" + fmt.Sprintf("%x", sha256.Sum256(key.PublicKey.N.Bytes()))[:16]
+	jwks, err := json.MarshalIndent(oidc.JWKS{Keys: []oidc.JWK{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.PublicKey.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.PublicKey.E)).Bytes()),
+	}}}, "", "  ")
+	if err != nil {
+		log.Fatalf("Failed to encode JWKS: %v", err)
+	}
+	if err := os.WriteFile(*jwksPath, jwks, 0644); err != nil {
+		log.Fatalf("Failed to write JWKS: %v", err)
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   *issuer,
+		"sub":   *subject,
+		"name":  *name,
+		"aud":   *audience,
+		"roles": strings.Split(*roles, ","),
+		"iat":   now.Unix(),
+		"exp":   now.Add(*ttl).Unix(),
+	}
+	if *email != "" {
+		claims["email"] = *email
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		log.Fatalf("Failed to sign token: %v", err)
+	}
+
+	log.Printf("✅ Signed with %s; JWKS written to %s", *keyPath, *jwksPath)
+	fmt.Println(signed)
+}
+
+func loadOrCreateDevKey(path string) (*rsa.PrivateKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s is not PEM", path)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
@@ -0,0 +1,347 @@
+package dunning
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"brinkbyte-billing-server/models"
+)
+
+// Storage interface for the dunning engine (minimal subset)
+type Storage interface {
+	GetTenant(ctx context.Context, tenantID string) (*models.Tenant, error)
+	UpdateTenant(ctx context.Context, tenant *models.Tenant) error
+	GetSubscription(ctx context.Context, tenantID string) (*models.Subscription, error)
+	UpdateSubscription(ctx context.Context, sub *models.Subscription) error
+	SaveDunningCase(ctx context.Context, dc *models.DunningCase) error
+	GetOpenDunningCase(ctx context.Context, tenantID string) (*models.DunningCase, error)
+	GetDueDunningCases(ctx context.Context, before time.Time) ([]models.DunningCase, error)
+	GetDunningCasesByTenant(ctx context.Context, tenantID string) ([]models.DunningCase, error)
+}
+
+// Charger retries a charge for a tenant and returns the recorded attempt
+type Charger func(ctx context.Context, tenantID string, amount float64, description, referenceType string, referenceID *string) (*models.PaymentAttempt, error)
+
+// Engine moves tenants with failed payments through the dunning schedule
+type Engine struct {
+	policy   Policy
+	store    Storage
+	charge   Charger
+	notifier Notifier
+	mu       sync.Mutex
+}
+
+// NewEngine creates a dunning engine
+func NewEngine(policy Policy, store Storage, charge Charger, notifier Notifier) *Engine {
+	if notifier == nil {
+		notifier = LogNotifier{}
+	}
+	return &Engine{
+		policy:   policy,
+		store:    store,
+		charge:   charge,
+		notifier: notifier,
+	}
+}
+
+// Policy returns the engine's dunning policy
+func (e *Engine) Policy() Policy {
+	return e.policy
+}
+
+// HandlePaymentResult updates dunning state for a charge that has reached a
+// final status. Failures open a case; successes recover the open case, or
+// the suspended case that suspended the tenant, when they pay for it.
+func (e *Engine) HandlePaymentResult(ctx context.Context, attempt *models.PaymentAttempt) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.handleResult(ctx, attempt)
+}
+
+func (e *Engine) handleResult(ctx context.Context, attempt *models.PaymentAttempt) error {
+	switch attempt.Status {
+	case models.PaymentStatusFailed:
+		return e.handleFailure(ctx, attempt)
+	case models.PaymentStatusSucceeded:
+		return e.handleSuccess(ctx, attempt)
+	}
+	return nil
+}
+
+func (e *Engine) handleFailure(ctx context.Context, attempt *models.PaymentAttempt) error {
+	dc, err := e.store.GetOpenDunningCase(ctx, attempt.TenantID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	if dc == nil {
+		// First failure - open a case and mark the subscription past due
+		dc = &models.DunningCase{
+			ID:               uuid.New().String(),
+			TenantID:         attempt.TenantID,
+			SubscriptionID:   attempt.SubscriptionID,
+			PaymentAttemptID: attempt.ID,
+			LastAttemptID:    attempt.ID,
+			Amount:           attempt.Amount,
+			Description:      attempt.Description,
+			ReferenceType:    attempt.ReferenceType,
+			ReferenceID:      attempt.ReferenceID,
+			Status:           models.DunningStatusOpen,
+			StartedAt:        now,
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		if len(e.policy.RetryDays) > 0 {
+			next := e.policy.retryAt(dc.StartedAt, 0)
+			dc.NextActionAt = &next
+		}
+
+		if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+			return err
+		}
+		if err := e.setSubscriptionStatus(ctx, attempt.TenantID, "past_due"); err != nil {
+			return err
+		}
+
+		log.Printf("[DUNNING] Opened case %s for tenant %s (attempt=%s, amount=%.2f)",
+			dc.ID, dc.TenantID, attempt.ID, attempt.Amount)
+		e.notify(ctx, NoticePaymentFailed, dc)
+
+		if dc.NextActionAt == nil {
+			return e.suspend(ctx, dc)
+		}
+		return nil
+	}
+
+	// Only the case's latest retry moves the schedule forward
+	if dc.LastAttemptID != attempt.ID {
+		return nil
+	}
+
+	if dc.RetryCount >= len(e.policy.RetryDays) {
+		return e.suspend(ctx, dc)
+	}
+
+	next := e.policy.retryAt(dc.StartedAt, dc.RetryCount)
+	dc.NextActionAt = &next
+	dc.UpdatedAt = now
+	if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+		return err
+	}
+
+	e.notify(ctx, NoticeRetryFailed, dc)
+	return nil
+}
+
+func (e *Engine) handleSuccess(ctx context.Context, attempt *models.PaymentAttempt) error {
+	dc, err := e.store.GetOpenDunningCase(ctx, attempt.TenantID)
+	if err != nil {
+		return err
+	}
+	if dc == nil {
+		if dc, err = e.suspendedCase(ctx, attempt.TenantID); err != nil || dc == nil {
+			return err
+		}
+	}
+	if !paysCase(dc, attempt) {
+		log.Printf("[DUNNING] Attempt %s for tenant %s doesn't pay case %s; case unchanged", attempt.ID, attempt.TenantID, dc.ID)
+		return nil
+	}
+
+	now := time.Now()
+	dc.Status = models.DunningStatusRecovered
+	dc.LastAttemptID = attempt.ID
+	dc.NextActionAt = nil
+	dc.ResolvedAt = &now
+	dc.UpdatedAt = now
+	if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+		return err
+	}
+
+	if err := e.setSubscriptionStatus(ctx, dc.TenantID, "active"); err != nil {
+		return err
+	}
+
+	log.Printf("[DUNNING] Case %s for tenant %s recovered by attempt %s", dc.ID, dc.TenantID, attempt.ID)
+	e.notify(ctx, NoticePaymentRecovered, dc)
+	return nil
+}
+
+// paysCase reports whether a successful charge settles a dunning case: one
+// of the case's own charges, a charge for the same reference, or one that
+// covers the outstanding amount
+func paysCase(dc *models.DunningCase, attempt *models.PaymentAttempt) bool {
+	if attempt.ID == dc.PaymentAttemptID || attempt.ID == dc.LastAttemptID {
+		return true
+	}
+	if dc.ReferenceID != nil && attempt.ReferenceID != nil &&
+		attempt.ReferenceType == dc.ReferenceType && *attempt.ReferenceID == *dc.ReferenceID {
+		return true
+	}
+	return attempt.Amount >= dc.Amount
+}
+
+// suspendedCase returns the tenant's latest dunning case if it ended in
+// suspension, so that a later payment can still recover it
+func (e *Engine) suspendedCase(ctx context.Context, tenantID string) (*models.DunningCase, error) {
+	cases, err := e.store.GetDunningCasesByTenant(ctx, tenantID)
+	if err != nil || len(cases) == 0 {
+		return nil, err
+	}
+	if cases[0].Status != models.DunningStatusSuspended {
+		return nil, nil
+	}
+	return &cases[0], nil
+}
+
+// suspend stops retrying the case and suspends the tenant's subscription and account
+func (e *Engine) suspend(ctx context.Context, dc *models.DunningCase) error {
+	now := time.Now()
+	dc.Status = models.DunningStatusSuspended
+	dc.NextActionAt = nil
+	dc.ResolvedAt = &now
+	dc.UpdatedAt = now
+	if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+		return err
+	}
+
+	if err := e.setSubscriptionStatus(ctx, dc.TenantID, "suspended"); err != nil {
+		return err
+	}
+
+	tenant, err := e.store.GetTenant(ctx, dc.TenantID)
+	if err != nil {
+		return err
+	}
+	if tenant != nil && tenant.Status == "active" {
+		tenant.Status = "suspended"
+		tenant.UpdatedAt = now
+		if err := e.store.UpdateTenant(ctx, tenant); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("[DUNNING] Case %s exhausted after %d retries, tenant %s suspended", dc.ID, dc.RetryCount, dc.TenantID)
+	e.notify(ctx, NoticeSuspended, dc)
+	return nil
+}
+
+// setSubscriptionStatus updates the status of the tenant's subscription, and
+// reactivates a tenant that dunning previously suspended
+func (e *Engine) setSubscriptionStatus(ctx context.Context, tenantID, status string) error {
+	sub, err := e.store.GetSubscription(ctx, tenantID)
+	if err != nil || sub == nil {
+		return err
+	}
+
+	previous := sub.Status
+	if previous != status {
+		sub.Status = status
+		sub.UpdatedAt = time.Now()
+		if err := e.store.UpdateSubscription(ctx, sub); err != nil {
+			return err
+		}
+	}
+
+	if status == "active" && previous == "suspended" {
+		tenant, err := e.store.GetTenant(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		if tenant != nil && tenant.Status == "suspended" {
+			tenant.Status = "active"
+			tenant.UpdatedAt = time.Now()
+			return e.store.UpdateTenant(ctx, tenant)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) notify(ctx context.Context, kind string, dc *models.DunningCase) {
+	notice := Notice{
+		Kind:        kind,
+		TenantID:    dc.TenantID,
+		CaseID:      dc.ID,
+		Amount:      dc.Amount,
+		RetryCount:  dc.RetryCount,
+		NextRetryAt: dc.NextActionAt,
+	}
+	if err := e.notifier.Notify(ctx, notice); err != nil {
+		log.Printf("[DUNNING] Failed to send %s notice to tenant %s: %v", kind, dc.TenantID, err)
+	}
+}
+
+// ProcessDue retries every open case whose next retry is due
+func (e *Engine) ProcessDue(ctx context.Context, now time.Time) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cases, err := e.store.GetDueDunningCases(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	for i := range cases {
+		dc := &cases[i]
+		if err := e.retry(ctx, dc); err != nil {
+			log.Printf("[DUNNING] Retry failed for case %s: %v", dc.ID, err)
+		}
+	}
+	return nil
+}
+
+func (e *Engine) retry(ctx context.Context, dc *models.DunningCase) error {
+	dc.RetryCount++
+	dc.NextActionAt = nil
+	dc.UpdatedAt = time.Now()
+
+	log.Printf("[DUNNING] Retry %d/%d for case %s (tenant %s)", dc.RetryCount, len(e.policy.RetryDays), dc.ID, dc.TenantID)
+
+	attempt, err := e.charge(ctx, dc.TenantID, dc.Amount, dc.Description, dc.ReferenceType, dc.ReferenceID)
+	if err != nil {
+		// Could not even attempt the charge (no payment method, provider down) - count it as a failed retry
+		log.Printf("[DUNNING] Charge error for case %s: %v", dc.ID, err)
+		if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+			return err
+		}
+		return e.handleFailure(ctx, &models.PaymentAttempt{
+			TenantID: dc.TenantID,
+			ID:       dc.LastAttemptID,
+			Status:   models.PaymentStatusFailed,
+		})
+	}
+
+	dc.LastAttemptID = attempt.ID
+	if err := e.store.SaveDunningCase(ctx, dc); err != nil {
+		return err
+	}
+
+	// Pending charges are resolved later through HandlePaymentResult
+	return e.handleResult(ctx, attempt)
+}
+
+// Run processes due retries on the given interval until the context is cancelled
+func (e *Engine) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("[DUNNING] Worker started (interval=%v, retry_days=%v, grace_days=%d)",
+		interval, e.policy.RetryDays, e.policy.GraceDays)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.ProcessDue(ctx, time.Now()); err != nil {
+				log.Printf("[DUNNING] Failed to process due cases: %v", err)
+			}
+		}
+	}
+}
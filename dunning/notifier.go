@@ -0,0 +1,47 @@
+package dunning
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Notice kinds sent during dunning
+const (
+	NoticePaymentFailed    = "payment_failed"
+	NoticeRetryFailed      = "retry_failed"
+	NoticePaymentRecovered = "payment_recovered"
+	NoticeSuspended        = "account_suspended"
+)
+
+// Notice is a customer-facing dunning notification
+type Notice struct {
+	Kind        string
+	TenantID    string
+	CaseID      string
+	Amount      float64
+	RetryCount  int
+	NextRetryAt *time.Time
+}
+
+// Notifier delivers dunning notices to tenants
+type Notifier interface {
+	Notify(ctx context.Context, notice Notice) error
+}
+
+// LogNotifier writes notices to the server log. It is the default until an
+// email or webhook integration is configured.
+type LogNotifier struct{}
+
+// Notify logs the notice
+func (LogNotifier) Notify(ctx context.Context, notice Notice) error {
+	if notice.NextRetryAt != nil {
+		log.Printf("[DUNNING] Notify tenant %s: %s (case=%s, amount=%.2f, retries=%d, next_retry=%s)",
+			notice.TenantID, notice.Kind, notice.CaseID, notice.Amount, notice.RetryCount,
+			notice.NextRetryAt.Format(time.RFC3339))
+		return nil
+	}
+	log.Printf("[DUNNING] Notify tenant %s: %s (case=%s, amount=%.2f, retries=%d)",
+		notice.TenantID, notice.Kind, notice.CaseID, notice.Amount, notice.RetryCount)
+	return nil
+}
@@ -0,0 +1,57 @@
+package dunning
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy configures the dunning schedule for failed payments
+type Policy struct {
+	RetryDays []int // days after the first failure on which to retry the charge
+	GraceDays int   // days a past-due tenant keeps valid licenses
+}
+
+// DefaultPolicy retries on day 1, 3 and 7 and gives a 7 day license grace window
+func DefaultPolicy() Policy {
+	return Policy{
+		RetryDays: []int{1, 3, 7},
+		GraceDays: 7,
+	}
+}
+
+// LoadPolicyFromEnv loads the dunning policy from environment variables
+func LoadPolicyFromEnv() Policy {
+	policy := DefaultPolicy()
+
+	if v := os.Getenv("DUNNING_RETRY_DAYS"); v != "" {
+		var days []int
+		for _, part := range strings.Split(v, ",") {
+			if d, err := strconv.Atoi(strings.TrimSpace(part)); err == nil && d > 0 {
+				days = append(days, d)
+			}
+		}
+		if len(days) > 0 {
+			policy.RetryDays = days
+		}
+	}
+
+	if v := os.Getenv("DUNNING_GRACE_DAYS"); v != "" {
+		if d, err := strconv.Atoi(v); err == nil && d >= 0 {
+			policy.GraceDays = d
+		}
+	}
+
+	return policy
+}
+
+// retryAt returns when the given retry (zero based) is due for a case started at start
+func (p Policy) retryAt(start time.Time, retry int) time.Time {
+	return start.AddDate(0, 0, p.RetryDays[retry])
+}
+
+// GraceEnd returns when a past-due tenant's licenses stop being valid
+func (p Policy) GraceEnd(start time.Time) time.Time {
+	return start.AddDate(0, 0, p.GraceDays)
+}
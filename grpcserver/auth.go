@@ -0,0 +1,185 @@
+package grpcserver
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/proto/billingpb"
+)
+
+// healthServicePrefix is left unauthenticated for load balancer probes
+const healthServicePrefix = "/grpc.health.v1.Health/"
+
+// Storage is the storage the auth interceptors need
+type Storage interface {
+	middleware.Storage
+	middleware.DeviceCertStorage
+	middleware.DeviceStorage
+}
+
+// signedMethods carry device request signatures, like the heartbeat and
+// usage batch routes over HTTP
+var signedMethods = map[string]bool{
+	billingpb.EdgeBilling_Heartbeat_FullMethodName:   true,
+	billingpb.EdgeBilling_ReportUsage_FullMethodName: true,
+}
+
+// authenticate accepts a device client certificate the same way
+// DeviceCertificate does, attaching the device and its tenant to the returned
+// context. Without one it checks the "authorization" metadata the same way
+// AuthMiddleware checks the Authorization header, if requireKey is set.
+func authenticate(ctx context.Context, store Storage, requireKey bool) (context.Context, error) {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if cert := middleware.ClientCertificate(&tlsInfo.State); cert != nil {
+				device, tenant, authErr := middleware.AuthenticateDeviceCert(ctx, store, cert)
+				if authErr != nil {
+					return nil, status.Error(statusCode(authErr.Status()), authErr.Message)
+				}
+				return middleware.WithTenant(middleware.WithDevice(ctx, device), tenant), nil
+			}
+		}
+	}
+	if !requireKey {
+		return ctx, nil
+	}
+
+	var authHeader string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			authHeader = values[0]
+		}
+	}
+
+	tenant, authErr := middleware.AuthenticateAPIKey(ctx, store, authHeader)
+	if authErr != nil {
+		return nil, status.Error(statusCode(authErr.Status()), authErr.Message)
+	}
+	return middleware.WithTenant(ctx, tenant), nil
+}
+
+// verifySignature checks a device request signature the same way
+// DeviceSignatureMiddleware does, reading the signing headers from the call
+// metadata. The signed method is POST and the path is the full gRPC method
+// name. Unary calls sign the request message in deterministic protobuf
+// encoding; streams sign an empty body, leaving their messages to the
+// transport.
+func verifySignature(ctx context.Context, store Storage, signing middleware.DeviceSignatureConfig, fullMethod string, body []byte) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	req := middleware.SignedRequest{
+		DeviceID:  get(middleware.DeviceIDHeader),
+		Timestamp: get(middleware.SignatureTimestampHeader),
+		Nonce:     get(middleware.SignatureNonceHeader),
+		Signature: get(middleware.SignatureHeader),
+		Method:    http.MethodPost,
+		Path:      fullMethod,
+	}
+	ctx, authErr := middleware.AuthenticateDeviceSignature(ctx, store, signing, req, func() ([]byte, error) {
+		return body, nil
+	})
+	if authErr != nil {
+		return nil, status.Error(statusCode(authErr.Status()), authErr.Message)
+	}
+	return ctx, nil
+}
+
+// statusCode maps an API error's HTTP status to a gRPC code
+func statusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	default:
+		return codes.Internal
+	}
+}
+
+// statusError converts an error from the shared handler logic to a gRPC
+// status, keeping the API error's message
+func statusError(err error) error {
+	apiErr := apierror.From(err)
+	return status.Error(statusCode(apiErr.Status()), apiErr.Message)
+}
+
+// UnaryAuthInterceptor authenticates unary calls by device certificate or,
+// if requireKey is set, tenant API key, then checks device signatures on
+// signed methods
+func UnaryAuthInterceptor(store Storage, requireKey bool, signing middleware.DeviceSignatureConfig) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, store, requireKey)
+		if err != nil {
+			return nil, err
+		}
+		if signedMethods[info.FullMethod] {
+			msg, ok := req.(proto.Message)
+			if !ok {
+				return nil, status.Error(codes.Internal, "request is not a protobuf message")
+			}
+			body, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+			if err != nil {
+				return nil, status.Error(codes.Internal, err.Error())
+			}
+			if ctx, err = verifySignature(ctx, store, signing, info.FullMethod, body); err != nil {
+				return nil, err
+			}
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuthInterceptor authenticates streaming calls by device certificate
+// or, if requireKey is set, tenant API key, then checks device signatures on
+// signed methods
+func StreamAuthInterceptor(store Storage, requireKey bool, signing middleware.DeviceSignatureConfig) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if strings.HasPrefix(info.FullMethod, healthServicePrefix) {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), store, requireKey)
+		if err != nil {
+			return err
+		}
+		if signedMethods[info.FullMethod] {
+			if ctx, err = verifySignature(ctx, store, signing, info.FullMethod, nil); err != nil {
+				return err
+			}
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticatedStream carries the authenticated tenant in its context
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,155 @@
+// Package grpcserver serves the edge licensing and usage ingestion API over
+// gRPC, sharing the HTTP API's handler logic and storage
+package grpcserver
+
+//go:generate protoc -I ../proto --go_out=../proto/billingpb --go_opt=paths=source_relative --go-grpc_out=../proto/billingpb --go-grpc_opt=paths=source_relative billing.proto
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"brinkbyte-billing-server/handlers"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/proto/billingpb"
+)
+
+// Server implements the EdgeBilling gRPC service
+type Server struct {
+	billingpb.UnimplementedEdgeBillingServer
+	handler *handlers.Handler
+}
+
+// NewServer creates a gRPC server for the EdgeBilling service. With
+// requireAuth, calls need a tenant API key just like AuthMiddleware. With
+// tlsConfig the server speaks TLS, and calls presenting a device client
+// certificate are authenticated by it instead. Heartbeat and ReportUsage
+// check device signatures according to signing, as over HTTP.
+func NewServer(handler *handlers.Handler, store Storage, requireAuth bool, signing middleware.DeviceSignatureConfig, tlsConfig *tls.Config) *grpc.Server {
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	opts = append(opts,
+		grpc.UnaryInterceptor(UnaryAuthInterceptor(store, requireAuth, signing)),
+		grpc.StreamInterceptor(StreamAuthInterceptor(store, requireAuth, signing)))
+
+	srv := grpc.NewServer(opts...)
+	billingpb.RegisterEdgeBillingServer(srv, &Server{handler: handler})
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	return srv
+}
+
+// ValidateLicense validates a camera license
+func (s *Server) ValidateLicense(ctx context.Context, req *billingpb.ValidateLicenseRequest) (*billingpb.ValidateLicenseResponse, error) {
+	resp, err := s.handler.EvaluateLicense(ctx, models.LicenseValidationRequest{
+		CameraID: req.GetCameraId(),
+		TenantID: req.GetTenantId(),
+		DeviceID: req.GetDeviceId(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &billingpb.ValidateLicenseResponse{
+		IsValid:            resp.IsValid,
+		LicenseMode:        resp.LicenseMode,
+		EnabledGrowthPacks: resp.EnabledGrowthPacks,
+		ValidUntil:         timestamppb.New(resp.ValidUntil),
+		CamerasAllowed:     int32(resp.CamerasAllowed),
+		Reason:             resp.Reason,
+	}, nil
+}
+
+// CheckEntitlement checks whether a feature is enabled for a tenant
+func (s *Server) CheckEntitlement(ctx context.Context, req *billingpb.CheckEntitlementRequest) (*billingpb.CheckEntitlementResponse, error) {
+	resp, err := s.handler.EvaluateEntitlement(ctx, models.EntitlementCheckRequest{
+		TenantID:        req.GetTenantId(),
+		FeatureCategory: req.GetFeatureCategory(),
+		FeatureName:     req.GetFeatureName(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &billingpb.CheckEntitlementResponse{
+		IsEnabled:      resp.IsEnabled,
+		QuotaRemaining: int32(resp.QuotaRemaining),
+		ValidUntil:     timestamppb.New(resp.ValidUntil),
+	}, nil
+}
+
+// ReportUsage ingests a client stream of usage events, persisting them in
+// chunks as they arrive
+func (s *Server) ReportUsage(stream billingpb.EdgeBilling_ReportUsageServer) error {
+	began := time.Now()
+	usage := s.handler.NewUsageStream(stream.Context())
+
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// The client is gone, so there is no one to report to; keep what arrived
+			usage.Abort(err)
+			usage.Close()
+			return err
+		}
+		usage.Add(usageEventInput(event))
+	}
+	resp := usage.Close()
+
+	log.Printf("[GRPC] Usage stream: %d events, %d accepted, %d rejected, %d held in %v",
+		usage.Count(), resp.AcceptedCount, resp.RejectedCount, resp.HeldCount, time.Since(began).Round(time.Millisecond))
+	return stream.SendAndClose(&billingpb.ReportUsageResponse{
+		AcceptedCount: int32(resp.AcceptedCount),
+		RejectedCount: int32(resp.RejectedCount),
+		AdjustedCount: int32(resp.AdjustedCount),
+		HeldCount:     int32(resp.HeldCount),
+		Errors:        resp.Errors,
+	})
+}
+
+// Heartbeat records that an edge device is alive
+func (s *Server) Heartbeat(ctx context.Context, req *billingpb.HeartbeatRequest) (*billingpb.HeartbeatResponse, error) {
+	resp, err := s.handler.RecordHeartbeat(ctx, models.HeartbeatRequest{
+		DeviceID:        req.GetDeviceId(),
+		TenantID:        req.GetTenantId(),
+		ActiveCameraIDs: req.GetActiveCameraIds(),
+		ManagementTier:  req.GetManagementTier(),
+	})
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return &billingpb.HeartbeatResponse{
+		Status:                 resp.Status,
+		NextHeartbeatInSeconds: int32(resp.NextHeartbeatSeconds),
+	}, nil
+}
+
+// usageEventInput converts a streamed event to the JSON API's input form
+func usageEventInput(e *billingpb.UsageEvent) models.UsageEventInput {
+	input := models.UsageEventInput{
+		TenantID:   e.GetTenantId(),
+		EventType:  e.GetEventType(),
+		ResourceID: e.GetResourceId(),
+		Quantity:   e.GetQuantity(),
+		Unit:       e.GetUnit(),
+		EventTime:  models.NewFlexibleTime(e.GetEventTime()),
+	}
+	if e.GetMetadata() != nil {
+		input.Metadata = e.GetMetadata().AsMap()
+	}
+	return input
+}
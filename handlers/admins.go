@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+)
+
+// adminKeyPrefix marks admin API keys, so they are not mistaken for tenant keys
+const adminKeyPrefix = "bba_"
+
+// ListAdmins returns all admin principals (admin)
+func (h *Handler) ListAdmins(w http.ResponseWriter, r *http.Request) {
+	admins, err := h.storage.ListAdminPrincipals(r.Context())
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list admins"))
+		return
+	}
+	if admins == nil {
+		admins = []models.AdminPrincipal{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"admins": admins,
+		"count":  len(admins),
+	})
+}
+
+// GetCurrentAdmin returns the calling admin and what it may do
+func (h *Handler) GetCurrentAdmin(w http.ResponseWriter, r *http.Request) {
+	admin := middleware.AdminFromContext(r.Context())
+	if admin == nil {
+		respondError(w, r, apierror.New(apierror.Unauthorized, "No admin identity"))
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"admin":       admin,
+		"permissions": admin.Permissions(),
+	})
+}
+
+// CreateAdmin creates a named admin principal and issues its API key, which
+// is only returned here (admin)
+func (h *Handler) CreateAdmin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name  string   `json:"name"`
+		Email *string  `json:"email,omitempty"`
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if strings.TrimSpace(req.Name) == "" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "name is required"))
+		return
+	}
+	if apiErr := validateAdminRoles(req.Roles); apiErr != nil {
+		respondError(w, r, apiErr)
+		return
+	}
+
+	admin, key, err := NewAdminPrincipal(req.Name, req.Email, req.Roles)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to generate admin key"))
+		return
+	}
+
+	ctx := r.Context()
+	if err := h.storage.CreateAdminPrincipal(ctx, admin); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to create admin"))
+		return
+	}
+
+	log.Printf("[ADMIN] Created admin %s with roles %v by %s", admin, admin.Roles, actingAdmin(r))
+	respondJSON(w, map[string]interface{}{
+		"admin":   admin,
+		"api_key": key,
+	})
+}
+
+// UpdateAdmin changes an admin's name, email, roles or status (admin)
+func (h *Handler) UpdateAdmin(w http.ResponseWriter, r *http.Request) {
+	adminID := mux.Vars(r)["id"]
+
+	var req struct {
+		Name   *string  `json:"name,omitempty"`
+		Email  *string  `json:"email,omitempty"`
+		Roles  []string `json:"roles,omitempty"`
+		Status *string  `json:"status,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	ctx := r.Context()
+
+	admin, err := h.storage.GetAdminPrincipal(ctx, adminID)
+	if err != nil || admin == nil {
+		respondError(w, r, apierror.New(apierror.AdminNotFound, "Admin not found"))
+		return
+	}
+
+	if req.Name != nil {
+		if strings.TrimSpace(*req.Name) == "" {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "name must not be empty"))
+			return
+		}
+		admin.Name = *req.Name
+	}
+	if req.Email != nil {
+		admin.Email = req.Email
+	}
+	if req.Roles != nil {
+		if apiErr := validateAdminRoles(req.Roles); apiErr != nil {
+			respondError(w, r, apiErr)
+			return
+		}
+		admin.Roles = req.Roles
+	}
+	if req.Status != nil {
+		if *req.Status != models.AdminStatusActive && *req.Status != models.AdminStatusDisabled {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "status must be active or disabled"))
+			return
+		}
+		admin.Status = *req.Status
+	}
+	admin.UpdatedAt = time.Now()
+
+	if err := h.storage.UpdateAdminPrincipal(ctx, admin); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to update admin"))
+		return
+	}
+
+	log.Printf("[ADMIN] Updated admin %s (roles=%v, status=%s) by %s", admin, admin.Roles, admin.Status, actingAdmin(r))
+	respondJSON(w, admin)
+}
+
+// RotateAdminKey replaces an admin's API key; the old key stops working
+// immediately (admin)
+func (h *Handler) RotateAdminKey(w http.ResponseWriter, r *http.Request) {
+	adminID := mux.Vars(r)["id"]
+	ctx := r.Context()
+
+	admin, err := h.storage.GetAdminPrincipal(ctx, adminID)
+	if err != nil || admin == nil {
+		respondError(w, r, apierror.New(apierror.AdminNotFound, "Admin not found"))
+		return
+	}
+
+	key, err := generateSecret(adminKeyPrefix)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to generate admin key"))
+		return
+	}
+	admin.KeyPrefix = key[:len(adminKeyPrefix)+8]
+	admin.KeyHash = middleware.HashAdminKey(key)
+	admin.UpdatedAt = time.Now()
+
+	if err := h.storage.UpdateAdminPrincipal(ctx, admin); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to rotate admin key"))
+		return
+	}
+
+	log.Printf("[ADMIN] Rotated key for admin %s by %s", admin, actingAdmin(r))
+	respondJSON(w, map[string]interface{}{
+		"admin":   admin,
+		"api_key": key,
+	})
+}
+
+// NewAdminPrincipal builds an active admin with a fresh API key, returned
+// alongside it; only the key's hash is stored. Shared by CreateAdmin and the
+// create-admin command.
+func NewAdminPrincipal(name string, email *string, roles []string) (*models.AdminPrincipal, string, error) {
+	key, err := generateSecret(adminKeyPrefix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	return &models.AdminPrincipal{
+		ID:        uuid.New().String(),
+		Name:      name,
+		Email:     email,
+		Roles:     roles,
+		Status:    models.AdminStatusActive,
+		KeyPrefix: key[:len(adminKeyPrefix)+8],
+		KeyHash:   middleware.HashAdminKey(key),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}, key, nil
+}
+
+func validateAdminRoles(roles []string) *apierror.Error {
+	if len(roles) == 0 {
+		return apierror.New(apierror.InvalidRequest, "at least one role is required")
+	}
+	for _, role := range roles {
+		if !models.ValidAdminRole(role) {
+			return apierror.New(apierror.InvalidRequest, "Unknown admin role: "+role).
+				WithDetail("role", role)
+		}
+	}
+	return nil
+}
+
+// generateSecret returns a random key or secret with the given prefix
+func generateSecret(prefix string) (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return prefix + hex.EncodeToString(b), nil
+}
+
+// actingAdminID identifies the authenticated admin making a request, for
+// audit fields; nil when there is none
+func actingAdminID(r *http.Request) *string {
+	admin := middleware.AdminFromContext(r.Context())
+	if admin == nil {
+		return nil
+	}
+	id := admin.String()
+	return &id
+}
+
+// actingAdmin names the admin making a request, for logs
+func actingAdmin(r *http.Request) string {
+	if admin := middleware.AdminFromContext(r.Context()); admin != nil {
+		return admin.String()
+	}
+	return "unknown admin"
+}
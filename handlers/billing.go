@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/dunning"
+	"brinkbyte-billing-server/middleware"
 	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/payments"
+	"brinkbyte-billing-server/pki"
+	"brinkbyte-billing-server/rating"
+	"brinkbyte-billing-server/retention"
+	"brinkbyte-billing-server/wallet"
 )
 
 // Storage interface for all storage implementations
@@ -23,11 +30,13 @@ type Storage interface {
 	GetTenantByAPIKey(ctx context.Context, apiKey string) (*models.Tenant, error)
 	CreateTenant(ctx context.Context, tenant *models.Tenant) error
 	UpdateTenant(ctx context.Context, tenant *models.Tenant) error
+	ListTenants(ctx context.Context, q models.TenantListQuery) ([]models.Tenant, error)
 
 	// Subscription operations
 	GetSubscription(ctx context.Context, tenantID string) (*models.Subscription, error)
 	CreateSubscription(ctx context.Context, sub *models.Subscription) error
 	UpdateSubscription(ctx context.Context, sub *models.Subscription) error
+	ListSubscriptions(ctx context.Context, q models.SubscriptionListQuery) ([]models.Subscription, error)
 
 	// Growth pack operations
 	GetEnabledGrowthPacks(ctx context.Context, tenantID string) ([]models.GrowthPackAssignment, error)
@@ -39,6 +48,7 @@ type Storage interface {
 	SaveCameraLicense(ctx context.Context, license *models.CameraLicense) error
 	GetCamerasByTenant(ctx context.Context, tenantID string) ([]models.CameraLicense, error)
 	CountCamerasByTenant(ctx context.Context, tenantID string) (int, error)
+	ListCameraLicenses(ctx context.Context, q models.CameraLicenseListQuery) ([]models.CameraLicense, error)
 
 	// Entitlement operations
 	GetEntitlement(ctx context.Context, tenantID, category, feature string) (*models.FeatureEntitlement, error)
@@ -47,24 +57,116 @@ type Storage interface {
 	// Usage operations
 	SaveUsageEvents(ctx context.Context, events []models.UsageEvent) error
 	GetUsageSummary(ctx context.Context, tenantID string, start, end time.Time) (map[string]float64, error)
+	GetUsageTimeSeries(ctx context.Context, tenantID, eventType string, start, end time.Time, granularity string, loc *time.Location) ([]models.UsageBucket, error)
+	GetUsageBreakdown(ctx context.Context, q models.UsageBreakdownQuery) ([]models.UsageBreakdownRow, error)
+	ExportUsageEvents(ctx context.Context, q models.UsageExportQuery, fn func(e models.UsageEvent) error) error
+	RebuildUsageRollups(ctx context.Context, tenantID string, start, end time.Time) (int, error)
+
+	// Usage retention operations
+	EnsureUsagePartitions(ctx context.Context, from, to time.Time) error
+	GetArchivableUsageMonths(ctx context.Context, cutoff time.Time) ([]time.Time, error)
+	ArchiveUsageMonth(ctx context.Context, month time.Time, write func(e models.UsageEvent) error, seal func() error) (int, error)
+	ImportUsageEvents(ctx context.Context, read func() (*models.UsageEvent, error)) (int, error)
 
 	// Edge device operations
 	SaveEdgeDevice(ctx context.Context, device *models.EdgeDevice) error
+	RecordDeviceHeartbeat(ctx context.Context, device *models.EdgeDevice) error
 	GetEdgeDevice(ctx context.Context, deviceID string) (*models.EdgeDevice, error)
+	RecordDeviceNonce(ctx context.Context, deviceID, nonce string, expiresAt time.Time) (bool, error)
+
+	// Device certificate operations
+	CreateDeviceCertificate(ctx context.Context, cert *models.DeviceCertificate) error
+	GetDeviceCertificate(ctx context.Context, serial string) (*models.DeviceCertificate, error)
+	ListDeviceCertificates(ctx context.Context, deviceID string) ([]models.DeviceCertificate, error)
+	RevokeDeviceCertificate(ctx context.Context, serial, reason string, at time.Time) error
+
+	// Enrollment token operations
+	CreateEnrollmentToken(ctx context.Context, token *models.EnrollmentToken) error
+	GetEnrollmentTokenByHash(ctx context.Context, tokenHash string) (*models.EnrollmentToken, error)
+	RedeemEnrollmentToken(ctx context.Context, tokenID, deviceID string, at time.Time) (bool, error)
+
+	// Payment operations
+	GetPaymentAccount(ctx context.Context, tenantID string) (*models.PaymentAccount, error)
+	SavePaymentAccount(ctx context.Context, account *models.PaymentAccount) error
+	SavePaymentAttempt(ctx context.Context, attempt *models.PaymentAttempt) error
+	GetPaymentAttempt(ctx context.Context, attemptID string) (*models.PaymentAttempt, error)
+	GetPaymentAttemptByChargeID(ctx context.Context, provider, chargeID string) (*models.PaymentAttempt, error)
+	GetPaymentAttemptsByTenant(ctx context.Context, tenantID string) ([]models.PaymentAttempt, error)
+	GetPaymentAttemptsInRange(ctx context.Context, start, end time.Time) ([]models.PaymentAttempt, error)
+
+	// Dunning operations
+	SaveDunningCase(ctx context.Context, dc *models.DunningCase) error
+	GetOpenDunningCase(ctx context.Context, tenantID string) (*models.DunningCase, error)
+	GetDueDunningCases(ctx context.Context, before time.Time) ([]models.DunningCase, error)
+	GetDunningCasesByTenant(ctx context.Context, tenantID string) ([]models.DunningCase, error)
+
+	// Credit note operations
+	SaveCreditNote(ctx context.Context, note *models.CreditNote) error
+	GetCreditNote(ctx context.Context, noteID string) (*models.CreditNote, error)
+	GetCreditNotesByTenant(ctx context.Context, tenantID string) ([]models.CreditNote, error)
+	GetCreditNotesInRange(ctx context.Context, start, end time.Time) ([]models.CreditNote, error)
+
+	// Wallet operations
+	GetWallet(ctx context.Context, tenantID string) (*models.Wallet, error)
+	SaveWallet(ctx context.Context, w *models.Wallet) error
+	AddCreditGrant(ctx context.Context, grant *models.CreditGrant) (bool, error)
+	DrawdownCredits(ctx context.Context, tenantID string, amount float64, tx models.WalletTransaction) (float64, error)
+	ExpireCreditGrants(ctx context.Context, tenantID string, now time.Time) error
+	GetWalletBalance(ctx context.Context, tenantID string, now time.Time) (float64, error)
+	GetActiveCreditGrants(ctx context.Context, tenantID string, now time.Time) ([]models.CreditGrant, error)
+	GetWalletTransactions(ctx context.Context, tenantID string, limit int) ([]models.WalletTransaction, error)
+	SavePendingDrawdown(ctx context.Context, pending *models.PendingDrawdown) error
+	GetPendingDrawdowns(ctx context.Context, limit int) ([]models.PendingDrawdown, error)
+	DeletePendingDrawdown(ctx context.Context, id string) (bool, error)
+
+	// Billing period operations
+	SaveBillingPeriod(ctx context.Context, period *models.BillingPeriod) error
+	GetBillingPeriod(ctx context.Context, periodID string) (*models.BillingPeriod, error)
+	GetBillingPeriods(ctx context.Context, tenantID string) ([]models.BillingPeriod, error)
+	SaveHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent) error
+	ReviewHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent, events []models.UsageEvent) (bool, error)
+	GetHeldUsageEvent(ctx context.Context, heldID string) (*models.HeldUsageEvent, error)
+	GetHeldUsageEvents(ctx context.Context, tenantID, status string) ([]models.HeldUsageEvent, error)
+
+	// Admin principal operations
+	CreateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error
+	UpdateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error
+	GetAdminPrincipal(ctx context.Context, adminID string) (*models.AdminPrincipal, error)
+	GetAdminPrincipalByKeyHash(ctx context.Context, keyHash string) (*models.AdminPrincipal, error)
+	ListAdminPrincipals(ctx context.Context) ([]models.AdminPrincipal, error)
+	CountAdminPrincipals(ctx context.Context) (int, error)
 
 	// Statistics
 	GetStats(ctx context.Context) (map[string]int, error)
 }
 
 type Handler struct {
-	storage   Storage
-	startTime time.Time
+	storage         Storage
+	paymentProvider payments.PaymentProvider
+	dunning         *dunning.Engine
+	wallet          *wallet.Ledger
+	rating          *rating.Engine
+	retention       *retention.Manager
+	deviceCA        *pki.CA
+	enrollment      EnrollmentPolicy
+	metadataKeys    []string // metadata keys usage can be broken down by
+	timestampPolicy TimestampPolicy
+	timestampStats  *timestampStats
+	ingest          IngestConfig
+	billingLocks    subscriptionLocks
+	startTime       time.Time
 }
 
 func NewHandler(store Storage) *Handler {
 	return &Handler{
-		storage:   store,
-		startTime: time.Now(),
+		storage:      store,
+		rating:       rating.NewEngine(rating.DefaultPriceBook(), DefaultCurrency),
+		metadataKeys:    models.DefaultUsageMetadataKeys(),
+		timestampPolicy: DefaultTimestampPolicy(),
+		timestampStats:  newTimestampStats(),
+		ingest:          DefaultIngestConfig(),
+		enrollment:      DefaultEnrollmentPolicy(),
+		startTime:       time.Now(),
 	}
 }
 
@@ -72,11 +174,33 @@ func NewHandler(store Storage) *Handler {
 func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 	var req models.LicenseValidationRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	ctx := r.Context()
+	resp, err := h.EvaluateLicense(r.Context(), req)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, resp)
+}
+
+// EvaluateLicense validates a camera license, creating a trial subscription
+// for tenants without one. Shared by the HTTP and gRPC APIs.
+func (h *Handler) EvaluateLicense(ctx context.Context, req models.LicenseValidationRequest) (*models.LicenseValidationResponse, error) {
+	tenantID, authErr := middleware.ScopeTenant(ctx, req.TenantID)
+	if authErr != nil {
+		return nil, authErr
+	}
+	req.TenantID = tenantID
+
+	device, err := h.requestDevice(ctx, &req.DeviceID, req.TenantID)
+	if err != nil {
+		return nil, err
+	}
+
 	log.Printf("[LICENSE] Validation request: camera=%s, tenant=%s, device=%s",
 		req.CameraID, req.TenantID, req.DeviceID)
 
@@ -84,8 +208,7 @@ func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 	sub, err := h.storage.GetSubscription(ctx, req.TenantID)
 	if err != nil {
 		log.Printf("[LICENSE] Error getting subscription: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to get subscription")
-		return
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get subscription")
 	}
 
 	// Get enabled growth packs
@@ -145,9 +268,14 @@ func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 			CamerasAllowed:     2,
 		}
 	} else {
-		// Check subscription status
-		isValid := sub.Status == "active"
+		// Check subscription status (past-due tenants keep licenses during the dunning grace window)
+		graceEnd, inGrace := h.pastDueGraceEnd(ctx, sub)
+		isValid := sub.Status == "active" || inGrace
 		licenseMode := sub.Plan
+		var reason apierror.Code
+		if !isValid {
+			reason = apierror.SubscriptionInactive
+		}
 
 		// Check camera count for trial
 		camerasAllowed := sub.CamerasLicensed
@@ -158,6 +286,7 @@ func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 				existingLicense, _ := h.storage.GetCameraLicense(ctx, req.CameraID, req.TenantID)
 				if existingLicense == nil {
 					isValid = false
+					reason = apierror.TrialLimitExceeded
 					log.Printf("[LICENSE] Trial camera limit exceeded for tenant %s", req.TenantID)
 				}
 			}
@@ -170,27 +299,41 @@ func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 			if time.Now().After(validUntil) {
 				isValid = false
 				licenseMode = "expired"
+				reason = apierror.LicenseExpired
 			}
 		} else if sub.SubscriptionEndDate != nil {
 			validUntil = *sub.SubscriptionEndDate
 			if time.Now().After(validUntil) {
 				isValid = false
 				licenseMode = "expired"
+				reason = apierror.LicenseExpired
 			}
 		} else {
 			// No expiry set - default to 1 year
 			validUntil = time.Now().AddDate(1, 0, 0)
 		}
 
+		if inGrace && graceEnd.Before(validUntil) {
+			validUntil = graceEnd
+		}
+
 		resp = &models.LicenseValidationResponse{
 			IsValid:            isValid,
 			LicenseMode:        licenseMode,
 			EnabledGrowthPacks: enabledPackNames,
 			ValidUntil:         validUntil,
 			CamerasAllowed:     camerasAllowed,
+			Reason:             string(reason),
 		}
 	}
 
+	// Devices enrolled with a camera quota may only license that many cameras
+	if resp.IsValid && h.deviceCameraLimitReached(ctx, device, req.CameraID) {
+		log.Printf("[LICENSE] Camera quota of %d exceeded for device %s", *device.MaxCameras, device.DeviceID)
+		resp.IsValid = false
+		resp.Reason = string(apierror.DeviceCameraLimitExceeded)
+	}
+
 	// Save/update camera license
 	if req.CameraID != "" {
 		packsJSON, _ := json.Marshal(resp.EnabledGrowthPacks)
@@ -213,21 +356,51 @@ func (h *Handler) ValidateLicense(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[LICENSE] Response for camera=%s: valid=%v, mode=%s, packs=%v",
 		req.CameraID, resp.IsValid, resp.LicenseMode, resp.EnabledGrowthPacks)
 
-	respondJSON(w, resp)
+	return resp, nil
 }
 
 // CheckEntitlement handles feature entitlement checks
 func (h *Handler) CheckEntitlement(w http.ResponseWriter, r *http.Request) {
 	var req models.EntitlementCheckRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	ctx := r.Context()
+	resp, err := h.EvaluateEntitlement(r.Context(), req)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, resp)
+}
+
+// EvaluateEntitlement checks whether a feature is enabled for a tenant through
+// its base license, growth packs or a stored entitlement. Shared by the HTTP
+// and gRPC APIs.
+func (h *Handler) EvaluateEntitlement(ctx context.Context, req models.EntitlementCheckRequest) (models.EntitlementCheckResponse, error) {
+	tenantID, authErr := middleware.ScopeTenant(ctx, req.TenantID)
+	if authErr != nil {
+		return models.EntitlementCheckResponse{}, authErr
+	}
+	req.TenantID = tenantID
+
 	log.Printf("[ENTITLEMENT] Check: tenant=%s, category=%s, feature=%s",
 		req.TenantID, req.FeatureCategory, req.FeatureName)
 
+	// Wallet-gated categories are off while a deny-mode wallet is empty
+	if !h.walletAllowsCategory(ctx, req.TenantID, req.FeatureCategory) {
+		resp := models.EntitlementCheckResponse{
+			IsEnabled:      false,
+			QuotaRemaining: 0,
+			ValidUntil:     time.Now(),
+		}
+		log.Printf("[ENTITLEMENT] Feature %s/%s disabled for tenant %s: prepaid balance exhausted",
+			req.FeatureCategory, req.FeatureName, req.TenantID)
+		return resp, nil
+	}
+
 	// Check base features first
 	baseFeatures := models.BaseFeatures()
 	if features, ok := baseFeatures[req.FeatureCategory]; ok {
@@ -241,8 +414,7 @@ func (h *Handler) CheckEntitlement(w http.ResponseWriter, r *http.Request) {
 				}
 				log.Printf("[ENTITLEMENT] Feature %s/%s is base feature, enabled",
 					req.FeatureCategory, req.FeatureName)
-				respondJSON(w, resp)
-				return
+				return resp, nil
 			}
 		}
 	}
@@ -262,8 +434,7 @@ func (h *Handler) CheckEntitlement(w http.ResponseWriter, r *http.Request) {
 					}
 					log.Printf("[ENTITLEMENT] Feature %s/%s enabled via pack %s",
 						req.FeatureCategory, req.FeatureName, pack.PackName)
-					respondJSON(w, resp)
-					return
+					return resp, nil
 				}
 			}
 		}
@@ -290,8 +461,7 @@ func (h *Handler) CheckEntitlement(w http.ResponseWriter, r *http.Request) {
 			QuotaRemaining: quotaRemaining,
 			ValidUntil:     validUntil,
 		}
-		respondJSON(w, resp)
-		return
+		return resp, nil
 	}
 
 	// Feature not enabled
@@ -302,61 +472,48 @@ func (h *Handler) CheckEntitlement(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("[ENTITLEMENT] Feature %s/%s not enabled for tenant %s",
 		req.FeatureCategory, req.FeatureName, req.TenantID)
-	respondJSON(w, resp)
+	return resp, nil
 }
 
 // ReportUsageBatch handles batch usage reporting
 func (h *Handler) ReportUsageBatch(w http.ResponseWriter, r *http.Request) {
+	if isNDJSON(r) {
+		h.streamUsageBatch(w, r)
+		return
+	}
+	h.extendReadDeadline(w)
+
+	// The cap applies to the decoded body, after any decompression
+	body := r.Body
+	if h.ingest.MaxBatchBytes > 0 {
+		body = http.MaxBytesReader(w, r.Body, h.ingest.MaxBatchBytes)
+	}
+
 	var req models.UsageBatchRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	var err error
+	req.Events, err = decodeUsageBatch(body, h.ingest.MaxBatchEvents)
+	if err == errBatchTooLarge {
+		respondError(w, r, apierror.Newf(apierror.PayloadTooLarge,
+			"batch exceeds maximum of %d events; split it or stream it as NDJSON", h.ingest.MaxBatchEvents).
+			WithDetail("max_events", h.ingest.MaxBatchEvents))
+		return
+	}
+	if err != nil {
 		log.Printf("[USAGE] Error decoding request: %v", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
 	ctx := r.Context()
 	log.Printf("[USAGE] Batch received: %d events", len(req.Events))
 
-	// Convert to storage format and save
-	var usageEvents []models.UsageEvent
 	for _, event := range req.Events {
-		// Handle event_time - FlexibleTime handles Unix timestamp strings
-		eventTime := event.EventTime.Time
-		if eventTime.IsZero() {
-			eventTime = time.Now()
-		}
-
-		metadataJSON, _ := json.Marshal(event.Metadata)
-		usageEvents = append(usageEvents, models.UsageEvent{
-			TenantID:   event.TenantID,
-			EventType:  event.EventType,
-			ResourceID: event.ResourceID,
-			Quantity:   event.Quantity,
-			Unit:       event.Unit,
-			Metadata:   metadataJSON,
-			EventTime:  eventTime,
-		})
-
 		log.Printf("[USAGE]   - %s: %s = %.2f %s (tenant=%s, time=%v)",
-			event.EventType, event.ResourceID, event.Quantity, event.Unit, event.TenantID, eventTime)
-	}
-
-	err := h.storage.SaveUsageEvents(ctx, usageEvents)
-	if err != nil {
-		log.Printf("[USAGE] Error saving events: %v", err)
-		respondJSON(w, models.UsageBatchResponse{
-			AcceptedCount: 0,
-			RejectedCount: len(req.Events),
-			Errors:        []string{err.Error()},
-		})
-		return
+			event.EventType, event.ResourceID, event.Quantity, event.Unit, event.TenantID, event.EventTime.Time)
 	}
 
-	resp := models.UsageBatchResponse{
-		AcceptedCount: len(req.Events),
-		RejectedCount: 0,
-		Errors:        []string{},
-	}
+	resp := models.UsageBatchResponse{Errors: []string{}}
+	h.ingestUsageChunk(ctx, req.Events, 0, &resp)
 
 	respondJSON(w, resp)
 }
@@ -365,35 +522,63 @@ func (h *Handler) ReportUsageBatch(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) Heartbeat(w http.ResponseWriter, r *http.Request) {
 	var req models.HeartbeatRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
-	ctx := r.Context()
+	resp, err := h.RecordHeartbeat(r.Context(), req)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, resp)
+}
+
+// RecordHeartbeat saves an edge device's latest heartbeat. Shared by the HTTP
+// and gRPC APIs.
+func (h *Handler) RecordHeartbeat(ctx context.Context, req models.HeartbeatRequest) (models.HeartbeatResponse, error) {
+	tenantID, authErr := middleware.ScopeTenant(ctx, req.TenantID)
+	if authErr != nil {
+		return models.HeartbeatResponse{}, authErr
+	}
+	req.TenantID = tenantID
+
+	if _, err := h.requestDevice(ctx, &req.DeviceID, req.TenantID); err != nil {
+		return models.HeartbeatResponse{}, err
+	}
+	if req.DeviceID == "" {
+		return models.HeartbeatResponse{}, apierror.New(apierror.InvalidRequest, "device_id is required")
+	}
+
 	log.Printf("[HEARTBEAT] Device: %s, tenant=%s, cameras=%d, tier=%s",
 		req.DeviceID, req.TenantID, len(req.ActiveCameraIDs), req.ManagementTier)
 
-	// Save/update edge device
+	// Only the heartbeat columns are written, so a heartbeat racing an
+	// enrollment can't restore the old credentials; unknown devices register
+	// themselves unless enrollment is required
 	now := time.Now()
-	device := &models.EdgeDevice{
+	heartbeat := &models.EdgeDevice{
 		ID:                uuid.New().String(),
 		DeviceID:          req.DeviceID,
 		TenantID:          req.TenantID,
-		Status:            "active",
+		Status:            models.DeviceStatusActive,
 		ManagementTier:    req.ManagementTier,
 		LastHeartbeat:     &now,
 		ActiveCameraCount: len(req.ActiveCameraIDs),
 		CreatedAt:         now,
 		UpdatedAt:         now,
 	}
-	h.storage.SaveEdgeDevice(ctx, device)
+	if err := h.storage.RecordDeviceHeartbeat(ctx, heartbeat); err != nil {
+		log.Printf("[HEARTBEAT] Failed to record heartbeat for %s: %v", req.DeviceID, err)
+	}
 
 	resp := models.HeartbeatResponse{
 		Status:               "ok",
 		NextHeartbeatSeconds: 900, // 15 minutes
 	}
 
-	respondJSON(w, resp)
+	return resp, nil
 }
 
 // GetLicenseStatus returns the license status for a tenant
@@ -401,14 +586,24 @@ func (h *Handler) GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tenantID := vars["tenantId"]
 
-	ctx := r.Context()
 	log.Printf("[LICENSE_STATUS] Request for tenant: %s", tenantID)
 
+	status, err := h.licenseStatus(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, legacyLicenseStatus(status))
+}
+
+// licenseStatus builds a tenant's license status, creating a trial
+// subscription for tenants without one
+func (h *Handler) licenseStatus(ctx context.Context, tenantID string) (*models.LicenseStatus, error) {
 	// Get subscription
 	sub, err := h.storage.GetSubscription(ctx, tenantID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get subscription")
-		return
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get subscription")
 	}
 
 	// Get cameras
@@ -416,7 +611,7 @@ func (h *Handler) GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
 
 	// Get growth packs
 	packs, _ := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
-	var enabledPackNames []string
+	enabledPackNames := []string{}
 	for _, pack := range packs {
 		enabledPackNames = append(enabledPackNames, pack.PackName)
 	}
@@ -457,17 +652,16 @@ func (h *Handler) GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
 		
 		if err := h.storage.CreateSubscription(ctx, newSub); err != nil {
 			log.Printf("[LICENSE_STATUS] Failed to create trial subscription: %v", err)
-			// Return unlicensed status if we can't create subscription
-			resp := map[string]interface{}{
-				"license_mode":         "unlicensed",
-				"is_valid":             false,
-				"active_cameras":       0,
-				"cameras_allowed":      0,
-				"enabled_growth_packs": []string{},
-				"cameras":              []interface{}{},
-			}
-			respondJSON(w, resp)
-			return
+			// Report unlicensed status if we can't create subscription
+			return &models.LicenseStatus{
+				TenantID:           tenantID,
+				LicenseMode:        "unlicensed",
+				TrialMaxCameras:    models.TrialMaxCameras,
+				EnabledGrowthPacks: []string{},
+				Cameras:            []models.CameraLicenseStatus{},
+				Pricing:            models.Pricing(calculatePricing(0, nil, "")),
+				LicenseKey:         maskLicenseKey(tenantID),
+			}, nil
 		}
 		
 		// Use the newly created subscription
@@ -477,36 +671,96 @@ func (h *Handler) GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
 
 	// Build response
 	var daysRemaining *int
-	var validUntil string
-	var trialStartedAt string
+	var validUntil time.Time
+	var trialStartedAt *time.Time
 	licenseMode := sub.Plan
 
 	if sub.Plan == "trial" && sub.TrialEndDate != nil {
 		days := int(time.Until(*sub.TrialEndDate).Hours() / 24)
 		daysRemaining = &days
-		validUntil = sub.TrialEndDate.Format(time.RFC3339)
-		if sub.TrialStartDate != nil {
-			trialStartedAt = sub.TrialStartDate.Format(time.RFC3339)
-		}
+		validUntil = *sub.TrialEndDate
+		trialStartedAt = sub.TrialStartDate
 		if days < 0 {
 			licenseMode = "expired"
 		}
 	} else if sub.SubscriptionEndDate != nil {
-		validUntil = sub.SubscriptionEndDate.Format(time.RFC3339)
+		validUntil = *sub.SubscriptionEndDate
 	} else {
-		validUntil = time.Now().AddDate(1, 0, 0).Format(time.RFC3339)
+		validUntil = time.Now().AddDate(1, 0, 0)
 	}
 
 	// Convert cameras to response format
-	var cameraList []map[string]interface{}
+	cameraList := []models.CameraLicenseStatus{}
 	for _, cam := range cameras {
 		var packs []string
 		json.Unmarshal(cam.EnabledGrowthPacks, &packs)
+		if packs == nil {
+			packs = []string{}
+		}
+
+		cameraList = append(cameraList, models.CameraLicenseStatus{
+			CameraID:           cam.CameraID,
+			TenantID:           cam.TenantID,
+			Mode:               cam.LicenseMode,
+			IsValid:            cam.IsValid,
+			EnabledGrowthPacks: packs,
+			ValidUntil:         cam.ValidUntil,
+			CreatedAt:          cam.CreatedAt,
+		})
+	}
+
+	// Calculate pricing
+	pricing := calculatePricing(len(cameras), packs, sub.BillingCycle)
+
+	_, inGrace := h.pastDueGraceEnd(ctx, sub)
+
+	return &models.LicenseStatus{
+		TenantID:           tenantID,
+		LicenseMode:        licenseMode,
+		IsValid:            (sub.Status == "active" || inGrace) && (daysRemaining == nil || *daysRemaining >= 0),
+		ActiveCameras:      len(cameras),
+		CamerasAllowed:     sub.CamerasLicensed,
+		TrialMaxCameras:    models.TrialMaxCameras, // Always return trial limit for UI
+		DaysRemaining:      daysRemaining,
+		TrialStartedAt:     trialStartedAt,
+		ValidUntil:         &validUntil,
+		EnabledGrowthPacks: enabledPackNames,
+		Cameras:            cameraList,
+		Pricing:            models.Pricing(pricing),
+		LicenseKey:         maskLicenseKey(tenantID), // show only last 4 characters
+		CanRevoke:          licenseMode == "base",    // Can only revoke base licenses
+	}, nil
+}
+
+// legacyLicenseStatus renders a license status in the v1 shape, where empty
+// lists are null and trial-only fields are left out
+func legacyLicenseStatus(status *models.LicenseStatus) map[string]interface{} {
+	if status.LicenseMode == "unlicensed" {
+		return map[string]interface{}{
+			"license_mode":         "unlicensed",
+			"is_valid":             false,
+			"active_cameras":       0,
+			"cameras_allowed":      0,
+			"enabled_growth_packs": []string{},
+			"cameras":              []interface{}{},
+		}
+	}
 
+	var enabledPackNames []string
+	if len(status.EnabledGrowthPacks) > 0 {
+		enabledPackNames = status.EnabledGrowthPacks
+	}
+
+	var cameraList []map[string]interface{}
+	for _, cam := range status.Cameras {
+		var packs []string
+		if len(cam.EnabledGrowthPacks) > 0 {
+			packs = cam.EnabledGrowthPacks
+		}
 		camResp := map[string]interface{}{
 			"camera_id":            cam.CameraID,
 			"tenant_id":            cam.TenantID,
-			"mode":                 cam.LicenseMode,
+			"mode":                 cam.Mode,
 			"is_valid":             cam.IsValid,
 			"enabled_growth_packs": packs,
 			"created_at":           cam.CreatedAt.Format(time.RFC3339),
@@ -517,32 +771,26 @@ func (h *Handler) GetLicenseStatus(w http.ResponseWriter, r *http.Request) {
 		cameraList = append(cameraList, camResp)
 	}
 
-	// Calculate pricing
-	pricing := calculatePricing(len(cameras), packs)
-
-	// Mask the license key (show only last 4 characters)
-	maskedKey := maskLicenseKey(tenantID)
-
 	resp := map[string]interface{}{
-		"license_mode":         licenseMode,
-		"is_valid":             sub.Status == "active" && (daysRemaining == nil || *daysRemaining >= 0),
-		"active_cameras":       len(cameras),
-		"cameras_allowed":      sub.CamerasLicensed,
-		"days_remaining":       daysRemaining,
-		"valid_until":          validUntil,
+		"license_mode":         status.LicenseMode,
+		"is_valid":             status.IsValid,
+		"active_cameras":       status.ActiveCameras,
+		"cameras_allowed":      status.CamerasAllowed,
+		"days_remaining":       status.DaysRemaining,
+		"valid_until":          status.ValidUntil.Format(time.RFC3339),
 		"enabled_growth_packs": enabledPackNames,
 		"cameras":              cameraList,
-		"pricing":              pricing,
-		"license_key":          maskedKey,
-		"can_revoke":           licenseMode == "base", // Can only revoke base licenses
-		"trial_max_cameras":    models.TrialMaxCameras, // Always return trial limit for UI
+		"pricing":              PricingBreakdown(status.Pricing),
+		"license_key":          status.LicenseKey,
+		"can_revoke":           status.CanRevoke,
+		"trial_max_cameras":    status.TrialMaxCameras,
 	}
 
-	if trialStartedAt != "" {
-		resp["trial_started_at"] = trialStartedAt
+	if status.TrialStartedAt != nil {
+		resp["trial_started_at"] = status.TrialStartedAt.Format(time.RFC3339)
 	}
 
-	respondJSON(w, resp)
+	return resp
 }
 
 // maskLicenseKey masks all but the last 4 characters of a license key
@@ -568,39 +816,55 @@ type PricingBreakdown struct {
 	GrowthPacks    map[string]float64 `json:"growth_packs"`
 	GrowthPackCost float64            `json:"growth_pack_cost"`
 	TotalMonthly   float64            `json:"total_monthly"`
+	BillingCycle   string             `json:"billing_cycle"`
+	TotalPerCycle  float64            `json:"total_per_cycle"`
+	AnnualDiscount float64            `json:"annual_discount,omitempty"` // saving vs 12x monthly
 	Currency       string             `json:"currency"`
 }
 
-// getGrowthPackPrice looks up the price for a growth pack from the model
-func getGrowthPackPrice(packName string) float64 {
+// getGrowthPackPrices looks up the list prices for a growth pack from the
+// model. The annual price is 0 when the pack has no explicit annual price.
+func getGrowthPackPrices(packName string) (monthly, annual float64) {
 	for _, pack := range models.AvailableGrowthPacks() {
 		if pack.PackName == packName {
-			return pack.PriceMonthly
+			return pack.PriceMonthly, pack.PriceAnnual
 		}
 	}
-	return 0
+	return 0, 0
 }
 
-func calculatePricing(cameraCount int, packs []models.GrowthPackAssignment) PricingBreakdown {
+func calculatePricing(cameraCount int, packs []models.GrowthPackAssignment, billingCycle string) PricingBreakdown {
 	baseCost := float64(cameraCount) * BasePerCameraRate
 
 	growthPackCosts := make(map[string]float64)
 	var growthPackTotal float64
+	var growthPackAnnualTotal float64
 
 	for _, pack := range packs {
-		// First check if pack has custom price, otherwise use model price
-		if pack.PriceMonthly != nil && *pack.PriceMonthly > 0 {
-			growthPackCosts[pack.PackName] = *pack.PriceMonthly
-			growthPackTotal += *pack.PriceMonthly
-		} else {
-			price := getGrowthPackPrice(pack.PackName)
-			growthPackCosts[pack.PackName] = price
-			growthPackTotal += price
+		price, annual := getGrowthPackPrices(pack.PackName)
+		// A custom monthly price replaces both list prices. Older assignments
+		// carry a copy of the list price, which keeps the list annual price.
+		if pack.PriceMonthly != nil && *pack.PriceMonthly > 0 && *pack.PriceMonthly != price {
+			price, annual = *pack.PriceMonthly, 0
 		}
+		growthPackCosts[pack.PackName] = price
+		growthPackTotal += price
+		growthPackAnnualTotal += annualPrice(price, annual)
 	}
 
 	totalMonthly := baseCost + growthPackTotal
 
+	if billingCycle == "" {
+		billingCycle = models.BillingCycleMonthly
+	}
+
+	totalPerCycle := totalMonthly
+	var annualDiscount float64
+	if billingCycle == models.BillingCycleAnnual {
+		totalPerCycle = roundCurrency(annualPrice(baseCost, 0) + growthPackAnnualTotal)
+		annualDiscount = roundCurrency(totalMonthly*12 - totalPerCycle)
+	}
+
 	return PricingBreakdown{
 		BaseCost:       baseCost,
 		CameraCount:    cameraCount,
@@ -608,6 +872,9 @@ func calculatePricing(cameraCount int, packs []models.GrowthPackAssignment) Pric
 		GrowthPacks:    growthPackCosts,
 		GrowthPackCost: growthPackTotal,
 		TotalMonthly:   totalMonthly,
+		BillingCycle:   billingCycle,
+		TotalPerCycle:  totalPerCycle,
+		AnnualDiscount: annualDiscount,
 		Currency:       DefaultCurrency,
 	}
 }
@@ -617,61 +884,98 @@ func (h *Handler) GetSubscription(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tenantID := vars["tenantId"]
 
-	ctx := r.Context()
 	log.Printf("[SUBSCRIPTION] Request for tenant: %s", tenantID)
 
-	sub, err := h.storage.GetSubscription(ctx, tenantID)
+	summary, err := h.subscriptionSummary(r.Context(), tenantID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get subscription")
+		respondError(w, r, err)
 		return
 	}
 
+	respondJSON(w, legacySubscriptionSummary(summary))
+}
+
+// subscriptionSummary prices a tenant's subscription on its billing cycle
+func (h *Handler) subscriptionSummary(ctx context.Context, tenantID string) (*models.SubscriptionSummary, error) {
+	sub, err := h.storage.GetSubscription(ctx, tenantID)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get subscription")
+	}
+
 	if sub == nil {
-		respondError(w, http.StatusNotFound, "Subscription not found")
-		return
+		return nil, apierror.New(apierror.SubscriptionNotFound, "Subscription not found")
 	}
 
 	// Get growth packs
 	packs, _ := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
-	var growthPackDetails []map[string]interface{}
-	var totalMonthly float64
-
+	growthPacks := []models.SubscriptionGrowthPack{}
 	for _, pack := range packs {
+		growthPacks = append(growthPacks, models.SubscriptionGrowthPack{
+			PackName:     pack.PackName,
+			EnabledAt:    pack.EnabledAt,
+			PriceMonthly: pack.PriceMonthly,
+		})
+	}
+
+	// Price the licensed cameras on the subscription's billing cycle
+	pricing := calculatePricing(sub.CamerasLicensed, packs, sub.BillingCycle)
+
+	var nextBilling *time.Time
+	if sub.Plan != "trial" {
+		next := nextBillingDate(sub, time.Now())
+		nextBilling = &next
+	}
+
+	return &models.SubscriptionSummary{
+		SubscriptionID:   sub.ID,
+		TenantID:         sub.TenantID,
+		Plan:             sub.Plan,
+		Status:           sub.Status,
+		CamerasLicensed:  sub.CamerasLicensed,
+		GrowthPacks:      growthPacks,
+		BillingCycle:     pricing.BillingCycle,
+		NextBillingDate:  nextBilling,
+		TotalMonthlyCost: pricing.TotalMonthly,
+		CycleCost:        pricing.TotalPerCycle,
+		AnnualDiscount:   pricing.AnnualDiscount,
+		CreditBalance:    sub.CreditBalance,
+		Currency:         pricing.Currency,
+	}, nil
+}
+
+// legacySubscriptionSummary renders a subscription summary in the v1 shape
+func legacySubscriptionSummary(summary *models.SubscriptionSummary) map[string]interface{} {
+	var growthPackDetails []map[string]interface{}
+	for _, pack := range summary.GrowthPacks {
 		packInfo := map[string]interface{}{
 			"pack_name":  pack.PackName,
 			"enabled_at": pack.EnabledAt.Format(time.RFC3339),
 		}
 		if pack.PriceMonthly != nil {
 			packInfo["price_monthly"] = *pack.PriceMonthly
-			totalMonthly += *pack.PriceMonthly
 		}
 		growthPackDetails = append(growthPackDetails, packInfo)
 	}
 
-	// Calculate base cost
-	cameraCost := float64(sub.CamerasLicensed) * 60.0 // $60/camera/month
-	totalMonthly += cameraCost
-
-	var nextBillingDate string
-	if sub.SubscriptionEndDate != nil {
-		nextBillingDate = sub.SubscriptionEndDate.Format(time.RFC3339)
-	} else if sub.Plan != "trial" {
-		nextBillingDate = time.Now().AddDate(0, 1, 0).Format(time.RFC3339)
+	var nextBilling string
+	if summary.NextBillingDate != nil {
+		nextBilling = summary.NextBillingDate.Format(time.RFC3339)
 	}
 
-	resp := map[string]interface{}{
-		"subscription_id":    sub.ID,
-		"tenant_id":          sub.TenantID,
-		"plan":               sub.Plan,
-		"status":             sub.Status,
-		"cameras_licensed":   sub.CamerasLicensed,
+	return map[string]interface{}{
+		"subscription_id":    summary.SubscriptionID,
+		"tenant_id":          summary.TenantID,
+		"plan":               summary.Plan,
+		"status":             summary.Status,
+		"cameras_licensed":   summary.CamerasLicensed,
 		"growth_packs":       growthPackDetails,
-		"billing_cycle":      sub.BillingCycle,
-		"next_billing_date":  nextBillingDate,
-		"total_monthly_cost": totalMonthly,
+		"billing_cycle":      summary.BillingCycle,
+		"next_billing_date":  nextBilling,
+		"total_monthly_cost": summary.TotalMonthlyCost,
+		"cycle_cost":         summary.CycleCost,
+		"annual_discount":    summary.AnnualDiscount,
+		"credit_balance":     summary.CreditBalance,
 	}
-
-	respondJSON(w, resp)
 }
 
 // GetEnabledGrowthPacks returns enabled growth packs for a tenant
@@ -684,7 +988,7 @@ func (h *Handler) GetEnabledGrowthPacks(w http.ResponseWriter, r *http.Request)
 
 	packs, err := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get growth packs")
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get growth packs"))
 		return
 	}
 
@@ -739,6 +1043,7 @@ func (h *Handler) GetPricingConfig(w http.ResponseWriter, r *http.Request) {
 			"pack_name":     pack.PackName,
 			"category":      pack.Category,
 			"price_monthly": pack.PriceMonthly,
+			"price_annual":  annualPrice(pack.PriceMonthly, pack.PriceAnnual),
 			"description":   pack.Description,
 		})
 	}
@@ -746,10 +1051,14 @@ func (h *Handler) GetPricingConfig(w http.ResponseWriter, r *http.Request) {
 	resp := map[string]interface{}{
 		"base_license": map[string]interface{}{
 			"per_camera_monthly": BasePerCameraRate,
+			"per_camera_annual":  annualPrice(BasePerCameraRate, 0),
 			"description":        "Base license per camera per month",
 		},
-		"growth_packs": growthPackPricing,
-		"currency":     DefaultCurrency,
+		"growth_packs":            growthPackPricing,
+		"usage_prices":            h.rating.PriceBook(),
+		"billing_cycles":          []string{models.BillingCycleMonthly, models.BillingCycleAnnual},
+		"annual_discount_percent": models.AnnualDiscountPercent,
+		"currency":                DefaultCurrency,
 	}
 
 	respondJSON(w, resp)
@@ -761,20 +1070,29 @@ func (h *Handler) RevokeLicense(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tenantID := vars["tenantId"]
 
-	ctx := r.Context()
+	revocation, err := h.revokeLicense(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, legacyLicenseRevocation(revocation))
+}
+
+// revokeLicense reverts a tenant's paid license to its trial, crediting the
+// unused part of the paid period
+func (h *Handler) revokeLicense(ctx context.Context, tenantID string) (*models.LicenseRevocation, error) {
 	log.Printf("[REVOKE] License revocation request for tenant: %s", tenantID)
 
 	// Get current subscription
 	sub, err := h.storage.GetSubscription(ctx, tenantID)
 	if err != nil || sub == nil {
-		respondError(w, http.StatusNotFound, "Subscription not found")
-		return
+		return nil, apierror.New(apierror.SubscriptionNotFound, "Subscription not found")
 	}
 
 	// Can only revoke a base license (not trial)
 	if sub.Plan == "trial" {
-		respondError(w, http.StatusBadRequest, "Cannot revoke a trial license")
-		return
+		return nil, apierror.New(apierror.TrialNotRevocable, "Cannot revoke a trial license")
 	}
 
 	// Get current camera count BEFORE revoking
@@ -788,6 +1106,10 @@ func (h *Handler) RevokeLicense(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[REVOKE] Current cameras: %d, Trial limit: %d, Cameras to stop: %d",
 		currentCameraCount, models.TrialMaxCameras, camerasToStop)
 
+	// Credit the unused part of the paid period before the plan changes
+	enabledPacks, _ := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
+	creditNote := h.downgradeCreditNote(ctx, sub, enabledPacks)
+
 	// Revert to trial mode - preserve original trial dates
 	sub.Plan = "trial"
 	sub.Status = "active"
@@ -814,16 +1136,23 @@ func (h *Handler) RevokeLicense(w http.ResponseWriter, r *http.Request) {
 	// Update subscription
 	if err := h.storage.UpdateSubscription(ctx, sub); err != nil {
 		log.Printf("[REVOKE] Failed to update subscription: %v", err)
-		respondError(w, http.StatusInternalServerError, "Failed to revoke license")
-		return
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to revoke license")
 	}
 
 	// Clear all growth pack assignments for this tenant
-	packs, _ := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
-	for _, pack := range packs {
+	for _, pack := range enabledPacks {
 		h.storage.DisableGrowthPack(ctx, tenantID, pack.PackName)
 	}
 
+	if creditNote != nil {
+		if err := h.issueCreditNote(ctx, creditNote); err != nil {
+			log.Printf("[REVOKE] Failed to issue credit note for tenant %s: %v", tenantID, err)
+			creditNote = nil
+		} else {
+			log.Printf("[REVOKE] Issued credit note %s for %.2f %s", creditNote.Number, creditNote.Total, creditNote.Currency)
+		}
+	}
+
 	// Calculate remaining trial days
 	var daysRemaining *int
 	if sub.TrialEndDate != nil {
@@ -837,21 +1166,44 @@ func (h *Handler) RevokeLicense(w http.ResponseWriter, r *http.Request) {
 	log.Printf("[REVOKE] License revoked for tenant %s, reverted to trial (%v days remaining), %d cameras need to be stopped",
 		tenantID, daysRemaining, camerasToStop)
 
+	return &models.LicenseRevocation{
+		Success:          true,
+		Message:          "License revoked. Reverted to trial mode.",
+		Plan:             sub.Plan,
+		Status:           sub.Status,
+		DaysRemaining:    daysRemaining,
+		TrialExpired:     sub.Status == "expired",
+		CamerasAllowed:   models.TrialMaxCameras,
+		CurrentCameras:   currentCameraCount,
+		CamerasOverLimit: camerasToStop,
+		ActionRequired:   camerasToStop > 0,
+		ActionMessage:    getActionMessage(camerasToStop),
+		CreditNote:       creditNote,
+	}, nil
+}
+
+// legacyLicenseRevocation renders a revocation in the v1 shape, which leaves
+// out credit_note when nothing was credited
+func legacyLicenseRevocation(revocation *models.LicenseRevocation) map[string]interface{} {
 	resp := map[string]interface{}{
-		"success":             true,
-		"message":             "License revoked. Reverted to trial mode.",
-		"plan":                sub.Plan,
-		"status":              sub.Status,
-		"days_remaining":      daysRemaining,
-		"trial_expired":       sub.Status == "expired",
-		"cameras_allowed":     models.TrialMaxCameras,
-		"current_cameras":     currentCameraCount,
-		"cameras_over_limit":  camerasToStop,
-		"action_required":     camerasToStop > 0,
-		"action_message":      getActionMessage(camerasToStop),
+		"success":             revocation.Success,
+		"message":             revocation.Message,
+		"plan":                revocation.Plan,
+		"status":              revocation.Status,
+		"days_remaining":      revocation.DaysRemaining,
+		"trial_expired":       revocation.TrialExpired,
+		"cameras_allowed":     revocation.CamerasAllowed,
+		"current_cameras":     revocation.CurrentCameras,
+		"cameras_over_limit":  revocation.CamerasOverLimit,
+		"action_required":     revocation.ActionRequired,
+		"action_message":      revocation.ActionMessage,
 	}
 
-	respondJSON(w, resp)
+	if revocation.CreditNote != nil {
+		resp["credit_note"] = revocation.CreditNote
+	}
+
+	return resp
 }
 
 // getActionMessage returns the appropriate message based on cameras over limit
@@ -870,7 +1222,6 @@ func (h *Handler) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	tenantID := vars["tenantId"]
 
-	ctx := r.Context()
 	log.Printf("[USAGE_SUMMARY] Request for tenant: %s", tenantID)
 
 	// Parse query parameters for date range
@@ -899,36 +1250,84 @@ func (h *Handler) GetUsageSummary(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	summary, err := h.storage.GetUsageSummary(ctx, tenantID, start, end)
+	summary, err := h.usageSummary(r.Context(), tenantID, start, end)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get usage summary")
+		respondError(w, r, err)
 		return
 	}
 
+	respondJSON(w, legacyUsageSummary(summary))
+}
+
+// Event types with their own usage summary counters
+const (
+	summaryEventAPICall        = "api_call"
+	summaryEventLLMTokens      = "llm_tokens"
+	summaryEventStorageGBDays  = "storage_gb_days"
+	summaryEventSMSSent        = "sms_sent"
+	summaryEventAgentExecution = "agent_execution"
+)
+
+// usageSummary totals and prices a tenant's usage over [start, end)
+func (h *Handler) usageSummary(ctx context.Context, tenantID string, start, end time.Time) (*models.UsageSummary, error) {
+	usage, err := h.storage.GetUsageSummary(ctx, tenantID, start, end)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get usage summary")
+	}
+	if usage == nil {
+		usage = make(map[string]float64)
+	}
+
+	// Priced usage for the same period
+	rated := h.rating.Rate(tenantID, start, end, usage)
+
+	return &models.UsageSummary{
+		TenantID:          tenantID,
+		PeriodStart:       start,
+		PeriodEnd:         end,
+		APICalls:          int(usage[summaryEventAPICall]),
+		LLMTokensUsed:     int(usage[summaryEventLLMTokens]),
+		StorageGBDays:     usage[summaryEventStorageGBDays],
+		SMSSent:           int(usage[summaryEventSMSSent]),
+		AgentExecutions:   int(usage[summaryEventAgentExecution]),
+		Usage:             usage,
+		RatedCharges:      rated.Charges,
+		UsageChargesTotal: rated.Total,
+		Currency:          rated.Currency,
+	}, nil
+}
+
+// legacyUsageSummary renders a usage summary in the v1 shape, which only has
+// counters for event types with usage in the period
+func legacyUsageSummary(summary *models.UsageSummary) map[string]interface{} {
 	resp := map[string]interface{}{
-		"tenant_id":    tenantID,
-		"period_start": start.Format(time.RFC3339),
-		"period_end":   end.Format(time.RFC3339),
+		"tenant_id":    summary.TenantID,
+		"period_start": summary.PeriodStart.Format(time.RFC3339),
+		"period_end":   summary.PeriodEnd.Format(time.RFC3339),
 	}
 
 	// Map event types to response fields
-	if v, ok := summary["api_call"]; ok {
-		resp["api_calls"] = int(v)
+	if _, ok := summary.Usage[summaryEventAPICall]; ok {
+		resp["api_calls"] = summary.APICalls
 	}
-	if v, ok := summary["llm_tokens"]; ok {
-		resp["llm_tokens_used"] = int(v)
+	if _, ok := summary.Usage[summaryEventLLMTokens]; ok {
+		resp["llm_tokens_used"] = summary.LLMTokensUsed
 	}
-	if v, ok := summary["storage_gb_days"]; ok {
-		resp["storage_gb_days"] = v
+	if _, ok := summary.Usage[summaryEventStorageGBDays]; ok {
+		resp["storage_gb_days"] = summary.StorageGBDays
 	}
-	if v, ok := summary["sms_sent"]; ok {
-		resp["sms_sent"] = int(v)
+	if _, ok := summary.Usage[summaryEventSMSSent]; ok {
+		resp["sms_sent"] = summary.SMSSent
 	}
-	if v, ok := summary["agent_execution"]; ok {
-		resp["agent_executions"] = int(v)
+	if _, ok := summary.Usage[summaryEventAgentExecution]; ok {
+		resp["agent_executions"] = summary.AgentExecutions
 	}
 
-	respondJSON(w, resp)
+	resp["rated_charges"] = summary.RatedCharges
+	resp["usage_charges_total"] = summary.UsageChargesTotal
+	resp["currency"] = summary.Currency
+
+	return resp
 }
 
 // ValidateCameraLicense validates a specific camera license
@@ -938,11 +1337,17 @@ func (h *Handler) ValidateCameraLicense(w http.ResponseWriter, r *http.Request)
 		TenantID string `json:"tenant_id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
 	ctx := r.Context()
+	tenantID, authErr := middleware.ScopeTenant(ctx, req.TenantID)
+	if authErr != nil {
+		respondError(w, r, authErr)
+		return
+	}
+	req.TenantID = tenantID
 	log.Printf("[CAMERA_VALIDATE] camera=%s, tenant=%s", req.CameraID, req.TenantID)
 
 	// Use the ValidateLicense logic
@@ -962,6 +1367,7 @@ func (h *Handler) ValidateCameraLicense(w http.ResponseWriter, r *http.Request)
 	isValid := true
 	licenseMode := "base"
 	validUntil := time.Now().AddDate(1, 0, 0)
+	var reason apierror.Code
 
 	if sub != nil {
 		licenseMode = sub.Plan
@@ -970,11 +1376,13 @@ func (h *Handler) ValidateCameraLicense(w http.ResponseWriter, r *http.Request)
 			if time.Now().After(validUntil) {
 				isValid = false
 				licenseMode = "expired"
+				reason = apierror.LicenseExpired
 			}
 		}
 	} else {
 		licenseMode = "unlicensed"
 		isValid = false
+		reason = apierror.Unlicensed
 	}
 
 	// Save camera license
@@ -1001,6 +1409,9 @@ func (h *Handler) ValidateCameraLicense(w http.ResponseWriter, r *http.Request)
 		"valid_until":          validUntil.Format(time.RFC3339),
 		"enabled_growth_packs": enabledPackNames,
 	}
+	if reason != "" {
+		resp["reason"] = reason
+	}
 
 	respondJSON(w, resp)
 }
@@ -1012,12 +1423,22 @@ func (h *Handler) ValidateCameraLicense(w http.ResponseWriter, r *http.Request)
 // CreateTenant creates a new tenant
 func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Name   string  `json:"name"`
-		Email  *string `json:"email,omitempty"`
-		APIKey *string `json:"api_key,omitempty"`
+		Name     string  `json:"name"`
+		Email    *string `json:"email,omitempty"`
+		APIKey      *string `json:"api_key,omitempty"`
+		Timezone    string  `json:"timezone,omitempty"`
+		CrossTenant bool    `json:"cross_tenant,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(req.Timezone); err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Invalid timezone: "+req.Timezone))
 		return
 	}
 
@@ -1032,21 +1453,23 @@ func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now()
 	tenant := &models.Tenant{
-		ID:        uuid.New().String(),
-		Name:      req.Name,
-		Email:     req.Email,
-		APIKey:    apiKey,
-		Status:    "active",
-		CreatedAt: now,
-		UpdatedAt: now,
+		ID:          uuid.New().String(),
+		Name:        req.Name,
+		Email:       req.Email,
+		APIKey:      apiKey,
+		Status:      "active",
+		Timezone:    req.Timezone,
+		CrossTenant: req.CrossTenant,
+		CreatedAt:   now,
+		UpdatedAt:   now,
 	}
 
 	if err := h.storage.CreateTenant(ctx, tenant); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create tenant")
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to create tenant"))
 		return
 	}
 
-	log.Printf("[ADMIN] Created tenant: %s (%s)", tenant.ID, tenant.Name)
+	log.Printf("[ADMIN] Created tenant: %s (%s) by %s", tenant.ID, tenant.Name, actingAdmin(r))
 	respondJSON(w, tenant)
 }
 
@@ -1056,12 +1479,14 @@ func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
 	tenantID := vars["id"]
 
 	var req struct {
-		Name   *string `json:"name,omitempty"`
-		Email  *string `json:"email,omitempty"`
-		Status *string `json:"status,omitempty"`
+		Name     *string `json:"name,omitempty"`
+		Email    *string `json:"email,omitempty"`
+		Status      *string `json:"status,omitempty"`
+		Timezone    *string `json:"timezone,omitempty"`
+		CrossTenant *bool   `json:"cross_tenant,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
@@ -1069,7 +1494,7 @@ func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
 
 	tenant, err := h.storage.GetTenant(ctx, tenantID)
 	if err != nil || tenant == nil {
-		respondError(w, http.StatusNotFound, "Tenant not found")
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
 		return
 	}
 
@@ -1082,14 +1507,25 @@ func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
 	if req.Status != nil {
 		tenant.Status = *req.Status
 	}
+	if req.Timezone != nil {
+		if _, err := time.LoadLocation(*req.Timezone); err != nil || *req.Timezone == "" {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "Invalid timezone: "+*req.Timezone))
+			return
+		}
+		tenant.Timezone = *req.Timezone
+	}
+	if req.CrossTenant != nil {
+		tenant.CrossTenant = *req.CrossTenant
+		log.Printf("[ADMIN] Tenant %s cross-tenant access set to %v by %s", tenantID, tenant.CrossTenant, actingAdmin(r))
+	}
 	tenant.UpdatedAt = time.Now()
 
 	if err := h.storage.UpdateTenant(ctx, tenant); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to update tenant")
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to update tenant"))
 		return
 	}
 
-	log.Printf("[ADMIN] Updated tenant: %s", tenantID)
+	log.Printf("[ADMIN] Updated tenant: %s by %s", tenantID, actingAdmin(r))
 	respondJSON(w, tenant)
 }
 
@@ -1102,7 +1538,7 @@ func (h *Handler) GetTenantAdmin(w http.ResponseWriter, r *http.Request) {
 
 	tenant, err := h.storage.GetTenant(ctx, tenantID)
 	if err != nil || tenant == nil {
-		respondError(w, http.StatusNotFound, "Tenant not found")
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
 		return
 	}
 
@@ -1118,7 +1554,7 @@ func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 		BillingCycle    string `json:"billing_cycle"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
@@ -1146,7 +1582,11 @@ func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if req.BillingCycle == "" {
-		req.BillingCycle = "monthly"
+		req.BillingCycle = models.BillingCycleMonthly
+	}
+	if !isValidBillingCycle(req.BillingCycle) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "billing_cycle must be 'monthly' or 'annual'"))
+		return
 	}
 
 	sub := &models.Subscription{
@@ -1160,16 +1600,17 @@ func (h *Handler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
 		SubscriptionStartDate: subStart,
 		SubscriptionEndDate:   subEnd,
 		BillingCycle:          req.BillingCycle,
+		BillingAnchorDate:     subStart,
 		CreatedAt:             now,
 		UpdatedAt:             now,
 	}
 
 	if err := h.storage.CreateSubscription(ctx, sub); err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to create subscription")
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to create subscription"))
 		return
 	}
 
-	log.Printf("[ADMIN] Created subscription: %s for tenant %s (plan=%s)", sub.ID, req.TenantID, req.Plan)
+	log.Printf("[ADMIN] Created subscription: %s for tenant %s (plan=%s) by %s", sub.ID, req.TenantID, req.Plan, actingAdmin(r))
 	respondJSON(w, sub)
 }
 
@@ -1185,7 +1626,7 @@ func (h *Handler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
 		BillingCycle    *string `json:"billing_cycle,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
@@ -1193,7 +1634,7 @@ func (h *Handler) UpdateSubscription(w http.ResponseWriter, r *http.Request) {
 
 	// Find subscription (by querying all subscriptions - simplified)
 	// In production, you'd have a GetSubscriptionByID method
-	respondError(w, http.StatusNotImplemented, "Update by subscription ID not implemented, use tenant ID")
+	respondError(w, r, apierror.New(apierror.NotImplemented, "Update by subscription ID not implemented, use tenant ID"))
 	_ = subID
 	_ = ctx
 }
@@ -1208,20 +1649,13 @@ func (h *Handler) ManageGrowthPacks(w http.ResponseWriter, r *http.Request) {
 		Disable []string `json:"disable,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		respondError(w, r, apierror.InvalidBody(err))
 		return
 	}
 
 	ctx := r.Context()
-	log.Printf("[ADMIN] Managing growth packs for tenant %s: enable=%v, disable=%v",
-		tenantID, req.Enable, req.Disable)
-
-	// Get available packs for pricing
-	availablePacks := models.AvailableGrowthPacks()
-	packPrices := make(map[string]float64)
-	for _, p := range availablePacks {
-		packPrices[p.PackName] = p.PriceMonthly
-	}
+	log.Printf("[ADMIN] Managing growth packs for tenant %s: enable=%v, disable=%v by %s",
+		tenantID, req.Enable, req.Disable, actingAdmin(r))
 
 	// Disable packs
 	for _, packName := range req.Disable {
@@ -1231,15 +1665,14 @@ func (h *Handler) ManageGrowthPacks(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Enable packs
+	// Packs are enabled at list price, monthly and annual
 	for _, packName := range req.Enable {
-		price := packPrices[packName]
 		assignment := &models.GrowthPackAssignment{
-			ID:           uuid.New().String(),
-			TenantID:     tenantID,
-			PackName:     packName,
-			EnabledAt:    time.Now(),
-			IsEnabled:    true,
-			PriceMonthly: &price,
+			ID:        uuid.New().String(),
+			TenantID:  tenantID,
+			PackName:  packName,
+			EnabledAt: time.Now(),
+			IsEnabled: true,
 		}
 		if err := h.storage.EnableGrowthPack(ctx, assignment); err != nil {
 			log.Printf("[ADMIN] Error enabling pack %s: %v", packName, err)
@@ -1287,7 +1720,7 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	stats, err := h.storage.GetStats(ctx)
 	if err != nil {
-		respondError(w, http.StatusInternalServerError, "Failed to get stats")
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get stats"))
 		return
 	}
 
@@ -1296,6 +1729,7 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 		ByType:      make(map[string]int),
 		Tenants:     stats["tenants"],
 	}
+	resp.TimestampFormats, resp.TimestampRejections = h.timestampStats.snapshot()
 
 	respondJSON(w, resp)
 }
@@ -1308,38 +1742,16 @@ func respondJSON(w http.ResponseWriter, data interface{}) {
 	}
 }
 
-func respondError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
+// respondError sends err as a typed API error response
+func respondError(w http.ResponseWriter, r *http.Request, err error) {
+	apierror.Write(w, r, err)
 }
 
-// ParseUnixTimestamp parses a Unix timestamp from string (for C++ client compatibility)
+// ParseUnixTimestamp parses a Unix timestamp from string (for C++ client compatibility).
+// Accepts the same formats as models.FlexibleTime.
 func ParseUnixTimestamp(s string) (time.Time, error) {
-	// Try parsing as Unix timestamp (seconds)
-	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
-		return time.Unix(ts, 0), nil
-	}
-
-	// Try RFC3339
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
-		return t, nil
-	}
-
-	// Try other common formats
-	formats := []string{
-		time.RFC3339Nano,
-		"2006-01-02T15:04:05Z",
-		"2006-01-02 15:04:05",
-	}
-
-	for _, format := range formats {
-		if t, err := time.Parse(format, s); err == nil {
-			return t, nil
-		}
-	}
-
-	return time.Time{}, nil
+	t, _, err := models.ParseFlexibleTime(s)
+	return t, err
 }
 
 // init to handle deprecated package paths
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// isValidBillingCycle reports whether the cycle is one we can price
+func isValidBillingCycle(cycle string) bool {
+	return cycle == models.BillingCycleMonthly || cycle == models.BillingCycleAnnual
+}
+
+// annualPrice returns the annual price for a monthly price, applying the
+// annual discount unless an explicit annual price is configured
+func annualPrice(monthly, explicitAnnual float64) float64 {
+	if explicitAnnual > 0 {
+		return explicitAnnual
+	}
+	return roundCurrency(monthly * 12 * (1 - models.AnnualDiscountPercent/100.0))
+}
+
+// roundCurrency rounds an amount to whole cents
+func roundCurrency(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// addMonthsClamped adds months to t, clamping to the last day of the target
+// month so that a Jan 31 anniversary bills on Feb 28/29 rather than Mar 3
+func addMonthsClamped(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	target := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	lastDay := target.AddDate(0, 1, -1).Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(target.Year(), target.Month(), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
+
+// cycleMonths returns the length of a billing cycle in months
+func cycleMonths(cycle string) int {
+	if cycle == models.BillingCycleAnnual {
+		return 12
+	}
+	return 1
+}
+
+// billingAnchor returns the date billing cycles are counted from
+func billingAnchor(sub *models.Subscription) time.Time {
+	if sub.BillingAnchorDate != nil {
+		return *sub.BillingAnchorDate
+	}
+	if sub.SubscriptionStartDate != nil {
+		return *sub.SubscriptionStartDate
+	}
+	return sub.CreatedAt
+}
+
+// currentBillingPeriod returns the start and end of the billing period that
+// contains now, stepping from the anchor date in whole cycles
+func currentBillingPeriod(sub *models.Subscription, now time.Time) (time.Time, time.Time) {
+	anchor := billingAnchor(sub)
+	step := cycleMonths(sub.BillingCycle)
+
+	start := anchor
+	end := addMonthsClamped(anchor, step)
+	for n := 1; !end.After(now); n++ {
+		start = end
+		end = addMonthsClamped(anchor, (n+1)*step)
+	}
+	return start, end
+}
+
+// nextBillingDate returns the next anniversary billing date, or the
+// subscription end date if the subscription ends first
+func nextBillingDate(sub *models.Subscription, now time.Time) time.Time {
+	_, next := currentBillingPeriod(sub, now)
+	if sub.SubscriptionEndDate != nil && sub.SubscriptionEndDate.Before(next) {
+		return *sub.SubscriptionEndDate
+	}
+	return next
+}
+
+// billingCycleReference marks payment attempts that pay for a billing cycle
+const billingCycleReference = "billing_cycle"
+
+// paidPeriodStart returns the start of the billing period PeriodPaidAmount
+// was paid towards
+func paidPeriodStart(sub *models.Subscription) time.Time {
+	if sub.PeriodPaidStart != nil {
+		return *sub.PeriodPaidStart
+	}
+	return billingAnchor(sub)
+}
+
+// paidForPeriod returns what was paid towards the billing period starting at
+// start; payments recorded for an earlier period don't count
+func paidForPeriod(sub *models.Subscription, start time.Time) float64 {
+	if !paidPeriodStart(sub).Equal(start) {
+		return 0
+	}
+	return sub.PeriodPaidAmount
+}
+
+// unusedCredit returns the credit owed for the unused part of the current
+// billing period when the subscription is changed part-way through it. Only
+// what was paid for the period is credited, so unpaid time earns nothing.
+func unusedCredit(sub *models.Subscription, cyclePrice float64, now time.Time) float64 {
+	start, end := currentBillingPeriod(sub, now)
+	total := end.Sub(start).Seconds()
+	if total <= 0 {
+		return 0
+	}
+
+	paid := math.Min(paidForPeriod(sub, start), cyclePrice)
+	if paid <= 0 {
+		return 0
+	}
+
+	remaining := end.Sub(now).Seconds()
+	return roundCurrency(paid * remaining / total)
+}
+
+// settleBillingCycleCharge records a succeeded billing cycle charge as paid
+// towards the billing period it was made in, such as a renewal charged with
+// reference type billing_cycle. Charges that settle after their period has
+// been replaced or has ended are left as they are.
+func (h *Handler) settleBillingCycleCharge(ctx context.Context, attempt *models.PaymentAttempt) error {
+	if attempt.Status != models.PaymentStatusSucceeded || attempt.ReferenceID == nil {
+		return nil
+	}
+
+	sub, err := h.storage.GetSubscription(ctx, attempt.TenantID)
+	if err != nil {
+		return err
+	}
+	if sub == nil || sub.ID != *attempt.ReferenceID {
+		return nil
+	}
+	unlock := h.billingLocks.lock(sub.ID)
+	defer unlock()
+	if sub, err = h.storage.GetSubscription(ctx, attempt.TenantID); err != nil || sub == nil {
+		return err
+	}
+
+	start, _ := currentBillingPeriod(sub, time.Now())
+	if attempt.CreatedAt.Before(billingAnchor(sub)) || attempt.CreatedAt.Before(start) {
+		return nil
+	}
+
+	sub.PeriodPaidAmount = roundCurrency(paidForPeriod(sub, start) + attempt.Amount)
+	sub.PeriodPaidStart = &start
+	if err := h.storage.UpdateSubscription(ctx, sub); err != nil {
+		return err
+	}
+	log.Printf("[BILLING_CYCLE] Charge %s settled %.2f towards the %s cycle of tenant %s",
+		attempt.ID, attempt.Amount, sub.BillingCycle, sub.TenantID)
+	return nil
+}
+
+// subscriptionLocks serialises billing changes to each subscription within
+// this process, so concurrent requests can't both charge for one change
+type subscriptionLocks struct {
+	mu    sync.Mutex
+	locks map[string]*subscriptionLock
+}
+
+type subscriptionLock struct {
+	mu      sync.Mutex
+	waiters int
+}
+
+// lock locks a subscription and returns the function that unlocks it
+func (l *subscriptionLocks) lock(subscriptionID string) func() {
+	l.mu.Lock()
+	if l.locks == nil {
+		l.locks = make(map[string]*subscriptionLock)
+	}
+	entry, ok := l.locks[subscriptionID]
+	if !ok {
+		entry = &subscriptionLock{}
+		l.locks[subscriptionID] = entry
+	}
+	entry.waiters++
+	l.mu.Unlock()
+
+	entry.mu.Lock()
+	return func() {
+		entry.mu.Unlock()
+		l.mu.Lock()
+		if entry.waiters--; entry.waiters == 0 {
+			delete(l.locks, subscriptionID)
+		}
+		l.mu.Unlock()
+	}
+}
+
+// ChangeBillingCycle switches a tenant between monthly and annual billing.
+// The paid, unused part of the current period is credited, and the new
+// cycle is paid from the tenant's credit balance first and the rest charged
+// to their payment method. A declined charge leaves the cycle unchanged.
+// Changes to a subscription are serialised, and a request for the cycle the
+// subscription is already on is refused before anything is charged.
+func (h *Handler) ChangeBillingCycle(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		BillingCycle string `json:"billing_cycle"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	if !isValidBillingCycle(req.BillingCycle) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "billing_cycle must be 'monthly' or 'annual'"))
+		return
+	}
+
+	ctx := r.Context()
+
+	sub, err := h.storage.GetSubscription(ctx, tenantID)
+	if err != nil || sub == nil {
+		respondError(w, r, apierror.New(apierror.SubscriptionNotFound, "Subscription not found"))
+		return
+	}
+
+	if sub.Plan == "trial" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Trial subscriptions have no billing cycle"))
+		return
+	}
+
+	// Re-read under the lock: a concurrent change may already have switched
+	// and paid for the cycle
+	unlock := h.billingLocks.lock(sub.ID)
+	defer unlock()
+	sub, err = h.storage.GetSubscription(ctx, tenantID)
+	if err != nil || sub == nil {
+		respondError(w, r, apierror.New(apierror.SubscriptionNotFound, "Subscription not found"))
+		return
+	}
+
+	if sub.BillingCycle == req.BillingCycle {
+		respondError(w, r, apierror.New(apierror.BillingCycleUnchanged, "Subscription is already on the "+req.BillingCycle+" cycle"))
+		return
+	}
+
+	packs, _ := h.storage.GetEnabledGrowthPacks(ctx, tenantID)
+	now := time.Now()
+
+	oldPricing := calculatePricing(sub.CamerasLicensed, packs, sub.BillingCycle)
+	credit := unusedCredit(sub, oldPricing.TotalPerCycle, now)
+
+	newPricing := calculatePricing(sub.CamerasLicensed, packs, req.BillingCycle)
+
+	available := roundCurrency(sub.CreditBalance + credit)
+	creditApplied := math.Min(available, newPricing.TotalPerCycle)
+	amountDue := roundCurrency(newPricing.TotalPerCycle - creditApplied)
+
+	var attempt *models.PaymentAttempt
+	if amountDue > 0 {
+		if !h.requirePaymentProvider(w, r) {
+			return
+		}
+		description := "Switch to " + req.BillingCycle + " billing"
+		attempt, err = h.chargeTenant(ctx, tenantID, amountDue, description, billingCycleReference, &sub.ID)
+		if err == errNoPaymentMethod {
+			respondError(w, r, apierror.New(apierror.NoPaymentMethod, err.Error()))
+			return
+		}
+		if err != nil {
+			log.Printf("[BILLING_CYCLE] Charge failed for tenant %s: %v", tenantID, err)
+			respondError(w, r, apierror.New(apierror.PaymentProviderError, "Failed to charge tenant"))
+			return
+		}
+		if attempt.Status == models.PaymentStatusFailed {
+			log.Printf("[BILLING_CYCLE] Tenant %s charge for %s cycle declined; cycle unchanged", tenantID, req.BillingCycle)
+			respondError(w, r, apierror.New(apierror.PaymentDeclined, "The charge for the new billing cycle was declined").
+				WithDetail("payment_attempt_id", attempt.ID))
+			return
+		}
+	}
+
+	previousCycle := sub.BillingCycle
+	sub.BillingCycle = req.BillingCycle
+	sub.BillingAnchorDate = &now
+	sub.CreditBalance = roundCurrency(available - creditApplied)
+	sub.PeriodPaidAmount = roundCurrency(creditApplied)
+	sub.PeriodPaidStart = &now
+	if attempt != nil && attempt.Status == models.PaymentStatusSucceeded {
+		// Pending charges are counted when they settle
+		sub.PeriodPaidAmount = roundCurrency(sub.PeriodPaidAmount + attempt.Amount)
+	}
+
+	if err := h.storage.UpdateSubscription(ctx, sub); err != nil {
+		log.Printf("[BILLING_CYCLE] Failed to update subscription: %v", err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to change billing cycle"))
+		return
+	}
+	if attempt != nil {
+		h.handlePaymentResult(ctx, attempt)
+	}
+
+	log.Printf("[BILLING_CYCLE] Tenant %s switched %s -> %s (credit=%.2f, applied=%.2f, charged=%.2f)",
+		tenantID, previousCycle, sub.BillingCycle, credit, creditApplied, amountDue)
+
+	resp := map[string]interface{}{
+		"success":           true,
+		"previous_cycle":    previousCycle,
+		"billing_cycle":     sub.BillingCycle,
+		"unused_credit":     credit,
+		"credit_applied":    roundCurrency(creditApplied),
+		"credit_balance":    sub.CreditBalance,
+		"cycle_cost":        newPricing.TotalPerCycle,
+		"amount_due":        amountDue,
+		"next_billing_date": nextBillingDate(sub, now).Format(time.RFC3339),
+		"pricing":           newPricing,
+	}
+	if attempt != nil {
+		resp["payment_attempt"] = attempt
+	}
+
+	respondJSON(w, resp)
+}
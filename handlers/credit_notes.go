@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+)
+
+// creditNoteNumber builds a human-readable credit note number
+func creditNoteNumber(id string, issuedAt time.Time) string {
+	return "CN-" + issuedAt.Format("20060102") + "-" + strings.ToUpper(id[:8])
+}
+
+// issueCreditNote validates and settles a credit note, either refunding the
+// referenced charges or adding the total to the tenant's account credit
+func (h *Handler) issueCreditNote(ctx context.Context, note *models.CreditNote) error {
+	if !models.IsValidCreditReason(note.Reason) {
+		return fmt.Errorf("unknown reason code %q", note.Reason)
+	}
+	if len(note.LineItems) == 0 {
+		return fmt.Errorf("credit note needs at least one line item")
+	}
+
+	var total float64
+	for i := range note.LineItems {
+		item := &note.LineItems[i]
+		if item.Amount <= 0 {
+			return fmt.Errorf("line item amounts must be positive")
+		}
+		total += item.Amount
+
+		// Refund outcomes are recorded here, never taken from the request
+		item.RefundedAmount = 0
+		item.RefundID = nil
+		item.RefundError = nil
+	}
+
+	now := time.Now()
+	note.ID = uuid.New().String()
+	note.Number = creditNoteNumber(note.ID, now)
+	note.Total = roundCurrency(total)
+	note.Currency = DefaultCurrency
+	note.Status = models.CreditNoteStatusIssued
+	note.IssuedAt = now
+	note.CreatedAt = now
+	note.UpdatedAt = now
+
+	switch note.Method {
+	case models.CreditMethodRefund:
+		return h.refundCreditNote(ctx, note)
+	case models.CreditMethodAccountCredit:
+		return h.creditAccount(ctx, note)
+	}
+	return fmt.Errorf("method must be '%s' or '%s'", models.CreditMethodRefund, models.CreditMethodAccountCredit)
+}
+
+// refundCreditNote refunds each line item against the charge it references,
+// recording the outcome on the line items. When some refunds fail after
+// others went through, the note is saved as partially refunded so the money
+// already returned is still reported.
+func (h *Handler) refundCreditNote(ctx context.Context, note *models.CreditNote) error {
+	if h.paymentProvider == nil {
+		return fmt.Errorf("no payment provider configured for refunds")
+	}
+
+	// Validate every line before moving any money
+	attempts := make(map[string]*models.PaymentAttempt)
+	requested := make(map[string]float64)
+	var order []string
+	for _, item := range note.LineItems {
+		if item.PaymentAttemptID == nil {
+			return fmt.Errorf("refund line items must reference a payment_attempt_id")
+		}
+		attempt, err := h.storage.GetPaymentAttempt(ctx, *item.PaymentAttemptID)
+		if err != nil {
+			return err
+		}
+		if attempt == nil || attempt.TenantID != note.TenantID {
+			return fmt.Errorf("payment attempt %s not found for tenant", *item.PaymentAttemptID)
+		}
+		if _, seen := attempts[attempt.ID]; !seen {
+			order = append(order, attempt.ID)
+		}
+		attempts[attempt.ID] = attempt
+		requested[attempt.ID] += item.Amount
+	}
+	for id, amount := range requested {
+		attempt := attempts[id]
+		if attempt.Status != models.PaymentStatusSucceeded && attempt.Status != models.PaymentStatusPartiallyRefunded {
+			return fmt.Errorf("payment attempt %s is %s and cannot be refunded", id, attempt.Status)
+		}
+		if roundCurrency(attempt.RefundedAmount+amount) > attempt.Amount {
+			return fmt.Errorf("refund of %.2f exceeds remaining balance of payment attempt %s", amount, id)
+		}
+	}
+
+	var failures []string
+	refunded := 0
+	for _, id := range order {
+		result, err := h.refundAttempt(ctx, attempts[id], requested[id])
+		if result != nil {
+			refunded++
+		}
+		for i := range note.LineItems {
+			item := &note.LineItems[i]
+			if *item.PaymentAttemptID != id {
+				continue
+			}
+			if result != nil {
+				item.RefundedAmount = item.Amount
+				item.RefundID = &result.ID
+			} else {
+				msg := err.Error()
+				item.RefundError = &msg
+			}
+		}
+		if err != nil {
+			log.Printf("[CREDIT_NOTE] Refund of payment attempt %s for %s failed: %v", id, note.Number, err)
+			failures = append(failures, fmt.Sprintf("payment attempt %s: %v", id, err))
+		}
+	}
+
+	switch {
+	case len(failures) == 0:
+		note.Status = models.CreditNoteStatusRefunded
+	case refunded > 0:
+		note.Status = models.CreditNoteStatusPartiallyRefunded
+	default:
+		note.Status = models.CreditNoteStatusFailed
+	}
+	note.UpdatedAt = time.Now()
+	if err := h.storage.SaveCreditNote(ctx, note); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("credit note %s is %s; refund failed for %s", note.Number, note.Status, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// creditAccount adds the credit note total to the credit applied to the next bill
+func (h *Handler) creditAccount(ctx context.Context, note *models.CreditNote) error {
+	sub, err := h.storage.GetSubscription(ctx, note.TenantID)
+	if err != nil {
+		return err
+	}
+	if sub == nil {
+		return fmt.Errorf("tenant has no subscription to credit")
+	}
+
+	sub.CreditBalance = roundCurrency(sub.CreditBalance + note.Total)
+	if err := h.storage.UpdateSubscription(ctx, sub); err != nil {
+		return err
+	}
+
+	note.Status = models.CreditNoteStatusCredited
+	return h.storage.SaveCreditNote(ctx, note)
+}
+
+// downgradeCreditNote issues account credit for the unused part of the
+// current billing period when a paid license is revoked mid-period
+func (h *Handler) downgradeCreditNote(ctx context.Context, sub *models.Subscription, packs []models.GrowthPackAssignment) *models.CreditNote {
+	now := time.Now()
+	pricing := calculatePricing(sub.CamerasLicensed, packs, sub.BillingCycle)
+	amount := unusedCredit(sub, pricing.TotalPerCycle, now)
+	if amount <= 0 {
+		return nil
+	}
+
+	periodStart, periodEnd := currentBillingPeriod(sub, now)
+	item := models.CreditNoteLineItem{
+		Description: fmt.Sprintf("Unused %s license time (%s to %s)", sub.Plan,
+			now.Format("2006-01-02"), periodEnd.Format("2006-01-02")),
+		Amount:      amount,
+		PeriodStart: &periodStart,
+		PeriodEnd:   &periodEnd,
+	}
+
+	// Reference the most recent successful charge, if any
+	attempts, _ := h.storage.GetPaymentAttemptsByTenant(ctx, sub.TenantID)
+	for _, attempt := range attempts {
+		if attempt.Status == models.PaymentStatusSucceeded || attempt.Status == models.PaymentStatusPartiallyRefunded {
+			id := attempt.ID
+			item.PaymentAttemptID = &id
+			break
+		}
+	}
+
+	memo := "Automatic credit for license revocation"
+	note := &models.CreditNote{
+		TenantID:  sub.TenantID,
+		Reason:    models.CreditReasonDowngrade,
+		Method:    models.CreditMethodAccountCredit,
+		LineItems: []models.CreditNoteLineItem{item},
+		Memo:      &memo,
+	}
+	return note
+}
+
+// CreateCreditNote issues a credit note for a tenant (admin endpoint)
+func (h *Handler) CreateCreditNote(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TenantID  string                      `json:"tenant_id"`
+		Reason    string                      `json:"reason"`
+		Method    string                      `json:"method"`
+		LineItems []models.CreditNoteLineItem `json:"line_items"`
+		Memo      *string                     `json:"memo,omitempty"`
+		IssuedBy  *string                     `json:"issued_by,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	ctx := r.Context()
+
+	tenant, err := h.storage.GetTenant(ctx, req.TenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	// Default the issuer to the acting admin
+	if req.IssuedBy == nil {
+		if admin := middleware.AdminFromContext(ctx); admin != nil {
+			issuedBy := admin.Name
+			req.IssuedBy = &issuedBy
+		}
+	}
+
+	note := &models.CreditNote{
+		TenantID:  req.TenantID,
+		Reason:    req.Reason,
+		Method:    req.Method,
+		LineItems: req.LineItems,
+		Memo:      req.Memo,
+		IssuedBy:  req.IssuedBy,
+	}
+
+	if err := h.issueCreditNote(ctx, note); err != nil {
+		log.Printf("[CREDIT_NOTE] Failed to issue credit note for tenant %s: %v", req.TenantID, err)
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	log.Printf("[CREDIT_NOTE] Issued %s for tenant %s: %.2f %s (%s, %s)",
+		note.Number, note.TenantID, note.Total, note.Currency, note.Reason, note.Status)
+	respondJSON(w, note)
+}
+
+// GetCreditNotes lists credit notes for a tenant
+func (h *Handler) GetCreditNotes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	notes, err := h.storage.GetCreditNotesByTenant(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get credit notes"))
+		return
+	}
+	if notes == nil {
+		notes = []models.CreditNote{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":    tenantID,
+		"credit_notes": notes,
+	})
+}
+
+// GetCreditNote returns a single credit note
+func (h *Handler) GetCreditNote(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	noteID := vars["id"]
+
+	note, err := h.storage.GetCreditNote(r.Context(), noteID)
+	if err != nil || note == nil {
+		respondError(w, r, apierror.New(apierror.CreditNoteNotFound, "Credit note not found"))
+		return
+	}
+
+	respondJSON(w, note)
+}
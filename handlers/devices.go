@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/pki"
+)
+
+// deviceSecretPrefix marks device signing secrets
+const deviceSecretPrefix = "bbd_"
+
+// EnableDeviceCA issues device client certificates at enrollment from the
+// given CA
+func (h *Handler) EnableDeviceCA(ca *pki.CA) {
+	h.deviceCA = ca
+}
+
+// enrollDeviceRequest is the body of EnrollDevice and, with a token instead
+// of a tenant ID, ActivateDevice
+type enrollDeviceRequest struct {
+	TenantID        string  `json:"tenant_id,omitempty"`
+	EnrollmentToken string  `json:"enrollment_token,omitempty"`
+	DeviceID        string  `json:"device_id"`
+	Name            *string `json:"name,omitempty"`
+	ManagementTier  string  `json:"management_tier,omitempty"`
+	CSR             string  `json:"csr,omitempty"` // PEM certificate signing request
+}
+
+// EnrollDevice registers an edge device for a tenant and issues its signing
+// secret, which is only returned here. With a csr, it also issues a client
+// certificate from the device CA. Enrolling an enrolled device replaces its
+// secret and revokes its earlier certificates, so only admins enroll devices
+// directly; tenants mint enrollment tokens for ActivateDevice (admin).
+func (h *Handler) EnrollDevice(w http.ResponseWriter, r *http.Request) {
+	var req enrollDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	ctx := r.Context()
+	if device := middleware.DeviceFromContext(ctx); device != nil {
+		respondError(w, r, apierror.New(apierror.DeviceAccessDenied, "Devices can't enroll devices"))
+		return
+	}
+	if middleware.AdminFromContext(ctx) == nil {
+		respondError(w, r, apierror.New(apierror.PermissionDenied, "Enrolling a device directly requires an admin; use an enrollment token"))
+		return
+	}
+
+	tenantID := req.TenantID
+	if tenantID == "" || req.DeviceID == "" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "tenant_id and device_id are required"))
+		return
+	}
+
+	resp, err := h.enrollDevice(ctx, tenantID, req, nil)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	respondJSON(w, resp)
+}
+
+// enrollDevice issues a device's credentials for a tenant. With a token, the
+// token is redeemed and its limits applied to the device; limits the token
+// doesn't set are kept. A device whose tier was fixed by a token only changes
+// tier by a token that sets one.
+func (h *Handler) enrollDevice(ctx context.Context, tenantID string, req enrollDeviceRequest, token *models.EnrollmentToken) (map[string]interface{}, error) {
+	if req.ManagementTier != "" && !models.ValidManagementTier(req.ManagementTier) {
+		return nil, apierror.New(apierror.InvalidRequest, "Unknown management tier: "+req.ManagementTier).
+			WithDetail("management_tier", req.ManagementTier)
+	}
+	if req.CSR != "" && h.deviceCA == nil {
+		return nil, apierror.New(apierror.FeatureDisabled, "Device certificates are not enabled")
+	}
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		return nil, apierror.New(apierror.TenantNotFound, "Tenant not found")
+	}
+
+	device, err := h.storage.GetEdgeDevice(ctx, req.DeviceID)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get edge device")
+	}
+
+	now := time.Now()
+	if device == nil {
+		device = &models.EdgeDevice{
+			ID:             uuid.New().String(),
+			DeviceID:       req.DeviceID,
+			TenantID:       tenantID,
+			Status:         models.DeviceStatusActive,
+			ManagementTier: models.ManagementTierBasic,
+			CreatedAt:      now,
+		}
+	} else if device.TenantID != tenantID {
+		log.Printf("[DEVICE] Device %s belongs to tenant %s, not %s", req.DeviceID, device.TenantID, tenantID)
+		return nil, apierror.New(apierror.DeviceAccessDenied, "Device belongs to another tenant").
+			WithDetail("device_id", req.DeviceID)
+	}
+	if req.Name != nil {
+		device.Name = req.Name
+	}
+	if req.ManagementTier != "" && req.ManagementTier != device.ManagementTier {
+		if device.TierLocked {
+			return nil, apierror.New(apierror.InvalidRequest, "Device's management tier is locked by its enrollment token").
+				WithDetail("management_tier", device.ManagementTier)
+		}
+		device.ManagementTier = req.ManagementTier
+	}
+
+	var issued *pki.IssuedCertificate
+	if req.CSR != "" {
+		issued, err = h.deviceCA.IssueDeviceCertificate([]byte(req.CSR), device.DeviceID, tenantID)
+		if err != nil {
+			return nil, apierror.Newf(apierror.InvalidRequest, "Failed to issue certificate: %v", err)
+		}
+	}
+
+	// Redeem the token last, so a bad request doesn't use it up
+	if token != nil {
+		redeemed, err := h.storage.RedeemEnrollmentToken(ctx, token.ID, device.DeviceID, now)
+		if err != nil {
+			return nil, apierror.Wrap(apierror.Internal, err, "Failed to redeem enrollment token")
+		}
+		if !redeemed {
+			return nil, apierror.New(apierror.InvalidEnrollmentToken, "Enrollment token is invalid, expired or already used")
+		}
+		if token.ManagementTier != nil {
+			device.ManagementTier = *token.ManagementTier
+			device.TierLocked = true
+		}
+		if token.MaxCameras != nil {
+			device.MaxCameras = token.MaxCameras
+		}
+	}
+
+	secret, err := generateSecret(deviceSecretPrefix)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to generate device secret")
+	}
+	device.SigningSecret = secret
+	device.EnrolledAt = &now
+	device.UpdatedAt = now
+
+	if err := h.storage.SaveEdgeDevice(ctx, device); err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to enroll device")
+	}
+
+	// Earlier credentials are replaced
+	if err := h.revokeDeviceCertificates(ctx, device.DeviceID, models.CertRevocationSuperseded, now); err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to revoke earlier certificates")
+	}
+
+	resp := map[string]interface{}{
+		"device":        device,
+		"device_secret": secret,
+	}
+	if issued != nil {
+		record := &models.DeviceCertificate{
+			Serial:    issued.Serial,
+			DeviceID:  device.DeviceID,
+			TenantID:  tenantID,
+			Subject:   issued.Certificate.Subject.String(),
+			NotBefore: issued.Certificate.NotBefore,
+			NotAfter:  issued.Certificate.NotAfter,
+			CreatedAt: now,
+		}
+		if err := h.storage.CreateDeviceCertificate(ctx, record); err != nil {
+			return nil, apierror.Wrap(apierror.Internal, err, "Failed to record device certificate")
+		}
+		resp["certificate"] = record
+		resp["certificate_pem"] = string(issued.PEM)
+		resp["ca_certificate_pem"] = string(h.deviceCA.CertificatePEM())
+		log.Printf("[DEVICE] Issued certificate %s to device %s", issued.Serial, device.DeviceID)
+	}
+
+	log.Printf("[DEVICE] Enrolled device %s for tenant %s", device.DeviceID, tenantID)
+	return resp, nil
+}
+
+// revokeDeviceCertificates revokes all of a device's unrevoked certificates
+func (h *Handler) revokeDeviceCertificates(ctx context.Context, deviceID, reason string, at time.Time) error {
+	certs, err := h.storage.ListDeviceCertificates(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if cert.Revoked() {
+			continue
+		}
+		if err := h.storage.RevokeDeviceCertificate(ctx, cert.Serial, reason, at); err != nil {
+			return err
+		}
+		log.Printf("[DEVICE] Revoked certificate %s of device %s (%s)", cert.Serial, deviceID, reason)
+	}
+	return nil
+}
+
+// GetDeviceCertificates lists the certificates issued to a device, newest
+// first (admin)
+func (h *Handler) GetDeviceCertificates(w http.ResponseWriter, r *http.Request) {
+	deviceID := mux.Vars(r)["deviceId"]
+	ctx := r.Context()
+
+	device, err := h.storage.GetEdgeDevice(ctx, deviceID)
+	if err != nil || device == nil {
+		respondError(w, r, apierror.New(apierror.DeviceNotFound, "Device not found"))
+		return
+	}
+
+	certs, err := h.storage.ListDeviceCertificates(ctx, deviceID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list device certificates"))
+		return
+	}
+	if certs == nil {
+		certs = []models.DeviceCertificate{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"device_id":    deviceID,
+		"certificates": certs,
+		"count":        len(certs),
+	})
+}
+
+// RevokeDeviceCertificate revokes one of a device's certificates; requests
+// presenting it are refused from then on (admin)
+func (h *Handler) RevokeDeviceCertificate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	deviceID, serial := vars["deviceId"], vars["serial"]
+
+	var req struct {
+		Reason string `json:"reason,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, apierror.InvalidBody(err))
+			return
+		}
+	}
+	if req.Reason == "" {
+		req.Reason = models.CertRevocationUnspecified
+	}
+	if !models.ValidCertRevocationReason(req.Reason) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Unknown revocation reason: "+req.Reason).
+			WithDetail("reason", req.Reason))
+		return
+	}
+
+	ctx := r.Context()
+
+	cert, err := h.storage.GetDeviceCertificate(ctx, serial)
+	if err != nil || cert == nil || cert.DeviceID != deviceID {
+		respondError(w, r, apierror.New(apierror.CertificateNotFound, "Certificate not found").
+			WithDetail("serial", serial))
+		return
+	}
+
+	if err := h.storage.RevokeDeviceCertificate(ctx, serial, req.Reason, time.Now()); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to revoke certificate"))
+		return
+	}
+
+	cert, err = h.storage.GetDeviceCertificate(ctx, serial)
+	if err != nil || cert == nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to reload certificate"))
+		return
+	}
+
+	log.Printf("[ADMIN] Revoked certificate %s of device %s (%s) by %s", serial, deviceID, req.Reason, actingAdmin(r))
+	respondJSON(w, cert)
+}
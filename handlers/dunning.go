@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/dunning"
+	"brinkbyte-billing-server/models"
+)
+
+// EnableDunning creates the dunning engine that retries failed charges through
+// the configured payment provider. The caller runs the returned engine's worker.
+func (h *Handler) EnableDunning(policy dunning.Policy, notifier dunning.Notifier) *dunning.Engine {
+	h.dunning = dunning.NewEngine(policy, h.storage, h.chargeTenant, notifier)
+	return h.dunning
+}
+
+// pastDueGraceEnd reports whether a past-due subscription is still inside the
+// dunning grace window, and when that window ends
+func (h *Handler) pastDueGraceEnd(ctx context.Context, sub *models.Subscription) (time.Time, bool) {
+	if sub.Status != "past_due" || h.dunning == nil {
+		return time.Time{}, false
+	}
+
+	dc, err := h.storage.GetOpenDunningCase(ctx, sub.TenantID)
+	if err != nil {
+		log.Printf("[DUNNING] Error getting dunning case for tenant %s: %v", sub.TenantID, err)
+		return time.Time{}, false
+	}
+
+	// Past due without a case (e.g. set by an admin) starts the window from the last update
+	start := sub.UpdatedAt
+	if dc != nil {
+		start = dc.StartedAt
+	}
+
+	graceEnd := h.dunning.Policy().GraceEnd(start)
+	return graceEnd, time.Now().Before(graceEnd)
+}
+
+// GetDunningCases lists dunning cases for a tenant
+func (h *Handler) GetDunningCases(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	cases, err := h.storage.GetDunningCasesByTenant(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get dunning cases"))
+		return
+	}
+	if cases == nil {
+		cases = []models.DunningCase{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id": tenantID,
+		"cases":     cases,
+	})
+}
+
+// ProcessDunning runs any due dunning retries immediately
+func (h *Handler) ProcessDunning(w http.ResponseWriter, r *http.Request) {
+	if h.dunning == nil {
+		respondError(w, r, apierror.New(apierror.FeatureDisabled, "Dunning is not enabled"))
+		return
+	}
+
+	if err := h.dunning.ProcessDue(r.Context(), time.Now()); err != nil {
+		log.Printf("[DUNNING] Manual run failed: %v", err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to process dunning"))
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{"success": true})
+}
@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+)
+
+// enrollmentTokenPrefix marks device enrollment tokens
+const enrollmentTokenPrefix = "bbe_"
+
+// EnrollmentPolicy controls edge device enrollment
+type EnrollmentPolicy struct {
+	Required    bool          // refuse heartbeats and license checks from unenrolled devices
+	TokenTTL    time.Duration // lifetime of enrollment tokens that don't ask for one
+	MaxTokenTTL time.Duration // longest lifetime a token may ask for
+}
+
+// DefaultEnrollmentPolicy lets unenrolled devices register by heartbeat, and
+// issues enrollment tokens valid for a day, at most a week
+func DefaultEnrollmentPolicy() EnrollmentPolicy {
+	return EnrollmentPolicy{
+		TokenTTL:    24 * time.Hour,
+		MaxTokenTTL: 7 * 24 * time.Hour,
+	}
+}
+
+// SetEnrollmentPolicy replaces the device enrollment policy
+func (h *Handler) SetEnrollmentPolicy(policy EnrollmentPolicy) {
+	h.enrollment = policy
+}
+
+func hashEnrollmentToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateEnrollmentToken mints a single-use token a device exchanges for its
+// credentials at ActivateDevice. The token is only returned here.
+func (h *Handler) CreateEnrollmentToken(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TenantID         string  `json:"tenant_id"`
+		ManagementTier   *string `json:"management_tier,omitempty"`
+		MaxCameras       *int    `json:"max_cameras,omitempty"`
+		ExpiresInMinutes int     `json:"expires_in_minutes,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+
+	ctx := r.Context()
+
+	if device := middleware.DeviceFromContext(ctx); device != nil {
+		respondError(w, r, apierror.New(apierror.DeviceAccessDenied, "Devices can't create enrollment tokens"))
+		return
+	}
+	tenantID, authErr := middleware.ScopeTenant(ctx, req.TenantID)
+	if authErr != nil {
+		respondError(w, r, authErr)
+		return
+	}
+	if tenantID == "" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "tenant_id is required"))
+		return
+	}
+	if req.ManagementTier != nil && !models.ValidManagementTier(*req.ManagementTier) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Unknown management tier: "+*req.ManagementTier).
+			WithDetail("management_tier", *req.ManagementTier))
+		return
+	}
+	if req.MaxCameras != nil && *req.MaxCameras < 1 {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "max_cameras must be at least 1"))
+		return
+	}
+
+	ttl := h.enrollment.TokenTTL
+	if req.ExpiresInMinutes < 0 {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "expires_in_minutes must be positive"))
+		return
+	}
+	if req.ExpiresInMinutes > 0 {
+		ttl = time.Duration(req.ExpiresInMinutes) * time.Minute
+	}
+	if ttl > h.enrollment.MaxTokenTTL {
+		respondError(w, r, apierror.Newf(apierror.InvalidRequest, "expires_in_minutes may be at most %d", int(h.enrollment.MaxTokenTTL.Minutes())).
+			WithDetail("max_minutes", int(h.enrollment.MaxTokenTTL.Minutes())))
+		return
+	}
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	secret, err := generateSecret(enrollmentTokenPrefix)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to generate enrollment token"))
+		return
+	}
+
+	createdBy := "tenant " + tenantID
+	if middleware.AdminFromContext(ctx) != nil {
+		createdBy = actingAdmin(r)
+	}
+
+	now := time.Now()
+	token := &models.EnrollmentToken{
+		ID:             uuid.New().String(),
+		TenantID:       tenantID,
+		TokenPrefix:    secret[:len(enrollmentTokenPrefix)+8],
+		TokenHash:      hashEnrollmentToken(secret),
+		ManagementTier: req.ManagementTier,
+		MaxCameras:     req.MaxCameras,
+		CreatedBy:      createdBy,
+		ExpiresAt:      now.Add(ttl),
+		CreatedAt:      now,
+	}
+	if err := h.storage.CreateEnrollmentToken(ctx, token); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to create enrollment token"))
+		return
+	}
+
+	log.Printf("[DEVICE] Created enrollment token %s for tenant %s by %s (expires %s)",
+		token.TokenPrefix, tenantID, createdBy, token.ExpiresAt.Format(time.RFC3339))
+	respondJSON(w, map[string]interface{}{
+		"enrollment_token": token,
+		"token":            secret,
+	})
+}
+
+// ActivateDevice exchanges an enrollment token for a device's credentials,
+// as EnrollDevice issues them. The token authenticates the request, so this
+// needs no API key.
+func (h *Handler) ActivateDevice(w http.ResponseWriter, r *http.Request) {
+	var req enrollDeviceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.EnrollmentToken == "" || req.DeviceID == "" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "enrollment_token and device_id are required"))
+		return
+	}
+
+	ctx := r.Context()
+
+	invalid := apierror.New(apierror.InvalidEnrollmentToken, "Enrollment token is invalid, expired or already used")
+	if !strings.HasPrefix(req.EnrollmentToken, enrollmentTokenPrefix) {
+		respondError(w, r, invalid)
+		return
+	}
+	token, err := h.storage.GetEnrollmentTokenByHash(ctx, hashEnrollmentToken(req.EnrollmentToken))
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get enrollment token"))
+		return
+	}
+	if token == nil || !token.Redeemable(time.Now()) {
+		log.Printf("[DEVICE] Device %s presented an unusable enrollment token", req.DeviceID)
+		respondError(w, r, invalid)
+		return
+	}
+	if req.TenantID != "" && req.TenantID != token.TenantID {
+		respondError(w, r, apierror.New(apierror.DeviceAccessDenied, "Enrollment token is for another tenant").
+			WithDetail("tenant_id", req.TenantID))
+		return
+	}
+
+	// The token decides the tier when it sets one
+	if token.ManagementTier != nil {
+		req.ManagementTier = ""
+	}
+
+	resp, err := h.enrollDevice(ctx, token.TenantID, req, token)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+	log.Printf("[DEVICE] Device %s activated with enrollment token %s", req.DeviceID, token.TokenPrefix)
+	respondJSON(w, resp)
+}
+
+// requestDevice resolves the device a license check or heartbeat speaks for,
+// filling in deviceID for signed and certificate-authenticated requests,
+// which may only speak for their own device. A known device must belong to
+// the tenant. When enrollment is required, the device must be enrolled and
+// not suspended; otherwise unknown devices resolve to nil.
+func (h *Handler) requestDevice(ctx context.Context, deviceID *string, tenantID string) (*models.EdgeDevice, error) {
+	if caller := middleware.DeviceFromContext(ctx); caller != nil {
+		if *deviceID == "" {
+			*deviceID = caller.DeviceID
+		} else if *deviceID != caller.DeviceID {
+			return nil, apierror.New(apierror.DeviceAccessDenied, "Request is authenticated as another device").
+				WithDetail("device_id", *deviceID)
+		}
+	}
+
+	if *deviceID == "" {
+		if h.enrollment.Required {
+			return nil, apierror.New(apierror.DeviceNotEnrolled, "An enrolled device_id is required")
+		}
+		return nil, nil
+	}
+
+	device, err := h.storage.GetEdgeDevice(ctx, *deviceID)
+	if err != nil {
+		return nil, apierror.Wrap(apierror.Internal, err, "Failed to get edge device")
+	}
+	if device != nil && device.TenantID != tenantID {
+		log.Printf("[DEVICE] Device %s belongs to tenant %s, not %s", *deviceID, device.TenantID, tenantID)
+		return nil, apierror.New(apierror.DeviceAccessDenied, "Device belongs to another tenant").
+			WithDetail("device_id", *deviceID)
+	}
+
+	if h.enrollment.Required {
+		if device == nil || !device.Enrolled() {
+			log.Printf("[DEVICE] Refused unenrolled device %s", *deviceID)
+			return nil, apierror.New(apierror.DeviceNotEnrolled, "Device is not enrolled").
+				WithDetail("device_id", *deviceID)
+		}
+		if device.Status == models.DeviceStatusSuspended {
+			return nil, apierror.New(apierror.DeviceAccessDenied, "Device is suspended").
+				WithDetail("device_id", *deviceID)
+		}
+	}
+
+	return device, nil
+}
+
+// deviceCameraLimitReached reports whether a device with a camera quota has
+// used it up on cameras other than cameraID
+func (h *Handler) deviceCameraLimitReached(ctx context.Context, device *models.EdgeDevice, cameraID string) bool {
+	if device == nil || device.MaxCameras == nil || cameraID == "" {
+		return false
+	}
+
+	cameras, err := h.storage.GetCamerasByTenant(ctx, device.TenantID)
+	if err != nil {
+		log.Printf("[LICENSE] Error counting cameras for device %s: %v", device.DeviceID, err)
+		return false
+	}
+
+	count := 0
+	for _, c := range cameras {
+		if c.DeviceID == nil || *c.DeviceID != device.DeviceID || !c.IsValid {
+			continue
+		}
+		if c.CameraID == cameraID {
+			return false
+		}
+		count++
+	}
+	return count >= *device.MaxCameras
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+)
+
+// ndjsonMaxLineBytes caps a single NDJSON usage event line
+const ndjsonMaxLineBytes = 1 << 20
+
+// IngestConfig limits usage batch ingestion
+type IngestConfig struct {
+	MaxBatchEvents    int           // events accepted per request; 0 is unlimited
+	MaxBatchBytes     int64         // decoded size of a JSON batch body; 0 is unlimited
+	ChunkSize         int           // events persisted per storage write when streaming NDJSON
+	StreamReadTimeout time.Duration // read deadline for usage batch bodies, replacing the server ReadTimeout
+}
+
+// DefaultIngestConfig accepts up to 10,000 events or 32 MiB of JSON per
+// request, persisted 500 at a time, with five minutes to upload them
+func DefaultIngestConfig() IngestConfig {
+	return IngestConfig{
+		MaxBatchEvents:    10000,
+		MaxBatchBytes:     32 << 20,
+		ChunkSize:         500,
+		StreamReadTimeout: 5 * time.Minute,
+	}
+}
+
+// SetIngestConfig replaces the usage batch ingestion limits
+func (h *Handler) SetIngestConfig(config IngestConfig) {
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = DefaultIngestConfig().ChunkSize
+	}
+	h.ingest = config
+}
+
+// isNDJSON reports whether a request body is newline-delimited JSON
+func isNDJSON(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/x-ndjson" || mediaType == "application/ndjson")
+}
+
+// extendReadDeadline gives large usage uploads longer than the server-wide
+// ReadTimeout. Ignored by connections that don't support deadlines.
+func (h *Handler) extendReadDeadline(w http.ResponseWriter) {
+	if h.ingest.StreamReadTimeout <= 0 {
+		return
+	}
+	if err := http.NewResponseController(w).SetReadDeadline(time.Now().Add(h.ingest.StreamReadTimeout)); err != nil {
+		log.Printf("[USAGE] Could not extend read deadline: %v", err)
+	}
+}
+
+// errBatchTooLarge stops decoding a JSON batch once it has more events than
+// the maximum batch size
+var errBatchTooLarge = errors.New("batch exceeds maximum size")
+
+// decodeUsageBatch decodes a JSON usage batch one event at a time, so an
+// oversized batch is refused as soon as it passes max events (0 is
+// unlimited) rather than after it has been read into memory whole
+func decodeUsageBatch(body io.Reader, max int) ([]models.UsageEventInput, error) {
+	dec := json.NewDecoder(body)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+
+	var events []models.UsageEventInput
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key != "events" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// null leaves the batch empty, as it would decoding the whole body
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		if tok == nil {
+			continue
+		}
+		if d, ok := tok.(json.Delim); !ok || d != '[' {
+			return nil, fmt.Errorf("events must be an array")
+		}
+		for dec.More() {
+			if max > 0 && len(events) >= max {
+				return nil, errBatchTooLarge
+			}
+			var event models.UsageEventInput
+			if err := dec.Decode(&event); err != nil {
+				return nil, err
+			}
+			events = append(events, event)
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// expectDelim reads the next token, which must be the delimiter want
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("expected %q in usage batch", want)
+	}
+	return nil
+}
+
+// ingestUsageChunk validates, routes and persists one chunk of reported
+// events, adding the outcome to resp. offset is the index of the chunk's
+// first event in the request, used in error messages.
+func (h *Handler) ingestUsageChunk(ctx context.Context, inputs []models.UsageEventInput, offset int, resp *models.UsageBatchResponse) {
+	now := time.Now()
+	usageEvents := make([]models.UsageEvent, 0, len(inputs))
+	var rejected []string
+	for i, event := range inputs {
+		tenantID, authErr := middleware.ScopeTenant(ctx, event.TenantID)
+		if authErr != nil {
+			rejected = append(rejected, fmt.Sprintf("event %d: %s (tenant %s)", offset+i, authErr.Message, event.TenantID))
+			continue
+		}
+
+		// Handle event_time - FlexibleTime handles Unix timestamp strings
+		eventTime, err := h.resolveEventTime(event.EventTime, now)
+		if err != nil {
+			rejected = append(rejected, fmt.Sprintf("event %d: %v", offset+i, err))
+			continue
+		}
+
+		metadataJSON, _ := json.Marshal(event.Metadata)
+		usageEvents = append(usageEvents, models.UsageEvent{
+			TenantID:   tenantID,
+			EventType:  event.EventType,
+			ResourceID: event.ResourceID,
+			Quantity:   event.Quantity,
+			Unit:       event.Unit,
+			Metadata:   metadataJSON,
+			EventTime:  eventTime,
+		})
+	}
+	resp.RejectedCount += len(rejected)
+	resp.Errors = append(resp.Errors, rejected...)
+
+	// Late events for closed billing periods don't change history
+	usageEvents, held, adjusted, err := h.routeLateUsage(ctx, usageEvents, now)
+	if err == nil {
+		err = h.storage.SaveUsageEvents(ctx, usageEvents)
+	}
+	if err != nil {
+		log.Printf("[USAGE] Error saving events %d-%d: %v", offset, offset+len(inputs)-1, err)
+		resp.RejectedCount += len(inputs) - len(rejected)
+		resp.Errors = append(resp.Errors, fmt.Sprintf("events %d-%d: %v", offset, offset+len(inputs)-1, err))
+		return
+	}
+
+	h.applyWalletUsage(ctx, usageEvents)
+
+	resp.AcceptedCount += len(usageEvents)
+	resp.AdjustedCount += adjusted
+	for i := range held {
+		if err := h.storage.SaveHeldUsageEvent(ctx, &held[i]); err != nil {
+			log.Printf("[USAGE] Error holding late event: %v", err)
+			resp.RejectedCount++
+			resp.Errors = append(resp.Errors, err.Error())
+			continue
+		}
+		resp.HeldCount++
+	}
+}
+
+// UsageStream ingests usage events one at a time, persisting them in chunks
+// as they arrive. Events past the maximum batch size are rejected
+// individually. Shared by NDJSON uploads and the gRPC ReportUsage stream.
+type UsageStream struct {
+	h          *Handler
+	ctx        context.Context
+	chunk      []models.UsageEventInput
+	chunkStart int
+	count      int
+	resp       models.UsageBatchResponse
+}
+
+// NewUsageStream starts a usage stream
+func (h *Handler) NewUsageStream(ctx context.Context) *UsageStream {
+	return &UsageStream{
+		h:     h,
+		ctx:   ctx,
+		chunk: make([]models.UsageEventInput, 0, h.ingest.ChunkSize),
+		resp:  models.UsageBatchResponse{Errors: []string{}},
+	}
+}
+
+// next claims the next event index, rejecting it if the batch is full
+func (s *UsageStream) next() (int, bool) {
+	i := s.count
+	s.count++
+	if max := s.h.ingest.MaxBatchEvents; max > 0 && i >= max {
+		s.Reject(i, fmt.Errorf("exceeds maximum batch size of %d", max))
+		return i, false
+	}
+	return i, true
+}
+
+// Add queues an event, persisting the pending chunk once it is full
+func (s *UsageStream) Add(event models.UsageEventInput) {
+	i, ok := s.next()
+	if !ok {
+		return
+	}
+	if len(s.chunk) == 0 {
+		s.chunkStart = i
+	}
+	s.chunk = append(s.chunk, event)
+	if len(s.chunk) >= s.h.ingest.ChunkSize {
+		s.flush()
+	}
+}
+
+// AddInvalid counts an event that could not be decoded as rejected
+func (s *UsageStream) AddInvalid(err error) {
+	if i, ok := s.next(); ok {
+		s.Reject(i, err)
+	}
+}
+
+// Reject records event i as rejected
+func (s *UsageStream) Reject(i int, err error) {
+	s.resp.RejectedCount++
+	s.resp.Errors = append(s.resp.Errors, fmt.Sprintf("event %d: %v", i, err))
+}
+
+// Abort records that the stream failed after the events received so far.
+// Events after the failure point were never read, so they are not counted.
+func (s *UsageStream) Abort(err error) {
+	log.Printf("[USAGE] Usage stream aborted after %d events: %v", s.count, err)
+	s.resp.Errors = append(s.resp.Errors, fmt.Sprintf("stream aborted after %d events: %v", s.count, err))
+}
+
+// Count returns the number of events received
+func (s *UsageStream) Count() int {
+	return s.count
+}
+
+func (s *UsageStream) flush() {
+	if len(s.chunk) > 0 {
+		s.h.ingestUsageChunk(s.ctx, s.chunk, s.chunkStart, &s.resp)
+		s.chunk = s.chunk[:0]
+	}
+}
+
+// Close persists any pending events and returns the outcome
+func (s *UsageStream) Close() models.UsageBatchResponse {
+	s.flush()
+	return s.resp
+}
+
+// streamUsageBatch ingests an NDJSON body of usage events, one event per
+// line, persisting them in chunks as they are read
+func (h *Handler) streamUsageBatch(w http.ResponseWriter, r *http.Request) {
+	began := time.Now()
+	h.extendReadDeadline(w)
+
+	stream := h.NewUsageStream(r.Context())
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 64*1024), ndjsonMaxLineBytes)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\r') {
+			continue
+		}
+
+		var event models.UsageEventInput
+		if err := json.Unmarshal(line, &event); err != nil {
+			stream.AddInvalid(fmt.Errorf("invalid JSON: %v", err))
+			continue
+		}
+		stream.Add(event)
+	}
+	if err := scanner.Err(); err != nil {
+		stream.Abort(err)
+	}
+	resp := stream.Close()
+
+	log.Printf("[USAGE] NDJSON batch: %d events, %d accepted, %d rejected, %d held in %v",
+		stream.Count(), resp.AcceptedCount, resp.RejectedCount, resp.HeldCount, time.Since(began).Round(time.Millisecond))
+	respondJSON(w, resp)
+}
@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// Admin list endpoints are cursor-paginated: each page returns next_cursor,
+// which is passed back as cursor to fetch the following page, and is null on
+// the last page.
+
+// ListTenants returns a page of tenants, oldest first (admin). API keys are
+// left out; fetch a single tenant to see its key.
+func (h *Handler) ListTenants(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, limit, err := parsePageParams(query)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+	createdAfter, err := parseOptionalTime(query, "created_after")
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+	createdBefore, err := parseOptionalTime(query, "created_before")
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	tenants, err := h.storage.ListTenants(r.Context(), models.TenantListQuery{
+		Status:        query.Get("status"),
+		Plan:          query.Get("plan"),
+		CreatedAfter:  createdAfter,
+		CreatedBefore: createdBefore,
+		NameSearch:    query.Get("q"),
+		After:         after,
+		Limit:         limit + 1,
+	})
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list tenants"))
+		return
+	}
+
+	var next *string
+	if len(tenants) > limit {
+		tenants = tenants[:limit]
+		next = nextCursor(tenants[limit-1].CreatedAt, tenants[limit-1].ID)
+	}
+	if tenants == nil {
+		tenants = []models.Tenant{}
+	}
+	for i := range tenants {
+		tenants[i].APIKey = nil
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenants":     tenants,
+		"count":       len(tenants),
+		"next_cursor": next,
+	})
+}
+
+// ListSubscriptions returns a page of tenants' current subscriptions, oldest
+// first (admin)
+func (h *Handler) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, limit, err := parsePageParams(query)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+	expiringBefore, err := parseOptionalTime(query, "expiring_before")
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	subs, err := h.storage.ListSubscriptions(r.Context(), models.SubscriptionListQuery{
+		Plan:           query.Get("plan"),
+		Status:         query.Get("status"),
+		ExpiringBefore: expiringBefore,
+		After:          after,
+		Limit:          limit + 1,
+	})
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list subscriptions"))
+		return
+	}
+
+	var next *string
+	if len(subs) > limit {
+		subs = subs[:limit]
+		next = nextCursor(subs[limit-1].CreatedAt, subs[limit-1].ID)
+	}
+	if subs == nil {
+		subs = []models.Subscription{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"subscriptions": subs,
+		"count":         len(subs),
+		"next_cursor":   next,
+	})
+}
+
+// ListCameraLicenses returns a page of camera licenses, oldest first (admin)
+func (h *Handler) ListCameraLicenses(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	after, limit, err := parsePageParams(query)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+	validatedAfter, err := parseOptionalTime(query, "last_validated_after")
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+	validatedBefore, err := parseOptionalTime(query, "last_validated_before")
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	var isValid *bool
+	if v := query.Get("is_valid"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "is_valid must be true or false"))
+			return
+		}
+		isValid = &b
+	}
+
+	cameras, err := h.storage.ListCameraLicenses(r.Context(), models.CameraLicenseListQuery{
+		TenantID:            query.Get("tenant_id"),
+		Mode:                query.Get("mode"),
+		IsValid:             isValid,
+		LastValidatedAfter:  validatedAfter,
+		LastValidatedBefore: validatedBefore,
+		After:               after,
+		Limit:               limit + 1,
+	})
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list camera licenses"))
+		return
+	}
+
+	var next *string
+	if len(cameras) > limit {
+		cameras = cameras[:limit]
+		next = nextCursor(cameras[limit-1].CreatedAt, cameras[limit-1].ID)
+	}
+	if cameras == nil {
+		cameras = []models.CameraLicense{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"camera_licenses": cameras,
+		"count":           len(cameras),
+		"next_cursor":     next,
+	})
+}
+
+// parsePageParams reads the cursor and limit query parameters
+func parsePageParams(query url.Values) (*models.ListCursor, int, error) {
+	limit := models.DefaultListLimit
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > models.MaxListLimit {
+			return nil, 0, fmt.Errorf("limit must be between 1 and %d", models.MaxListLimit)
+		}
+		limit = n
+	}
+
+	var after *models.ListCursor
+	if v := query.Get("cursor"); v != "" {
+		c, err := models.ParseListCursor(v)
+		if err != nil {
+			return nil, 0, err
+		}
+		after = c
+	}
+	return after, limit, nil
+}
+
+// parseOptionalTime reads an optional RFC3339 query parameter
+func parseOptionalTime(query url.Values, name string) (*time.Time, error) {
+	v := query.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be RFC3339", name)
+	}
+	return &t, nil
+}
+
+func nextCursor(createdAt time.Time, id string) *string {
+	cursor := models.ListCursor{CreatedAt: createdAt, ID: id}.Encode()
+	return &cursor
+}
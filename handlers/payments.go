@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/payments"
+)
+
+// errNoPaymentMethod is returned when a tenant has no stored payment method to charge
+var errNoPaymentMethod = errors.New("tenant has no payment method on file")
+
+// SetPaymentProvider configures the payment integration and subscribes to
+// its asynchronous charge status updates
+func (h *Handler) SetPaymentProvider(provider payments.PaymentProvider) {
+	h.paymentProvider = provider
+	provider.OnStatusChange(func(ctx context.Context, event payments.StatusEvent) {
+		if err := h.applyChargeStatus(ctx, event); err != nil {
+			log.Printf("[PAYMENTS] Failed to apply status for charge %s: %v", event.ChargeID, err)
+		}
+	})
+}
+
+// ensurePaymentAccount returns the tenant's provider account, creating the
+// provider customer on first use
+func (h *Handler) ensurePaymentAccount(ctx context.Context, tenant *models.Tenant) (*models.PaymentAccount, error) {
+	account, err := h.storage.GetPaymentAccount(ctx, tenant.ID)
+	if err != nil {
+		return nil, err
+	}
+	if account != nil && account.Provider == h.paymentProvider.Name() {
+		return account, nil
+	}
+
+	customer := payments.Customer{Name: tenant.Name}
+	if tenant.Email != nil {
+		customer.Email = *tenant.Email
+	}
+	created, err := h.paymentProvider.CreateCustomer(ctx, customer)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	account = &models.PaymentAccount{
+		TenantID:   tenant.ID,
+		Provider:   h.paymentProvider.Name(),
+		CustomerID: created.ID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if err := h.storage.SavePaymentAccount(ctx, account); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[PAYMENTS] Created %s customer %s for tenant %s", account.Provider, account.CustomerID, tenant.ID)
+	return account, nil
+}
+
+// chargeTenant charges the tenant's stored payment method and records the
+// attempt against what it paid for. A declined charge is not an error; the
+// returned attempt carries the failed status. The attempt is saved as pending
+// before the provider is called, so a charge is never made without a record.
+func (h *Handler) chargeTenant(ctx context.Context, tenantID string, amount float64, description, referenceType string, referenceID *string) (*models.PaymentAttempt, error) {
+	if h.paymentProvider == nil {
+		return nil, errors.New("no payment provider configured")
+	}
+
+	account, err := h.storage.GetPaymentAccount(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if account == nil || account.PaymentMethodID == nil {
+		return nil, errNoPaymentMethod
+	}
+
+	now := time.Now()
+	attempt := &models.PaymentAttempt{
+		ID:            uuid.New().String(),
+		TenantID:      tenantID,
+		Provider:      h.paymentProvider.Name(),
+		Amount:        roundCurrency(amount),
+		Currency:      DefaultCurrency,
+		Status:        models.PaymentStatusPending,
+		Description:   description,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+
+	if sub, _ := h.storage.GetSubscription(ctx, tenantID); sub != nil {
+		attempt.SubscriptionID = &sub.ID
+	}
+
+	if err := h.storage.SavePaymentAttempt(ctx, attempt); err != nil {
+		return nil, err
+	}
+
+	result, err := h.paymentProvider.Charge(ctx, payments.ChargeRequest{
+		CustomerID:      account.CustomerID,
+		PaymentMethodID: *account.PaymentMethodID,
+		Amount:          attempt.Amount,
+		Currency:        attempt.Currency,
+		Description:     description,
+		IdempotencyKey:  attempt.ID,
+	})
+	if err != nil {
+		code, message := "provider_error", err.Error()
+		attempt.Status = models.PaymentStatusFailed
+		attempt.FailureCode = &code
+		attempt.FailureMessage = &message
+		attempt.UpdatedAt = time.Now()
+		if saveErr := h.storage.SavePaymentAttempt(ctx, attempt); saveErr != nil {
+			log.Printf("[PAYMENTS] Failed to record provider error on attempt %s: %v", attempt.ID, saveErr)
+		}
+		return nil, err
+	}
+
+	attempt.ProviderChargeID = &result.ID
+	attempt.Status = string(result.Status)
+	if result.FailureCode != "" {
+		attempt.FailureCode = &result.FailureCode
+		attempt.FailureMessage = &result.FailureMessage
+	}
+	attempt.UpdatedAt = time.Now()
+
+	if err := h.storage.SavePaymentAttempt(ctx, attempt); err != nil {
+		log.Printf("[PAYMENTS] Charge %s made but attempt %s not updated: %v", result.ID, attempt.ID, err)
+		return nil, err
+	}
+
+	log.Printf("[PAYMENTS] Charge attempt %s for tenant %s: %.2f %s (%s)",
+		attempt.ID, tenantID, attempt.Amount, attempt.Currency, attempt.Status)
+	return attempt, nil
+}
+
+// applyChargeStatus records an asynchronous status update from the provider
+func (h *Handler) applyChargeStatus(ctx context.Context, event payments.StatusEvent) error {
+	attempt, err := h.storage.GetPaymentAttemptByChargeID(ctx, h.paymentProvider.Name(), event.ChargeID)
+	if err != nil {
+		return err
+	}
+	if attempt == nil {
+		log.Printf("[PAYMENTS] Status update for unknown charge %s", event.ChargeID)
+		return nil
+	}
+
+	// Only pending charges settle. Succeeded, failed and refunded charges are
+	// final (refund states are owned by RefundPayment), so replayed or stale
+	// updates are ignored.
+	if attempt.Status != models.PaymentStatusPending {
+		log.Printf("[PAYMENTS] Ignoring %s update for charge %s, already %s", event.Status, event.ChargeID, attempt.Status)
+		return nil
+	}
+	if event.Status != payments.ChargeStatusSucceeded && event.Status != payments.ChargeStatusFailed {
+		return nil
+	}
+
+	attempt.Status = string(event.Status)
+	if event.FailureCode != "" {
+		attempt.FailureCode = &event.FailureCode
+		attempt.FailureMessage = &event.FailureMessage
+	}
+	attempt.UpdatedAt = time.Now()
+
+	if err := h.storage.SavePaymentAttempt(ctx, attempt); err != nil {
+		return err
+	}
+
+	log.Printf("[PAYMENTS] Charge %s for tenant %s is now %s", event.ChargeID, attempt.TenantID, attempt.Status)
+	if attempt.ReferenceType == walletTopUpReference {
+		_, err = h.settleWalletTopUp(ctx, attempt)
+		return err
+	}
+	if attempt.ReferenceType == billingCycleReference {
+		if err := h.settleBillingCycleCharge(ctx, attempt); err != nil {
+			log.Printf("[BILLING_CYCLE] Failed to settle charge %s: %v", attempt.ID, err)
+		}
+	}
+	h.handlePaymentResult(ctx, attempt)
+	return nil
+}
+
+// handlePaymentResult passes a settled payment to the dunning engine.
+// Wallet top-ups are credited on success and never enter dunning.
+func (h *Handler) handlePaymentResult(ctx context.Context, attempt *models.PaymentAttempt) {
+	if attempt.ReferenceType == walletTopUpReference {
+		return
+	}
+	if h.dunning == nil {
+		return
+	}
+	if err := h.dunning.HandlePaymentResult(ctx, attempt); err != nil {
+		log.Printf("[DUNNING] Failed to handle result of attempt %s: %v", attempt.ID, err)
+	}
+}
+
+// requirePaymentProvider responds with an error when no provider is configured
+func (h *Handler) requirePaymentProvider(w http.ResponseWriter, r *http.Request) bool {
+	if h.paymentProvider == nil {
+		respondError(w, r, apierror.New(apierror.FeatureDisabled, "No payment provider configured"))
+		return false
+	}
+	return true
+}
+
+// AttachPaymentMethod stores a payment method token for a tenant, creating
+// the provider customer if needed
+func (h *Handler) AttachPaymentMethod(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePaymentProvider(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.Token == "" {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "token is required"))
+		return
+	}
+
+	ctx := r.Context()
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	account, err := h.ensurePaymentAccount(ctx, tenant)
+	if err != nil {
+		log.Printf("[PAYMENTS] Failed to create customer for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.New(apierror.PaymentProviderError, "Failed to create payment customer"))
+		return
+	}
+
+	method, err := h.paymentProvider.AttachPaymentMethod(ctx, account.CustomerID, req.Token)
+	if err != nil {
+		log.Printf("[PAYMENTS] Failed to attach payment method for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.New(apierror.PaymentMethodRejected, "Failed to attach payment method"))
+		return
+	}
+
+	account.PaymentMethodID = &method.ID
+	account.CardBrand = &method.Brand
+	account.CardLast4 = &method.Last4
+	account.UpdatedAt = time.Now()
+
+	if err := h.storage.SavePaymentAccount(ctx, account); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to save payment account"))
+		return
+	}
+
+	log.Printf("[PAYMENTS] Attached payment method %s for tenant %s", method.ID, tenantID)
+	respondJSON(w, account)
+}
+
+// ChargeTenant creates a one-off charge against a tenant's payment method
+func (h *Handler) ChargeTenant(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePaymentProvider(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		Amount        float64 `json:"amount"`
+		Description   string  `json:"description"`
+		ReferenceType string  `json:"reference_type"`
+		ReferenceID   *string `json:"reference_id,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.Amount <= 0 {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "amount must be positive"))
+		return
+	}
+	if req.ReferenceType == "" {
+		req.ReferenceType = "manual"
+	}
+
+	attempt, err := h.chargeTenant(r.Context(), tenantID, req.Amount, req.Description, req.ReferenceType, req.ReferenceID)
+	if err == errNoPaymentMethod {
+		respondError(w, r, apierror.New(apierror.NoPaymentMethod, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Printf("[PAYMENTS] Charge failed for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.New(apierror.PaymentProviderError, "Failed to charge tenant"))
+		return
+	}
+
+	// Renewals charged against a subscription count towards its current period
+	if attempt.ReferenceType == billingCycleReference {
+		if err := h.settleBillingCycleCharge(r.Context(), attempt); err != nil {
+			log.Printf("[BILLING_CYCLE] Failed to settle charge %s: %v", attempt.ID, err)
+		}
+	}
+	h.handlePaymentResult(r.Context(), attempt)
+	respondJSON(w, attempt)
+}
+
+// GetPaymentAttempts lists payment attempts for a tenant
+func (h *Handler) GetPaymentAttempts(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	attempts, err := h.storage.GetPaymentAttemptsByTenant(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get payment attempts"))
+		return
+	}
+	if attempts == nil {
+		attempts = []models.PaymentAttempt{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id": tenantID,
+		"attempts":  attempts,
+	})
+}
+
+// refundAttempt refunds an amount of a payment attempt through the provider
+// and records the refunded total on the attempt. The refund result is
+// returned whenever money moved, even if recording it failed.
+func (h *Handler) refundAttempt(ctx context.Context, attempt *models.PaymentAttempt, amount float64) (*payments.RefundResult, error) {
+	if attempt.ProviderChargeID == nil {
+		return nil, errors.New("payment attempt has no provider charge")
+	}
+
+	result, err := h.paymentProvider.Refund(ctx, *attempt.ProviderChargeID, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	attempt.RefundedAmount = roundCurrency(attempt.RefundedAmount + result.Amount)
+	if attempt.RefundedAmount >= attempt.Amount {
+		attempt.Status = models.PaymentStatusRefunded
+	} else {
+		attempt.Status = models.PaymentStatusPartiallyRefunded
+	}
+	attempt.UpdatedAt = time.Now()
+
+	if err := h.storage.SavePaymentAttempt(ctx, attempt); err != nil {
+		return result, err
+	}
+
+	log.Printf("[PAYMENTS] Refunded %.2f of attempt %s (tenant %s)", result.Amount, attempt.ID, attempt.TenantID)
+	return result, nil
+}
+
+// RefundPayment refunds some or all of a succeeded payment attempt by issuing
+// a refund credit note against it
+func (h *Handler) RefundPayment(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePaymentProvider(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	attemptID := vars["id"]
+
+	var req struct {
+		Amount float64 `json:"amount"` // 0 refunds the remaining balance
+		Reason string  `json:"reason"`
+		Memo   *string `json:"memo,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = models.CreditReasonBillingError
+	}
+
+	ctx := r.Context()
+
+	attempt, err := h.storage.GetPaymentAttempt(ctx, attemptID)
+	if err != nil || attempt == nil {
+		respondError(w, r, apierror.New(apierror.PaymentNotFound, "Payment attempt not found"))
+		return
+	}
+
+	amount := req.Amount
+	if amount <= 0 {
+		amount = roundCurrency(attempt.Amount - attempt.RefundedAmount)
+	}
+
+	note := &models.CreditNote{
+		TenantID: attempt.TenantID,
+		Reason:   req.Reason,
+		Method:   models.CreditMethodRefund,
+		LineItems: []models.CreditNoteLineItem{{
+			Description:      "Refund of " + attempt.Description,
+			Amount:           amount,
+			PaymentAttemptID: &attempt.ID,
+		}},
+		Memo: req.Memo,
+	}
+
+	if err := h.issueCreditNote(ctx, note); err != nil {
+		log.Printf("[PAYMENTS] Refund failed for attempt %s: %v", attemptID, err)
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Refund failed: "+err.Error()))
+		return
+	}
+
+	payment, _ := h.storage.GetPaymentAttempt(ctx, attemptID)
+	respondJSON(w, map[string]interface{}{
+		"refunded_amount": note.Total,
+		"credit_note":     note,
+		"payment":         payment,
+	})
+}
+
+// PaymentWebhook receives asynchronous charge status callbacks from the provider
+func (h *Handler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if !h.requirePaymentProvider(w, r) {
+		return
+	}
+
+	event, err := h.paymentProvider.ParseWebhook(r)
+	if err != nil {
+		log.Printf("[PAYMENTS] Rejected webhook: %v", err)
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "Invalid webhook"))
+		return
+	}
+
+	if err := h.applyChargeStatus(r.Context(), *event); err != nil {
+		log.Printf("[PAYMENTS] Failed to apply webhook for charge %s: %v", event.ChargeID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to process webhook"))
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{"received": true})
+}
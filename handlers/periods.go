@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// closedPeriodFor returns the closed period containing t, if any
+func closedPeriodFor(periods []models.BillingPeriod, t time.Time) *models.BillingPeriod {
+	for i := range periods {
+		if periods[i].Contains(t) {
+			return &periods[i]
+		}
+	}
+	return nil
+}
+
+// adjustLateEvent moves a late event for a closed period to now, labelling it
+// with where it came from so it shows up as an adjustment on the current bill
+func adjustLateEvent(e models.UsageEvent, period *models.BillingPeriod, now time.Time) models.UsageEvent {
+	metadata := make(map[string]interface{})
+	if len(e.Metadata) > 0 {
+		json.Unmarshal(e.Metadata, &metadata)
+		if metadata == nil {
+			metadata = make(map[string]interface{})
+		}
+	}
+	metadata[models.AdjustmentMetadataKey] = true
+	metadata[models.AdjustmentOriginalTimeKey] = e.EventTime.UTC().Format(time.RFC3339)
+	metadata[models.AdjustmentClosedPeriodIDKey] = period.ID
+
+	e.Metadata, _ = json.Marshal(metadata)
+	e.EventTime = now
+	return e
+}
+
+// routeLateUsage checks incoming events against their tenants' closed
+// billing periods. Events for a closed period come back as adjustments dated
+// now; events for a locked period are returned separately to be held.
+func (h *Handler) routeLateUsage(ctx context.Context, events []models.UsageEvent, now time.Time) ([]models.UsageEvent, []models.HeldUsageEvent, int, error) {
+	periodsByTenant := make(map[string][]models.BillingPeriod)
+	accepted := make([]models.UsageEvent, 0, len(events))
+	var held []models.HeldUsageEvent
+	adjusted := 0
+
+	for _, e := range events {
+		periods, ok := periodsByTenant[e.TenantID]
+		if !ok {
+			var err error
+			periods, err = h.storage.GetBillingPeriods(ctx, e.TenantID)
+			if err != nil {
+				return nil, nil, 0, fmt.Errorf("failed to get billing periods: %w", err)
+			}
+			periodsByTenant[e.TenantID] = periods
+		}
+
+		period := closedPeriodFor(periods, e.EventTime)
+		switch {
+		case period == nil:
+			accepted = append(accepted, e)
+		case period.Status == models.BillingPeriodLocked:
+			held = append(held, models.HeldUsageEvent{
+				ID:         uuid.New().String(),
+				TenantID:   e.TenantID,
+				PeriodID:   period.ID,
+				Event:      e,
+				Status:     models.HeldUsagePending,
+				ReceivedAt: now,
+			})
+		default:
+			accepted = append(accepted, adjustLateEvent(e, period, now))
+			adjusted++
+		}
+	}
+
+	if adjusted > 0 || len(held) > 0 {
+		log.Printf("[PERIODS] Late usage: %d adjusted into the current period, %d held for review", adjusted, len(held))
+	}
+	return accepted, held, adjusted, nil
+}
+
+// GetBillingPeriods lists a tenant's closed billing periods (admin)
+func (h *Handler) GetBillingPeriods(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	periods, err := h.storage.GetBillingPeriods(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get billing periods"))
+		return
+	}
+	if periods == nil {
+		periods = []models.BillingPeriod{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id": tenantID,
+		"periods":   periods,
+	})
+}
+
+// CloseBillingPeriod closes a tenant's billing period to further usage,
+// snapshotting its usage totals. Defaults to the previous period.
+func (h *Handler) CloseBillingPeriod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		At   *time.Time `json:"at,omitempty"`   // any time within the period
+		Lock bool       `json:"lock,omitempty"` // hold late usage for review instead of adjusting
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, apierror.InvalidBody(err))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	at := req.At
+	if at == nil {
+		currentStart, _ := h.usagePeriod(ctx, tenantID, now)
+		previous := currentStart.Add(-time.Nanosecond)
+		at = &previous
+	}
+	start, end := h.usagePeriod(ctx, tenantID, *at)
+	if end.After(now) {
+		respondError(w, r, apierror.New(apierror.PeriodNotEnded, "Billing period has not ended yet"))
+		return
+	}
+
+	periods, err := h.storage.GetBillingPeriods(ctx, tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get billing periods"))
+		return
+	}
+	for _, p := range periods {
+		if p.PeriodStart.Before(end) && start.Before(p.PeriodEnd) {
+			respondError(w, r, apierror.Newf(apierror.PeriodAlreadyClosed, "Billing period is already %s", p.Status))
+			return
+		}
+	}
+
+	totals, err := h.storage.GetUsageSummary(ctx, tenantID, start, end)
+	if err != nil {
+		log.Printf("[PERIODS] Error getting usage for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get usage summary"))
+		return
+	}
+
+	period := &models.BillingPeriod{
+		ID:          uuid.New().String(),
+		TenantID:    tenantID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Status:      models.BillingPeriodClosed,
+		UsageTotals: totals,
+		ClosedBy:    actingAdminID(r),
+		ClosedAt:    now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if req.Lock {
+		period.Status = models.BillingPeriodLocked
+		period.LockedAt = &now
+	}
+
+	if err := h.storage.SaveBillingPeriod(ctx, period); err != nil {
+		log.Printf("[PERIODS] Error saving billing period for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to close billing period"))
+		return
+	}
+
+	log.Printf("[PERIODS] %s billing period %s - %s for tenant %s",
+		period.Status, start.Format(time.RFC3339), end.Format(time.RFC3339), tenantID)
+	respondJSON(w, period)
+}
+
+// LockBillingPeriod locks a closed billing period so late usage for it is
+// held for review rather than adjusted into the current period (admin)
+func (h *Handler) LockBillingPeriod(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+	periodID := vars["periodId"]
+	ctx := r.Context()
+
+	period, err := h.storage.GetBillingPeriod(ctx, periodID)
+	if err != nil || period == nil || period.TenantID != tenantID {
+		respondError(w, r, apierror.New(apierror.BillingPeriodNotFound, "Billing period not found"))
+		return
+	}
+
+	if period.Status != models.BillingPeriodLocked {
+		now := time.Now()
+		period.Status = models.BillingPeriodLocked
+		period.LockedAt = &now
+		period.UpdatedAt = now
+		if err := h.storage.SaveBillingPeriod(ctx, period); err != nil {
+			respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to lock billing period"))
+			return
+		}
+		log.Printf("[PERIODS] Locked billing period %s for tenant %s", period.ID, tenantID)
+	}
+
+	respondJSON(w, period)
+}
+
+// GetHeldUsage lists late usage events held for review (admin). Defaults to
+// pending events for every tenant.
+func (h *Handler) GetHeldUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	tenantID := query.Get("tenant_id")
+	status := query.Get("status")
+	if status == "" {
+		status = models.HeldUsagePending
+	} else if status == "all" {
+		status = ""
+	}
+
+	held, err := h.storage.GetHeldUsageEvents(r.Context(), tenantID, status)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get held usage"))
+		return
+	}
+	if held == nil {
+		held = []models.HeldUsageEvent{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"held_events": held,
+		"count":       len(held),
+	})
+}
+
+// ReleaseHeldUsage accepts a held event as an adjustment to the tenant's
+// current period (admin)
+func (h *Handler) ReleaseHeldUsage(w http.ResponseWriter, r *http.Request) {
+	h.reviewHeldUsage(w, r, models.HeldUsageReleased)
+}
+
+// RejectHeldUsage discards a held event (admin)
+func (h *Handler) RejectHeldUsage(w http.ResponseWriter, r *http.Request) {
+	h.reviewHeldUsage(w, r, models.HeldUsageRejected)
+}
+
+func (h *Handler) reviewHeldUsage(w http.ResponseWriter, r *http.Request, status string) {
+	vars := mux.Vars(r)
+	heldID := vars["heldId"]
+
+	var req struct {
+		Note *string `json:"note,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, apierror.InvalidBody(err))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	now := time.Now()
+
+	held, err := h.storage.GetHeldUsageEvent(ctx, heldID)
+	if err != nil || held == nil {
+		respondError(w, r, apierror.New(apierror.HeldUsageNotFound, "Held usage event not found"))
+		return
+	}
+	if held.Status != models.HeldUsagePending {
+		respondError(w, r, apierror.Newf(apierror.AlreadyReviewed, "Held usage event is already %s", held.Status))
+		return
+	}
+
+	var events []models.UsageEvent
+	if status == models.HeldUsageReleased {
+		period, err := h.storage.GetBillingPeriod(ctx, held.PeriodID)
+		if err != nil || period == nil {
+			respondError(w, r, apierror.New(apierror.Internal, "Failed to get billing period"))
+			return
+		}
+		events = []models.UsageEvent{adjustLateEvent(held.Event, period, now)}
+	}
+
+	reviewed := *held
+	reviewed.Status = status
+	reviewed.ReviewedBy = actingAdminID(r)
+	reviewed.ReviewedAt = &now
+	reviewed.Note = req.Note
+
+	// The status change and the released usage commit together, and only
+	// while the event is still pending, so concurrent reviews count it once
+	ok, err := h.storage.ReviewHeldUsageEvent(ctx, &reviewed, events)
+	if err != nil {
+		log.Printf("[PERIODS] Error reviewing held usage %s: %v", held.ID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to update held usage"))
+		return
+	}
+	if !ok {
+		respondError(w, r, apierror.New(apierror.AlreadyReviewed, "Held usage event is already reviewed"))
+		return
+	}
+	held = &reviewed
+	if len(events) > 0 {
+		h.applyWalletUsage(ctx, events)
+	}
+
+	log.Printf("[PERIODS] Held usage %s for tenant %s %s", held.ID, held.TenantID, status)
+	respondJSON(w, held)
+}
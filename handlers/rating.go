@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/rating"
+)
+
+// SetPriceBook replaces the prices used to rate metered usage
+func (h *Handler) SetPriceBook(book rating.PriceBook) {
+	h.rating = rating.NewEngine(book, DefaultCurrency)
+}
+
+// usagePeriod returns the tenant's current billing period, or the current
+// calendar month when the tenant has no subscription
+func (h *Handler) usagePeriod(ctx context.Context, tenantID string, now time.Time) (time.Time, time.Time) {
+	sub, _ := h.storage.GetSubscription(ctx, tenantID)
+	if sub != nil {
+		return currentBillingPeriod(sub, now)
+	}
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	return start, start.AddDate(0, 1, 0)
+}
+
+// ratedUsage prices a tenant's usage totals for a period
+func (h *Handler) ratedUsage(ctx context.Context, tenantID string, start, end time.Time) (*models.RatedUsage, error) {
+	summary, err := h.storage.GetUsageSummary(ctx, tenantID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	return h.rating.Rate(tenantID, start, end, summary), nil
+}
+
+// marginalUsageCost prices newly saved usage events against what the tenant
+// used before them in their billing period, so tiers carry across batches.
+// Each period the events fall in is priced separately, and prior usage is
+// counted by event time, so late and concurrent batches land on the right
+// tier and never count themselves.
+//
+// Charges are final once made: a late event is priced at the tier its event
+// time reaches, but the events after it, already charged, are not repriced
+// against the higher prior total. Drawdowns can therefore differ from the
+// period's rated usage (GetRatedUsage), which prices the period totals and
+// is what the period is billed on.
+func (h *Handler) marginalUsageCost(ctx context.Context, tenantID, eventType string, events []models.UsageEvent) (float64, error) {
+	sorted := make([]models.UsageEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].EventTime.Before(sorted[j].EventTime)
+	})
+
+	var cost float64
+	for i := 0; i < len(sorted); {
+		first := sorted[i].EventTime
+		start, end := h.usagePeriod(ctx, tenantID, first)
+
+		var quantity float64
+		for ; i < len(sorted) && sorted[i].EventTime.Before(end); i++ {
+			quantity += sorted[i].Quantity
+		}
+
+		// Usage summaries include their end time, so stop just short of the
+		// batch's first event in the period
+		var prior float64
+		if first.After(start) {
+			summary, err := h.storage.GetUsageSummary(ctx, tenantID, start, first.Add(-time.Nanosecond))
+			if err != nil {
+				return 0, err
+			}
+			prior = summary[eventType]
+		}
+		cost += h.rating.MarginalAmount(eventType, prior, quantity)
+	}
+	return cost, nil
+}
+
+// GetRatedUsage returns a tenant's priced usage charges for billing.
+// Defaults to the tenant's current billing period.
+func (h *Handler) GetRatedUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+	ctx := r.Context()
+
+	start, end := h.usagePeriod(ctx, tenantID, time.Now())
+
+	query := r.URL.Query()
+	if v := query.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "start must be RFC3339"))
+			return
+		}
+		start = t
+	}
+	if v := query.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "end must be RFC3339"))
+			return
+		}
+		end = t
+	}
+	if !end.After(start) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "end must be after start"))
+		return
+	}
+
+	rated, err := h.ratedUsage(ctx, tenantID, start, end)
+	if err != nil {
+		log.Printf("[RATING] Error rating usage for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to rate usage"))
+		return
+	}
+
+	respondJSON(w, rated)
+}
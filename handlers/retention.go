@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/retention"
+)
+
+// EnableRetention creates the manager that partitions and archives usage
+// events. The caller runs the returned manager's worker.
+func (h *Handler) EnableRetention(config retention.Config) *retention.Manager {
+	h.retention = retention.NewManager(config, h.storage)
+	return h.retention
+}
+
+// requireRetention responds with an error when usage retention is not enabled
+func (h *Handler) requireRetention(w http.ResponseWriter, r *http.Request) bool {
+	if h.retention == nil {
+		respondError(w, r, apierror.New(apierror.FeatureDisabled, "Usage retention is not enabled"))
+		return false
+	}
+	return true
+}
+
+// GetUsageArchives lists archived usage files (admin)
+func (h *Handler) GetUsageArchives(w http.ResponseWriter, r *http.Request) {
+	if !h.requireRetention(w, r) {
+		return
+	}
+
+	archives, err := h.retention.Archives()
+	if err != nil {
+		log.Printf("[RETENTION] Error listing archives: %v", err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to list usage archives"))
+		return
+	}
+
+	config := h.retention.Config()
+	respondJSON(w, map[string]interface{}{
+		"retention_days": config.RetentionDays,
+		"archives":       archives,
+		"count":          len(archives),
+	})
+}
+
+// ArchiveUsage archives a single month of usage events, or runs the retention
+// pass over every expired month when no month is given (admin)
+func (h *Handler) ArchiveUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.requireRetention(w, r) {
+		return
+	}
+
+	var req struct {
+		Month string `json:"month,omitempty"` // YYYY-MM
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, apierror.InvalidBody(err))
+			return
+		}
+	}
+
+	var archives []retention.Archive
+	if req.Month != "" {
+		month, err := retention.ParseMonth(req.Month)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+			return
+		}
+		current := time.Now().UTC()
+		if !month.Before(time.Date(current.Year(), current.Month(), 1, 0, 0, 0, 0, time.UTC)) {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "Only past months can be archived"))
+			return
+		}
+
+		archive, err := h.retention.ArchiveMonth(r.Context(), month)
+		if err != nil {
+			log.Printf("[RETENTION] Error archiving %s: %v", req.Month, err)
+			respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to archive usage"))
+			return
+		}
+		if archive != nil {
+			archives = append(archives, *archive)
+		}
+	} else {
+		var err error
+		archives, err = h.retention.RunOnce(r.Context(), time.Now())
+		if err != nil {
+			log.Printf("[RETENTION] Error applying retention: %v", err)
+			respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to archive usage"))
+			return
+		}
+	}
+
+	if archives == nil {
+		archives = []retention.Archive{}
+	}
+	respondJSON(w, map[string]interface{}{
+		"archived": archives,
+		"count":    len(archives),
+	})
+}
+
+// RestoreUsage re-imports archived months of usage events (admin)
+func (h *Handler) RestoreUsage(w http.ResponseWriter, r *http.Request) {
+	if !h.requireRetention(w, r) {
+		return
+	}
+
+	var req struct {
+		From string `json:"from"` // YYYY-MM
+		To   string `json:"to"`   // YYYY-MM, defaults to from
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.To == "" {
+		req.To = req.From
+	}
+
+	from, err := retention.ParseMonth(req.From)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "from: "+err.Error()))
+		return
+	}
+	to, err := retention.ParseMonth(req.To)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "to: "+err.Error()))
+		return
+	}
+	if to.Before(from) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "to must not be before from"))
+		return
+	}
+
+	result, err := h.retention.Restore(r.Context(), from, to)
+	if err != nil {
+		log.Printf("[RETENTION] Error restoring %s..%s: %v", req.From, req.To, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to restore usage"))
+		return
+	}
+
+	respondJSON(w, result)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// RevenueReport summarises collected revenue net of refunds and credit notes
+type RevenueReport struct {
+	PeriodStart     string  `json:"period_start"`
+	PeriodEnd       string  `json:"period_end"`
+	GrossCollected  float64 `json:"gross_collected"`
+	Refunded        float64 `json:"refunded"`
+	AccountCredited float64 `json:"account_credited"`
+	NetRevenue      float64 `json:"net_revenue"`
+	PaymentCount    int     `json:"payment_count"`
+	CreditNoteCount int     `json:"credit_note_count"`
+	Currency        string  `json:"currency"`
+}
+
+// GetRevenueReport returns revenue for a period, including credit notes (admin endpoint)
+func (h *Handler) GetRevenueReport(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	start := time.Now().AddDate(0, -1, 0)
+	if v := query.Get("start"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			start = t
+		}
+	}
+	end := time.Now()
+	if v := query.Get("end"); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			end = t
+		}
+	}
+
+	attempts, err := h.storage.GetPaymentAttemptsInRange(ctx, start, end)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get payments"))
+		return
+	}
+	notes, err := h.storage.GetCreditNotesInRange(ctx, start, end)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get credit notes"))
+		return
+	}
+
+	report := RevenueReport{
+		PeriodStart: start.Format(time.RFC3339),
+		PeriodEnd:   end.Format(time.RFC3339),
+		Currency:    DefaultCurrency,
+	}
+
+	for _, attempt := range attempts {
+		switch attempt.Status {
+		case models.PaymentStatusSucceeded, models.PaymentStatusRefunded, models.PaymentStatusPartiallyRefunded:
+			report.GrossCollected += attempt.Amount
+			report.PaymentCount++
+		}
+	}
+
+	// Refunds are counted from credit notes so each one is reported once, in the period it was issued
+	for _, note := range notes {
+		switch note.Status {
+		case models.CreditNoteStatusRefunded:
+			report.Refunded += note.Total
+		case models.CreditNoteStatusPartiallyRefunded:
+			report.Refunded += note.Refunded()
+		case models.CreditNoteStatusCredited:
+			report.AccountCredited += note.Total
+		default:
+			continue
+		}
+		report.CreditNoteCount++
+	}
+
+	report.GrossCollected = roundCurrency(report.GrossCollected)
+	report.Refunded = roundCurrency(report.Refunded)
+	report.AccountCredited = roundCurrency(report.AccountCredited)
+	report.NetRevenue = roundCurrency(report.GrossCollected - report.Refunded - report.AccountCredited)
+
+	respondJSON(w, report)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"brinkbyte-billing-server/models"
+)
+
+// Reasons a usage event's timestamp is rejected, as counted in stats
+const (
+	timestampRejectInvalid = "invalid"
+	timestampRejectFuture  = "too_far_future"
+	timestampRejectPast    = "too_far_past"
+)
+
+// TimestampPolicy controls how usage event timestamps are validated
+type TimestampPolicy struct {
+	Strict        bool          // reject unparseable timestamps instead of using the receive time
+	MaxFutureSkew time.Duration // reject events further ahead of the server clock; 0 disables
+	MaxAge        time.Duration // reject events older than this; 0 disables
+}
+
+// DefaultTimestampPolicy keeps lenient parsing and rejects events more than
+// 15 minutes in the future
+func DefaultTimestampPolicy() TimestampPolicy {
+	return TimestampPolicy{
+		Strict:        false,
+		MaxFutureSkew: 15 * time.Minute,
+	}
+}
+
+// SetTimestampPolicy replaces the usage event timestamp policy
+func (h *Handler) SetTimestampPolicy(policy TimestampPolicy) {
+	h.timestampPolicy = policy
+}
+
+// timestampStats counts usage event timestamp formats and rejections
+type timestampStats struct {
+	mu       sync.Mutex
+	formats  map[string]int64
+	rejected map[string]int64
+}
+
+func newTimestampStats() *timestampStats {
+	return &timestampStats{
+		formats:  make(map[string]int64),
+		rejected: make(map[string]int64),
+	}
+}
+
+func (s *timestampStats) record(format, rejectReason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.formats[format]++
+	if rejectReason != "" {
+		s.rejected[rejectReason]++
+	}
+}
+
+// snapshot returns copies of the format and rejection counters
+func (s *timestampStats) snapshot() (map[string]int64, map[string]int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	formats := make(map[string]int64, len(s.formats))
+	for k, v := range s.formats {
+		formats[k] = v
+	}
+	rejected := make(map[string]int64, len(s.rejected))
+	for k, v := range s.rejected {
+		rejected[k] = v
+	}
+	return formats, rejected
+}
+
+// resolveEventTime applies the timestamp policy to a reported event time.
+// Missing times, and unparseable ones outside strict mode, become now.
+func (h *Handler) resolveEventTime(ft models.FlexibleTime, now time.Time) (time.Time, error) {
+	format := ft.Format
+	if format == "" {
+		format = models.TimeFormatMissing
+	}
+	policy := h.timestampPolicy
+
+	t := ft.Time
+	var err error
+	reason := ""
+	switch {
+	case ft.Err != nil && policy.Strict:
+		reason = timestampRejectInvalid
+		err = fmt.Errorf("invalid event_time: %v", ft.Err)
+	case ft.Err != nil || t.IsZero():
+		t = now
+	case policy.MaxFutureSkew > 0 && t.Sub(now) > policy.MaxFutureSkew:
+		reason = timestampRejectFuture
+		err = fmt.Errorf("event_time %s is more than %v in the future", t.UTC().Format(time.RFC3339), policy.MaxFutureSkew)
+	case policy.MaxAge > 0 && now.Sub(t) > policy.MaxAge:
+		reason = timestampRejectPast
+		err = fmt.Errorf("event_time %s is more than %v in the past", t.UTC().Format(time.RFC3339), policy.MaxAge)
+	}
+
+	h.timestampStats.record(format, reason)
+	return t, err
+}
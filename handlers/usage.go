@@ -0,0 +1,470 @@
+package handlers
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// MaxTimeSeriesBuckets caps the number of buckets in one time-series response
+const MaxTimeSeriesBuckets = 1000
+
+// tenantLocation returns the tenant's reporting timezone, defaulting to UTC
+func (h *Handler) tenantLocation(ctx context.Context, tenantID string) *time.Location {
+	tenant, _ := h.storage.GetTenant(ctx, tenantID)
+	if tenant == nil || tenant.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(tenant.Timezone)
+	if err != nil {
+		log.Printf("[USAGE] Tenant %s has invalid timezone %q, using UTC", tenantID, tenant.Timezone)
+		return time.UTC
+	}
+	return loc
+}
+
+// defaultTimeSeriesRange returns the range charted when none is given
+func defaultTimeSeriesRange(granularity string, now time.Time) time.Time {
+	switch granularity {
+	case models.GranularityMonth:
+		return now.AddDate(-1, 0, 0)
+	case models.GranularityDay:
+		return now.AddDate(0, 0, -30)
+	}
+	return now.Add(-24 * time.Hour)
+}
+
+// GetUsageTimeSeries returns a tenant's usage bucketed by hour, day or month
+// in the tenant's timezone, one zero-filled series per event type
+func (h *Handler) GetUsageTimeSeries(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+	ctx := r.Context()
+
+	query := r.URL.Query()
+	granularity := query.Get("granularity")
+	if granularity == "" {
+		granularity = models.GranularityDay
+	}
+	if granularity != models.GranularityHour && granularity != models.GranularityDay && granularity != models.GranularityMonth {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "granularity must be hour, day or month"))
+		return
+	}
+	eventType := query.Get("event_type")
+
+	loc := h.tenantLocation(ctx, tenantID)
+	now := time.Now().In(loc)
+
+	end := now
+	if v := query.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "end must be RFC3339"))
+			return
+		}
+		end = t.In(loc)
+	}
+	start := defaultTimeSeriesRange(granularity, end)
+	if v := query.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, "start must be RFC3339"))
+			return
+		}
+		start = t.In(loc)
+	}
+	if !end.After(start) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "end must be after start"))
+		return
+	}
+
+	// Lay out the buckets covering [start, end) before touching storage
+	var bucketStarts []time.Time
+	for b := models.UsageBucketStart(start, granularity, loc); b.Before(end); b = models.NextUsageBucket(b, granularity) {
+		if len(bucketStarts) == MaxTimeSeriesBuckets {
+			respondError(w, r, apierror.Newf(apierror.InvalidRequest,
+				"range has more than %d %s buckets; narrow it or use a coarser granularity", MaxTimeSeriesBuckets, granularity).
+				WithDetail("max_buckets", MaxTimeSeriesBuckets))
+			return
+		}
+		bucketStarts = append(bucketStarts, b)
+	}
+	rangeStart := bucketStarts[0]
+	rangeEnd := models.NextUsageBucket(bucketStarts[len(bucketStarts)-1], granularity)
+
+	buckets, err := h.storage.GetUsageTimeSeries(ctx, tenantID, eventType, rangeStart, rangeEnd, granularity, loc)
+	if err != nil {
+		log.Printf("[USAGE] Error getting time series for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get usage time series"))
+		return
+	}
+
+	// Zero-fill every series over the same buckets
+	index := make(map[int64]int, len(bucketStarts))
+	for i, b := range bucketStarts {
+		index[b.Unix()] = i
+	}
+	seriesByType := make(map[string]*models.UsageSeries)
+	var eventTypes []string
+	if eventType != "" {
+		eventTypes = append(eventTypes, eventType)
+	}
+	newSeries := func(et string) *models.UsageSeries {
+		series := &models.UsageSeries{EventType: et, Points: make([]models.UsagePoint, len(bucketStarts))}
+		for i, b := range bucketStarts {
+			series.Points[i].BucketStart = b
+		}
+		return series
+	}
+	for _, et := range eventTypes {
+		seriesByType[et] = newSeries(et)
+	}
+	for _, b := range buckets {
+		i, ok := index[b.BucketStart.Unix()]
+		if !ok {
+			continue // an event exactly at rangeEnd
+		}
+		series, ok := seriesByType[b.EventType]
+		if !ok {
+			series = newSeries(b.EventType)
+			seriesByType[b.EventType] = series
+			eventTypes = append(eventTypes, b.EventType)
+		}
+		series.Points[i].Quantity += b.Quantity
+		series.Total += b.Quantity
+	}
+	sort.Strings(eventTypes)
+
+	series := make([]models.UsageSeries, 0, len(eventTypes))
+	for _, et := range eventTypes {
+		series = append(series, *seriesByType[et])
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":   tenantID,
+		"granularity": granularity,
+		"timezone":    loc.String(),
+		"start":       rangeStart.Format(time.RFC3339),
+		"end":         rangeEnd.Format(time.RFC3339),
+		"buckets":     len(bucketStarts),
+		"series":      series,
+	})
+}
+
+// SetUsageMetadataKeys sets which metadata keys usage can be grouped and filtered by
+func (h *Handler) SetUsageMetadataKeys(keys []string) {
+	h.metadataKeys = nil
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			h.metadataKeys = append(h.metadataKeys, key)
+		}
+	}
+}
+
+// isUsageMetadataKey reports whether usage can be broken down by a metadata key
+func (h *Handler) isUsageMetadataKey(key string) bool {
+	for _, k := range h.metadataKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// parseUsageRange reads start and end query parameters, defaulting to the last month
+func parseUsageRange(r *http.Request) (time.Time, time.Time, error) {
+	end := time.Now()
+	start := end.AddDate(0, -1, 0)
+
+	query := r.URL.Query()
+	if v := query.Get("start"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return start, end, fmt.Errorf("start must be RFC3339")
+		}
+		start = t
+	}
+	if v := query.Get("end"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return start, end, fmt.Errorf("end must be RFC3339")
+		}
+		end = t
+	}
+	if !end.After(start) {
+		return start, end, fmt.Errorf("end must be after start")
+	}
+	return start, end, nil
+}
+
+// GetUsageBreakdown groups a tenant's usage by event type, resource and
+// metadata keys, e.g. ?group_by=resource_id,metadata.camera_id&event_type=llm_tokens.
+// resource_id and metadata.<key> query parameters filter the usage.
+func (h *Handler) GetUsageBreakdown(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+	ctx := r.Context()
+
+	start, end, err := parseUsageRange(r)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	query := r.URL.Query()
+	q := models.UsageBreakdownQuery{
+		TenantID:        tenantID,
+		Start:           start,
+		End:             end,
+		EventType:       query.Get("event_type"),
+		ResourceID:      query.Get("resource_id"),
+		MetadataFilters: make(map[string]string),
+		Limit:           100,
+	}
+
+	if v := query.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 1000 {
+			q.Limit = n
+		}
+	}
+
+	groupBy := query.Get("group_by")
+	if groupBy == "" {
+		groupBy = models.DimensionResourceID
+	}
+	seen := make(map[string]bool)
+	for _, dim := range strings.Split(groupBy, ",") {
+		dim = strings.TrimSpace(dim)
+		if dim == "" || seen[dim] {
+			continue
+		}
+		if dim != models.DimensionEventType && dim != models.DimensionResourceID &&
+			!(strings.HasPrefix(dim, models.DimensionMetadataPrefix) && h.isUsageMetadataKey(strings.TrimPrefix(dim, models.DimensionMetadataPrefix))) {
+			respondError(w, r, apierror.Newf(apierror.InvalidRequest, "cannot group by %q; allowed: event_type, resource_id, metadata.{%s}",
+				dim, strings.Join(h.metadataKeys, ",")))
+			return
+		}
+		seen[dim] = true
+		q.GroupBy = append(q.GroupBy, dim)
+	}
+
+	for param, values := range query {
+		if !strings.HasPrefix(param, models.DimensionMetadataPrefix) || len(values) == 0 {
+			continue
+		}
+		key := strings.TrimPrefix(param, models.DimensionMetadataPrefix)
+		if !h.isUsageMetadataKey(key) {
+			respondError(w, r, apierror.Newf(apierror.InvalidRequest, "cannot filter by metadata key %q", key))
+			return
+		}
+		q.MetadataFilters[key] = values[0]
+	}
+
+	rows, err := h.storage.GetUsageBreakdown(ctx, q)
+	if err != nil {
+		log.Printf("[USAGE] Error getting breakdown for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get usage breakdown"))
+		return
+	}
+
+	// Attribute each event type's rated charge to its groups by quantity share
+	if seen[models.DimensionEventType] || q.EventType != "" {
+		rated, err := h.ratedUsage(ctx, tenantID, start, end)
+		if err == nil {
+			charges := make(map[string]models.RatedCharge)
+			for _, c := range rated.Charges {
+				charges[c.EventType] = c
+			}
+			for i := range rows {
+				eventType := q.EventType
+				if eventType == "" {
+					eventType = rows[i].Dimensions[models.DimensionEventType]
+				}
+				if c, ok := charges[eventType]; ok && c.Quantity > 0 {
+					amount := roundCurrency(c.Amount * rows[i].Quantity / c.Quantity)
+					rows[i].Amount = &amount
+				}
+			}
+		}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":    tenantID,
+		"period_start": start.Format(time.RFC3339),
+		"period_end":   end.Format(time.RFC3339),
+		"group_by":     q.GroupBy,
+		"filters":      q.MetadataFilters,
+		"rows":         rows,
+	})
+}
+
+// Usage export formats
+const (
+	ExportFormatNDJSON = "ndjson"
+	ExportFormatCSV    = "csv"
+)
+
+// streamUsageExport writes matching usage events to the response as they
+// are read from storage, flushing every few hundred rows
+func (h *Handler) streamUsageExport(w http.ResponseWriter, r *http.Request, tenantID string) {
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = ExportFormatNDJSON
+	}
+	if format != ExportFormatNDJSON && format != ExportFormatCSV {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "format must be ndjson or csv"))
+		return
+	}
+
+	start, end, err := parseUsageRange(r)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	q := models.UsageExportQuery{
+		TenantID:  tenantID,
+		EventType: query.Get("event_type"),
+		Start:     start,
+		End:       end,
+	}
+
+	name := "usage-all"
+	if tenantID != "" {
+		name = "usage-" + tenantID
+	}
+	name += "-" + start.UTC().Format("20060102") + "-" + end.UTC().Format("20060102") + "." + format
+
+	if format == ExportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+
+	flusher, _ := w.(http.Flusher)
+	csvWriter := csv.NewWriter(w)
+	encoder := json.NewEncoder(w)
+	if format == ExportFormatCSV {
+		csvWriter.Write([]string{"tenant_id", "event_type", "resource_id", "quantity", "unit", "event_time", "metadata"})
+	}
+
+	count := 0
+	err = h.storage.ExportUsageEvents(r.Context(), q, func(e models.UsageEvent) error {
+		if format == ExportFormatCSV {
+			metadata := string(e.Metadata)
+			if metadata == "" || metadata == "null" {
+				metadata = "{}"
+			}
+			csvWriter.Write([]string{
+				e.TenantID, e.EventType, e.ResourceID,
+				strconv.FormatFloat(e.Quantity, 'f', -1, 64), e.Unit,
+				e.EventTime.UTC().Format(time.RFC3339Nano), metadata,
+			})
+		} else if err := encoder.Encode(e); err != nil {
+			return err
+		}
+
+		count++
+		if count%500 == 0 {
+			csvWriter.Flush()
+			if err := csvWriter.Error(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return nil
+	})
+	csvWriter.Flush()
+
+	// Headers are already sent, so a failure can only be logged
+	if err != nil {
+		log.Printf("[USAGE] Export for tenant %q stopped after %d events: %v", tenantID, count, err)
+		return
+	}
+	log.Printf("[USAGE] Exported %d events for tenant %q as %s", count, tenantID, format)
+}
+
+// ExportUsage streams a tenant's raw usage events as NDJSON or CSV,
+// e.g. ?format=csv&start=...&end=...&event_type=llm_tokens
+func (h *Handler) ExportUsage(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	h.streamUsageExport(w, r, vars["tenantId"])
+}
+
+// ExportAllUsage streams usage events across all tenants (admin), or one
+// tenant when tenant_id is given
+func (h *Handler) ExportAllUsage(w http.ResponseWriter, r *http.Request) {
+	h.streamUsageExport(w, r, r.URL.Query().Get("tenant_id"))
+}
+
+// RebuildUsageRollups recomputes usage rollups from raw events, e.g. after a
+// backfill of historical events. All fields are optional. Archived months
+// keep their rollups and are reported as skipped; without usage retention,
+// which knows the archived months, start and end are required.
+func (h *Handler) RebuildUsageRollups(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TenantID string     `json:"tenant_id"`
+		Start    *time.Time `json:"start,omitempty"`
+		End      *time.Time `json:"end,omitempty"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			respondError(w, r, apierror.InvalidBody(err))
+			return
+		}
+	}
+
+	var start, end time.Time
+	if req.Start != nil {
+		start = *req.Start
+	}
+	if req.End != nil {
+		end = *req.End
+	}
+	if !start.IsZero() && !end.IsZero() && !end.After(start) {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "end must be after start"))
+		return
+	}
+
+	began := time.Now()
+	rebuilt, skipped := 0, []string{}
+	var err error
+	if h.retention != nil {
+		rebuilt, skipped, err = h.retention.RebuildRollups(r.Context(), req.TenantID, start, end)
+	} else if start.IsZero() || end.IsZero() {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "start and end are required when usage retention is disabled"))
+		return
+	} else {
+		rebuilt, err = h.storage.RebuildUsageRollups(r.Context(), req.TenantID, start, end)
+	}
+	if err != nil {
+		log.Printf("[USAGE] Error rebuilding rollups: %v", err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to rebuild usage rollups"))
+		return
+	}
+
+	log.Printf("[USAGE] Rebuilt %d usage rollups (tenant=%q, skipped archived months %v) in %v", rebuilt, req.TenantID, skipped, time.Since(began))
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":      req.TenantID,
+		"rebuilt":        rebuilt,
+		"skipped_months": skipped,
+		"duration_ms":    time.Since(began).Milliseconds(),
+	})
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+)
+
+// /api/v2 endpoints. They share their logic with v1 but respond with the
+// typed bodies in models, so every field is always present. v1 keeps its
+// original shapes for the legacy C++ client.
+
+// GetLicenseStatusV2 returns the license status for a tenant
+func (h *Handler) GetLicenseStatusV2(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	log.Printf("[LICENSE_STATUS] v2 request for tenant: %s", tenantID)
+
+	status, err := h.licenseStatus(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, status)
+}
+
+// GetSubscriptionV2 returns subscription information for a tenant
+func (h *Handler) GetSubscriptionV2(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	log.Printf("[SUBSCRIPTION] v2 request for tenant: %s", tenantID)
+
+	summary, err := h.subscriptionSummary(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, summary)
+}
+
+// RevokeLicenseV2 reverts a paid license to the tenant's trial
+func (h *Handler) RevokeLicenseV2(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	revocation, err := h.revokeLicense(r.Context(), tenantID)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, revocation)
+}
+
+// GetUsageSummaryV2 returns usage summary for a tenant. Unlike v1, invalid
+// start and end parameters are rejected rather than replaced by defaults.
+func (h *Handler) GetUsageSummaryV2(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	log.Printf("[USAGE_SUMMARY] v2 request for tenant: %s", tenantID)
+
+	start, end, err := parseUsageRange(r)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	summary, err := h.usageSummary(r.Context(), tenantID, start, end)
+	if err != nil {
+		respondError(w, r, err)
+		return
+	}
+
+	respondJSON(w, summary)
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/wallet"
+)
+
+// walletTopUpReference marks payment attempts that purchase prepaid credit
+const walletTopUpReference = "wallet_top_up"
+
+// EnableWallet turns on prepaid credit drawdown for covered usage
+func (h *Handler) EnableWallet(config wallet.Config) *wallet.Ledger {
+	h.wallet = wallet.NewLedger(config, h.storage, h.marginalUsageCost)
+	return h.wallet
+}
+
+// requireWallet responds with an error when prepaid credit is not enabled
+func (h *Handler) requireWallet(w http.ResponseWriter, r *http.Request) bool {
+	if h.wallet == nil {
+		respondError(w, r, apierror.New(apierror.FeatureDisabled, "Prepaid wallet is not enabled"))
+		return false
+	}
+	return true
+}
+
+// applyWalletUsage draws the cost of newly saved usage from prepaid credit.
+// Drawdowns that fail are kept by the ledger and replayed later, so the
+// saved usage is still charged.
+func (h *Handler) applyWalletUsage(ctx context.Context, events []models.UsageEvent) {
+	if h.wallet == nil {
+		return
+	}
+	if err := h.wallet.ApplyUsage(ctx, events); err != nil {
+		log.Printf("[WALLET] Error applying usage drawdown: %v", err)
+	}
+}
+
+// walletAllowsCategory reports whether a wallet-gated category is usable
+func (h *Handler) walletAllowsCategory(ctx context.Context, tenantID, category string) bool {
+	if h.wallet == nil {
+		return true
+	}
+	allowed, err := h.wallet.AllowsCategory(ctx, tenantID, category)
+	if err != nil {
+		log.Printf("[WALLET] Error checking balance for tenant %s: %v", tenantID, err)
+	}
+	return allowed
+}
+
+// settleWalletTopUp credits the wallet once a top-up charge succeeds
+func (h *Handler) settleWalletTopUp(ctx context.Context, attempt *models.PaymentAttempt) (*models.CreditGrant, error) {
+	if h.wallet == nil || attempt.Status != models.PaymentStatusSucceeded {
+		return nil, nil
+	}
+	attemptID := attempt.ID
+	return h.wallet.AddCredit(ctx, attempt.TenantID, models.CreditGrantTopUp, attempt.Amount,
+		attempt.Description, nil, &attemptID)
+}
+
+// TopUpWallet purchases prepaid credit for a tenant. With charge set the
+// tenant's payment method is charged and the credit is added once the
+// charge succeeds; otherwise the credit is recorded as paid out of band.
+func (h *Handler) TopUpWallet(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWallet(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		Amount      float64 `json:"amount"`
+		Description string  `json:"description"`
+		Charge      bool    `json:"charge"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.Amount <= 0 {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, "amount must be positive"))
+		return
+	}
+	if req.Description == "" {
+		req.Description = "Prepaid credit top-up"
+	}
+
+	ctx := r.Context()
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	if !req.Charge {
+		grant, err := h.wallet.AddCredit(ctx, tenantID, models.CreditGrantTopUp, roundCurrency(req.Amount), req.Description, nil, nil)
+		if err != nil {
+			respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+			return
+		}
+		respondJSON(w, map[string]interface{}{
+			"tenant_id": tenantID,
+			"grant":     grant,
+		})
+		return
+	}
+
+	if !h.requirePaymentProvider(w, r) {
+		return
+	}
+
+	attempt, err := h.chargeTenant(ctx, tenantID, req.Amount, req.Description, walletTopUpReference, nil)
+	if err == errNoPaymentMethod {
+		respondError(w, r, apierror.New(apierror.NoPaymentMethod, err.Error()))
+		return
+	}
+	if err != nil {
+		log.Printf("[WALLET] Top-up charge failed for tenant %s: %v", tenantID, err)
+		respondError(w, r, apierror.New(apierror.PaymentProviderError, "Failed to charge tenant"))
+		return
+	}
+
+	resp := map[string]interface{}{
+		"tenant_id":       tenantID,
+		"payment_attempt": attempt,
+	}
+
+	grant, err := h.settleWalletTopUp(ctx, attempt)
+	if err != nil {
+		log.Printf("[WALLET] Failed to credit top-up %s: %v", attempt.ID, err)
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Charge succeeded but credit could not be added"))
+		return
+	}
+	if grant != nil {
+		resp["grant"] = grant
+	}
+
+	respondJSON(w, resp)
+}
+
+// GrantWalletCredit adds free or promotional credit, optionally expiring
+func (h *Handler) GrantWalletCredit(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWallet(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		Amount        float64    `json:"amount"`
+		Description   string     `json:"description"`
+		ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+		ExpiresInDays int        `json:"expires_in_days,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.ExpiresAt == nil && req.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		req.ExpiresAt = &expiresAt
+	}
+	if req.Description == "" {
+		req.Description = "Promotional credit"
+	}
+
+	ctx := r.Context()
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	grant, err := h.wallet.AddCredit(ctx, tenantID, models.CreditGrantPromo, roundCurrency(req.Amount), req.Description, req.ExpiresAt, nil)
+	if err != nil {
+		respondError(w, r, apierror.New(apierror.InvalidRequest, err.Error()))
+		return
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id": tenantID,
+		"grant":     grant,
+	})
+}
+
+// UpdateWalletSettings changes what happens when a tenant's balance runs out
+func (h *Handler) UpdateWalletSettings(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWallet(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	var req struct {
+		ZeroBalanceBehavior string `json:"zero_balance_behavior"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		respondError(w, r, apierror.InvalidBody(err))
+		return
+	}
+	if req.ZeroBalanceBehavior != models.ZeroBalanceAllowOverage && req.ZeroBalanceBehavior != models.ZeroBalanceDeny {
+		respondError(w, r, apierror.Newf(apierror.InvalidRequest,
+			"zero_balance_behavior must be '%s' or '%s'", models.ZeroBalanceAllowOverage, models.ZeroBalanceDeny))
+		return
+	}
+
+	ctx := r.Context()
+
+	tenant, err := h.storage.GetTenant(ctx, tenantID)
+	if err != nil || tenant == nil {
+		respondError(w, r, apierror.New(apierror.TenantNotFound, "Tenant not found"))
+		return
+	}
+
+	wal, err := h.wallet.EnsureWallet(ctx, tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get wallet"))
+		return
+	}
+
+	wal.ZeroBalanceBehavior = req.ZeroBalanceBehavior
+	wal.UpdatedAt = time.Now()
+	if err := h.storage.SaveWallet(ctx, wal); err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to save wallet"))
+		return
+	}
+
+	log.Printf("[WALLET] Tenant %s zero-balance behavior set to %s", tenantID, wal.ZeroBalanceBehavior)
+	respondJSON(w, wal)
+}
+
+// GetWallet returns a tenant's prepaid balance, active grants and settings
+func (h *Handler) GetWallet(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWallet(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+	ctx := r.Context()
+
+	wal, err := h.storage.GetWallet(ctx, tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get wallet"))
+		return
+	}
+	if wal == nil {
+		respondError(w, r, apierror.New(apierror.WalletNotFound, "No wallet for tenant"))
+		return
+	}
+
+	balance, err := h.wallet.Balance(ctx, tenantID)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get wallet balance"))
+		return
+	}
+
+	grants, err := h.storage.GetActiveCreditGrants(ctx, tenantID, time.Now())
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get credit grants"))
+		return
+	}
+	if grants == nil {
+		grants = []models.CreditGrant{}
+	}
+
+	var covered []string
+	for eventType := range h.wallet.Config().EventCategories {
+		covered = append(covered, eventType)
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":             tenantID,
+		"balance":               roundCurrency(balance),
+		"currency":              wal.Currency,
+		"zero_balance_behavior": wal.ZeroBalanceBehavior,
+		"covered_event_types":   covered,
+		"grants":                grants,
+	})
+}
+
+// GetWalletTransactions returns a tenant's credit ledger, newest first
+func (h *Handler) GetWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	if !h.requireWallet(w, r) {
+		return
+	}
+
+	vars := mux.Vars(r)
+	tenantID := vars["tenantId"]
+
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 1000 {
+			limit = n
+		}
+	}
+
+	txs, err := h.storage.GetWalletTransactions(r.Context(), tenantID, limit)
+	if err != nil {
+		respondError(w, r, apierror.Wrap(apierror.Internal, err, "Failed to get wallet transactions"))
+		return
+	}
+	if txs == nil {
+		txs = []models.WalletTransaction{}
+	}
+
+	respondJSON(w, map[string]interface{}{
+		"tenant_id":    tenantID,
+		"transactions": txs,
+	})
+}
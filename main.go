@@ -2,33 +2,64 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"google.golang.org/grpc"
 
+	"brinkbyte-billing-server/dunning"
+	"brinkbyte-billing-server/grpcserver"
 	"brinkbyte-billing-server/handlers"
 	"brinkbyte-billing-server/middleware"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/oidc"
+	"brinkbyte-billing-server/openapi"
+	"brinkbyte-billing-server/payments"
+	"brinkbyte-billing-server/pki"
+	"brinkbyte-billing-server/rating"
+	"brinkbyte-billing-server/retention"
 	"brinkbyte-billing-server/storage"
+	"brinkbyte-billing-server/wallet"
 )
 
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	// Local tooling that needs no storage
+	if len(os.Args) > 1 && os.Args[1] == "dev-admin-token" {
+		runDevAdminToken(os.Args[2:])
+		return
+	}
+
 	// Initialize storage based on environment
 	var store handlers.Storage
 	var err error
 
+	// Maintenance commands work on the real database; running them against a
+	// throwaway in-memory store would report success while changing nothing
+	maintenance := len(os.Args) > 1 && (os.Args[1] == "rebuild-rollups" || os.Args[1] == "restore-usage" || os.Args[1] == "create-admin")
+
 	usePostgres := os.Getenv("USE_POSTGRES") != "false"
+	if maintenance && !usePostgres {
+		log.Fatalf("%s requires PostgreSQL storage (USE_POSTGRES=false)", os.Args[1])
+	}
 	if usePostgres {
 		// Try PostgreSQL storage
 		config := storage.LoadPostgresConfigFromEnv()
 		pgStore, pgErr := storage.NewPostgresStorage(ctx, config)
+		if pgErr != nil && maintenance {
+			log.Fatalf("%s requires PostgreSQL storage: %v", os.Args[1], pgErr)
+		}
 		if pgErr != nil {
 			log.Printf("⚠️  PostgreSQL unavailable (%v), falling back to in-memory storage", pgErr)
 			store = storage.NewInMemoryStorage()
@@ -41,31 +72,198 @@ func main() {
 		log.Println("📦 Using in-memory storage (USE_POSTGRES=false)")
 	}
 
+	// One-off maintenance commands
+	if len(os.Args) > 1 && os.Args[1] == "rebuild-rollups" {
+		runRebuildRollups(ctx, store, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "restore-usage" {
+		runRestoreUsage(ctx, store, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "create-admin" {
+		runCreateAdmin(ctx, store, os.Args[2:])
+		return
+	}
+
 	// Initialize handlers
 	handler := handlers.NewHandler(store)
 
+	// Configure payment provider. Payments are off unless one is chosen; only
+	// the local fake provider is built in, for development.
+	var paymentProvider payments.PaymentProvider
+	switch provider := getEnvOrDefault("PAYMENT_PROVIDER", "none"); provider {
+	case "fake":
+		paymentProvider = payments.NewFakeProvider(payments.LoadFakeProviderConfigFromEnv())
+		handler.SetPaymentProvider(paymentProvider)
+		log.Println("⚠️  Using fake payment provider; no real money moves (development only)")
+	case "none":
+		log.Println("💳 Payments disabled (PAYMENT_PROVIDER=none)")
+	default:
+		log.Printf("⚠️  Unknown PAYMENT_PROVIDER %q, payments disabled", provider)
+	}
+
+	// Start dunning worker for failed payments
+	if os.Getenv("DUNNING_ENABLED") != "false" {
+		engine := handler.EnableDunning(dunning.LoadPolicyFromEnv(), dunning.LogNotifier{})
+		interval, err := time.ParseDuration(getEnvOrDefault("DUNNING_INTERVAL", "1h"))
+		if err != nil {
+			interval = time.Hour
+		}
+		go engine.Run(ctx, interval)
+	}
+
+	// Load metered usage prices
+	handler.SetPriceBook(rating.LoadPriceBookFromEnv())
+
+	// Metadata keys usage can be broken down by
+	if keys := os.Getenv("USAGE_METADATA_KEYS"); keys != "" {
+		handler.SetUsageMetadataKeys(strings.Split(keys, ","))
+	}
+
+	// Usage event timestamp validation
+	timestampPolicy := handlers.DefaultTimestampPolicy()
+	timestampPolicy.Strict = os.Getenv("USAGE_TIMESTAMP_STRICT") == "true"
+	if d, err := time.ParseDuration(getEnvOrDefault("USAGE_MAX_FUTURE_SKEW", "15m")); err == nil {
+		timestampPolicy.MaxFutureSkew = d
+	}
+	if d, err := time.ParseDuration(getEnvOrDefault("USAGE_MAX_EVENT_AGE", "0")); err == nil {
+		timestampPolicy.MaxAge = d
+	}
+	handler.SetTimestampPolicy(timestampPolicy)
+
+	// Usage batch ingestion limits
+	ingestConfig := handlers.DefaultIngestConfig()
+	if n, err := strconv.Atoi(os.Getenv("USAGE_MAX_BATCH_EVENTS")); err == nil && n >= 0 {
+		ingestConfig.MaxBatchEvents = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("USAGE_MAX_BATCH_BYTES"), 10, 64); err == nil && n >= 0 {
+		ingestConfig.MaxBatchBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("USAGE_INGEST_CHUNK_SIZE")); err == nil && n > 0 {
+		ingestConfig.ChunkSize = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("USAGE_INGEST_READ_TIMEOUT")); err == nil {
+		ingestConfig.StreamReadTimeout = d
+	}
+	handler.SetIngestConfig(ingestConfig)
+
+	// Edge device enrollment; when required, only enrolled devices may send
+	// heartbeats and validate licenses
+	enrollmentPolicy := handlers.DefaultEnrollmentPolicy()
+	enrollmentPolicy.Required = os.Getenv("REQUIRE_DEVICE_ENROLLMENT") == "true"
+	if d, err := time.ParseDuration(os.Getenv("ENROLLMENT_TOKEN_TTL")); err == nil && d > 0 {
+		enrollmentPolicy.TokenTTL = d
+	}
+	if d, err := time.ParseDuration(os.Getenv("ENROLLMENT_TOKEN_MAX_TTL")); err == nil && d > 0 {
+		enrollmentPolicy.MaxTokenTTL = d
+	}
+	handler.SetEnrollmentPolicy(enrollmentPolicy)
+
+	// Keep usage event partitions ahead and archive events past retention
+	if os.Getenv("USAGE_RETENTION_ENABLED") != "false" {
+		manager := handler.EnableRetention(retention.LoadConfigFromEnv())
+		interval, err := time.ParseDuration(getEnvOrDefault("USAGE_RETENTION_INTERVAL", "24h"))
+		if err != nil {
+			interval = 24 * time.Hour
+		}
+		go manager.Run(ctx, interval)
+	}
+
+	// Enable prepaid credit drawdown for metered usage
+	if os.Getenv("WALLET_ENABLED") != "false" {
+		ledger := handler.EnableWallet(wallet.LoadConfigFromEnv())
+		interval, err := time.ParseDuration(getEnvOrDefault("WALLET_REPLAY_INTERVAL", "5m"))
+		if err != nil {
+			interval = 5 * time.Minute
+		}
+		go ledger.Run(ctx, interval)
+	}
+
+	// Internal CA issuing edge device client certificates at enrollment
+	pkiConfig := pki.LoadConfigFromEnv()
+	var deviceCA *pki.CA
+	if pkiConfig.CAEnabled() {
+		deviceCA, err = pki.LoadOrCreateCA(pkiConfig)
+		if err != nil {
+			log.Fatalf("Failed to load device CA: %v", err)
+		}
+		handler.EnableDeviceCA(deviceCA)
+		log.Printf("🪪 Device certificates enabled (CA %s)", deviceCA.Subject())
+	}
+
 	// Setup router
 	r := mux.NewRouter()
 
 	// Apply global middleware
+	r.Use(middleware.RequestID)
 	r.Use(middleware.Logging)
 	r.Use(middleware.CORS)
 
+	// Unmatched routes get typed errors too; mux skips middleware for these
+	r.NotFoundHandler = middleware.RequestID(http.HandlerFunc(middleware.NotFound))
+	r.MethodNotAllowedHandler = middleware.RequestID(http.HandlerFunc(middleware.MethodNotAllowed))
+
+	// Check requests and responses against the OpenAPI spec (development)
+	if os.Getenv("OPENAPI_VALIDATE") == "true" {
+		doc, err := openapi.Load()
+		if err != nil {
+			log.Fatalf("Failed to load OpenAPI spec: %v", err)
+		}
+		validator, err := middleware.OpenAPIValidation(doc)
+		if err != nil {
+			log.Fatalf("Failed to set up OpenAPI validation: %v", err)
+		}
+		r.Use(validator)
+		log.Println("📐 OpenAPI request and response validation enabled")
+	}
+
 	// Handle OPTIONS requests for CORS preflight (must be before other routes)
 	r.Methods("OPTIONS").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
 		w.WriteHeader(http.StatusOK)
 	})
 
 	// API routes - Billing endpoints (new)
 	api := r.PathPrefix("/api/v1").Subrouter()
 
+	// Edge devices may authenticate with client certificates instead of API
+	// keys, but only on the endpoints the edge client calls
+	if deviceCA != nil {
+		api.Use(middleware.DeviceCertificate(store,
+			"/api/v1/billing/validate",
+			"/api/v1/licenses/validate",
+			"/api/v1/entitlements/check",
+			"/api/v1/usage/batch",
+			"/api/v1/heartbeat",
+		))
+	}
+
 	// Apply auth middleware to API routes (optional based on env)
 	if os.Getenv("REQUIRE_AUTH") == "true" {
 		api.Use(middleware.AuthMiddleware(store))
+		api.Use(middleware.TenantScope)
+	}
+
+	// Accept gzip and zstd request bodies
+	maxDecompressed := int64(middleware.DefaultMaxDecompressedBytes)
+	if n, err := strconv.ParseInt(os.Getenv("MAX_DECOMPRESSED_BODY_BYTES"), 10, 64); err == nil && n > 0 {
+		maxDecompressed = n
 	}
+	api.Use(middleware.DecompressBody(maxDecompressed))
+
+	// Edge device request signatures, checked when present unless required
+	deviceSigning := middleware.DefaultDeviceSignatureConfig()
+	deviceSigning.Required = os.Getenv("REQUIRE_DEVICE_SIGNATURE") == "true"
+	if n, err := strconv.ParseInt(os.Getenv("DEVICE_SIGNATURE_MAX_BODY_BYTES"), 10, 64); err == nil && n > 0 {
+		deviceSigning.MaxBodyBytes = n
+	}
+	if d, err := time.ParseDuration(getEnvOrDefault("DEVICE_SIGNATURE_WINDOW", "5m")); err == nil && d > 0 {
+		deviceSigning.Window = d
+	}
+	deviceSigned := middleware.DeviceSignatureMiddleware(store, deviceSigning)
 
 	// License & Subscription endpoints (GET)
 	// NOTE: More specific routes must come BEFORE parameterized routes
@@ -76,42 +274,166 @@ func main() {
 	api.HandleFunc("/billing/subscription/{tenantId}", handler.GetSubscription).Methods("GET")
 	api.HandleFunc("/billing/growth-packs/{tenantId}", handler.GetEnabledGrowthPacks).Methods("GET")
 	api.HandleFunc("/billing/usage/{tenantId}", handler.GetUsageSummary).Methods("GET")
+	api.HandleFunc("/billing/usage/{tenantId}/timeseries", handler.GetUsageTimeSeries).Methods("GET")
+	api.HandleFunc("/billing/usage/{tenantId}/breakdown", handler.GetUsageBreakdown).Methods("GET")
+	api.HandleFunc("/billing/usage/{tenantId}/export", handler.ExportUsage).Methods("GET")
 	api.HandleFunc("/billing/validate", handler.ValidateCameraLicense).Methods("POST")
+	api.HandleFunc("/billing/wallet/{tenantId}", handler.GetWallet).Methods("GET")
+	api.HandleFunc("/billing/wallet/{tenantId}/transactions", handler.GetWalletTransactions).Methods("GET")
 
 	// Legacy endpoints (POST) - for backwards compatibility with C++ client
 	api.HandleFunc("/licenses/validate", handler.ValidateLicense).Methods("POST")
 	api.HandleFunc("/entitlements/check", handler.CheckEntitlement).Methods("POST")
-	api.HandleFunc("/usage/batch", handler.ReportUsageBatch).Methods("POST")
-	api.HandleFunc("/heartbeat", handler.Heartbeat).Methods("POST")
+	api.Handle("/usage/batch", deviceSigned(http.HandlerFunc(handler.ReportUsageBatch))).Methods("POST")
+	api.Handle("/heartbeat", deviceSigned(http.HandlerFunc(handler.Heartbeat))).Methods("POST")
+
+	// Edge device enrollment tokens; devices exchange them for their
+	// credentials at /devices/activate, and only admins enroll devices directly
+	api.HandleFunc("/devices/enrollment-tokens", handler.CreateEnrollmentToken).Methods("POST")
+
+	// v2 API - typed responses where every field is always present
+	apiV2 := r.PathPrefix("/api/v2").Subrouter()
+	if os.Getenv("REQUIRE_AUTH") == "true" {
+		apiV2.Use(middleware.AuthMiddleware(store))
+		apiV2.Use(middleware.TenantScope)
+	}
+	apiV2.Use(middleware.DecompressBody(maxDecompressed))
+	apiV2.HandleFunc("/billing/license/{tenantId}", handler.GetLicenseStatusV2).Methods("GET")
+	apiV2.HandleFunc("/billing/license/{tenantId}/revoke", handler.RevokeLicenseV2).Methods("POST")
+	apiV2.HandleFunc("/billing/subscription/{tenantId}", handler.GetSubscriptionV2).Methods("GET")
+	apiV2.HandleFunc("/billing/usage/{tenantId}", handler.GetUsageSummaryV2).Methods("GET")
+
+	// Payment provider callbacks (verified by the provider integration, not
+	// API keys). Unsigned webhooks are only served when explicitly allowed for
+	// development, as anyone could post them.
+	if paymentProvider != nil {
+		if paymentProvider.VerifiesWebhooks() {
+			r.HandleFunc("/api/v1/payments/webhook", handler.PaymentWebhook).Methods("POST")
+		} else if os.Getenv("FAKE_PAYMENT_WEBHOOK") == "true" {
+			r.HandleFunc("/api/v1/payments/webhook", handler.PaymentWebhook).Methods("POST")
+			log.Printf("⚠️  Serving unverified %s payment webhooks (FAKE_PAYMENT_WEBHOOK=true); development only", paymentProvider.Name())
+		}
+	}
+
+	// Device activation (authenticated by the enrollment token, not API keys)
+	r.HandleFunc("/api/v1/devices/activate", handler.ActivateDevice).Methods("POST")
 
 	// Admin routes (protected)
 	admin := r.PathPrefix("/api/v1/admin").Subrouter()
 	if os.Getenv("REQUIRE_ADMIN_AUTH") == "true" {
-		admin.Use(middleware.AdminAuthMiddleware)
+		// Admin dashboard SSO tokens, accepted alongside admin API keys
+		var verifier *oidc.Verifier
+		if config := oidc.LoadConfigFromEnv(); config.Enabled() {
+			verifier, err = oidc.NewVerifier(ctx, config)
+			if err != nil {
+				log.Fatalf("Failed to set up admin SSO: %v", err)
+			}
+			log.Printf("🔑 Admin SSO enabled (issuer %s, keys from %s)", verifier.Issuer(), verifier.KeySource())
+		}
+		admin.Use(middleware.AdminAuthMiddleware(store, verifier))
+	} else {
+		admin.Use(middleware.UnauthenticatedAdmin)
 	}
-	admin.HandleFunc("/tenants", handler.CreateTenant).Methods("POST")
-	admin.HandleFunc("/tenants/{id}", handler.UpdateTenant).Methods("PUT")
-	admin.HandleFunc("/tenants/{id}", handler.GetTenantAdmin).Methods("GET")
-	admin.HandleFunc("/subscriptions", handler.CreateSubscription).Methods("POST")
-	admin.HandleFunc("/subscriptions/{id}", handler.UpdateSubscription).Methods("PUT")
-	admin.HandleFunc("/subscriptions/{tenantId}/growth-packs", handler.ManageGrowthPacks).Methods("PUT")
+	admin.HandleFunc("/tenants", middleware.RequirePermission(models.PermTenantsRead, handler.ListTenants)).Methods("GET")
+	admin.HandleFunc("/tenants", middleware.RequirePermission(models.PermTenantsWrite, handler.CreateTenant)).Methods("POST")
+	admin.HandleFunc("/tenants/{id}", middleware.RequirePermission(models.PermTenantsWrite, handler.UpdateTenant)).Methods("PUT")
+	admin.HandleFunc("/tenants/{id}", middleware.RequirePermission(models.PermTenantsRead, handler.GetTenantAdmin)).Methods("GET")
+	admin.HandleFunc("/subscriptions", middleware.RequirePermission(models.PermSubscriptionsRead, handler.ListSubscriptions)).Methods("GET")
+	admin.HandleFunc("/subscriptions", middleware.RequirePermission(models.PermSubscriptionsWrite, handler.CreateSubscription)).Methods("POST")
+	admin.HandleFunc("/camera-licenses", middleware.RequirePermission(models.PermSubscriptionsRead, handler.ListCameraLicenses)).Methods("GET")
+	admin.HandleFunc("/subscriptions/{id}", middleware.RequirePermission(models.PermSubscriptionsWrite, handler.UpdateSubscription)).Methods("PUT")
+	admin.HandleFunc("/subscriptions/{tenantId}/growth-packs", middleware.RequirePermission(models.PermSubscriptionsWrite, handler.ManageGrowthPacks)).Methods("PUT")
+	admin.HandleFunc("/subscriptions/{tenantId}/billing-cycle", middleware.RequirePermission(models.PermSubscriptionsWrite, handler.ChangeBillingCycle)).Methods("PUT")
+	admin.HandleFunc("/payments/{tenantId}/payment-method", middleware.RequirePermission(models.PermBillingWrite, handler.AttachPaymentMethod)).Methods("PUT")
+	admin.HandleFunc("/payments/{tenantId}/charges", middleware.RequirePermission(models.PermBillingWrite, handler.ChargeTenant)).Methods("POST")
+	admin.HandleFunc("/payments/{tenantId}/attempts", middleware.RequirePermission(models.PermBillingRead, handler.GetPaymentAttempts)).Methods("GET")
+	admin.HandleFunc("/payments/attempts/{id}/refund", middleware.RequirePermission(models.PermBillingWrite, handler.RefundPayment)).Methods("POST")
+	admin.HandleFunc("/credit-notes", middleware.RequirePermission(models.PermBillingWrite, handler.CreateCreditNote)).Methods("POST")
+	admin.HandleFunc("/credit-notes/tenant/{tenantId}", middleware.RequirePermission(models.PermBillingRead, handler.GetCreditNotes)).Methods("GET")
+	admin.HandleFunc("/credit-notes/{id}", middleware.RequirePermission(models.PermBillingRead, handler.GetCreditNote)).Methods("GET")
+	admin.HandleFunc("/reports/revenue", middleware.RequirePermission(models.PermBillingRead, handler.GetRevenueReport)).Methods("GET")
+	admin.HandleFunc("/usage/export", middleware.RequirePermission(models.PermUsageRead, handler.ExportAllUsage)).Methods("GET")
+	admin.HandleFunc("/usage/rollups/rebuild", middleware.RequirePermission(models.PermUsageWrite, handler.RebuildUsageRollups)).Methods("POST")
+	admin.HandleFunc("/usage/archives", middleware.RequirePermission(models.PermUsageRead, handler.GetUsageArchives)).Methods("GET")
+	admin.HandleFunc("/usage/archives", middleware.RequirePermission(models.PermUsageWrite, handler.ArchiveUsage)).Methods("POST")
+	admin.HandleFunc("/usage/archives/restore", middleware.RequirePermission(models.PermUsageWrite, handler.RestoreUsage)).Methods("POST")
+	admin.HandleFunc("/usage/held", middleware.RequirePermission(models.PermUsageRead, handler.GetHeldUsage)).Methods("GET")
+	admin.HandleFunc("/usage/held/{heldId}/release", middleware.RequirePermission(models.PermUsageWrite, handler.ReleaseHeldUsage)).Methods("POST")
+	admin.HandleFunc("/usage/held/{heldId}/reject", middleware.RequirePermission(models.PermUsageWrite, handler.RejectHeldUsage)).Methods("POST")
+	admin.HandleFunc("/billing/periods/{tenantId}", middleware.RequirePermission(models.PermBillingRead, handler.GetBillingPeriods)).Methods("GET")
+	admin.HandleFunc("/billing/periods/{tenantId}/close", middleware.RequirePermission(models.PermBillingWrite, handler.CloseBillingPeriod)).Methods("POST")
+	admin.HandleFunc("/billing/periods/{tenantId}/{periodId}/lock", middleware.RequirePermission(models.PermBillingWrite, handler.LockBillingPeriod)).Methods("POST")
+	admin.HandleFunc("/usage/{tenantId}/charges", middleware.RequirePermission(models.PermUsageRead, handler.GetRatedUsage)).Methods("GET")
+	admin.HandleFunc("/wallet/{tenantId}/top-ups", middleware.RequirePermission(models.PermBillingWrite, handler.TopUpWallet)).Methods("POST")
+	admin.HandleFunc("/wallet/{tenantId}/grants", middleware.RequirePermission(models.PermBillingWrite, handler.GrantWalletCredit)).Methods("POST")
+	admin.HandleFunc("/wallet/{tenantId}/settings", middleware.RequirePermission(models.PermBillingWrite, handler.UpdateWalletSettings)).Methods("PUT")
+	admin.HandleFunc("/dunning/run", middleware.RequirePermission(models.PermBillingWrite, handler.ProcessDunning)).Methods("POST")
+	admin.HandleFunc("/dunning/{tenantId}", middleware.RequirePermission(models.PermBillingRead, handler.GetDunningCases)).Methods("GET")
+	admin.HandleFunc("/devices/enroll", middleware.RequirePermission(models.PermTenantsWrite, handler.EnrollDevice)).Methods("POST")
+	admin.HandleFunc("/devices/enrollment-tokens", middleware.RequirePermission(models.PermTenantsWrite, handler.CreateEnrollmentToken)).Methods("POST")
+	admin.HandleFunc("/devices/{deviceId}/certificates", middleware.RequirePermission(models.PermTenantsRead, handler.GetDeviceCertificates)).Methods("GET")
+	admin.HandleFunc("/devices/{deviceId}/certificates/{serial}/revoke", middleware.RequirePermission(models.PermTenantsWrite, handler.RevokeDeviceCertificate)).Methods("POST")
+	admin.HandleFunc("/admins", middleware.RequirePermission(models.PermAdminsManage, handler.ListAdmins)).Methods("GET")
+	admin.HandleFunc("/admins", middleware.RequirePermission(models.PermAdminsManage, handler.CreateAdmin)).Methods("POST")
+	admin.HandleFunc("/admins/me", handler.GetCurrentAdmin).Methods("GET")
+	admin.HandleFunc("/admins/{id}", middleware.RequirePermission(models.PermAdminsManage, handler.UpdateAdmin)).Methods("PUT")
+	admin.HandleFunc("/admins/{id}/rotate-key", middleware.RequirePermission(models.PermAdminsManage, handler.RotateAdminKey)).Methods("POST")
 
 	// Public routes
 	r.HandleFunc("/health", handler.HealthCheck).Methods("GET")
 	r.HandleFunc("/stats", handler.GetStats).Methods("GET")
+	r.HandleFunc("/openapi.json", openapi.Handler).Methods("GET")
 
 	// Start server
 	port := getEnvOrDefault("PORT", "8081")
 	addr := ":" + port
 
+	// Long usage exports need a longer write timeout than API calls
+	writeTimeout, err := time.ParseDuration(getEnvOrDefault("HTTP_WRITE_TIMEOUT", "15s"))
+	if err != nil {
+		writeTimeout = 15 * time.Second
+	}
+
 	srv := &http.Server{
 		Addr:         addr,
 		Handler:      r,
 		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
+		WriteTimeout: writeTimeout,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	// Serve TLS, reloading the certificate when its files change; with a
+	// device CA, clients may present device certificates
+	var tlsConfig *tls.Config
+	if pkiConfig.TLSEnabled() {
+		certs, err := pki.NewCertReloader(pkiConfig.CertFile, pkiConfig.KeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load TLS certificate: %v", err)
+		}
+		go certs.Run(ctx, pkiConfig.ReloadInterval)
+		tlsConfig = pki.ServerTLSConfig(certs, deviceCA)
+		srv.TLSConfig = tlsConfig
+		log.Printf("🔒 Serving TLS with %s (checked for changes every %v)", pkiConfig.CertFile, pkiConfig.ReloadInterval)
+	} else if deviceCA != nil {
+		log.Println("⚠️  Device CA configured without TLS_CERT_FILE/TLS_KEY_FILE; certificates are issued but can't be presented")
+	}
+
+	// gRPC licensing and usage ingestion for edge clients, on its own port
+	var grpcSrv *grpc.Server
+	grpcPort := getEnvOrDefault("GRPC_PORT", "9090")
+	if os.Getenv("GRPC_ENABLED") != "false" {
+		lis, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			log.Fatalf("Failed to listen on gRPC port %s: %v", grpcPort, err)
+		}
+		grpcSrv = grpcserver.NewServer(handler, store, os.Getenv("REQUIRE_AUTH") == "true", deviceSigning, tlsConfig)
+		go func() {
+			if err := grpcSrv.Serve(lis); err != nil {
+				log.Printf("gRPC server error: %v", err)
+			}
+		}()
+	}
+
 	// Graceful shutdown
 	go func() {
 		sigChan := make(chan os.Signal, 1)
@@ -125,6 +447,19 @@ func main() {
 		if err := srv.Shutdown(shutdownCtx); err != nil {
 			log.Printf("Error during shutdown: %v", err)
 		}
+		if grpcSrv != nil {
+			// Let open usage streams finish, but not past the shutdown deadline
+			stopped := make(chan struct{})
+			go func() {
+				grpcSrv.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-shutdownCtx.Done():
+				grpcSrv.Stop()
+			}
+		}
 		cancel()
 	}()
 
@@ -136,7 +471,20 @@ func main() {
 	log.Printf("   GET  http://localhost%s/api/v1/billing/growth-packs/available", addr)
 	log.Printf("   GET  http://localhost%s/api/v1/billing/pricing", addr)
 	log.Printf("   GET  http://localhost%s/api/v1/billing/usage/{tenantId}", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/billing/usage/{tenantId}/timeseries", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/billing/usage/{tenantId}/breakdown", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/billing/usage/{tenantId}/export", addr)
 	log.Printf("   POST http://localhost%s/api/v1/billing/validate", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/billing/wallet/{tenantId}", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/billing/wallet/{tenantId}/transactions", addr)
+	log.Printf("   POST http://localhost%s/api/v1/devices/enrollment-tokens", addr)
+	log.Printf("   POST http://localhost%s/api/v1/devices/activate", addr)
+	log.Printf("")
+	log.Printf("📊 v2 Billing API Endpoints:")
+	log.Printf("   GET  http://localhost%s/api/v2/billing/license/{tenantId}", addr)
+	log.Printf("   POST http://localhost%s/api/v2/billing/license/{tenantId}/revoke", addr)
+	log.Printf("   GET  http://localhost%s/api/v2/billing/subscription/{tenantId}", addr)
+	log.Printf("   GET  http://localhost%s/api/v2/billing/usage/{tenantId}", addr)
 	log.Printf("")
 	log.Printf("📊 Legacy API Endpoints (C++ client):")
 	log.Printf("   POST http://localhost%s/api/v1/licenses/validate", addr)
@@ -145,18 +493,66 @@ func main() {
 	log.Printf("   POST http://localhost%s/api/v1/heartbeat", addr)
 	log.Printf("")
 	log.Printf("🔧 Admin Endpoints:")
+	log.Printf("   GET  http://localhost%s/api/v1/admin/tenants", addr)
 	log.Printf("   POST http://localhost%s/api/v1/admin/tenants", addr)
 	log.Printf("   PUT  http://localhost%s/api/v1/admin/tenants/{id}", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/subscriptions", addr)
 	log.Printf("   POST http://localhost%s/api/v1/admin/subscriptions", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/camera-licenses", addr)
 	log.Printf("   PUT  http://localhost%s/api/v1/admin/subscriptions/{tenantId}/growth-packs", addr)
+	log.Printf("   PUT  http://localhost%s/api/v1/admin/subscriptions/{tenantId}/billing-cycle", addr)
+	log.Printf("   PUT  http://localhost%s/api/v1/admin/payments/{tenantId}/payment-method", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/payments/{tenantId}/charges", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/payments/{tenantId}/attempts", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/payments/attempts/{id}/refund", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/credit-notes", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/credit-notes/tenant/{tenantId}", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/reports/revenue", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/usage/{tenantId}/charges", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/usage/export", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/usage/rollups/rebuild", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/usage/archives", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/usage/archives", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/usage/archives/restore", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/usage/held", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/usage/held/{heldId}/release", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/usage/held/{heldId}/reject", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/billing/periods/{tenantId}", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/billing/periods/{tenantId}/close", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/billing/periods/{tenantId}/{periodId}/lock", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/wallet/{tenantId}/top-ups", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/wallet/{tenantId}/grants", addr)
+	log.Printf("   PUT  http://localhost%s/api/v1/admin/wallet/{tenantId}/settings", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/dunning/{tenantId}", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/dunning/run", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/devices/enroll", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/devices/enrollment-tokens", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/devices/{deviceId}/certificates", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/devices/{deviceId}/certificates/{serial}/revoke", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/admins", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/admins", addr)
+	log.Printf("   GET  http://localhost%s/api/v1/admin/admins/me", addr)
+	log.Printf("   PUT  http://localhost%s/api/v1/admin/admins/{id}", addr)
+	log.Printf("   POST http://localhost%s/api/v1/admin/admins/{id}/rotate-key", addr)
 	log.Printf("")
 	log.Printf("📊 Admin Endpoints:")
 	log.Printf("   GET  http://localhost%s/health", addr)
 	log.Printf("   GET  http://localhost%s/stats", addr)
+	log.Printf("   GET  http://localhost%s/openapi.json", addr)
 	log.Printf("")
+	if grpcSrv != nil {
+		log.Printf("📡 gRPC Edge API on port %s (brinkbyte.billing.v1.EdgeBilling):", grpcPort)
+		log.Printf("   ValidateLicense, CheckEntitlement, ReportUsage (stream), Heartbeat")
+		log.Printf("")
+	}
 	log.Printf("✨ Server ready to accept connections!")
 
-	if err = srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	if tlsConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		log.Fatal(err)
 	}
 
@@ -0,0 +1,185 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/oidc"
+)
+
+// AdminContextKey is the context key for the acting admin
+const AdminContextKey ContextKey = "admin"
+
+// AdminStorage is the storage admin authentication needs
+type AdminStorage interface {
+	GetAdminPrincipalByKeyHash(ctx context.Context, keyHash string) (*models.AdminPrincipal, error)
+	CountAdminPrincipals(ctx context.Context) (int, error)
+}
+
+// bootstrapAdmin acts for requests using ADMIN_API_KEY, so the first named
+// admins can be created
+var bootstrapAdmin = models.AdminPrincipal{
+	ID:     "bootstrap",
+	Name:   "ADMIN_API_KEY",
+	Roles:  []string{models.AdminRoleSuperAdmin},
+	Status: models.AdminStatusActive,
+}
+
+// unauthenticatedAdmin acts for requests when admin auth is off
+var unauthenticatedAdmin = models.AdminPrincipal{
+	ID:     "unauthenticated",
+	Name:   "unauthenticated",
+	Roles:  []string{models.AdminRoleSuperAdmin},
+	Status: models.AdminStatusActive,
+}
+
+// HashAdminKey returns the stored form of an admin API key
+func HashAdminKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithAdmin attaches the acting admin to a context
+func WithAdmin(ctx context.Context, admin *models.AdminPrincipal) context.Context {
+	return context.WithValue(ctx, AdminContextKey, admin)
+}
+
+// AdminFromContext retrieves the acting admin from a context
+func AdminFromContext(ctx context.Context) *models.AdminPrincipal {
+	if admin, ok := ctx.Value(AdminContextKey).(*models.AdminPrincipal); ok {
+		return admin
+	}
+	return nil
+}
+
+// AdminAuthMiddleware authenticates admin endpoints with a named admin's key,
+// with ADMIN_API_KEY, which acts as a super-admin, or, when verifier is set,
+// with an SSO token whose claims map to admin roles. Until one of these exists
+// (ADMIN_API_KEY unset, no admins stored and no SSO) every request is refused;
+// the first admin comes from ADMIN_API_KEY or the create-admin command.
+func AdminAuthMiddleware(store AdminStorage, verifier *oidc.Verifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// Skip auth for OPTIONS requests (CORS preflight)
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx := r.Context()
+			adminKey := os.Getenv("ADMIN_API_KEY")
+			if adminKey == "" && verifier == nil {
+				count, err := store.CountAdminPrincipals(ctx)
+				if err != nil {
+					apierror.Write(w, r, apierror.Wrap(apierror.Internal, err, "Authentication error"))
+					return
+				}
+				if count == 0 {
+					log.Printf("[ADMIN_AUTH] No ADMIN_API_KEY, SSO or admins configured; refusing %s %s", r.Method, r.URL.Path)
+					apierror.Write(w, r, apierror.New(apierror.Unauthorized,
+						"No admin credentials are configured; set ADMIN_API_KEY or run create-admin"))
+					return
+				}
+			}
+
+			// Get Authorization header
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				apierror.Write(w, r, apierror.New(apierror.Unauthorized, "Missing Authorization header"))
+				return
+			}
+
+			// Parse Bearer token
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" || parts[1] == "" {
+				apierror.Write(w, r, apierror.New(apierror.Unauthorized, "Invalid Authorization header format"))
+				return
+			}
+			apiKey := parts[1]
+
+			admin := &bootstrapAdmin
+			if verifier != nil && oidc.LooksLikeToken(apiKey) {
+				identity, err := verifier.Verify(ctx, apiKey)
+				if err != nil {
+					log.Printf("[ADMIN_AUTH] Rejected SSO token: %v", err)
+					apierror.Write(w, r, apierror.New(apierror.Unauthorized, "Invalid or expired token"))
+					return
+				}
+				if len(identity.Roles) == 0 {
+					log.Printf("[ADMIN_AUTH] SSO user %s has no admin roles", identity.Subject)
+					apierror.Write(w, r, apierror.New(apierror.PermissionDenied, "Token grants no admin roles"))
+					return
+				}
+				admin = ssoAdmin(identity)
+			} else if adminKey == "" || subtle.ConstantTimeCompare([]byte(apiKey), []byte(adminKey)) != 1 {
+				var err error
+				admin, err = store.GetAdminPrincipalByKeyHash(ctx, HashAdminKey(apiKey))
+				if err != nil {
+					log.Printf("[ADMIN_AUTH] Error looking up admin key: %v", err)
+					apierror.Write(w, r, apierror.Wrap(apierror.Internal, err, "Authentication error"))
+					return
+				}
+				if admin == nil {
+					log.Printf("[ADMIN_AUTH] Invalid admin API key attempt")
+					apierror.Write(w, r, apierror.New(apierror.InvalidAPIKey, "Invalid admin API key"))
+					return
+				}
+				if admin.Status != models.AdminStatusActive {
+					log.Printf("[ADMIN_AUTH] Disabled admin %s attempted %s %s", admin, r.Method, r.URL.Path)
+					apierror.Write(w, r, apierror.New(apierror.InvalidAPIKey, "Admin is disabled"))
+					return
+				}
+			}
+
+			log.Printf("[ADMIN_AUTH] Admin %s authenticated for %s %s", admin, r.Method, r.URL.Path)
+			next.ServeHTTP(w, r.WithContext(WithAdmin(ctx, admin)))
+		})
+	}
+}
+
+// ssoAdmin is the principal for an SSO identity. It isn't stored; its roles
+// come from the token on every request.
+func ssoAdmin(identity *oidc.Identity) *models.AdminPrincipal {
+	admin := &models.AdminPrincipal{
+		ID:     "sso:" + identity.Subject,
+		Name:   identity.Name,
+		Roles:  identity.Roles,
+		Status: models.AdminStatusActive,
+	}
+	if identity.Email != "" {
+		admin.Email = &identity.Email
+	}
+	return admin
+}
+
+// UnauthenticatedAdmin lets every request through as a super-admin, for
+// servers that don't require admin auth
+func UnauthenticatedAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithAdmin(r.Context(), &unauthenticatedAdmin)))
+	})
+}
+
+// RequirePermission only lets admins whose roles grant perm reach next
+func RequirePermission(perm models.AdminPermission, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		admin := AdminFromContext(r.Context())
+		if admin == nil || !admin.Can(perm) {
+			if admin != nil {
+				log.Printf("[ADMIN_AUTH] Admin %s lacks %s for %s %s", admin, perm, r.Method, r.URL.Path)
+			}
+			apierror.Write(w, r, apierror.Newf(apierror.PermissionDenied, "Requires the %s permission", perm).
+				WithDetail("permission", string(perm)))
+			return
+		}
+		next(w, r)
+	}
+}
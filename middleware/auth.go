@@ -2,12 +2,11 @@ package middleware
 
 import (
 	"context"
-	"encoding/json"
 	"log"
 	"net/http"
-	"os"
 	"strings"
 
+	"brinkbyte-billing-server/apierror"
 	"brinkbyte-billing-server/models"
 )
 
@@ -24,6 +23,59 @@ type Storage interface {
 	GetTenantByAPIKey(ctx context.Context, apiKey string) (*models.Tenant, error)
 }
 
+// AuthenticateAPIKey resolves an "Authorization: Bearer <key>" header value to
+// an active tenant. Shared by AuthMiddleware and the gRPC interceptors.
+func AuthenticateAPIKey(ctx context.Context, store Storage, authHeader string) (*models.Tenant, *apierror.Error) {
+	if authHeader == "" {
+		return nil, apierror.New(apierror.Unauthorized, "Missing Authorization header")
+	}
+
+	// Parse Bearer token
+	parts := strings.SplitN(authHeader, " ", 2)
+	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+		return nil, apierror.New(apierror.Unauthorized, "Invalid Authorization header format")
+	}
+
+	apiKey := parts[1]
+	if apiKey == "" {
+		return nil, apierror.New(apierror.Unauthorized, "Empty API key")
+	}
+
+	// Look up tenant by API key
+	tenant, err := store.GetTenantByAPIKey(ctx, apiKey)
+	if err != nil {
+		log.Printf("[AUTH] Error looking up API key: %v", err)
+		return nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+
+	if tenant == nil {
+		log.Printf("[AUTH] Invalid API key: %s...", apiKey[:min(10, len(apiKey))])
+		return nil, apierror.New(apierror.InvalidAPIKey, "Invalid API key")
+	}
+
+	// Check tenant status
+	if tenant.Status != "active" {
+		log.Printf("[AUTH] Tenant %s is not active (status: %s)", tenant.ID, tenant.Status)
+		return nil, apierror.New(apierror.TenantInactive, "Tenant account is not active").WithDetail("status", tenant.Status)
+	}
+
+	log.Printf("[AUTH] Authenticated tenant: %s (%s)", tenant.ID, tenant.Name)
+	return tenant, nil
+}
+
+// WithTenant attaches an authenticated tenant to a context
+func WithTenant(ctx context.Context, tenant *models.Tenant) context.Context {
+	return context.WithValue(ctx, TenantContextKey, tenant)
+}
+
+// TenantFromContext retrieves the authenticated tenant from a context
+func TenantFromContext(ctx context.Context) *models.Tenant {
+	if tenant, ok := ctx.Value(TenantContextKey).(*models.Tenant); ok {
+		return tenant
+	}
+	return nil
+}
+
 // AuthMiddleware validates API key and attaches tenant info to context
 func AuthMiddleware(store Storage) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -34,106 +86,27 @@ func AuthMiddleware(store Storage) func(http.Handler) http.Handler {
 				return
 			}
 
-			// Get Authorization header
-			authHeader := r.Header.Get("Authorization")
-			if authHeader == "" {
-				respondError(w, http.StatusUnauthorized, "Missing Authorization header")
-				return
-			}
-
-			// Parse Bearer token
-			parts := strings.SplitN(authHeader, " ", 2)
-			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-				respondError(w, http.StatusUnauthorized, "Invalid Authorization header format")
-				return
-			}
-
-			apiKey := parts[1]
-			if apiKey == "" {
-				respondError(w, http.StatusUnauthorized, "Empty API key")
-				return
-			}
-
-			// Look up tenant by API key
-			tenant, err := store.GetTenantByAPIKey(r.Context(), apiKey)
-			if err != nil {
-				log.Printf("[AUTH] Error looking up API key: %v", err)
-				respondError(w, http.StatusInternalServerError, "Authentication error")
-				return
-			}
-
-			if tenant == nil {
-				log.Printf("[AUTH] Invalid API key: %s...", apiKey[:min(10, len(apiKey))])
-				respondError(w, http.StatusUnauthorized, "Invalid API key")
+			// Already authenticated by a device certificate
+			if TenantFromContext(r.Context()) != nil {
+				next.ServeHTTP(w, r)
 				return
 			}
 
-			// Check tenant status
-			if tenant.Status != "active" {
-				log.Printf("[AUTH] Tenant %s is not active (status: %s)", tenant.ID, tenant.Status)
-				respondError(w, http.StatusForbidden, "Tenant account is not active")
+			tenant, authErr := AuthenticateAPIKey(r.Context(), store, r.Header.Get("Authorization"))
+			if authErr != nil {
+				apierror.Write(w, r, authErr)
 				return
 			}
 
 			// Attach tenant to context
-			ctx := context.WithValue(r.Context(), TenantContextKey, tenant)
-			log.Printf("[AUTH] Authenticated tenant: %s (%s)", tenant.ID, tenant.Name)
-
-			next.ServeHTTP(w, r.WithContext(ctx))
+			next.ServeHTTP(w, r.WithContext(WithTenant(r.Context(), tenant)))
 		})
 	}
 }
 
-// AdminAuthMiddleware validates admin API key for admin endpoints
-func AdminAuthMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Skip auth for OPTIONS requests (CORS preflight)
-		if r.Method == "OPTIONS" {
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Get admin API key from environment
-		adminKey := os.Getenv("ADMIN_API_KEY")
-		if adminKey == "" {
-			// If no admin key configured, allow access (development mode)
-			log.Printf("[ADMIN_AUTH] Warning: ADMIN_API_KEY not set, allowing unauthenticated access")
-			next.ServeHTTP(w, r)
-			return
-		}
-
-		// Get Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			respondError(w, http.StatusUnauthorized, "Missing Authorization header")
-			return
-		}
-
-		// Parse Bearer token
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			respondError(w, http.StatusUnauthorized, "Invalid Authorization header format")
-			return
-		}
-
-		apiKey := parts[1]
-		if apiKey != adminKey {
-			log.Printf("[ADMIN_AUTH] Invalid admin API key attempt")
-			respondError(w, http.StatusUnauthorized, "Invalid admin API key")
-			return
-		}
-
-		log.Printf("[ADMIN_AUTH] Admin access granted for %s %s", r.Method, r.URL.Path)
-		next.ServeHTTP(w, r)
-	})
-}
-
 // GetTenantFromContext retrieves the tenant from request context
 func GetTenantFromContext(r *http.Request) *models.Tenant {
-	if tenant, ok := r.Context().Value(TenantContextKey).(*models.Tenant); ok {
-		return tenant
-	}
-	return nil
+	return TenantFromContext(r.Context())
 }
 
 // OptionalAuthMiddleware attaches tenant info if API key provided, but doesn't require it
@@ -177,13 +150,6 @@ func OptionalAuthMiddleware(store Storage) func(http.Handler) http.Handler {
 	}
 }
 
-// helper function
-func respondError(w http.ResponseWriter, code int, message string) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	json.NewEncoder(w).Encode(map[string]string{"error": message})
-}
-
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	"brinkbyte-billing-server/apierror"
+)
+
+// DefaultMaxDecompressedBytes caps how large a compressed request body may
+// grow once decompressed
+const DefaultMaxDecompressedBytes = 256 << 20
+
+// decompressedBody closes both the decompressor and the underlying body
+type decompressedBody struct {
+	io.Reader
+	closeDecoder func()
+	body         io.ReadCloser
+}
+
+func (b *decompressedBody) Close() error {
+	b.closeDecoder()
+	return b.body.Close()
+}
+
+// DecompressBody transparently decodes gzip and zstd request bodies according
+// to Content-Encoding. Decoded bodies larger than maxBytes fail to read.
+// Unsupported encodings are rejected with 415.
+func DecompressBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+			var body io.ReadCloser
+			switch encoding {
+			case "", "identity":
+				next.ServeHTTP(w, r)
+				return
+			case "gzip", "x-gzip":
+				gz, err := gzip.NewReader(r.Body)
+				if err != nil {
+					apierror.Write(w, r, apierror.Wrap(apierror.MalformedBody, err, "Invalid gzip body: "+err.Error()))
+					return
+				}
+				body = &decompressedBody{Reader: gz, closeDecoder: func() { gz.Close() }, body: r.Body}
+			case "zstd":
+				zr, err := zstd.NewReader(r.Body, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxBytes)))
+				if err != nil {
+					apierror.Write(w, r, apierror.Wrap(apierror.MalformedBody, err, "Invalid zstd body: "+err.Error()))
+					return
+				}
+				body = &decompressedBody{Reader: zr, closeDecoder: zr.Close, body: r.Body}
+			default:
+				log.Printf("[HTTP] Unsupported Content-Encoding %q for %s %s", encoding, r.Method, r.URL.Path)
+				apierror.Write(w, r, apierror.New(apierror.UnsupportedMediaType, "Unsupported Content-Encoding").
+					WithDetail("supported", []string{"gzip", "zstd", "identity"}))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, body, maxBytes)
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
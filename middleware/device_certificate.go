@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/pki"
+)
+
+// DeviceCertStorage is the storage device certificate checks need
+type DeviceCertStorage interface {
+	GetTenant(ctx context.Context, tenantID string) (*models.Tenant, error)
+	GetEdgeDevice(ctx context.Context, deviceID string) (*models.EdgeDevice, error)
+	GetDeviceCertificate(ctx context.Context, serial string) (*models.DeviceCertificate, error)
+}
+
+// ClientCertificate returns the verified client certificate of a TLS
+// connection, or nil if the client didn't present one
+func ClientCertificate(state *tls.ConnectionState) *x509.Certificate {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return state.VerifiedChains[0][0]
+}
+
+// AuthenticateDeviceCert maps a client certificate already verified against
+// the device CA to its edge device and tenant. The certificate must be on
+// record and not revoked, and its subject must still match the device's
+// enrollment. Shared by DeviceCertificate and the gRPC interceptors.
+func AuthenticateDeviceCert(ctx context.Context, store DeviceCertStorage, cert *x509.Certificate) (*models.EdgeDevice, *models.Tenant, *apierror.Error) {
+	serial := pki.SerialString(cert)
+	deviceID, tenantID := pki.DeviceIdentity(cert)
+
+	record, err := store.GetDeviceCertificate(ctx, serial)
+	if err != nil {
+		log.Printf("[DEVICE_AUTH] Error looking up certificate %s: %v", serial, err)
+		return nil, nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+	if record == nil {
+		log.Printf("[DEVICE_AUTH] Unknown certificate %s for device %s", serial, deviceID)
+		return nil, nil, apierror.New(apierror.CertificateRevoked, "Client certificate is not on record")
+	}
+	if record.Revoked() {
+		log.Printf("[DEVICE_AUTH] Revoked certificate %s for device %s", serial, deviceID)
+		return nil, nil, apierror.New(apierror.CertificateRevoked, "Client certificate has been revoked").
+			WithDetail("serial", serial)
+	}
+	if record.DeviceID != deviceID || record.TenantID != tenantID {
+		log.Printf("[DEVICE_AUTH] Certificate %s subject doesn't match its record", serial)
+		return nil, nil, apierror.New(apierror.CertificateRevoked, "Client certificate subject doesn't match its record")
+	}
+
+	device, err := store.GetEdgeDevice(ctx, deviceID)
+	if err != nil {
+		log.Printf("[DEVICE_AUTH] Error looking up device %s: %v", deviceID, err)
+		return nil, nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+	if device == nil || !device.Enrolled() {
+		log.Printf("[DEVICE_AUTH] Certificate %s names unenrolled device %s", serial, deviceID)
+		return nil, nil, apierror.New(apierror.DeviceNotEnrolled, "Device is not enrolled")
+	}
+	if device.TenantID != tenantID {
+		log.Printf("[DEVICE_AUTH] Certificate %s names tenant %s but device %s belongs to %s", serial, tenantID, deviceID, device.TenantID)
+		return nil, nil, apierror.New(apierror.DeviceAccessDenied, "Device is not enrolled for this tenant")
+	}
+	if device.Status == models.DeviceStatusSuspended {
+		log.Printf("[DEVICE_AUTH] Certificate from suspended device %s", deviceID)
+		return nil, nil, apierror.New(apierror.DeviceAccessDenied, "Device is suspended")
+	}
+
+	tenant, err := store.GetTenant(ctx, tenantID)
+	if err != nil {
+		log.Printf("[DEVICE_AUTH] Error looking up tenant %s: %v", tenantID, err)
+		return nil, nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+	if tenant == nil {
+		return nil, nil, apierror.New(apierror.DeviceAccessDenied, "Device's tenant no longer exists")
+	}
+	if tenant.Status != "active" {
+		log.Printf("[DEVICE_AUTH] Tenant %s is not active (status: %s)", tenant.ID, tenant.Status)
+		return nil, nil, apierror.New(apierror.TenantInactive, "Tenant account is not active").WithDetail("status", tenant.Status)
+	}
+
+	log.Printf("[DEVICE_AUTH] Authenticated device %s (tenant %s) by certificate %s", deviceID, tenantID, serial)
+	return device, tenant, nil
+}
+
+// DeviceCertificate authenticates requests that present a device client
+// certificate, attaching the device and its tenant to the context so that
+// AuthMiddleware accepts them without an API key. Certificates only stand in
+// for API keys on the device endpoints in routes (path templates); elsewhere,
+// and on requests without a certificate, requests pass through unchanged. It
+// must run on a router whose routes have been matched.
+func DeviceCertificate(store DeviceCertStorage, routes ...string) func(http.Handler) http.Handler {
+	deviceRoutes := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		deviceRoutes[route] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cert := ClientCertificate(r.TLS)
+			if cert == nil || !deviceRoutes[routeTemplate(r)] {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			device, tenant, authErr := AuthenticateDeviceCert(r.Context(), store, cert)
+			if authErr != nil {
+				apierror.Write(w, r, authErr)
+				return
+			}
+
+			ctx := WithTenant(WithDevice(r.Context(), device), tenant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// routeTemplate returns the path template of the request's matched route
+func routeTemplate(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return ""
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return ""
+	}
+	return template
+}
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"brinkbyte-billing-server/apierror"
+	"brinkbyte-billing-server/models"
+)
+
+// Device request signing headers
+const (
+	DeviceIDHeader           = "X-Device-ID"
+	SignatureTimestampHeader = "X-Signature-Timestamp" // Unix seconds
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature" // "v1=" + hex HMAC-SHA256
+)
+
+// signatureVersion prefixes signatures so the scheme can change later
+const signatureVersion = "v1="
+
+// DeviceContextKey is the context key for the authenticated edge device
+const DeviceContextKey ContextKey = "device"
+
+// DeviceStorage is the storage device signature checks need. Nonces are
+// recorded in storage so a replay is caught by every server instance.
+type DeviceStorage interface {
+	GetEdgeDevice(ctx context.Context, deviceID string) (*models.EdgeDevice, error)
+	RecordDeviceNonce(ctx context.Context, deviceID, nonce string, expiresAt time.Time) (bool, error)
+}
+
+// DeviceSignatureConfig controls device request signature checks
+type DeviceSignatureConfig struct {
+	Required     bool          // reject unsigned requests; otherwise only signed ones are checked
+	Window       time.Duration // how far a timestamp may be from the server's clock
+	MaxBodyBytes int64         // largest signed body; see DeviceSignatureMiddleware
+}
+
+// DefaultMaxSignedBodyBytes caps signed request bodies, which are buffered
+// whole so the signature is checked before a handler sees them
+const DefaultMaxSignedBodyBytes = 16 << 20
+
+// DefaultDeviceSignatureConfig checks signatures when present, within five
+// minutes of the server's clock
+func DefaultDeviceSignatureConfig() DeviceSignatureConfig {
+	return DeviceSignatureConfig{
+		Window:       5 * time.Minute,
+		MaxBodyBytes: DefaultMaxSignedBodyBytes,
+	}
+}
+
+// WithDevice attaches the authenticated device to a context
+func WithDevice(ctx context.Context, device *models.EdgeDevice) context.Context {
+	return context.WithValue(ctx, DeviceContextKey, device)
+}
+
+// DeviceFromContext retrieves the authenticated device from a context
+func DeviceFromContext(ctx context.Context) *models.EdgeDevice {
+	if device, ok := ctx.Value(DeviceContextKey).(*models.EdgeDevice); ok {
+		return device
+	}
+	return nil
+}
+
+// DeviceSignature computes a request signature. The signed string is the
+// method, target, timestamp, nonce and hex SHA-256 of the (uncompressed) body,
+// each on its own line. The target is the escaped path, followed by "?" and
+// the raw query string exactly as sent when there is one.
+func DeviceSignature(secret, method, path, query, timestamp, nonce string, body []byte) string {
+	target := path
+	if query != "" {
+		target += "?" + query
+	}
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{method, target, timestamp, nonce, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return signatureVersion + hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedRequest carries a device request's signature headers along with the
+// method, path and query they sign
+type SignedRequest struct {
+	DeviceID  string
+	Timestamp string
+	Nonce     string
+	Signature string
+	Method    string
+	Path      string
+	Query     string // raw query string, without the "?"
+}
+
+// AuthenticateDeviceSignature verifies a device request signature and
+// returns ctx with the signing device attached. Unsigned requests pass
+// unchanged unless config.Required, and requests from devices authenticated
+// by client certificate need no signature. readBody is only called for
+// signed requests. Shared by DeviceSignatureMiddleware and the gRPC server.
+func AuthenticateDeviceSignature(ctx context.Context, store DeviceStorage, config DeviceSignatureConfig, req SignedRequest, readBody func() ([]byte, error)) (context.Context, *apierror.Error) {
+	deviceID := req.DeviceID
+	certDevice := DeviceFromContext(ctx) // set by DeviceCertificate
+	if deviceID == "" && req.Signature == "" {
+		if config.Required && certDevice == nil {
+			return nil, apierror.New(apierror.InvalidSignature, "Device signature required")
+		}
+		return ctx, nil
+	}
+
+	if certDevice != nil && deviceID != certDevice.DeviceID {
+		log.Printf("[DEVICE_AUTH] Device %s signed a request over device %s's certificate", deviceID, certDevice.DeviceID)
+		return nil, apierror.New(apierror.DeviceAccessDenied, "Signature and client certificate name different devices")
+	}
+	if certDevice != nil && req.Signature == "" {
+		return ctx, nil
+	}
+
+	if deviceID == "" || req.Signature == "" || req.Timestamp == "" || req.Nonce == "" {
+		return nil, apierror.New(apierror.InvalidSignature, "Incomplete device signature headers").
+			WithDetail("required", []string{DeviceIDHeader, SignatureTimestampHeader, SignatureNonceHeader, SignatureHeader})
+	}
+
+	now := time.Now()
+	ts, err := strconv.ParseInt(req.Timestamp, 10, 64)
+	if err != nil {
+		return nil, apierror.New(apierror.InvalidSignature, "Invalid signature timestamp")
+	}
+	if skew := now.Sub(time.Unix(ts, 0)); skew > config.Window || skew < -config.Window {
+		log.Printf("[DEVICE_AUTH] Device %s signature timestamp off by %v", deviceID, skew.Round(time.Second))
+		return nil, apierror.New(apierror.InvalidSignature, "Signature timestamp outside the allowed window").
+			WithDetail("window_seconds", int(config.Window.Seconds()))
+	}
+
+	device, err := store.GetEdgeDevice(ctx, deviceID)
+	if err != nil {
+		log.Printf("[DEVICE_AUTH] Error looking up device %s: %v", deviceID, err)
+		return nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+	if device == nil || device.SigningSecret == "" {
+		log.Printf("[DEVICE_AUTH] Signed request from unenrolled device %s", deviceID)
+		return nil, apierror.New(apierror.DeviceNotEnrolled, "Device is not enrolled")
+	}
+	if device.Status == models.DeviceStatusSuspended {
+		log.Printf("[DEVICE_AUTH] Signed request from suspended device %s", deviceID)
+		return nil, apierror.New(apierror.DeviceAccessDenied, "Device is suspended")
+	}
+
+	body, err := readBody()
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		log.Printf("[DEVICE_AUTH] Signed body from device %s exceeds %d bytes", deviceID, tooLarge.Limit)
+		return nil, apierror.Newf(apierror.PayloadTooLarge,
+			"Signed request bodies are limited to %d bytes; split the batch", tooLarge.Limit).
+			WithDetail("max_bytes", tooLarge.Limit)
+	}
+	if err != nil {
+		return nil, apierror.InvalidBody(err)
+	}
+
+	expected := DeviceSignature(device.SigningSecret, req.Method, req.Path, req.Query, req.Timestamp, req.Nonce, body)
+	if !hmac.Equal([]byte(req.Signature), []byte(expected)) {
+		log.Printf("[DEVICE_AUTH] Invalid signature from device %s", deviceID)
+		return nil, apierror.New(apierror.InvalidSignature, "Invalid device signature")
+	}
+
+	// Only remember nonces of valid signatures, so forged requests can't
+	// burn a device's nonces. A timestamp up to Window in the future
+	// stays acceptable for twice Window.
+	fresh, err := store.RecordDeviceNonce(ctx, deviceID, req.Nonce, now.Add(2*config.Window))
+	if err != nil {
+		log.Printf("[DEVICE_AUTH] Error recording nonce for device %s: %v", deviceID, err)
+		return nil, apierror.Wrap(apierror.Internal, err, "Authentication error")
+	}
+	if !fresh {
+		log.Printf("[DEVICE_AUTH] Replayed nonce from device %s", deviceID)
+		return nil, apierror.New(apierror.InvalidSignature, "Signature nonce already used")
+	}
+
+	return WithDevice(ctx, device), nil
+}
+
+// DeviceSignatureMiddleware verifies HMAC signatures from enrolled edge
+// devices and attaches the device to the request context, binding the request
+// to the device and its tenant. It must run after DecompressBody. Requests
+// from devices authenticated by client certificate need no signature.
+//
+// A signed body is read in full, up to config.MaxBodyBytes, before the
+// handler runs: verifying at the end of a stream would let handlers act on
+// events that turn out to be forged. Signed NDJSON uploads are therefore
+// buffered rather than streamed, and devices split larger batches.
+func DeviceSignatureMiddleware(store DeviceStorage, config DeviceSignatureConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := SignedRequest{
+				DeviceID:  r.Header.Get(DeviceIDHeader),
+				Timestamp: r.Header.Get(SignatureTimestampHeader),
+				Nonce:     r.Header.Get(SignatureNonceHeader),
+				Signature: r.Header.Get(SignatureHeader),
+				Method:    r.Method,
+				Path:      r.URL.EscapedPath(),
+				Query:     r.URL.RawQuery,
+			}
+			readBody := func() ([]byte, error) {
+				body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, config.MaxBodyBytes))
+				if err != nil {
+					return nil, err
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				return body, nil
+			}
+
+			ctx, authErr := AuthenticateDeviceSignature(r.Context(), store, config, req, readBody)
+			if authErr != nil {
+				apierror.Write(w, r, authErr)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
@@ -4,14 +4,25 @@ import (
 	"log"
 	"net/http"
 	"time"
+
+	"github.com/google/uuid"
+
+	"brinkbyte-billing-server/apierror"
 )
 
+// RequestIDHeader carries the request ID on requests and responses
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength bounds client-supplied request IDs
+const maxRequestIDLength = 128
+
 // CORS adds CORS headers to all responses
 func CORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-ID")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		
 		// Handle preflight
 		if r.Method == "OPTIONS" {
@@ -23,13 +34,50 @@ func CORS(next http.Handler) http.Handler {
 	})
 }
 
+// RequestID tags each request with an ID, reusing the client's X-Request-ID
+// when it sends a usable one. The ID is echoed in the response header and in
+// error bodies so failures can be traced through the logs.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(apierror.WithRequestID(r.Context(), requestID)))
+	})
+}
+
+// validRequestID accepts short IDs of printable ASCII, so they are safe to log
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NotFound answers requests that match no route
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, apierror.Newf(apierror.RouteNotFound, "No route for %s %s", r.Method, r.URL.Path))
+}
+
+// MethodNotAllowed answers requests for a route that doesn't accept the method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	apierror.Write(w, r, apierror.Newf(apierror.MethodNotAllowed, "%s is not allowed on %s", r.Method, r.URL.Path))
+}
+
 // Logging logs all HTTP requests
 func Logging(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 		
 		// Log request
-		log.Printf("[HTTP] %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		log.Printf("[HTTP] %s %s from %s (request %s)", r.Method, r.URL.Path, r.RemoteAddr, apierror.RequestIDFromContext(r.Context()))
 		
 		next.ServeHTTP(w, r)
 		
@@ -0,0 +1,227 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+
+	"brinkbyte-billing-server/apierror"
+)
+
+// OpenAPIValidation checks every request and response against doc, for use
+// in development so schema drift fails loudly. Invalid requests are rejected
+// with 400. Responses that don't match are logged and replaced with a 500
+// describing the drift; JSON response objects may not carry undocumented
+// fields. Streamed (non-JSON) responses only have their status checked.
+// Authentication is left to the auth middleware.
+func OpenAPIValidation(doc *openapi3.T) (func(http.Handler) http.Handler, error) {
+	disallowAdditionalProperties(doc)
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build OpenAPI router: %w", err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				log.Printf("[OPENAPI] %s %s is not in the spec: %v", r.Method, r.URL.Path, err)
+				apierror.Write(w, r, apierror.Newf(apierror.Internal, "OpenAPI drift: %s %s is not documented", r.Method, r.URL.Path))
+				return
+			}
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+					SkipSettingDefaults: true,
+					ExcludeRequestBody:  !validatableBody(r.Header),
+				},
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+				apierror.Write(w, r, apierror.Wrap(apierror.InvalidRequest, err, err.Error()))
+				return
+			}
+
+			rec := &validatingWriter{ResponseWriter: w, input: requestInput}
+			next.ServeHTTP(rec, r)
+			rec.finish()
+		})
+	}, nil
+}
+
+// validatableBody reports whether a body can be checked before the handler
+// sees it. Compressed bodies are decoded later by DecompressBody, and NDJSON
+// has no body decoder.
+func validatableBody(header http.Header) bool {
+	if header.Get("Content-Encoding") != "" {
+		return false
+	}
+	return isJSON(header.Get("Content-Type"))
+}
+
+func isJSON(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && mediaType == "application/json"
+}
+
+// disallowAdditionalProperties marks every object schema with documented
+// properties as closed, so undocumented fields fail validation. Maps, which
+// declare their own additionalProperties, are left alone.
+func disallowAdditionalProperties(doc *openapi3.T) {
+	seen := make(map[*openapi3.Schema]bool)
+	var walk func(ref *openapi3.SchemaRef)
+	walk = func(ref *openapi3.SchemaRef) {
+		if ref == nil || ref.Value == nil || seen[ref.Value] {
+			return
+		}
+		s := ref.Value
+		seen[s] = true
+
+		if len(s.Properties) > 0 && s.AdditionalProperties.Has == nil && s.AdditionalProperties.Schema == nil {
+			closed := false
+			s.AdditionalProperties.Has = &closed
+		}
+		for _, p := range s.Properties {
+			walk(p)
+		}
+		walk(s.Items)
+		walk(s.AdditionalProperties.Schema)
+		for _, group := range []openapi3.SchemaRefs{s.OneOf, s.AnyOf, s.AllOf} {
+			for _, sub := range group {
+				walk(sub)
+			}
+		}
+	}
+
+	for _, ref := range doc.Components.Schemas {
+		walk(ref)
+	}
+	for _, ref := range doc.Components.Responses {
+		for _, mt := range ref.Value.Content {
+			walk(mt.Schema)
+		}
+	}
+	for _, item := range doc.Paths.Map() {
+		for _, op := range item.Operations() {
+			if op.RequestBody != nil && op.RequestBody.Value != nil {
+				for _, mt := range op.RequestBody.Value.Content {
+					walk(mt.Schema)
+				}
+			}
+			for _, resp := range op.Responses.Map() {
+				if resp.Value == nil {
+					continue
+				}
+				for _, mt := range resp.Value.Content {
+					walk(mt.Schema)
+				}
+			}
+		}
+	}
+}
+
+// validatingWriter buffers JSON responses so they can be validated, and
+// replaced, before anything reaches the client. Other responses stream
+// through after their status is checked.
+type validatingWriter struct {
+	http.ResponseWriter
+	input     *openapi3filter.RequestValidationInput
+	status    int
+	buffering bool
+	body      bytes.Buffer
+}
+
+func (v *validatingWriter) WriteHeader(status int) {
+	if v.status != 0 {
+		return
+	}
+	v.status = status
+	v.buffering = isJSON(v.Header().Get("Content-Type"))
+	if v.buffering {
+		return
+	}
+
+	if err := v.validate(status, nil); err != nil {
+		log.Printf("[OPENAPI] Response drift for %s %s: %v", v.input.Request.Method, v.input.Request.URL.Path, err)
+	}
+	v.ResponseWriter.WriteHeader(status)
+}
+
+func (v *validatingWriter) Write(b []byte) (int, error) {
+	if v.status == 0 {
+		v.WriteHeader(http.StatusOK)
+	}
+	if v.buffering {
+		return v.body.Write(b)
+	}
+	return v.ResponseWriter.Write(b)
+}
+
+// Flush passes through for streamed responses; buffered ones go out at the end
+func (v *validatingWriter) Flush() {
+	if v.buffering {
+		return
+	}
+	if f, ok := v.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController
+func (v *validatingWriter) Unwrap() http.ResponseWriter {
+	return v.ResponseWriter
+}
+
+func (v *validatingWriter) validate(status int, body []byte) error {
+	input := &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: v.input,
+		Status:                 status,
+		Header:                 v.Header(),
+		Options: &openapi3filter.Options{
+			IncludeResponseStatus: true,
+			ExcludeResponseBody:   body == nil,
+		},
+	}
+	if body != nil {
+		input.SetBodyBytes(body)
+	}
+	return openapi3filter.ValidateResponse(context.Background(), input)
+}
+
+// finish validates and sends a buffered response
+func (v *validatingWriter) finish() {
+	if v.status == 0 {
+		v.WriteHeader(http.StatusOK)
+	}
+	if !v.buffering {
+		return
+	}
+
+	if err := v.validate(v.status, v.body.Bytes()); err != nil {
+		log.Printf("[OPENAPI] Response drift for %s %s: %v", v.input.Request.Method, v.input.Request.URL.Path, err)
+		v.Header().Del("Content-Length")
+		apierror.Write(v.ResponseWriter, v.input.Request, apierror.Wrap(apierror.Internal, err, "OpenAPI drift: response does not match the spec: "+err.Error()))
+		return
+	}
+	v.ResponseWriter.WriteHeader(v.status)
+	io.Copy(v.ResponseWriter, &v.body)
+}
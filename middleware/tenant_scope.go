@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"brinkbyte-billing-server/apierror"
+)
+
+// ScopeTenant binds a tenant ID taken from a request to the authenticated
+// tenant and returns the ID to act on. An empty ID means the caller's own
+// tenant. Keys may only act for their own tenant unless the tenant has
+// cross-tenant access (partner keys), and signed device requests only for the
+// device's tenant. Without an authenticated tenant, as when REQUIRE_AUTH is
+// off, IDs are used as given.
+func ScopeTenant(ctx context.Context, tenantID string) (string, *apierror.Error) {
+	if device := DeviceFromContext(ctx); device != nil && tenantID != device.TenantID {
+		if tenantID != "" {
+			log.Printf("[DEVICE_AUTH] Device %s denied access to tenant %s", device.DeviceID, tenantID)
+			return "", apierror.New(apierror.DeviceAccessDenied, "Device is not enrolled for this tenant").
+				WithDetail("tenant_id", tenantID)
+		}
+		tenantID = device.TenantID
+	}
+
+	caller := TenantFromContext(ctx)
+	if caller == nil || tenantID == caller.ID {
+		return tenantID, nil
+	}
+	if tenantID == "" {
+		return caller.ID, nil
+	}
+	if caller.CrossTenant {
+		log.Printf("[AUTH] Partner tenant %s acting for tenant %s", caller.ID, tenantID)
+		return tenantID, nil
+	}
+
+	log.Printf("[AUTH] Tenant %s denied access to tenant %s", caller.ID, tenantID)
+	return "", apierror.New(apierror.TenantAccessDenied, "API key is not authorized for this tenant").
+		WithDetail("tenant_id", tenantID)
+}
+
+// TenantScope rejects requests whose {tenantId} path variable names a tenant
+// the caller may not act for. It must run after AuthMiddleware, on a router
+// whose routes have been matched.
+func TenantScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tenantID, ok := mux.Vars(r)["tenantId"]; ok {
+			if _, authErr := ScopeTenant(r.Context(), tenantID); authErr != nil {
+				apierror.Write(w, r, authErr)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"sort"
+	"time"
+)
+
+// AdminPermission allows a group of admin API routes
+type AdminPermission string
+
+// Admin permissions
+const (
+	PermTenantsRead        AdminPermission = "tenants:read"
+	PermTenantsWrite       AdminPermission = "tenants:write"
+	PermSubscriptionsRead  AdminPermission = "subscriptions:read"
+	PermSubscriptionsWrite AdminPermission = "subscriptions:write"
+	PermBillingRead        AdminPermission = "billing:read"  // payments, credit notes, wallets, periods, dunning, revenue
+	PermBillingWrite       AdminPermission = "billing:write" // charges, refunds, credit notes, wallet credit, period close
+	PermUsageRead          AdminPermission = "usage:read"
+	PermUsageWrite         AdminPermission = "usage:write" // rollup rebuilds, archives, held usage review
+	PermAdminsManage       AdminPermission = "admins:manage"
+)
+
+// Admin roles
+const (
+	AdminRoleViewer       = "viewer"        // read-only
+	AdminRoleSupport      = "support"       // manages tenants, subscriptions and usage
+	AdminRoleBillingAdmin = "billing-admin" // manages subscriptions, money and usage
+	AdminRoleSuperAdmin   = "super-admin"   // everything, including admins
+)
+
+// Admin principal statuses
+const (
+	AdminStatusActive   = "active"
+	AdminStatusDisabled = "disabled"
+)
+
+var adminReadPermissions = []AdminPermission{PermTenantsRead, PermSubscriptionsRead, PermBillingRead, PermUsageRead}
+
+var adminRolePermissions = map[string][]AdminPermission{
+	AdminRoleViewer:       adminReadPermissions,
+	AdminRoleSupport:      append([]AdminPermission{PermTenantsWrite, PermSubscriptionsWrite, PermUsageWrite}, adminReadPermissions...),
+	AdminRoleBillingAdmin: append([]AdminPermission{PermSubscriptionsWrite, PermBillingWrite, PermUsageWrite}, adminReadPermissions...),
+	AdminRoleSuperAdmin: append([]AdminPermission{PermTenantsWrite, PermSubscriptionsWrite, PermBillingWrite, PermUsageWrite,
+		PermAdminsManage}, adminReadPermissions...),
+}
+
+// ValidAdminRole reports whether role is a known admin role
+func ValidAdminRole(role string) bool {
+	_, ok := adminRolePermissions[role]
+	return ok
+}
+
+// AdminPrincipal is a named admin API user. Only a hash of its key is
+// stored; the key itself is shown once, when issued.
+type AdminPrincipal struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     *string   `json:"email,omitempty"`
+	Roles     []string  `json:"roles"`
+	Status    string    `json:"status"`     // active, disabled
+	KeyPrefix string    `json:"key_prefix"` // identifies the key without revealing it
+	KeyHash   string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Can reports whether any of the principal's roles grants p
+func (a *AdminPrincipal) Can(p AdminPermission) bool {
+	for _, role := range a.Roles {
+		for _, granted := range adminRolePermissions[role] {
+			if granted == p {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Permissions lists everything the principal's roles grant
+func (a *AdminPrincipal) Permissions() []AdminPermission {
+	seen := make(map[AdminPermission]bool)
+	perms := []AdminPermission{}
+	for _, role := range a.Roles {
+		for _, p := range adminRolePermissions[role] {
+			if !seen[p] {
+				seen[p] = true
+				perms = append(perms, p)
+			}
+		}
+	}
+	sort.Slice(perms, func(i, j int) bool { return perms[i] < perms[j] })
+	return perms
+}
+
+// String identifies the principal in logs
+func (a *AdminPrincipal) String() string {
+	return a.Name + " (" + a.ID + ")"
+}
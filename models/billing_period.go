@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Billing period status values. Late usage for a closed period is moved into
+// the current period as an adjustment; late usage for a locked period is
+// held for review.
+const (
+	BillingPeriodClosed = "closed"
+	BillingPeriodLocked = "locked"
+)
+
+// Held usage event status values
+const (
+	HeldUsagePending  = "pending"
+	HeldUsageReleased = "released"
+	HeldUsageRejected = "rejected"
+)
+
+// Metadata keys labelling usage moved out of a closed period
+const (
+	AdjustmentMetadataKey       = "late_adjustment"
+	AdjustmentOriginalTimeKey   = "original_event_time"
+	AdjustmentClosedPeriodIDKey = "closed_period_id"
+)
+
+// BillingPeriod is a tenant billing period that has been closed to new usage.
+// Open periods are not stored.
+type BillingPeriod struct {
+	ID          string             `json:"id"`
+	TenantID    string             `json:"tenant_id"`
+	PeriodStart time.Time          `json:"period_start"`
+	PeriodEnd   time.Time          `json:"period_end"`
+	Status      string             `json:"status"`       // closed, locked
+	UsageTotals map[string]float64 `json:"usage_totals"` // usage by event type when closed
+	ClosedBy    *string            `json:"closed_by,omitempty"`
+	ClosedAt    time.Time          `json:"closed_at"`
+	LockedAt    *time.Time         `json:"locked_at,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+// Contains reports whether t falls inside the period
+func (p *BillingPeriod) Contains(t time.Time) bool {
+	return !t.Before(p.PeriodStart) && t.Before(p.PeriodEnd)
+}
+
+// HeldUsageEvent is a late usage event for a locked period awaiting review
+type HeldUsageEvent struct {
+	ID         string     `json:"id"`
+	TenantID   string     `json:"tenant_id"`
+	PeriodID   string     `json:"period_id"`
+	Event      UsageEvent `json:"event"`
+	Status     string     `json:"status"` // pending, released, rejected
+	ReceivedAt time.Time  `json:"received_at"`
+	ReviewedBy *string    `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	Note       *string    `json:"note,omitempty"`
+}
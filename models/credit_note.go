@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// Credit note reason codes
+const (
+	CreditReasonDowngrade       = "downgrade"
+	CreditReasonGoodwill        = "goodwill"
+	CreditReasonBillingError    = "billing_error"
+	CreditReasonDuplicateCharge = "duplicate_charge"
+	CreditReasonServiceOutage   = "service_outage"
+)
+
+// Credit note settlement methods
+const (
+	CreditMethodRefund        = "refund"         // money returned through the payment provider
+	CreditMethodAccountCredit = "account_credit" // applied to the tenant's next bill
+)
+
+// Credit note status values
+const (
+	CreditNoteStatusIssued            = "issued"
+	CreditNoteStatusRefunded          = "refunded"
+	CreditNoteStatusPartiallyRefunded = "partially_refunded" // some refunds failed after others went through
+	CreditNoteStatusCredited          = "credited"
+	CreditNoteStatusFailed            = "failed"
+)
+
+// CreditNoteLineItem is one credited amount, optionally referencing the original charge
+type CreditNoteLineItem struct {
+	Description      string     `json:"description"`
+	Amount           float64    `json:"amount"`
+	PaymentAttemptID *string    `json:"payment_attempt_id,omitempty"`
+	PeriodStart      *time.Time `json:"period_start,omitempty"`
+	PeriodEnd        *time.Time `json:"period_end,omitempty"`
+	RefundedAmount   float64    `json:"refunded_amount,omitempty"` // returned through the payment provider
+	RefundID         *string    `json:"refund_id,omitempty"`
+	RefundError      *string    `json:"refund_error,omitempty"` // why the refund of this line failed
+}
+
+// CreditNote records money owed back to a tenant against billed periods
+type CreditNote struct {
+	ID        string               `json:"id"`
+	Number    string               `json:"number"`
+	TenantID  string               `json:"tenant_id"`
+	Reason    string               `json:"reason"` // downgrade, goodwill, billing_error, duplicate_charge, service_outage
+	Method    string               `json:"method"` // refund, account_credit
+	Status    string               `json:"status"` // issued, refunded, partially_refunded, credited, failed
+	Currency  string               `json:"currency"`
+	Total     float64              `json:"total"`
+	LineItems []CreditNoteLineItem `json:"line_items"`
+	Memo      *string              `json:"memo,omitempty"`
+	IssuedBy  *string              `json:"issued_by,omitempty"`
+	IssuedAt  time.Time            `json:"issued_at"`
+	CreatedAt time.Time            `json:"created_at"`
+	UpdatedAt time.Time            `json:"updated_at"`
+}
+
+// Refunded returns how much of the note was returned through the payment provider
+func (n *CreditNote) Refunded() float64 {
+	var total float64
+	for _, item := range n.LineItems {
+		total += item.RefundedAmount
+	}
+	return total
+}
+
+// IsValidCreditReason reports whether the reason is a known reason code
+func IsValidCreditReason(reason string) bool {
+	switch reason {
+	case CreditReasonDowngrade, CreditReasonGoodwill, CreditReasonBillingError,
+		CreditReasonDuplicateCharge, CreditReasonServiceOutage:
+		return true
+	}
+	return false
+}
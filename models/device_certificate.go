@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Device certificate revocation reasons
+const (
+	CertRevocationUnspecified = "unspecified"
+	CertRevocationSuperseded  = "superseded" // replaced by credentials issued at re-enrollment
+	CertRevocationCompromise  = "key_compromise"
+	CertRevocationRetired     = "device_retired"
+)
+
+// ValidCertRevocationReason reports whether reason is a known revocation reason
+func ValidCertRevocationReason(reason string) bool {
+	switch reason {
+	case CertRevocationUnspecified, CertRevocationSuperseded, CertRevocationCompromise, CertRevocationRetired:
+		return true
+	}
+	return false
+}
+
+// DeviceCertificate records a client certificate issued to an edge device by
+// the internal CA. Requests presenting a certificate are only accepted while
+// its record exists and is not revoked.
+type DeviceCertificate struct {
+	Serial           string     `json:"serial"` // hex serial number
+	DeviceID         string     `json:"device_id"`
+	TenantID         string     `json:"tenant_id"`
+	Subject          string     `json:"subject"`
+	NotBefore        time.Time  `json:"not_before"`
+	NotAfter         time.Time  `json:"not_after"`
+	RevokedAt        *time.Time `json:"revoked_at,omitempty"`
+	RevocationReason *string    `json:"revocation_reason,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// Revoked reports whether the certificate has been revoked
+func (c *DeviceCertificate) Revoked() bool {
+	return c.RevokedAt != nil
+}
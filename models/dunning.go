@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Dunning case status values
+const (
+	DunningStatusOpen      = "open"
+	DunningStatusRecovered = "recovered"
+	DunningStatusSuspended = "suspended"
+)
+
+// DunningCase tracks the retry schedule for a tenant's failed payment
+type DunningCase struct {
+	ID               string     `json:"id"`
+	TenantID         string     `json:"tenant_id"`
+	SubscriptionID   *string    `json:"subscription_id,omitempty"`
+	PaymentAttemptID string     `json:"payment_attempt_id"` // the charge that failed first
+	LastAttemptID    string     `json:"last_attempt_id"`    // the most recent charge in this case
+	Amount           float64    `json:"amount"`
+	Description      string     `json:"description"`
+	ReferenceType    string     `json:"reference_type"`
+	ReferenceID      *string    `json:"reference_id,omitempty"`
+	Status           string     `json:"status"` // open, recovered, suspended
+	RetryCount       int        `json:"retry_count"`
+	NextActionAt     *time.Time `json:"next_action_at,omitempty"`
+	StartedAt        time.Time  `json:"started_at"`
+	ResolvedAt       *time.Time `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
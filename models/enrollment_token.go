@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// EnrollmentToken is a short-lived, single-use secret an edge device
+// exchanges for its credentials. Only a hash of the token is stored.
+type EnrollmentToken struct {
+	ID             string     `json:"id"`
+	TenantID       string     `json:"tenant_id"`
+	TokenPrefix    string     `json:"token_prefix"` // first characters of the token, to tell tokens apart
+	TokenHash      string     `json:"-"`
+	ManagementTier *string    `json:"management_tier,omitempty"` // tier the enrolled device is fixed to
+	MaxCameras     *int       `json:"max_cameras,omitempty"`     // cameras the enrolled device may license
+	CreatedBy      string     `json:"created_by"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	UsedAt         *time.Time `json:"used_at,omitempty"`
+	UsedByDevice   *string    `json:"used_by_device,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Redeemable reports whether the token is unused and unexpired
+func (t *EnrollmentToken) Redeemable(now time.Time) bool {
+	return t.UsedAt == nil && now.Before(t.ExpiresAt)
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Admin list page sizes
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// ListCursor marks the last item of a page. Lists are ordered by
+// (created_at, id), so the next page starts strictly after the cursor and
+// is stable while new rows are inserted.
+type ListCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Encode returns the opaque cursor string handed to clients
+func (c ListCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseListCursor decodes a cursor produced by Encode
+func ParseListCursor(s string) (*ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || id == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &ListCursor{CreatedAt: t, ID: id}, nil
+}
+
+// Admits reports whether an item belongs after the cursor. A nil cursor
+// admits everything.
+func (c *ListCursor) Admits(createdAt time.Time, id string) bool {
+	if c == nil {
+		return true
+	}
+	if !createdAt.Equal(c.CreatedAt) {
+		return createdAt.After(c.CreatedAt)
+	}
+	return id > c.ID
+}
+
+// ListOrderLess orders list items by (created_at, id)
+func ListOrderLess(aCreated time.Time, aID string, bCreated time.Time, bID string) bool {
+	if !aCreated.Equal(bCreated) {
+		return aCreated.Before(bCreated)
+	}
+	return aID < bID
+}
+
+// TenantListQuery filters a page of tenants
+type TenantListQuery struct {
+	Status        string     // optional filter
+	Plan          string     // optional filter on the tenant's current subscription
+	CreatedAfter  *time.Time // optional, inclusive
+	CreatedBefore *time.Time // optional, exclusive
+	NameSearch    string     // optional case-insensitive substring of the name
+	After         *ListCursor
+	Limit         int
+}
+
+// SubscriptionListQuery filters a page of current subscriptions, one per tenant
+type SubscriptionListQuery struct {
+	Plan           string     // optional filter
+	Status         string     // optional filter
+	ExpiringBefore *time.Time // optional; see Subscription.ExpiresAt
+	After          *ListCursor
+	Limit          int
+}
+
+// CameraLicenseListQuery filters a page of camera licenses
+type CameraLicenseListQuery struct {
+	TenantID            string     // optional filter
+	Mode                string     // optional license_mode filter
+	IsValid             *bool      // optional filter
+	LastValidatedAfter  *time.Time // optional, inclusive
+	LastValidatedBefore *time.Time // optional, exclusive
+	After               *ListCursor
+	Limit               int
+}
+
+// ExpiresAt is when the subscription's current term ends: the trial end for
+// trials, otherwise the subscription end date. Nil means open-ended.
+func (s *Subscription) ExpiresAt() *time.Time {
+	if s.Plan == "trial" {
+		return s.TrialEndDate
+	}
+	return s.SubscriptionEndDate
+}
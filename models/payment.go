@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Payment attempt status values
+const (
+	PaymentStatusPending           = "pending"
+	PaymentStatusSucceeded         = "succeeded"
+	PaymentStatusFailed            = "failed"
+	PaymentStatusRefunded          = "refunded"
+	PaymentStatusPartiallyRefunded = "partially_refunded"
+)
+
+// PaymentAccount links a tenant to its customer record at the payment provider
+type PaymentAccount struct {
+	TenantID        string    `json:"tenant_id"`
+	Provider        string    `json:"provider"`
+	CustomerID      string    `json:"customer_id"`
+	PaymentMethodID *string   `json:"payment_method_id,omitempty"`
+	CardBrand       *string   `json:"card_brand,omitempty"`
+	CardLast4       *string   `json:"card_last4,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PaymentAttempt records a single charge against a tenant and what it paid for
+type PaymentAttempt struct {
+	ID               string    `json:"id"`
+	TenantID         string    `json:"tenant_id"`
+	SubscriptionID   *string   `json:"subscription_id,omitempty"`
+	Provider         string    `json:"provider"`
+	ProviderChargeID *string   `json:"provider_charge_id,omitempty"`
+	Amount           float64   `json:"amount"`
+	RefundedAmount   float64   `json:"refunded_amount"`
+	Currency         string    `json:"currency"`
+	Status           string    `json:"status"` // pending, succeeded, failed, refunded, partially_refunded
+	FailureCode      *string   `json:"failure_code,omitempty"`
+	FailureMessage   *string   `json:"failure_message,omitempty"`
+	Description      string    `json:"description"`
+	ReferenceType    string    `json:"reference_type"` // subscription, billing_cycle, growth_pack, manual
+	ReferenceID      *string   `json:"reference_id,omitempty"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
@@ -11,15 +11,24 @@ const (
 	TrialDurationDays = 90 // Trial period in days
 )
 
+// Billing cycle configuration constants
+const (
+	BillingCycleMonthly   = "monthly"
+	BillingCycleAnnual    = "annual"
+	AnnualDiscountPercent = 15 // Discount off 12x the monthly price when billed annually
+)
+
 // Tenant represents a customer/organization
 type Tenant struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Email     *string   `json:"email,omitempty"`
-	APIKey    *string   `json:"api_key,omitempty"`
-	Status    string    `json:"status"` // active, suspended, cancelled
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Email       *string   `json:"email,omitempty"`
+	APIKey      *string   `json:"api_key,omitempty"`
+	Status      string    `json:"status"`       // active, suspended, cancelled
+	Timezone    string    `json:"timezone"`     // IANA name used for usage reporting, e.g. Australia/Sydney
+	CrossTenant bool      `json:"cross_tenant"` // partner key that may act for other tenants
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Subscription represents a tenant's subscription plan
@@ -34,6 +43,10 @@ type Subscription struct {
 	SubscriptionStartDate *time.Time `json:"subscription_start_date,omitempty"`
 	SubscriptionEndDate   *time.Time `json:"subscription_end_date,omitempty"`
 	BillingCycle          string     `json:"billing_cycle"` // monthly, annual
+	BillingAnchorDate     *time.Time `json:"billing_anchor_date,omitempty"` // start of the current billing cycle schedule
+	CreditBalance         float64    `json:"credit_balance"`                // credit carried to the next bill (AUD)
+	PeriodPaidAmount      float64    `json:"period_paid_amount"`            // paid towards the billing period starting at PeriodPaidStart (AUD)
+	PeriodPaidStart       *time.Time `json:"period_paid_start,omitempty"`   // start of the period PeriodPaidAmount covers; unset means the first cycle from the anchor date
 	CreatedAt             time.Time  `json:"created_at"`
 	UpdatedAt             time.Time  `json:"updated_at"`
 }
@@ -89,10 +102,37 @@ type EdgeDevice struct {
 	ManagementTier    string     `json:"management_tier"` // basic, managed
 	LastHeartbeat     *time.Time `json:"last_heartbeat,omitempty"`
 	ActiveCameraCount int        `json:"active_camera_count"`
+	SigningSecret     string     `json:"-"` // HMAC key for signed requests, issued at enrollment
+	EnrolledAt        *time.Time `json:"enrolled_at,omitempty"`
+	MaxCameras        *int       `json:"max_cameras,omitempty"` // cameras the device may license, from its enrollment token
+	TierLocked        bool       `json:"tier_locked,omitempty"` // management tier set by the enrollment token; heartbeats can't change it
 	CreatedAt         time.Time  `json:"created_at"`
 	UpdatedAt         time.Time  `json:"updated_at"`
 }
 
+// Edge device statuses
+const (
+	DeviceStatusActive    = "active"
+	DeviceStatusOffline   = "offline"
+	DeviceStatusSuspended = "suspended"
+)
+
+// Edge device management tiers
+const (
+	ManagementTierBasic   = "basic"
+	ManagementTierManaged = "managed"
+)
+
+// ValidManagementTier reports whether tier is a known management tier
+func ValidManagementTier(tier string) bool {
+	return tier == ManagementTierBasic || tier == ManagementTierManaged
+}
+
+// Enrolled reports whether the device has been issued credentials
+func (d *EdgeDevice) Enrolled() bool {
+	return d.EnrolledAt != nil
+}
+
 // GrowthPackInfo represents growth pack metadata
 type GrowthPackInfo struct {
 	PackID       string   `json:"pack_id"`
@@ -100,6 +140,7 @@ type GrowthPackInfo struct {
 	Description  string   `json:"description"`
 	Category     string   `json:"category"`
 	PriceMonthly float64  `json:"price_monthly"`
+	PriceAnnual  float64  `json:"price_annual,omitempty"` // overrides the discounted 12x monthly price
 	Features     []string `json:"features"`
 	IsEnabled    bool     `json:"is_enabled"`
 }
@@ -140,6 +181,7 @@ func AvailableGrowthPacks() []GrowthPackInfo {
 			Description:  "Extended cloud storage for video and analytics data",
 			Category:     "data",
 			PriceMonthly: 149.00,
+			PriceAnnual:  1490.00,
 			Features: []string{
 				"1TB cloud storage",
 				"30-day retention",
@@ -166,6 +208,7 @@ func AvailableGrowthPacks() []GrowthPackInfo {
 			Description:  "AI-powered insights and LLM-based analytics",
 			Category:     "intelligence",
 			PriceMonthly: 599.00,
+			PriceAnnual:  5990.00,
 			Features: []string{
 				"Full analyst seat",
 				"Premium connectors",
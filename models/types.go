@@ -2,7 +2,10 @@ package models
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,6 +22,7 @@ type LicenseValidationResponse struct {
 	EnabledGrowthPacks []string  `json:"enabled_growth_packs"`
 	ValidUntil         time.Time `json:"valid_until"`
 	CamerasAllowed     int       `json:"cameras_allowed"`
+	Reason             string    `json:"reason,omitempty"` // apierror code explaining is_valid=false
 }
 
 // Entitlement check structures
@@ -56,9 +60,26 @@ type UsageEventLegacy struct {
 	Metadata   map[string]interface{} `json:"metadata"`
 }
 
-// FlexibleTime handles time that may come as Unix timestamp string or RFC3339
+// Timestamp formats FlexibleTime recognises, as reported in its Format field
+const (
+	TimeFormatMissing     = "missing"
+	TimeFormatUnixSeconds = "unix_seconds"
+	TimeFormatUnixMillis  = "unix_millis"
+	TimeFormatUnixMicros  = "unix_micros"
+	TimeFormatUnixNanos   = "unix_nanos"
+	TimeFormatRFC3339     = "rfc3339"
+	TimeFormatDateTime    = "datetime" // 2006-01-02 15:04:05 without a zone, taken as UTC
+	TimeFormatDate        = "date"
+	TimeFormatInvalid     = "invalid"
+)
+
+// FlexibleTime handles time that may come as Unix timestamp string or RFC3339.
+// Unparseable values don't fail decoding: Time is left zero and Err is set, so
+// callers can reject the single event.
 type FlexibleTime struct {
 	time.Time
+	Format string `json:"-"` // one of the TimeFormat constants
+	Err    error  `json:"-"`
 }
 
 func (ft *FlexibleTime) UnmarshalJSON(data []byte) error {
@@ -68,41 +89,83 @@ func (ft *FlexibleTime) UnmarshalJSON(data []byte) error {
 		s = s[1 : len(s)-1]
 	}
 
-	// Try parsing as Unix timestamp (seconds)
-	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
-		ft.Time = time.Unix(ts, 0)
-		return nil
+	if s == "null" {
+		s = ""
 	}
+	*ft = NewFlexibleTime(s)
+	return nil
+}
 
-	// Try RFC3339
-	if t, err := time.Parse(time.RFC3339, s); err == nil {
-		ft.Time = t
-		return nil
+// NewFlexibleTime parses an unquoted event time the way UnmarshalJSON does.
+// An empty string is a missing time.
+func NewFlexibleTime(s string) FlexibleTime {
+	if s == "" {
+		return FlexibleTime{Format: TimeFormatMissing}
 	}
+	t, format, err := ParseFlexibleTime(s)
+	return FlexibleTime{Time: t, Format: format, Err: err}
+}
 
-	// Try RFC3339Nano
-	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
-		ft.Time = t
-		return nil
-	}
+// Epoch magnitudes above which a Unix timestamp is taken to be in a finer
+// unit. 1e11 seconds is in the year 5138, while 1e11 milliseconds is 1973,
+// so values from any realistic clock fall clearly on one side.
+const (
+	epochMillisThreshold = 1e11
+	epochMicrosThreshold = 1e14
+	epochNanosThreshold  = 1e17
+)
 
-	// Try other formats
-	formats := []string{
-		"2006-01-02T15:04:05Z",
-		"2006-01-02 15:04:05",
-		"2006-01-02",
+// ParseFlexibleTime parses a Unix timestamp in seconds, milliseconds,
+// microseconds or nanoseconds (told apart by magnitude), RFC3339, or a plain
+// UTC date or date-time, and reports which format it was
+func ParseFlexibleTime(s string) (time.Time, string, error) {
+	if ts, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return unixTime(float64(ts), ts)
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsInf(f, 0) && !math.IsNaN(f) {
+		return unixTime(f, 0)
 	}
 
-	for _, format := range formats {
+	if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+		return t, TimeFormatRFC3339, nil
+	}
+	for _, format := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
 		if t, err := time.Parse(format, s); err == nil {
-			ft.Time = t
-			return nil
+			return t, TimeFormatDateTime, nil
 		}
 	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, TimeFormatDate, nil
+	}
 
-	// Default to current time if all parsing fails
-	ft.Time = time.Now()
-	return nil
+	return time.Time{}, TimeFormatInvalid, fmt.Errorf("unrecognised timestamp %q", s)
+}
+
+// unixTime converts an epoch value in whichever unit its magnitude implies.
+// Integer values are passed as exact too so nanosecond precision survives.
+func unixTime(v float64, exact int64) (time.Time, string, error) {
+	abs := math.Abs(v)
+	switch {
+	case abs < epochMillisThreshold:
+		sec, frac := math.Modf(v)
+		return time.Unix(int64(sec), int64(frac*1e9)), TimeFormatUnixSeconds, nil
+	case abs < epochMicrosThreshold:
+		if exact != 0 {
+			return time.UnixMilli(exact), TimeFormatUnixMillis, nil
+		}
+		return time.Unix(0, int64(v*1e6)), TimeFormatUnixMillis, nil
+	case abs < epochNanosThreshold:
+		if exact != 0 {
+			return time.UnixMicro(exact), TimeFormatUnixMicros, nil
+		}
+		return time.Unix(0, int64(v*1e3)), TimeFormatUnixMicros, nil
+	case abs < math.MaxInt64:
+		if exact != 0 {
+			return time.Unix(0, exact), TimeFormatUnixNanos, nil
+		}
+		return time.Unix(0, int64(v)), TimeFormatUnixNanos, nil
+	}
+	return time.Time{}, TimeFormatInvalid, fmt.Errorf("timestamp %v out of range", v)
 }
 
 // UsageEventInput is the input format from C++ client with flexible event_time
@@ -124,9 +187,150 @@ type UsageBatchRequest struct {
 type UsageBatchResponse struct {
 	AcceptedCount int      `json:"accepted_count"`
 	RejectedCount int      `json:"rejected_count"`
+	AdjustedCount int      `json:"adjusted_count,omitempty"` // accepted late events moved into the current period
+	HeldCount     int      `json:"held_count,omitempty"`     // late events held for review
 	Errors        []string `json:"errors"`
 }
 
+// Usage rollup granularities
+const (
+	RollupHour = "hour"
+	RollupDay  = "day"
+)
+
+// UsageRollup is pre-aggregated usage for one tenant, event type and
+// resource over an hour or day bucket (UTC)
+type UsageRollup struct {
+	Granularity string    `json:"granularity"` // hour, day
+	TenantID    string    `json:"tenant_id"`
+	EventType   string    `json:"event_type"`
+	ResourceID  string    `json:"resource_id"`
+	BucketStart time.Time `json:"bucket_start"`
+	Quantity    float64   `json:"quantity"`
+	EventCount  int       `json:"event_count"`
+}
+
+// Usage time-series granularities
+const (
+	GranularityHour  = "hour"
+	GranularityDay   = "day"
+	GranularityMonth = "month"
+)
+
+// UsageBucket is the usage of one event type in one time-series bucket
+type UsageBucket struct {
+	EventType   string    `json:"event_type"`
+	BucketStart time.Time `json:"bucket_start"`
+	Quantity    float64   `json:"quantity"`
+}
+
+// UsageBucketStart returns the start of the time-series bucket containing t in loc
+func UsageBucketStart(t time.Time, granularity string, loc *time.Location) time.Time {
+	t = t.In(loc)
+	switch granularity {
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+	case GranularityDay:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+}
+
+// NextUsageBucket returns the start of the bucket after the one starting at t
+func NextUsageBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	case GranularityDay:
+		return t.AddDate(0, 0, 1)
+	}
+	return t.Add(time.Hour)
+}
+
+// UsagePoint is one zero-filled bucket of a usage series
+type UsagePoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	Quantity    float64   `json:"quantity"`
+}
+
+// UsageSeries is the bucketed usage of one event type
+type UsageSeries struct {
+	EventType string       `json:"event_type"`
+	Total     float64      `json:"total"`
+	Points    []UsagePoint `json:"points"`
+}
+
+// Usage breakdown dimensions; metadata keys are addressed as "metadata.<key>"
+const (
+	DimensionEventType      = "event_type"
+	DimensionResourceID     = "resource_id"
+	DimensionMetadataPrefix = "metadata."
+)
+
+// DefaultUsageMetadataKeys are the metadata keys usage can be broken down by
+func DefaultUsageMetadataKeys() []string {
+	return []string{"camera_id", "site", "model", "agent_id"}
+}
+
+// UsageBreakdownQuery groups and filters a tenant's usage over [Start, End]
+type UsageBreakdownQuery struct {
+	TenantID        string
+	Start           time.Time
+	End             time.Time
+	EventType       string            // optional filter
+	ResourceID      string            // optional filter
+	MetadataFilters map[string]string // metadata key -> required string value
+	GroupBy         []string          // event_type, resource_id, metadata.<key>
+	Limit           int
+}
+
+// UsesMetadata reports whether the query needs raw event metadata
+func (q UsageBreakdownQuery) UsesMetadata() bool {
+	if len(q.MetadataFilters) > 0 {
+		return true
+	}
+	for _, dim := range q.GroupBy {
+		if strings.HasPrefix(dim, DimensionMetadataPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// UsageExportQuery selects raw usage events to export over [Start, End)
+type UsageExportQuery struct {
+	TenantID  string // empty exports every tenant
+	EventType string // optional filter
+	Start     time.Time
+	End       time.Time
+}
+
+// UsageBreakdownRow is the usage of one combination of group-by values
+type UsageBreakdownRow struct {
+	Dimensions map[string]string `json:"dimensions"`
+	Quantity   float64           `json:"quantity"`
+	Amount     *float64          `json:"amount,omitempty"` // share of the rated charge, when grouped by event type
+}
+
+// RatedCharge is the priced usage of one event type over a period
+type RatedCharge struct {
+	EventType string  `json:"event_type"`
+	Quantity  float64 `json:"quantity"`
+	Unit      string  `json:"unit"`
+	Model     string  `json:"pricing_model"` // flat, tiered, package
+	Amount    float64 `json:"amount"`
+}
+
+// RatedUsage is a tenant's priced usage for a billing period
+type RatedUsage struct {
+	TenantID    string        `json:"tenant_id"`
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Charges     []RatedCharge `json:"charges"`
+	Total       float64       `json:"total"`
+	Currency    string        `json:"currency"`
+}
+
 // Heartbeat structures
 type HeartbeatRequest struct {
 	DeviceID        string   `json:"device_id"`
@@ -152,7 +356,9 @@ type HealthResponse struct {
 
 // Stats response
 type StatsResponse struct {
-	TotalEvents int            `json:"total_events"`
-	ByType      map[string]int `json:"by_type"`
-	Tenants     int            `json:"tenants"`
+	TotalEvents         int              `json:"total_events"`
+	ByType              map[string]int   `json:"by_type"`
+	Tenants             int              `json:"tenants"`
+	TimestampFormats    map[string]int64 `json:"timestamp_formats"`    // usage event_time formats seen since startup
+	TimestampRejections map[string]int64 `json:"timestamp_rejections"` // usage events rejected by reason since startup
 }
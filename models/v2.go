@@ -0,0 +1,108 @@
+package models
+
+import "time"
+
+// Typed /api/v2 response bodies. Unlike their v1 counterparts every field is
+// always present: optional values are null rather than missing, lists are
+// empty rather than null, and times are RFC3339.
+
+// Pricing is the cost breakdown of a subscription
+type Pricing struct {
+	BaseCost       float64            `json:"base_cost"`
+	CameraCount    int                `json:"camera_count"`
+	PerCameraRate  float64            `json:"per_camera_rate"`
+	GrowthPacks    map[string]float64 `json:"growth_packs"`
+	GrowthPackCost float64            `json:"growth_pack_cost"`
+	TotalMonthly   float64            `json:"total_monthly"`
+	BillingCycle   string             `json:"billing_cycle"`
+	TotalPerCycle  float64            `json:"total_per_cycle"`
+	AnnualDiscount float64            `json:"annual_discount"` // saving vs 12x monthly; 0 on monthly billing
+	Currency       string             `json:"currency"`
+}
+
+// CameraLicenseStatus is the license state of one of a tenant's cameras
+type CameraLicenseStatus struct {
+	CameraID           string     `json:"camera_id"`
+	TenantID           string     `json:"tenant_id"`
+	Mode               string     `json:"mode"`
+	IsValid            bool       `json:"is_valid"`
+	EnabledGrowthPacks []string   `json:"enabled_growth_packs"`
+	ValidUntil         *time.Time `json:"valid_until"`
+	CreatedAt          time.Time  `json:"created_at"`
+}
+
+// LicenseStatus is a tenant's license status
+type LicenseStatus struct {
+	TenantID           string                `json:"tenant_id"`
+	LicenseMode        string                `json:"license_mode"` // trial, base, enterprise, expired or unlicensed
+	IsValid            bool                  `json:"is_valid"`
+	ActiveCameras      int                   `json:"active_cameras"`
+	CamerasAllowed     int                   `json:"cameras_allowed"`
+	TrialMaxCameras    int                   `json:"trial_max_cameras"`
+	DaysRemaining      *int                  `json:"days_remaining"`   // trials only
+	TrialStartedAt     *time.Time            `json:"trial_started_at"` // trials only
+	ValidUntil         *time.Time            `json:"valid_until"`      // null when unlicensed
+	EnabledGrowthPacks []string              `json:"enabled_growth_packs"`
+	Cameras            []CameraLicenseStatus `json:"cameras"`
+	Pricing            Pricing               `json:"pricing"`
+	LicenseKey         string                `json:"license_key"` // masked to the last 4 characters
+	CanRevoke          bool                  `json:"can_revoke"`
+}
+
+// SubscriptionGrowthPack is a growth pack enabled on a subscription
+type SubscriptionGrowthPack struct {
+	PackName     string    `json:"pack_name"`
+	EnabledAt    time.Time `json:"enabled_at"`
+	PriceMonthly *float64  `json:"price_monthly"` // custom price; null uses the list price
+}
+
+// SubscriptionSummary is a tenant's subscription and what it costs
+type SubscriptionSummary struct {
+	SubscriptionID   string                   `json:"subscription_id"`
+	TenantID         string                   `json:"tenant_id"`
+	Plan             string                   `json:"plan"`
+	Status           string                   `json:"status"`
+	CamerasLicensed  int                      `json:"cameras_licensed"`
+	GrowthPacks      []SubscriptionGrowthPack `json:"growth_packs"`
+	BillingCycle     string                   `json:"billing_cycle"`
+	NextBillingDate  *time.Time               `json:"next_billing_date"` // null for trials
+	TotalMonthlyCost float64                  `json:"total_monthly_cost"`
+	CycleCost        float64                  `json:"cycle_cost"`
+	AnnualDiscount   float64                  `json:"annual_discount"`
+	CreditBalance    float64                  `json:"credit_balance"`
+	Currency         string                   `json:"currency"`
+}
+
+// LicenseRevocation is the outcome of reverting a paid license to its trial
+type LicenseRevocation struct {
+	Success          bool        `json:"success"`
+	Message          string      `json:"message"`
+	Plan             string      `json:"plan"`
+	Status           string      `json:"status"`
+	DaysRemaining    *int        `json:"days_remaining"`
+	TrialExpired     bool        `json:"trial_expired"`
+	CamerasAllowed   int         `json:"cameras_allowed"`
+	CurrentCameras   int         `json:"current_cameras"`
+	CamerasOverLimit int         `json:"cameras_over_limit"`
+	ActionRequired   bool        `json:"action_required"`
+	ActionMessage    string      `json:"action_message"`
+	CreditNote       *CreditNote `json:"credit_note"` // credit for unused paid time, if any
+}
+
+// UsageSummary is a tenant's usage over a period and what it costs. The
+// named counters are 0 when there was no usage of that type; Usage has every
+// event type reported in the period.
+type UsageSummary struct {
+	TenantID          string             `json:"tenant_id"`
+	PeriodStart       time.Time          `json:"period_start"`
+	PeriodEnd         time.Time          `json:"period_end"`
+	APICalls          int                `json:"api_calls"`
+	LLMTokensUsed     int                `json:"llm_tokens_used"`
+	StorageGBDays     float64            `json:"storage_gb_days"`
+	SMSSent           int                `json:"sms_sent"`
+	AgentExecutions   int                `json:"agent_executions"`
+	Usage             map[string]float64 `json:"usage"`
+	RatedCharges      []RatedCharge      `json:"rated_charges"`
+	UsageChargesTotal float64            `json:"usage_charges_total"`
+	Currency          string             `json:"currency"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Wallet zero-balance behaviours
+const (
+	ZeroBalanceAllowOverage = "allow_overage" // keep the feature on and bill the shortfall as overage
+	ZeroBalanceDeny         = "deny"          // switch the covered entitlements off until topped up
+)
+
+// Credit grant types
+const (
+	CreditGrantTopUp = "top_up" // purchased credit
+	CreditGrantPromo = "grant"  // free or promotional credit, usually expiring
+)
+
+// Wallet transaction types
+const (
+	WalletTxTopUp    = "top_up"
+	WalletTxGrant    = "grant"
+	WalletTxDrawdown = "drawdown"
+	WalletTxOverage  = "overage"
+	WalletTxExpiry   = "expiry"
+)
+
+// Wallet holds a tenant's prepaid credit settings
+type Wallet struct {
+	TenantID            string    `json:"tenant_id"`
+	Currency            string    `json:"currency"`
+	ZeroBalanceBehavior string    `json:"zero_balance_behavior"` // allow_overage, deny
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// CreditGrant is a block of prepaid credit that usage is drawn from
+type CreditGrant struct {
+	ID               string     `json:"id"`
+	TenantID         string     `json:"tenant_id"`
+	Type             string     `json:"type"` // top_up, grant
+	Amount           float64    `json:"amount"`
+	Remaining        float64    `json:"remaining"`
+	Description      string     `json:"description"`
+	PaymentAttemptID *string    `json:"payment_attempt_id,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+}
+
+// PendingDrawdown is covered usage whose drawdown failed after the usage was
+// saved. It is kept until a replay draws it down, so no usage goes uncharged.
+type PendingDrawdown struct {
+	ID        string       `json:"id"`
+	TenantID  string       `json:"tenant_id"`
+	EventType string       `json:"event_type"`
+	Events    []UsageEvent `json:"events"`
+	Attempts  int          `json:"attempts"`
+	LastError string       `json:"last_error"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
+
+// WalletTransaction is one entry in a tenant's credit ledger.
+// Amount is signed: credits are positive, drawdowns and expiries negative.
+// Overage entries record usage the balance could not cover.
+type WalletTransaction struct {
+	ID           int64     `json:"id"`
+	TenantID     string    `json:"tenant_id"`
+	Type         string    `json:"type"` // top_up, grant, drawdown, overage, expiry
+	Amount       float64   `json:"amount"`
+	BalanceAfter float64   `json:"balance_after"`
+	GrantID      *string   `json:"grant_id,omitempty"`
+	EventType    *string   `json:"event_type,omitempty"`
+	Quantity     *float64  `json:"quantity,omitempty"`
+	Description  string    `json:"description"`
+	CreatedAt    time.Time `json:"created_at"`
+}
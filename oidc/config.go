@@ -0,0 +1,82 @@
+package oidc
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Config holds admin SSO token validation configuration
+type Config struct {
+	Issuer           string              // required iss claim; empty disables SSO
+	Audience         string              // required aud claim; must be set when SSO is enabled
+	JWKSURL          string              // signing keys are fetched from here...
+	JWKSFile         string              // ...or read from here
+	RolesClaim       string              // claim listing the caller's groups or roles; dots reach into nested objects
+	RoleMap          map[string][]string // claim value -> admin roles
+	RolesPassthrough bool                // claim values that are admin role names also map to themselves
+	RefreshInterval  time.Duration       // how long fetched keys are trusted before refetching
+	ClockSkew        time.Duration       // leeway on exp, nbf and iat
+}
+
+// DefaultConfig reads roles from the "roles" claim and refreshes keys hourly
+func DefaultConfig() Config {
+	return Config{
+		RolesClaim:      "roles",
+		RoleMap:         map[string][]string{},
+		RefreshInterval: time.Hour,
+		ClockSkew:       time.Minute,
+	}
+}
+
+// Enabled reports whether SSO tokens are accepted
+func (c Config) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// LoadConfigFromEnv loads SSO configuration from environment variables.
+// ADMIN_OIDC_ROLE_MAP maps claim values to admin roles as
+// "group=role|role,group=role"; ADMIN_OIDC_ROLES_PASSTHROUGH=true also
+// accepts claim values that already name an admin role.
+func LoadConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	config.Issuer = os.Getenv("ADMIN_OIDC_ISSUER")
+	config.Audience = os.Getenv("ADMIN_OIDC_AUDIENCE")
+	config.JWKSURL = os.Getenv("ADMIN_OIDC_JWKS_URL")
+	config.JWKSFile = os.Getenv("ADMIN_OIDC_JWKS_FILE")
+
+	if v := os.Getenv("ADMIN_OIDC_ROLES_CLAIM"); v != "" {
+		config.RolesClaim = v
+	}
+
+	if v := os.Getenv("ADMIN_OIDC_ROLE_MAP"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			value, roles, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok || value == "" {
+				continue
+			}
+			for _, role := range strings.Split(roles, "|") {
+				if role = strings.TrimSpace(role); role != "" {
+					config.RoleMap[value] = append(config.RoleMap[value], role)
+				}
+			}
+		}
+	}
+
+	config.RolesPassthrough = os.Getenv("ADMIN_OIDC_ROLES_PASSTHROUGH") == "true"
+
+	if v := os.Getenv("ADMIN_OIDC_JWKS_REFRESH"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.RefreshInterval = d
+		}
+	}
+
+	if v := os.Getenv("ADMIN_OIDC_CLOCK_SKEW"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			config.ClockSkew = d
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,168 @@
+package oidc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"brinkbyte-billing-server/models"
+)
+
+// signingMethods are the asymmetric algorithms accepted. HMAC is left out so
+// a public key can never be used as a shared secret.
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Identity is the admin an SSO token speaks for
+type Identity struct {
+	Subject string
+	Name    string
+	Email   string
+	Roles   []string // admin roles mapped from the roles claim
+}
+
+// Verifier validates SSO bearer tokens issued to admins
+type Verifier struct {
+	config Config
+	keys   *KeySet
+}
+
+// NewVerifier creates a verifier and loads the signing keys, failing if
+// they can't be loaded
+func NewVerifier(ctx context.Context, config Config) (*Verifier, error) {
+	if !config.Enabled() {
+		return nil, errors.New("ADMIN_OIDC_ISSUER is required")
+	}
+	if config.Audience == "" {
+		return nil, errors.New("ADMIN_OIDC_AUDIENCE is required")
+	}
+	keys, err := NewKeySet(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := keys.Load(ctx); err != nil {
+		return nil, err
+	}
+	return &Verifier{config: config, keys: keys}, nil
+}
+
+// Issuer returns the issuer tokens must come from
+func (v *Verifier) Issuer() string {
+	return v.config.Issuer
+}
+
+// KeySource describes where signing keys are loaded from
+func (v *Verifier) KeySource() string {
+	return v.keys.Source()
+}
+
+// LooksLikeToken reports whether a bearer credential is a JWT rather than an
+// API key
+func LooksLikeToken(credential string) bool {
+	return strings.Count(credential, ".") == 2 && strings.HasPrefix(credential, "eyJ")
+}
+
+// Verify checks a token's signature, issuer, audience and lifetime and
+// returns who it identifies
+func (v *Verifier) Verify(ctx context.Context, raw string) (*Identity, error) {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithIssuer(v.config.Issuer),
+		jwt.WithLeeway(v.config.ClockSkew),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithAudience(v.config.Audience),
+	}
+
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+
+	identity := &Identity{Subject: subject}
+	identity.Email, _ = claims["email"].(string)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Name == "" {
+		identity.Name = identity.Email
+	}
+	if identity.Name == "" {
+		identity.Name = subject
+	}
+
+	values, err := claimStrings(claims, v.config.RolesClaim)
+	if err != nil {
+		return nil, err
+	}
+	identity.Roles = v.mapRoles(values)
+	return identity, nil
+}
+
+// mapRoles turns roles claim values into admin roles, dropping values that
+// map to nothing
+func (v *Verifier) mapRoles(values []string) []string {
+	seen := make(map[string]bool)
+	roles := []string{}
+	add := func(role string) {
+		if models.ValidAdminRole(role) && !seen[role] {
+			seen[role] = true
+			roles = append(roles, role)
+		}
+	}
+	for _, value := range values {
+		if mapped, ok := v.config.RoleMap[value]; ok {
+			for _, role := range mapped {
+				add(role)
+			}
+			continue
+		}
+		if v.config.RolesPassthrough {
+			add(value)
+		}
+	}
+	return roles
+}
+
+// claimStrings reads a claim holding a list of strings, or one
+// space-separated string as in the OAuth scope claim. Dots in path reach
+// into nested objects, as in Keycloak's realm_access.roles.
+func claimStrings(claims jwt.MapClaims, path string) ([]string, error) {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, nil
+		}
+		if value, ok = obj[part]; !ok {
+			return nil, nil
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v), nil
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %s must list strings", path)
+			}
+			values = append(values, s)
+		}
+		return values, nil
+	case nil:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("claim %s must be a string or list of strings", path)
+}
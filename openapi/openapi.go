@@ -0,0 +1,37 @@
+// Package openapi embeds the OpenAPI 3 description of the billing HTTP API
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"fmt"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+// Spec is the OpenAPI document for every HTTP route registered in main.go.
+// Keep it in step with the handlers; OPENAPI_VALIDATE=true fails requests
+// whose responses drift from it.
+//
+//go:embed openapi.json
+var Spec []byte
+
+// Load parses and validates the embedded document. Each call returns a fresh
+// copy that callers may modify.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(Spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI spec: %w", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI spec: %w", err)
+	}
+	return doc, nil
+}
+
+// Handler serves the embedded document
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(Spec)
+}
@@ -0,0 +1,282 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FakeOutcome controls how the fake provider resolves a charge
+type FakeOutcome string
+
+const (
+	FakeOutcomeSuccess FakeOutcome = "success"
+	FakeOutcomeDecline FakeOutcome = "decline"
+	FakeOutcomeDelayed FakeOutcome = "delayed"
+)
+
+// Payment method tokens that force a specific outcome, similar to the test
+// card numbers real providers publish
+const (
+	FakeTokenSuccess        = "tok_success"
+	FakeTokenDecline        = "tok_decline"
+	FakeTokenDelayed        = "tok_delayed"
+	FakeTokenDelayedDecline = "tok_delayed_decline"
+)
+
+// FakeProviderConfig holds configuration for the fake provider
+type FakeProviderConfig struct {
+	DefaultOutcome FakeOutcome   // outcome for tokens without a forced outcome
+	DelayedOutcome FakeOutcome   // final outcome of delayed charges (success or decline)
+	Delay          time.Duration // how long delayed charges stay pending
+}
+
+// LoadFakeProviderConfigFromEnv loads fake provider configuration from environment variables
+func LoadFakeProviderConfigFromEnv() FakeProviderConfig {
+	config := FakeProviderConfig{
+		DefaultOutcome: FakeOutcomeSuccess,
+		DelayedOutcome: FakeOutcomeSuccess,
+		Delay:          5 * time.Second,
+	}
+
+	if o := os.Getenv("FAKE_PAYMENT_OUTCOME"); o != "" {
+		config.DefaultOutcome = FakeOutcome(o)
+	}
+	if o := os.Getenv("FAKE_PAYMENT_DELAYED_OUTCOME"); o != "" {
+		config.DelayedOutcome = FakeOutcome(o)
+	}
+	if d := os.Getenv("FAKE_PAYMENT_DELAY"); d != "" {
+		if parsed, err := time.ParseDuration(d); err == nil {
+			config.Delay = parsed
+		}
+	}
+
+	return config
+}
+
+type fakeCharge struct {
+	id       string
+	amount   float64
+	refunded float64
+	status   ChargeStatus
+}
+
+// FakeProvider is a fully local PaymentProvider for development and tests.
+// It never talks to the network; outcomes come from the token or the config.
+type FakeProvider struct {
+	config    FakeProviderConfig
+	customers map[string]*Customer
+	methods   map[string]*PaymentMethod
+	outcomes  map[string]FakeOutcome // keyed by payment method ID
+	charges   map[string]*fakeCharge
+	handler   StatusHandler
+	mu        sync.Mutex
+}
+
+// NewFakeProvider creates a new fake provider
+func NewFakeProvider(config FakeProviderConfig) *FakeProvider {
+	if config.DefaultOutcome == "" {
+		config.DefaultOutcome = FakeOutcomeSuccess
+	}
+	if config.DelayedOutcome == "" {
+		config.DelayedOutcome = FakeOutcomeSuccess
+	}
+	return &FakeProvider{
+		config:    config,
+		customers: make(map[string]*Customer),
+		methods:   make(map[string]*PaymentMethod),
+		outcomes:  make(map[string]FakeOutcome),
+		charges:   make(map[string]*fakeCharge),
+	}
+}
+
+// Name identifies the fake provider
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// CreateCustomer registers a customer in memory
+func (p *FakeProvider) CreateCustomer(ctx context.Context, customer Customer) (*Customer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	created := customer
+	created.ID = "cus_" + uuid.New().String()[:18]
+	p.customers[created.ID] = &created
+	return &created, nil
+}
+
+// AttachPaymentMethod stores a payment method, remembering any outcome forced by the token
+func (p *FakeProvider) AttachPaymentMethod(ctx context.Context, customerID, token string) (*PaymentMethod, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.customers[customerID]; !ok {
+		return nil, ErrCustomerNotFound
+	}
+
+	method := &PaymentMethod{
+		ID:         "pm_" + uuid.New().String()[:18],
+		CustomerID: customerID,
+		Brand:      "visa",
+		Last4:      "4242",
+	}
+
+	switch token {
+	case FakeTokenSuccess:
+		p.outcomes[method.ID] = FakeOutcomeSuccess
+	case FakeTokenDecline:
+		p.outcomes[method.ID] = FakeOutcomeDecline
+		method.Last4 = "0002"
+	case FakeTokenDelayed:
+		p.outcomes[method.ID] = FakeOutcomeDelayed
+	case FakeTokenDelayedDecline:
+		p.outcomes[method.ID] = FakeOutcomeDelayed + "_" + FakeOutcomeDecline
+	}
+
+	p.methods[method.ID] = method
+	return method, nil
+}
+
+// Charge resolves a charge immediately, or leaves it pending and resolves it after the configured delay
+func (p *FakeProvider) Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	method, ok := p.methods[req.PaymentMethodID]
+	if !ok || method.CustomerID != req.CustomerID {
+		return nil, ErrPaymentMethodNotFound
+	}
+
+	outcome, forced := p.outcomes[method.ID]
+	if !forced {
+		outcome = p.config.DefaultOutcome
+	}
+
+	charge := &fakeCharge{
+		id:     "ch_" + uuid.New().String()[:18],
+		amount: req.Amount,
+	}
+	p.charges[charge.id] = charge
+
+	result := &ChargeResult{ID: charge.id}
+
+	switch {
+	case outcome == FakeOutcomeSuccess:
+		charge.status = ChargeStatusSucceeded
+	case outcome == FakeOutcomeDecline:
+		charge.status = ChargeStatusFailed
+		result.FailureCode = "card_declined"
+		result.FailureMessage = "The card was declined"
+	case strings.HasPrefix(string(outcome), string(FakeOutcomeDelayed)):
+		charge.status = ChargeStatusPending
+		final := p.config.DelayedOutcome
+		if outcome == FakeOutcomeDelayed+"_"+FakeOutcomeDecline {
+			final = FakeOutcomeDecline
+		}
+		go p.resolveLater(charge.id, final)
+	default:
+		return nil, fmt.Errorf("unknown fake payment outcome %q", outcome)
+	}
+
+	result.Status = charge.status
+	log.Printf("[PAYMENTS] Fake charge %s for %.2f %s: %s", charge.id, req.Amount, req.Currency, result.Status)
+	return result, nil
+}
+
+// resolveLater settles a pending charge and notifies the status handler
+func (p *FakeProvider) resolveLater(chargeID string, outcome FakeOutcome) {
+	time.Sleep(p.config.Delay)
+
+	p.mu.Lock()
+	charge, ok := p.charges[chargeID]
+	if !ok || charge.status != ChargeStatusPending {
+		p.mu.Unlock()
+		return
+	}
+
+	event := StatusEvent{ChargeID: chargeID, OccurredAt: time.Now()}
+	if outcome == FakeOutcomeDecline {
+		charge.status = ChargeStatusFailed
+		event.FailureCode = "card_declined"
+		event.FailureMessage = "The card was declined"
+	} else {
+		charge.status = ChargeStatusSucceeded
+	}
+	event.Status = charge.status
+	handler := p.handler
+	p.mu.Unlock()
+
+	log.Printf("[PAYMENTS] Fake charge %s resolved: %s", chargeID, event.Status)
+	if handler != nil {
+		handler(context.Background(), event)
+	}
+}
+
+// Refund returns money from a succeeded charge
+func (p *FakeProvider) Refund(ctx context.Context, chargeID string, amount float64) (*RefundResult, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[chargeID]
+	if !ok {
+		return nil, ErrChargeNotFound
+	}
+	if charge.status != ChargeStatusSucceeded && charge.status != ChargeStatusRefunded {
+		return nil, fmt.Errorf("cannot refund charge in status %s", charge.status)
+	}
+	if amount <= 0 {
+		amount = charge.amount - charge.refunded
+	}
+	if charge.refunded+amount > charge.amount+0.005 {
+		return nil, ErrRefundExceedsCharge
+	}
+
+	charge.refunded += amount
+	if charge.refunded >= charge.amount-0.005 {
+		charge.status = ChargeStatusRefunded
+	}
+
+	return &RefundResult{
+		ID:       "re_" + uuid.New().String()[:18],
+		ChargeID: chargeID,
+		Amount:   amount,
+		Status:   ChargeStatusSucceeded,
+	}, nil
+}
+
+// OnStatusChange registers the handler for delayed charge resolutions
+func (p *FakeProvider) OnStatusChange(handler StatusHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handler = handler
+}
+
+// VerifiesWebhooks is false: the fake provider's webhooks are unsigned
+func (p *FakeProvider) VerifiesWebhooks() bool {
+	return false
+}
+
+// ParseWebhook decodes a StatusEvent posted as plain JSON. The fake provider
+// performs no signature verification.
+func (p *FakeProvider) ParseWebhook(r *http.Request) (*StatusEvent, error) {
+	var event StatusEvent
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		return nil, fmt.Errorf("invalid webhook payload: %w", err)
+	}
+	if event.ChargeID == "" {
+		return nil, fmt.Errorf("webhook payload missing charge_id")
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now()
+	}
+	return &event, nil
+}
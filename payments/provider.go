@@ -0,0 +1,111 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ChargeStatus is the lifecycle state of a charge at the provider
+type ChargeStatus string
+
+const (
+	ChargeStatusPending   ChargeStatus = "pending"
+	ChargeStatusSucceeded ChargeStatus = "succeeded"
+	ChargeStatusFailed    ChargeStatus = "failed"
+	ChargeStatusRefunded  ChargeStatus = "refunded"
+)
+
+var (
+	// ErrCustomerNotFound is returned when the provider has no such customer
+	ErrCustomerNotFound = errors.New("payment customer not found")
+	// ErrPaymentMethodNotFound is returned when the token is unknown to the provider
+	ErrPaymentMethodNotFound = errors.New("payment method not found")
+	// ErrChargeNotFound is returned when refunding or looking up an unknown charge
+	ErrChargeNotFound = errors.New("charge not found")
+	// ErrRefundExceedsCharge is returned when refunding more than was captured
+	ErrRefundExceedsCharge = errors.New("refund amount exceeds charge amount")
+)
+
+// Customer is a billing customer at the payment provider
+type Customer struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// PaymentMethod is a stored, tokenised payment instrument
+type PaymentMethod struct {
+	ID         string
+	CustomerID string
+	Brand      string
+	Last4      string
+}
+
+// ChargeRequest describes a charge against a customer's payment method
+type ChargeRequest struct {
+	CustomerID      string
+	PaymentMethodID string
+	Amount          float64
+	Currency        string
+	Description     string
+	IdempotencyKey  string
+}
+
+// ChargeResult is the provider's immediate answer to a charge request.
+// Pending charges are resolved later through a StatusEvent.
+type ChargeResult struct {
+	ID             string
+	Status         ChargeStatus
+	FailureCode    string
+	FailureMessage string
+}
+
+// RefundResult is the provider's answer to a refund request
+type RefundResult struct {
+	ID       string
+	ChargeID string
+	Amount   float64
+	Status   ChargeStatus
+}
+
+// StatusEvent is an asynchronous charge status update from the provider
+type StatusEvent struct {
+	ChargeID       string       `json:"charge_id"`
+	Status         ChargeStatus `json:"status"`
+	FailureCode    string       `json:"failure_code,omitempty"`
+	FailureMessage string       `json:"failure_message,omitempty"`
+	OccurredAt     time.Time    `json:"occurred_at"`
+}
+
+// StatusHandler receives asynchronous charge status updates
+type StatusHandler func(ctx context.Context, event StatusEvent)
+
+// PaymentProvider is implemented by every payment integration
+type PaymentProvider interface {
+	// Name identifies the provider in stored payment records
+	Name() string
+
+	// CreateCustomer registers a billing customer and returns its provider record
+	CreateCustomer(ctx context.Context, customer Customer) (*Customer, error)
+
+	// AttachPaymentMethod exchanges a client-side token for a stored payment method
+	AttachPaymentMethod(ctx context.Context, customerID, token string) (*PaymentMethod, error)
+
+	// Charge attempts to collect money from a stored payment method
+	Charge(ctx context.Context, req ChargeRequest) (*ChargeResult, error)
+
+	// Refund returns some or all of a succeeded charge
+	Refund(ctx context.Context, chargeID string, amount float64) (*RefundResult, error)
+
+	// OnStatusChange registers the handler for asynchronous status updates
+	OnStatusChange(handler StatusHandler)
+
+	// ParseWebhook verifies and decodes a provider status callback
+	ParseWebhook(r *http.Request) (*StatusEvent, error)
+
+	// VerifiesWebhooks reports whether ParseWebhook authenticates callbacks
+	// by their signature. Unverified webhooks may only be served in development.
+	VerifiesWebhooks() bool
+}
@@ -0,0 +1,241 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+// caValidity is the lifetime of a CA created by LoadOrCreateCA
+const caValidity = 10 * 365 * 24 * time.Hour
+
+// CA is the internal certificate authority for edge devices. Device
+// certificates carry the device ID as the subject common name and the tenant
+// ID as the organization.
+type CA struct {
+	cert     *x509.Certificate
+	certPEM  []byte
+	key      crypto.Signer
+	validity time.Duration
+}
+
+// IssuedCertificate is a device certificate signed by the CA
+type IssuedCertificate struct {
+	Certificate *x509.Certificate
+	PEM         []byte
+	Serial      string
+}
+
+// LoadOrCreateCA loads the device CA, creating it first when configured to
+// and its files don't exist
+func LoadOrCreateCA(config Config) (*CA, error) {
+	if config.CreateCA {
+		if _, err := os.Stat(config.CACertFile); errors.Is(err, os.ErrNotExist) {
+			if err := createCA(config.CACertFile, config.CAKeyFile); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return LoadCA(config.CACertFile, config.CAKeyFile, config.CertValidity)
+}
+
+// LoadCA loads a CA certificate and private key from PEM files
+func LoadCA(certFile, keyFile string, validity time.Duration) (*CA, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("CA certificate file has no PEM certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CA{
+		cert:     cert,
+		certPEM:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		key:      key,
+		validity: validity,
+	}, nil
+}
+
+// createCA writes a new self-signed ECDSA CA
+func createCA(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "BrinkByte Billing Device CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	return nil
+}
+
+// Subject returns the CA's subject, for logs
+func (ca *CA) Subject() string {
+	return ca.cert.Subject.String()
+}
+
+// CertificatePEM returns the CA certificate devices should trust
+func (ca *CA) CertificatePEM() []byte {
+	return ca.certPEM
+}
+
+// Pool returns a pool holding the CA, for verifying client certificates
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	return pool
+}
+
+// IssueDeviceCertificate signs a client certificate for a device from its
+// PEM certificate signing request. The CSR proves the device holds the
+// private key; its subject is ignored in favor of the device and tenant IDs.
+func (ca *CA) IssueDeviceCertificate(csrPEM []byte, deviceID, tenantID string) (*IssuedCertificate, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, errors.New("csr must be a PEM CERTIFICATE REQUEST")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid csr: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("invalid csr signature: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	notAfter := now.Add(ca.validity)
+	if notAfter.After(ca.cert.NotAfter) {
+		notAfter = ca.cert.NotAfter
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: deviceID, Organization: []string{tenantID}},
+		NotBefore:    now.Add(-5 * time.Minute), // tolerate device clock skew
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign device certificate: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse device certificate: %w", err)
+	}
+
+	return &IssuedCertificate{
+		Certificate: cert,
+		PEM:         pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		Serial:      SerialString(cert),
+	}, nil
+}
+
+// SerialString formats a certificate's serial number as stored
+func SerialString(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// DeviceIdentity reads the device and tenant IDs from a device certificate
+func DeviceIdentity(cert *x509.Certificate) (deviceID, tenantID string) {
+	deviceID = cert.Subject.CommonName
+	if len(cert.Subject.Organization) > 0 {
+		tenantID = cert.Subject.Organization[0]
+	}
+	return deviceID, tenantID
+}
+
+func randomSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+// parsePrivateKey reads a PKCS#8, SEC 1 EC or PKCS#1 RSA private key
+func parsePrivateKey(keyPEM []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("CA key file has no PEM key")
+	}
+
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("CA key can't sign")
+	}
+	return signer, nil
+}
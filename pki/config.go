@@ -0,0 +1,64 @@
+// Package pki serves TLS and runs the internal certificate authority that
+// issues edge devices their client certificates
+package pki
+
+import (
+	"os"
+	"time"
+)
+
+// Config holds TLS serving and device CA configuration
+type Config struct {
+	CertFile       string        // server certificate (PEM); TLS is served when set with KeyFile
+	KeyFile        string        // server private key (PEM)
+	ReloadInterval time.Duration // how often the server certificate files are checked for changes
+
+	CACertFile   string        // device CA certificate (PEM); device certificates are enabled when set with CAKeyFile
+	CAKeyFile    string        // device CA private key (PEM)
+	CreateCA     bool          // create the CA files if they don't exist
+	CertValidity time.Duration // lifetime of issued device certificates
+}
+
+// DefaultConfig checks certificate files every minute and issues device
+// certificates for a year
+func DefaultConfig() Config {
+	return Config{
+		ReloadInterval: time.Minute,
+		CertValidity:   365 * 24 * time.Hour,
+	}
+}
+
+// TLSEnabled reports whether the server should serve TLS
+func (c Config) TLSEnabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// CAEnabled reports whether device certificates are issued and accepted
+func (c Config) CAEnabled() bool {
+	return c.CACertFile != "" && c.CAKeyFile != ""
+}
+
+// LoadConfigFromEnv loads TLS and device CA configuration from environment
+// variables
+func LoadConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	config.CertFile = os.Getenv("TLS_CERT_FILE")
+	config.KeyFile = os.Getenv("TLS_KEY_FILE")
+	if v := os.Getenv("TLS_RELOAD_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.ReloadInterval = d
+		}
+	}
+
+	config.CACertFile = os.Getenv("DEVICE_CA_CERT_FILE")
+	config.CAKeyFile = os.Getenv("DEVICE_CA_KEY_FILE")
+	config.CreateCA = os.Getenv("DEVICE_CA_CREATE") == "true"
+	if v := os.Getenv("DEVICE_CERT_VALIDITY"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			config.CertValidity = d
+		}
+	}
+
+	return config
+}
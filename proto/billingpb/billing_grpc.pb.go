@@ -0,0 +1,263 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.29.3
+// source: billing.proto
+
+package billingpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	EdgeBilling_ValidateLicense_FullMethodName  = "/brinkbyte.billing.v1.EdgeBilling/ValidateLicense"
+	EdgeBilling_CheckEntitlement_FullMethodName = "/brinkbyte.billing.v1.EdgeBilling/CheckEntitlement"
+	EdgeBilling_ReportUsage_FullMethodName      = "/brinkbyte.billing.v1.EdgeBilling/ReportUsage"
+	EdgeBilling_Heartbeat_FullMethodName        = "/brinkbyte.billing.v1.EdgeBilling/Heartbeat"
+)
+
+// EdgeBillingClient is the client API for EdgeBilling service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// EdgeBilling is the licensing and usage ingestion API for edge clients. It
+// mirrors the legacy /api/v1 endpoints used by the C++ client and shares their
+// handler logic and storage. Calls are authenticated with the tenant API key
+// in the "authorization" metadata ("Bearer <key>") when auth is required.
+// ReportUsage and Heartbeat take device signatures in the x-device-id,
+// x-signature-timestamp, x-signature-nonce and x-signature metadata, signing
+// POST, the full method name and the deterministic protobuf encoding of the
+// request (empty for ReportUsage).
+type EdgeBillingClient interface {
+	// ValidateLicense validates a camera license, starting a trial for tenants
+	// without a subscription (POST /api/v1/licenses/validate)
+	ValidateLicense(ctx context.Context, in *ValidateLicenseRequest, opts ...grpc.CallOption) (*ValidateLicenseResponse, error)
+	// CheckEntitlement checks whether a feature is enabled for a tenant
+	// (POST /api/v1/entitlements/check)
+	CheckEntitlement(ctx context.Context, in *CheckEntitlementRequest, opts ...grpc.CallOption) (*CheckEntitlementResponse, error)
+	// ReportUsage streams usage events, persisting them in chunks as they
+	// arrive, and returns the batch outcome when the client closes the stream
+	// (POST /api/v1/usage/batch)
+	ReportUsage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UsageEvent, ReportUsageResponse], error)
+	// Heartbeat records that an edge device is alive (POST /api/v1/heartbeat)
+	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
+}
+
+type edgeBillingClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewEdgeBillingClient(cc grpc.ClientConnInterface) EdgeBillingClient {
+	return &edgeBillingClient{cc}
+}
+
+func (c *edgeBillingClient) ValidateLicense(ctx context.Context, in *ValidateLicenseRequest, opts ...grpc.CallOption) (*ValidateLicenseResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ValidateLicenseResponse)
+	err := c.cc.Invoke(ctx, EdgeBilling_ValidateLicense_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeBillingClient) CheckEntitlement(ctx context.Context, in *CheckEntitlementRequest, opts ...grpc.CallOption) (*CheckEntitlementResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CheckEntitlementResponse)
+	err := c.cc.Invoke(ctx, EdgeBilling_CheckEntitlement_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *edgeBillingClient) ReportUsage(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UsageEvent, ReportUsageResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &EdgeBilling_ServiceDesc.Streams[0], EdgeBilling_ReportUsage_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[UsageEvent, ReportUsageResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EdgeBilling_ReportUsageClient = grpc.ClientStreamingClient[UsageEvent, ReportUsageResponse]
+
+func (c *edgeBillingClient) Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HeartbeatResponse)
+	err := c.cc.Invoke(ctx, EdgeBilling_Heartbeat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// EdgeBillingServer is the server API for EdgeBilling service.
+// All implementations must embed UnimplementedEdgeBillingServer
+// for forward compatibility.
+//
+// EdgeBilling is the licensing and usage ingestion API for edge clients. It
+// mirrors the legacy /api/v1 endpoints used by the C++ client and shares their
+// handler logic and storage. Calls are authenticated with the tenant API key
+// in the "authorization" metadata ("Bearer <key>") when auth is required.
+// ReportUsage and Heartbeat take device signatures in the x-device-id,
+// x-signature-timestamp, x-signature-nonce and x-signature metadata, signing
+// POST, the full method name and the deterministic protobuf encoding of the
+// request (empty for ReportUsage).
+type EdgeBillingServer interface {
+	// ValidateLicense validates a camera license, starting a trial for tenants
+	// without a subscription (POST /api/v1/licenses/validate)
+	ValidateLicense(context.Context, *ValidateLicenseRequest) (*ValidateLicenseResponse, error)
+	// CheckEntitlement checks whether a feature is enabled for a tenant
+	// (POST /api/v1/entitlements/check)
+	CheckEntitlement(context.Context, *CheckEntitlementRequest) (*CheckEntitlementResponse, error)
+	// ReportUsage streams usage events, persisting them in chunks as they
+	// arrive, and returns the batch outcome when the client closes the stream
+	// (POST /api/v1/usage/batch)
+	ReportUsage(grpc.ClientStreamingServer[UsageEvent, ReportUsageResponse]) error
+	// Heartbeat records that an edge device is alive (POST /api/v1/heartbeat)
+	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
+	mustEmbedUnimplementedEdgeBillingServer()
+}
+
+// UnimplementedEdgeBillingServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedEdgeBillingServer struct{}
+
+func (UnimplementedEdgeBillingServer) ValidateLicense(context.Context, *ValidateLicenseRequest) (*ValidateLicenseResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ValidateLicense not implemented")
+}
+func (UnimplementedEdgeBillingServer) CheckEntitlement(context.Context, *CheckEntitlementRequest) (*CheckEntitlementResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckEntitlement not implemented")
+}
+func (UnimplementedEdgeBillingServer) ReportUsage(grpc.ClientStreamingServer[UsageEvent, ReportUsageResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method ReportUsage not implemented")
+}
+func (UnimplementedEdgeBillingServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Heartbeat not implemented")
+}
+func (UnimplementedEdgeBillingServer) mustEmbedUnimplementedEdgeBillingServer() {}
+func (UnimplementedEdgeBillingServer) testEmbeddedByValue()                     {}
+
+// UnsafeEdgeBillingServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to EdgeBillingServer will
+// result in compilation errors.
+type UnsafeEdgeBillingServer interface {
+	mustEmbedUnimplementedEdgeBillingServer()
+}
+
+func RegisterEdgeBillingServer(s grpc.ServiceRegistrar, srv EdgeBillingServer) {
+	// If the following call pancis, it indicates UnimplementedEdgeBillingServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&EdgeBilling_ServiceDesc, srv)
+}
+
+func _EdgeBilling_ValidateLicense_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateLicenseRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeBillingServer).ValidateLicense(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EdgeBilling_ValidateLicense_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeBillingServer).ValidateLicense(ctx, req.(*ValidateLicenseRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EdgeBilling_CheckEntitlement_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CheckEntitlementRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeBillingServer).CheckEntitlement(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EdgeBilling_CheckEntitlement_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeBillingServer).CheckEntitlement(ctx, req.(*CheckEntitlementRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _EdgeBilling_ReportUsage_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(EdgeBillingServer).ReportUsage(&grpc.GenericServerStream[UsageEvent, ReportUsageResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type EdgeBilling_ReportUsageServer = grpc.ClientStreamingServer[UsageEvent, ReportUsageResponse]
+
+func _EdgeBilling_Heartbeat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HeartbeatRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(EdgeBillingServer).Heartbeat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: EdgeBilling_Heartbeat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(EdgeBillingServer).Heartbeat(ctx, req.(*HeartbeatRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// EdgeBilling_ServiceDesc is the grpc.ServiceDesc for EdgeBilling service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var EdgeBilling_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "brinkbyte.billing.v1.EdgeBilling",
+	HandlerType: (*EdgeBillingServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ValidateLicense",
+			Handler:    _EdgeBilling_ValidateLicense_Handler,
+		},
+		{
+			MethodName: "CheckEntitlement",
+			Handler:    _EdgeBilling_CheckEntitlement_Handler,
+		},
+		{
+			MethodName: "Heartbeat",
+			Handler:    _EdgeBilling_Heartbeat_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ReportUsage",
+			Handler:       _EdgeBilling_ReportUsage_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "billing.proto",
+}
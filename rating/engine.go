@@ -0,0 +1,81 @@
+package rating
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"brinkbyte-billing-server/models"
+)
+
+// Engine prices metered usage from a price book
+type Engine struct {
+	book     PriceBook
+	currency string
+}
+
+// NewEngine creates a rating engine for the given prices
+func NewEngine(book PriceBook, currency string) *Engine {
+	return &Engine{book: book, currency: currency}
+}
+
+// PriceBook returns the prices the engine rates with
+func (e *Engine) PriceBook() PriceBook {
+	return e.book
+}
+
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// Amount returns the unrounded charge for a period total of an event type.
+// Event types without a price are free.
+func (e *Engine) Amount(eventType string, quantity float64) float64 {
+	price, ok := e.book[eventType]
+	if !ok {
+		return 0
+	}
+	return price.Amount(quantity)
+}
+
+// MarginalAmount returns the cost of adding quantity to a period that has
+// already used prior units, so tiers and packages carry across batches
+func (e *Engine) MarginalAmount(eventType string, prior, quantity float64) float64 {
+	return e.Amount(eventType, prior+quantity) - e.Amount(eventType, prior)
+}
+
+// Rate prices a tenant's usage totals for a period
+func (e *Engine) Rate(tenantID string, start, end time.Time, totals map[string]float64) *models.RatedUsage {
+	rated := &models.RatedUsage{
+		TenantID:    tenantID,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Charges:     []models.RatedCharge{},
+		Currency:    e.currency,
+	}
+
+	eventTypes := make([]string, 0, len(totals))
+	for eventType := range totals {
+		eventTypes = append(eventTypes, eventType)
+	}
+	sort.Strings(eventTypes)
+
+	for _, eventType := range eventTypes {
+		price, ok := e.book[eventType]
+		if !ok {
+			continue
+		}
+		charge := models.RatedCharge{
+			EventType: eventType,
+			Quantity:  totals[eventType],
+			Unit:      price.Unit,
+			Model:     price.Model,
+			Amount:    roundAmount(price.Amount(totals[eventType])),
+		}
+		rated.Charges = append(rated.Charges, charge)
+		rated.Total += charge.Amount
+	}
+
+	rated.Total = roundAmount(rated.Total)
+	return rated
+}
@@ -0,0 +1,190 @@
+package rating
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+)
+
+// Pricing models
+const (
+	ModelFlat    = "flat"    // unit_price per unit
+	ModelTiered  = "tiered"  // graduated: each tier's units at that tier's price
+	ModelPackage = "package" // package_price per started block of package_size units
+)
+
+// Tier is one band of graduated pricing. UpTo is the cumulative quantity
+// the band ends at; zero means unbounded.
+type Tier struct {
+	UpTo      float64 `json:"up_to"`
+	UnitPrice float64 `json:"unit_price"`
+}
+
+// Price defines how one metered event type is charged
+type Price struct {
+	EventType    string  `json:"event_type"`
+	Model        string  `json:"model"`
+	Unit         string  `json:"unit"`
+	UnitPrice    float64 `json:"unit_price,omitempty"`
+	Tiers        []Tier  `json:"tiers,omitempty"`
+	PackageSize  float64 `json:"package_size,omitempty"`
+	PackagePrice float64 `json:"package_price,omitempty"`
+}
+
+// PriceBook maps event types to their prices
+type PriceBook map[string]Price
+
+// DefaultPriceBook returns the standard prices (AUD) for metered usage
+func DefaultPriceBook() PriceBook {
+	return PriceBook{
+		"api_call": {
+			EventType: "api_call",
+			Model:     ModelTiered,
+			Unit:      "calls",
+			Tiers: []Tier{
+				{UpTo: 10000, UnitPrice: 0},
+				{UpTo: 1000000, UnitPrice: 0.0001},
+				{UpTo: 0, UnitPrice: 0.00005},
+			},
+		},
+		"llm_tokens": {
+			EventType:    "llm_tokens",
+			Model:        ModelPackage,
+			Unit:         "tokens",
+			PackageSize:  1000,
+			PackagePrice: 0.02,
+		},
+		"storage_gb_days": {
+			EventType: "storage_gb_days",
+			Model:     ModelFlat,
+			Unit:      "gb_days",
+			UnitPrice: 0.003,
+		},
+		"sms_sent": {
+			EventType: "sms_sent",
+			Model:     ModelFlat,
+			Unit:      "messages",
+			UnitPrice: 0.08,
+		},
+		"agent_execution": {
+			EventType: "agent_execution",
+			Model:     ModelFlat,
+			Unit:      "executions",
+			UnitPrice: 0.05,
+		},
+	}
+}
+
+// LoadPriceBookFromEnv loads prices from the JSON file named by
+// RATING_PRICE_BOOK (a list of prices), overriding the defaults per event type
+func LoadPriceBookFromEnv() PriceBook {
+	book := DefaultPriceBook()
+
+	path := os.Getenv("RATING_PRICE_BOOK")
+	if path == "" {
+		return book
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Printf("[RATING] Failed to read price book %s, using defaults: %v", path, err)
+		return book
+	}
+
+	var prices []Price
+	if err := json.Unmarshal(data, &prices); err != nil {
+		log.Printf("[RATING] Failed to parse price book %s, using defaults: %v", path, err)
+		return book
+	}
+
+	for _, p := range prices {
+		if err := p.Validate(); err != nil {
+			log.Printf("[RATING] Skipping price for %s: %v", p.EventType, err)
+			continue
+		}
+		book[p.EventType] = p
+	}
+
+	return book
+}
+
+// Validate checks the price is complete for its model
+func (p Price) Validate() error {
+	if p.EventType == "" {
+		return fmt.Errorf("event_type is required")
+	}
+
+	switch p.Model {
+	case ModelFlat:
+		if p.UnitPrice < 0 {
+			return fmt.Errorf("unit_price must not be negative")
+		}
+	case ModelTiered:
+		if len(p.Tiers) == 0 {
+			return fmt.Errorf("tiered pricing needs at least one tier")
+		}
+		var last float64
+		for i, t := range p.Tiers {
+			if t.UnitPrice < 0 {
+				return fmt.Errorf("tier unit_price must not be negative")
+			}
+			if t.UpTo == 0 && i != len(p.Tiers)-1 {
+				return fmt.Errorf("only the last tier may be unbounded")
+			}
+			if t.UpTo != 0 && t.UpTo <= last {
+				return fmt.Errorf("tier bounds must increase")
+			}
+			last = t.UpTo
+		}
+		if p.Tiers[len(p.Tiers)-1].UpTo != 0 {
+			return fmt.Errorf("the last tier must be unbounded")
+		}
+	case ModelPackage:
+		if p.PackageSize <= 0 {
+			return fmt.Errorf("package_size must be positive")
+		}
+		if p.PackagePrice < 0 {
+			return fmt.Errorf("package_price must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown pricing model %q", p.Model)
+	}
+
+	return nil
+}
+
+// Amount returns the charge for a total quantity over a billing period
+func (p Price) Amount(quantity float64) float64 {
+	if quantity <= 0 {
+		return 0
+	}
+
+	switch p.Model {
+	case ModelFlat:
+		return quantity * p.UnitPrice
+
+	case ModelTiered:
+		var amount, floor float64
+		for _, t := range p.Tiers {
+			ceiling := t.UpTo
+			if ceiling == 0 || ceiling > quantity {
+				ceiling = quantity
+			}
+			if ceiling > floor {
+				amount += (ceiling - floor) * t.UnitPrice
+				floor = ceiling
+			}
+			if floor >= quantity {
+				break
+			}
+		}
+		return amount
+
+	case ModelPackage:
+		return math.Ceil(quantity/p.PackageSize) * p.PackagePrice
+	}
+
+	return 0
+}
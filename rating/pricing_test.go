@@ -0,0 +1,35 @@
+package rating
+
+import "testing"
+
+func TestPriceValidateTiers(t *testing.T) {
+	tests := []struct {
+		name    string
+		tiers   []Tier
+		wantErr bool
+	}{
+		{"unbounded last tier", []Tier{{UpTo: 100, UnitPrice: 0.01}, {UnitPrice: 0.005}}, false},
+		{"single unbounded tier", []Tier{{UnitPrice: 0.01}}, false},
+		{"bounded last tier", []Tier{{UpTo: 100, UnitPrice: 0.01}, {UpTo: 1000, UnitPrice: 0.005}}, true},
+		{"unbounded middle tier", []Tier{{UnitPrice: 0.01}, {UpTo: 100, UnitPrice: 0.005}}, true},
+		{"decreasing bounds", []Tier{{UpTo: 100, UnitPrice: 0.01}, {UpTo: 50, UnitPrice: 0.005}, {UnitPrice: 0.001}}, true},
+		{"no tiers", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Price{EventType: "api_call", Model: ModelTiered, Unit: "calls", Tiers: tt.tiers}
+			if err := p.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDefaultPriceBookIsValid(t *testing.T) {
+	for eventType, p := range DefaultPriceBook() {
+		if err := p.Validate(); err != nil {
+			t.Errorf("default price for %s: %v", eventType, err)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package retention
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"brinkbyte-billing-server/models"
+)
+
+// MonthFormat is how archived months are named, e.g. 2025-01
+const MonthFormat = "2006-01"
+
+const (
+	archivePrefix = "usage-"
+	archiveSuffix = ".ndjson.gz"
+	manifestFile  = "restored.json"
+)
+
+// Archive is one compressed file of archived usage events. A month can have
+// several when late events arrive after it was first archived.
+type Archive struct {
+	Month     string    `json:"month"`
+	File      string    `json:"file"`
+	SizeBytes int64     `json:"size_bytes"`
+	CreatedAt time.Time `json:"created_at"`
+	Events    int       `json:"events,omitempty"` // only known when just archived
+	Restored  bool      `json:"restored"`         // the month is currently restored
+}
+
+// archiveName names an archive file, e.g. usage-2025-01-1735689600000000000.ndjson.gz
+func archiveName(month, created time.Time) string {
+	return fmt.Sprintf("%s%s-%d%s", archivePrefix, month.Format(MonthFormat), created.UnixNano(), archiveSuffix)
+}
+
+// parseArchiveName is the inverse of archiveName
+func parseArchiveName(name string) (time.Time, time.Time, bool) {
+	if !strings.HasPrefix(name, archivePrefix) || !strings.HasSuffix(name, archiveSuffix) {
+		return time.Time{}, time.Time{}, false
+	}
+	rest := strings.TrimSuffix(strings.TrimPrefix(name, archivePrefix), archiveSuffix)
+	if len(rest) < len(MonthFormat)+2 || rest[len(MonthFormat)] != '-' {
+		return time.Time{}, time.Time{}, false
+	}
+	month, err := time.Parse(MonthFormat, rest[:len(MonthFormat)])
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(rest[len(MonthFormat)+1:], 10, 64)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return month, time.Unix(0, nanos).UTC(), true
+}
+
+// listArchives returns the archive files in dir, oldest month first
+func listArchives(dir string) ([]Archive, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archives: %w", err)
+	}
+
+	var archives []Archive
+	for _, entry := range entries {
+		month, created, ok := parseArchiveName(entry.Name())
+		if !ok || entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		archives = append(archives, Archive{
+			Month:     month.Format(MonthFormat),
+			File:      entry.Name(),
+			SizeBytes: info.Size(),
+			CreatedAt: created,
+		})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		if archives[i].Month != archives[j].Month {
+			return archives[i].Month < archives[j].Month
+		}
+		return archives[i].CreatedAt.Before(archives[j].CreatedAt)
+	})
+	return archives, nil
+}
+
+// archiveWriter writes gzipped NDJSON to a temporary file that only takes
+// its final name once sealed, so a crash never leaves a partial archive
+type archiveWriter struct {
+	path   string
+	tmp    *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	sealed bool
+}
+
+func createArchive(dir string, month, created time.Time) (*archiveWriter, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create archive dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".archive-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+
+	w := &archiveWriter{path: filepath.Join(dir, archiveName(month, created)), tmp: tmp}
+	w.buf = bufio.NewWriter(tmp)
+	w.gz = gzip.NewWriter(w.buf)
+	w.enc = json.NewEncoder(w.gz)
+	return w, nil
+}
+
+func (w *archiveWriter) write(e models.UsageEvent) error {
+	if err := w.enc.Encode(e); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	return nil
+}
+
+// seal flushes the archive to disk and moves it into place
+func (w *archiveWriter) seal() error {
+	if err := w.gz.Close(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := w.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+	if err := w.tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync archive: %w", err)
+	}
+	if err := w.tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close archive: %w", err)
+	}
+	if err := os.Rename(w.tmp.Name(), w.path); err != nil {
+		return fmt.Errorf("failed to move archive into place: %w", err)
+	}
+	w.sealed = true
+	return nil
+}
+
+// discard removes the archive, sealed or not
+func (w *archiveWriter) discard() {
+	if w.sealed {
+		os.Remove(w.path)
+		return
+	}
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+// archiveReader reads events back from a sequence of archive files
+type archiveReader struct {
+	paths []string
+	file  *os.File
+	gz    *gzip.Reader
+	dec   *json.Decoder
+}
+
+func newArchiveReader(paths []string) *archiveReader {
+	return &archiveReader{paths: paths}
+}
+
+// read returns the next event, or nil once every file has been read
+func (r *archiveReader) read() (*models.UsageEvent, error) {
+	for {
+		if r.dec == nil {
+			if len(r.paths) == 0 {
+				return nil, nil
+			}
+			if err := r.open(r.paths[0]); err != nil {
+				return nil, err
+			}
+			r.paths = r.paths[1:]
+		}
+
+		var e models.UsageEvent
+		err := r.dec.Decode(&e)
+		if err == io.EOF {
+			r.closeFile()
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive %s: %w", r.file.Name(), err)
+		}
+		return &e, nil
+	}
+}
+
+func (r *archiveReader) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open archive %s: %w", path, err)
+	}
+	r.file, r.gz, r.dec = f, gz, json.NewDecoder(gz)
+	return nil
+}
+
+func (r *archiveReader) closeFile() {
+	if r.file != nil {
+		r.gz.Close()
+		r.file.Close()
+	}
+	r.file, r.gz, r.dec = nil, nil, nil
+}
+
+// Close releases the file currently being read
+func (r *archiveReader) Close() {
+	r.closeFile()
+}
+
+// loadRestored reads the set of months currently restored from archive
+func loadRestored(dir string) (map[string]time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestFile))
+	if os.IsNotExist(err) {
+		return map[string]time.Time{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read restore manifest: %w", err)
+	}
+
+	restored := make(map[string]time.Time)
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return nil, fmt.Errorf("failed to parse restore manifest: %w", err)
+	}
+	return restored, nil
+}
+
+// saveRestored atomically replaces the restore manifest
+func saveRestored(dir string, restored map[string]time.Time) error {
+	data, err := json.MarshalIndent(restored, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, manifestFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write restore manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(dir, manifestFile)); err != nil {
+		return fmt.Errorf("failed to write restore manifest: %w", err)
+	}
+	return nil
+}
+
+func removeArchive(dir, name string) error {
+	return os.Remove(filepath.Join(dir, name))
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
@@ -0,0 +1,45 @@
+package retention
+
+import (
+	"os"
+	"strconv"
+)
+
+// Config holds usage event retention configuration
+type Config struct {
+	RetentionDays   int    // raw events older than this are archived; 0 keeps them forever
+	ArchiveDir      string // directory archived months are written to
+	PartitionsAhead int    // future monthly partitions kept ahead of the current month
+}
+
+// DefaultConfig keeps raw events forever and partitions three months ahead
+func DefaultConfig() Config {
+	return Config{
+		RetentionDays:   0,
+		ArchiveDir:      "./archive/usage",
+		PartitionsAhead: 3,
+	}
+}
+
+// LoadConfigFromEnv loads retention configuration from environment variables
+func LoadConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	if v := os.Getenv("USAGE_RETENTION_DAYS"); v != "" {
+		if d, err := strconv.Atoi(v); err == nil && d >= 0 {
+			config.RetentionDays = d
+		}
+	}
+
+	if v := os.Getenv("USAGE_ARCHIVE_DIR"); v != "" {
+		config.ArchiveDir = v
+	}
+
+	if v := os.Getenv("USAGE_PARTITIONS_AHEAD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			config.PartitionsAhead = n
+		}
+	}
+
+	return config
+}
@@ -0,0 +1,394 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"brinkbyte-billing-server/models"
+)
+
+// Storage interface for usage retention (minimal subset)
+type Storage interface {
+	EnsureUsagePartitions(ctx context.Context, from, to time.Time) error
+	GetArchivableUsageMonths(ctx context.Context, cutoff time.Time) ([]time.Time, error)
+	ArchiveUsageMonth(ctx context.Context, month time.Time, write func(e models.UsageEvent) error, seal func() error) (int, error)
+	ImportUsageEvents(ctx context.Context, read func() (*models.UsageEvent, error)) (int, error)
+	RebuildUsageRollups(ctx context.Context, tenantID string, start, end time.Time) (int, error)
+}
+
+// RestoreResult summarises a restore from archive
+type RestoreResult struct {
+	Restored []string `json:"restored"` // months re-imported
+	Skipped  []string `json:"skipped"`  // months already restored or never archived
+	Events   int      `json:"events"`
+}
+
+// Manager keeps usage_events partitioned ahead of time and moves months that
+// fall outside the retention window to compressed archives on local disk.
+// Raw events are archived in whole UTC months; rollups are never archived, so
+// usage summaries keep working for archived months.
+type Manager struct {
+	config Config
+	store  Storage
+	mu     sync.Mutex // serializes archive and restore runs
+}
+
+// NewManager creates a retention manager
+func NewManager(config Config, store Storage) *Manager {
+	return &Manager{config: config, store: store}
+}
+
+// Config returns the retention configuration
+func (m *Manager) Config() Config {
+	return m.config
+}
+
+// monthStart returns the start of the UTC month t falls in
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// ParseMonth parses a YYYY-MM month
+func ParseMonth(s string) (time.Time, error) {
+	month, err := time.Parse(MonthFormat, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("month must be YYYY-MM")
+	}
+	return month, nil
+}
+
+// RunOnce creates upcoming partitions and archives every month that ended
+// before the retention cutoff. Restored months are left alone until they are
+// archived again explicitly.
+func (m *Manager) RunOnce(ctx context.Context, now time.Time) ([]Archive, error) {
+	current := monthStart(now)
+	if err := m.store.EnsureUsagePartitions(ctx, current, current.AddDate(0, m.config.PartitionsAhead+1, 0)); err != nil {
+		return nil, err
+	}
+
+	if m.config.RetentionDays <= 0 {
+		return nil, nil
+	}
+
+	cutoff := now.AddDate(0, 0, -m.config.RetentionDays)
+	months, err := m.store.GetArchivableUsageMonths(ctx, cutoff)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	restored, err := loadRestored(m.config.ArchiveDir)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var archived []Archive
+	for _, month := range months {
+		if _, ok := restored[month.Format(MonthFormat)]; ok {
+			continue
+		}
+		archive, err := m.ArchiveMonth(ctx, month)
+		if err != nil {
+			return archived, err
+		}
+		if archive != nil {
+			archived = append(archived, *archive)
+		}
+	}
+	return archived, nil
+}
+
+// ArchiveMonth writes a month's raw usage events to a new archive file and
+// drops them from storage. Archiving a restored month replaces its earlier
+// archives, since everything in them was re-imported, but only once the new
+// archive holds at least as many events as they did. Returns nil when the
+// month had no events.
+func (m *Manager) ArchiveMonth(ctx context.Context, month time.Time) (*Archive, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	month = monthStart(month)
+	key := month.Format(MonthFormat)
+
+	restored, err := loadRestored(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := m.archivesFor(key)
+	if err != nil {
+		return nil, err
+	}
+
+	_, isRestored := restored[key]
+	earlier := 0
+	if isRestored {
+		if earlier, err = m.countEvents(previous); err != nil {
+			return nil, err
+		}
+	}
+
+	created := time.Now().UTC()
+	w, err := createArchive(m.config.ArchiveDir, month, created)
+	if err != nil {
+		return nil, err
+	}
+
+	n, err := m.store.ArchiveUsageMonth(ctx, month, w.write, w.seal)
+	if err != nil {
+		w.discard()
+		return nil, fmt.Errorf("failed to archive usage for %s: %w", key, err)
+	}
+	if n == 0 {
+		w.discard()
+	}
+
+	if isRestored {
+		// Earlier archives are only superseded once the new archive holds at
+		// least as many events. Fewer means the restore never fully reached
+		// this store, so the earlier archives may still be the only copy.
+		if n > 0 && n >= earlier {
+			for _, a := range previous {
+				if err := removeArchive(m.config.ArchiveDir, a.File); err != nil {
+					log.Printf("[RETENTION] Failed to remove superseded archive %s: %v", a.File, err)
+				}
+			}
+		} else if len(previous) > 0 {
+			log.Printf("[RETENTION] Archived %d of %d restored usage events for %s, keeping earlier archives", n, earlier, key)
+		}
+		delete(restored, key)
+		if err := saveRestored(m.config.ArchiveDir, restored); err != nil {
+			return nil, err
+		}
+	}
+
+	if n == 0 {
+		return nil, nil
+	}
+
+	log.Printf("[RETENTION] Archived %d usage events for %s to %s", n, key, w.path)
+	archive := &Archive{Month: key, File: filepath.Base(w.path), CreatedAt: created, Events: n}
+	if size, err := fileSize(w.path); err == nil {
+		archive.SizeBytes = size
+	}
+	return archive, nil
+}
+
+// Restore re-imports the archived months from from through to, inclusive.
+// Months are restored whole and at most once until they are archived again.
+func (m *Manager) Restore(ctx context.Context, from, to time.Time) (*RestoreResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	restored, err := loadRestored(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RestoreResult{Restored: []string{}, Skipped: []string{}}
+	for month := monthStart(from); !month.After(monthStart(to)); month = month.AddDate(0, 1, 0) {
+		key := month.Format(MonthFormat)
+
+		archives, err := m.archivesFor(key)
+		if err != nil {
+			return result, err
+		}
+		if _, ok := restored[key]; ok || len(archives) == 0 {
+			result.Skipped = append(result.Skipped, key)
+			continue
+		}
+
+		if err := m.store.EnsureUsagePartitions(ctx, month, month.AddDate(0, 1, 0)); err != nil {
+			return result, err
+		}
+
+		paths := make([]string, len(archives))
+		for i, a := range archives {
+			paths[i] = filepath.Join(m.config.ArchiveDir, a.File)
+		}
+		reader := newArchiveReader(paths)
+		n, err := m.store.ImportUsageEvents(ctx, reader.read)
+		reader.Close()
+		if err != nil {
+			return result, fmt.Errorf("failed to restore usage for %s: %w", key, err)
+		}
+
+		restored[key] = time.Now().UTC()
+		if err := saveRestored(m.config.ArchiveDir, restored); err != nil {
+			return result, err
+		}
+
+		log.Printf("[RETENTION] Restored %d usage events for %s", n, key)
+		result.Restored = append(result.Restored, key)
+		result.Events += n
+	}
+
+	return result, nil
+}
+
+// RebuildRollups recomputes usage rollups from raw events between start and
+// end (zero times are unbounded), skipping archived months: their raw events
+// are gone, so their rollups are all that is left of them. Returns the number
+// of rollups rebuilt and the months skipped.
+func (m *Manager) RebuildRollups(ctx context.Context, tenantID string, start, end time.Time) (int, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	months, err := m.archivedMonths()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Storage widens ranges to whole UTC days, which never reach across a
+	// month boundary
+	rebuilt := 0
+	skipped := []string{}
+	rebuild := func(from, to time.Time) error {
+		n, err := m.store.RebuildUsageRollups(ctx, tenantID, from, to)
+		rebuilt += n
+		return err
+	}
+
+	from := start
+	for _, month := range months {
+		next := month.AddDate(0, 1, 0)
+		if !end.IsZero() && !month.Before(end) {
+			break
+		}
+		if !start.IsZero() && !next.After(start) {
+			continue
+		}
+		skipped = append(skipped, month.Format(MonthFormat))
+		if from.IsZero() || from.Before(month) {
+			if err := rebuild(from, month); err != nil {
+				return rebuilt, skipped, err
+			}
+		}
+		from = next
+	}
+	if end.IsZero() || from.IsZero() || from.Before(end) {
+		if err := rebuild(from, end); err != nil {
+			return rebuilt, skipped, err
+		}
+	}
+
+	if len(skipped) > 0 {
+		log.Printf("[RETENTION] Kept the rollups of archived months %v while rebuilding", skipped)
+	}
+	return rebuilt, skipped, nil
+}
+
+// archivedMonths lists the months with archives that are not restored,
+// oldest first. Callers must hold the lock.
+func (m *Manager) archivedMonths() ([]time.Time, error) {
+	archives, err := listArchives(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := loadRestored(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var months []time.Time
+	for _, a := range archives {
+		if _, ok := restored[a.Month]; ok {
+			continue
+		}
+		if n := len(months); n > 0 && months[n-1].Format(MonthFormat) == a.Month {
+			continue
+		}
+		month, err := ParseMonth(a.Month)
+		if err != nil {
+			return nil, err
+		}
+		months = append(months, month)
+	}
+	return months, nil
+}
+
+// Archives lists the archive files on disk
+func (m *Manager) Archives() ([]Archive, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	archives, err := listArchives(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	restored, err := loadRestored(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	for i := range archives {
+		_, archives[i].Restored = restored[archives[i].Month]
+	}
+	if archives == nil {
+		archives = []Archive{}
+	}
+	return archives, nil
+}
+
+// countEvents counts the events in the given archive files. Callers must hold the lock.
+func (m *Manager) countEvents(archives []Archive) (int, error) {
+	paths := make([]string, len(archives))
+	for i, a := range archives {
+		paths[i] = filepath.Join(m.config.ArchiveDir, a.File)
+	}
+	reader := newArchiveReader(paths)
+	defer reader.Close()
+
+	n := 0
+	for {
+		e, err := reader.read()
+		if err != nil {
+			return n, err
+		}
+		if e == nil {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// archivesFor lists a month's archive files, oldest first. Callers must hold the lock.
+func (m *Manager) archivesFor(month string) ([]Archive, error) {
+	all, err := listArchives(m.config.ArchiveDir)
+	if err != nil {
+		return nil, err
+	}
+	var archives []Archive
+	for _, a := range all {
+		if a.Month == month {
+			archives = append(archives, a)
+		}
+	}
+	return archives, nil
+}
+
+// Run keeps partitions ahead and archives expired months on the given
+// interval until the context is cancelled
+func (m *Manager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("[RETENTION] Worker started (interval=%v, retention_days=%d, archive_dir=%s)",
+		interval, m.config.RetentionDays, m.config.ArchiveDir)
+
+	for {
+		if _, err := m.RunOnce(ctx, time.Now()); err != nil {
+			log.Printf("[RETENTION] Failed to apply usage retention: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package retention_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"brinkbyte-billing-server/models"
+	"brinkbyte-billing-server/retention"
+	"brinkbyte-billing-server/storage"
+)
+
+func TestRebuildRollupsKeepsArchivedMonths(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewInMemoryStorage()
+	manager := retention.NewManager(retention.Config{ArchiveDir: t.TempDir()}, store)
+
+	archived := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	live := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	events := []models.UsageEvent{
+		{TenantID: "t1", EventType: "camera_hours", ResourceID: "cam-1", Quantity: 5, Unit: "hours", EventTime: archived.Add(36 * time.Hour)},
+		{TenantID: "t1", EventType: "camera_hours", ResourceID: "cam-1", Quantity: 3, Unit: "hours", EventTime: live.Add(36 * time.Hour)},
+	}
+	if err := store.SaveUsageEvents(ctx, events); err != nil {
+		t.Fatalf("save usage events: %v", err)
+	}
+	if _, err := manager.ArchiveMonth(ctx, archived); err != nil {
+		t.Fatalf("archive month: %v", err)
+	}
+
+	if _, skipped, err := manager.RebuildRollups(ctx, "", time.Time{}, time.Time{}); err != nil {
+		t.Fatalf("rebuild rollups: %v", err)
+	} else if len(skipped) != 1 || skipped[0] != "2024-01" {
+		t.Fatalf("skipped months = %v, want [2024-01]", skipped)
+	}
+
+	for _, tc := range []struct {
+		month time.Time
+		want  float64
+	}{
+		{archived, 5},
+		{live, 3},
+	} {
+		summary, err := store.GetUsageSummary(ctx, "t1", tc.month, tc.month.AddDate(0, 1, 0))
+		if err != nil {
+			t.Fatalf("usage summary: %v", err)
+		}
+		if got := summary["camera_hours"]; got != tc.want {
+			t.Errorf("%s camera_hours = %v, want %v", tc.month.Format(retention.MonthFormat), got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"brinkbyte-billing-server/models"
+)
+
+// metadataString renders a metadata value the way Postgres' ->> operator
+// does: strings as-is, other values as JSON, missing keys as ""
+func metadataString(metadata map[string]interface{}, key string) string {
+	v, ok := metadata[key]
+	if !ok || v == nil {
+		return ""
+	}
+	if str, ok := v.(string); ok {
+		return str
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// matchesBreakdownFilters applies a breakdown query's filters. Metadata
+// filters match string values only, like JSONB containment.
+func matchesBreakdownFilters(q models.UsageBreakdownQuery, eventType, resourceID string, metadata map[string]interface{}) bool {
+	if q.EventType != "" && eventType != q.EventType {
+		return false
+	}
+	if q.ResourceID != "" && resourceID != q.ResourceID {
+		return false
+	}
+	for key, want := range q.MetadataFilters {
+		if v, ok := metadata[key].(string); !ok || v != want {
+			return false
+		}
+	}
+	return true
+}
+
+// breakdownAggregator sums quantities per combination of group-by values
+type breakdownAggregator struct {
+	groupBy []string
+	index   map[string]int
+	groups  []models.UsageBreakdownRow
+}
+
+func newBreakdownAggregator(groupBy []string) *breakdownAggregator {
+	return &breakdownAggregator{groupBy: groupBy, index: make(map[string]int)}
+}
+
+func (a *breakdownAggregator) add(eventType, resourceID string, metadata map[string]interface{}, quantity float64) {
+	values := make([]string, len(a.groupBy))
+	for i, dim := range a.groupBy {
+		switch {
+		case dim == models.DimensionEventType:
+			values[i] = eventType
+		case dim == models.DimensionResourceID:
+			values[i] = resourceID
+		case strings.HasPrefix(dim, models.DimensionMetadataPrefix):
+			values[i] = metadataString(metadata, strings.TrimPrefix(dim, models.DimensionMetadataPrefix))
+		}
+	}
+
+	key := strings.Join(values, "\x00")
+	i, ok := a.index[key]
+	if !ok {
+		dims := make(map[string]string, len(a.groupBy))
+		for j, dim := range a.groupBy {
+			dims[dim] = values[j]
+		}
+		i = len(a.groups)
+		a.index[key] = i
+		a.groups = append(a.groups, models.UsageBreakdownRow{Dimensions: dims})
+	}
+	a.groups[i].Quantity += quantity
+}
+
+// rows returns the largest groups first, at most limit of them
+func (a *breakdownAggregator) rows(limit int) []models.UsageBreakdownRow {
+	sort.SliceStable(a.groups, func(i, j int) bool {
+		return a.groups[i].Quantity > a.groups[j].Quantity
+	})
+	if limit > 0 && len(a.groups) > limit {
+		return a.groups[:limit]
+	}
+	if a.groups == nil {
+		return []models.UsageBreakdownRow{}
+	}
+	return a.groups
+}
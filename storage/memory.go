@@ -3,6 +3,8 @@ package storage
 import (
 	"context"
 	"encoding/json"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,7 +20,27 @@ type InMemoryStorage struct {
 	cameras       map[string]*models.CameraLicense // keyed by "tenantId:cameraId"
 	entitlements  map[string]*models.FeatureEntitlement // keyed by "tenantId:category:feature"
 	usageEvents   []models.UsageEvent
+	usageRollups  map[rollupKey]*models.UsageRollup
+	rollupBuckets map[bucketKey][]*models.UsageRollup // rollups per tenant bucket
+	eventsByHour  map[bucketKey][]int // usage event indexes per tenant hour
+	usageSpans    map[string][2]time.Time // first and last event time per tenant
 	devices       map[string]*models.EdgeDevice // keyed by device_id
+	deviceCerts   map[string]*models.DeviceCertificate // keyed by serial
+	enrollTokens  map[string]*models.EnrollmentToken // keyed by token id
+	paymentAccts  map[string]*models.PaymentAccount // keyed by tenant_id
+	payments      map[string]*models.PaymentAttempt // keyed by attempt id
+	dunningCases  map[string]*models.DunningCase // keyed by case id
+	creditNotes   map[string]*models.CreditNote // keyed by credit note id
+	wallets       map[string]*models.Wallet // keyed by tenant_id
+	creditGrants  map[string]*models.CreditGrant // keyed by grant id
+	walletTxs     []models.WalletTransaction
+	walletTxSeq   int64
+	pendingDraws  map[string]*models.PendingDrawdown // keyed by pending drawdown id
+	periods       map[string]*models.BillingPeriod // keyed by period id
+	heldUsage     map[string]*models.HeldUsageEvent // keyed by held event id
+	admins        map[string]*models.AdminPrincipal // keyed by admin id
+	deviceNonces  map[string]time.Time // keyed by device id and nonce, valued by expiry
+	nonceSweep    time.Time
 	mu            sync.RWMutex
 }
 
@@ -31,7 +53,24 @@ func NewInMemoryStorage() *InMemoryStorage {
 		cameras:       make(map[string]*models.CameraLicense),
 		entitlements:  make(map[string]*models.FeatureEntitlement),
 		usageEvents:   make([]models.UsageEvent, 0),
+		usageRollups:  make(map[rollupKey]*models.UsageRollup),
+		rollupBuckets: make(map[bucketKey][]*models.UsageRollup),
+		eventsByHour:  make(map[bucketKey][]int),
+		usageSpans:    make(map[string][2]time.Time),
 		devices:       make(map[string]*models.EdgeDevice),
+		deviceCerts:   make(map[string]*models.DeviceCertificate),
+		enrollTokens:  make(map[string]*models.EnrollmentToken),
+		paymentAccts:  make(map[string]*models.PaymentAccount),
+		payments:      make(map[string]*models.PaymentAttempt),
+		dunningCases:  make(map[string]*models.DunningCase),
+		creditNotes:   make(map[string]*models.CreditNote),
+		wallets:       make(map[string]*models.Wallet),
+		creditGrants:  make(map[string]*models.CreditGrant),
+		pendingDraws:  make(map[string]*models.PendingDrawdown),
+		periods:       make(map[string]*models.BillingPeriod),
+		heldUsage:     make(map[string]*models.HeldUsageEvent),
+		admins:        make(map[string]*models.AdminPrincipal),
+		deviceNonces:  make(map[string]time.Time),
 	}
 }
 
@@ -73,6 +112,45 @@ func (s *InMemoryStorage) UpdateTenant(ctx context.Context, tenant *models.Tenan
 	return nil
 }
 
+func (s *InMemoryStorage) ListTenants(ctx context.Context, q models.TenantListQuery) ([]models.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search := strings.ToLower(q.NameSearch)
+	var tenants []models.Tenant
+	for _, t := range s.tenants {
+		if !q.After.Admits(t.CreatedAt, t.ID) {
+			continue
+		}
+		if q.Status != "" && t.Status != q.Status {
+			continue
+		}
+		if q.Plan != "" {
+			sub, ok := s.subscriptions[t.ID]
+			if !ok || sub.Plan != q.Plan {
+				continue
+			}
+		}
+		if q.CreatedAfter != nil && t.CreatedAt.Before(*q.CreatedAfter) {
+			continue
+		}
+		if q.CreatedBefore != nil && !t.CreatedAt.Before(*q.CreatedBefore) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(t.Name), search) {
+			continue
+		}
+		tenants = append(tenants, *t)
+	}
+	sort.Slice(tenants, func(i, j int) bool {
+		return models.ListOrderLess(tenants[i].CreatedAt, tenants[i].ID, tenants[j].CreatedAt, tenants[j].ID)
+	})
+	if q.Limit > 0 && len(tenants) > q.Limit {
+		tenants = tenants[:q.Limit]
+	}
+	return tenants, nil
+}
+
 // =====================================
 // Subscription Operations
 // =====================================
@@ -100,6 +178,38 @@ func (s *InMemoryStorage) UpdateSubscription(ctx context.Context, sub *models.Su
 	return nil
 }
 
+func (s *InMemoryStorage) ListSubscriptions(ctx context.Context, q models.SubscriptionListQuery) ([]models.Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []models.Subscription
+	for _, sub := range s.subscriptions {
+		if !q.After.Admits(sub.CreatedAt, sub.ID) {
+			continue
+		}
+		if q.Plan != "" && sub.Plan != q.Plan {
+			continue
+		}
+		if q.Status != "" && sub.Status != q.Status {
+			continue
+		}
+		if q.ExpiringBefore != nil {
+			expiresAt := sub.ExpiresAt()
+			if expiresAt == nil || !expiresAt.Before(*q.ExpiringBefore) {
+				continue
+			}
+		}
+		subs = append(subs, *sub)
+	}
+	sort.Slice(subs, func(i, j int) bool {
+		return models.ListOrderLess(subs[i].CreatedAt, subs[i].ID, subs[j].CreatedAt, subs[j].ID)
+	})
+	if q.Limit > 0 && len(subs) > q.Limit {
+		subs = subs[:q.Limit]
+	}
+	return subs, nil
+}
+
 // =====================================
 // Growth Pack Operations
 // =====================================
@@ -199,6 +309,41 @@ func (s *InMemoryStorage) CountCamerasByTenant(ctx context.Context, tenantID str
 	return len(cameras), nil
 }
 
+func (s *InMemoryStorage) ListCameraLicenses(ctx context.Context, q models.CameraLicenseListQuery) ([]models.CameraLicense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cameras []models.CameraLicense
+	for _, cam := range s.cameras {
+		if !q.After.Admits(cam.CreatedAt, cam.ID) {
+			continue
+		}
+		if q.TenantID != "" && cam.TenantID != q.TenantID {
+			continue
+		}
+		if q.Mode != "" && cam.LicenseMode != q.Mode {
+			continue
+		}
+		if q.IsValid != nil && cam.IsValid != *q.IsValid {
+			continue
+		}
+		if q.LastValidatedAfter != nil && cam.LastValidated.Before(*q.LastValidatedAfter) {
+			continue
+		}
+		if q.LastValidatedBefore != nil && !cam.LastValidated.Before(*q.LastValidatedBefore) {
+			continue
+		}
+		cameras = append(cameras, *cam)
+	}
+	sort.Slice(cameras, func(i, j int) bool {
+		return models.ListOrderLess(cameras[i].CreatedAt, cameras[i].ID, cameras[j].CreatedAt, cameras[j].ID)
+	})
+	if q.Limit > 0 && len(cameras) > q.Limit {
+		cameras = cameras[:q.Limit]
+	}
+	return cameras, nil
+}
+
 // =====================================
 // Entitlement Operations
 // =====================================
@@ -227,26 +372,378 @@ func (s *InMemoryStorage) SaveEntitlement(ctx context.Context, ent *models.Featu
 // Usage Event Operations
 // =====================================
 
+type rollupKey struct {
+	granularity, tenantID, eventType, resourceID string
+	bucket                                       int64
+}
+
+type bucketKey struct {
+	granularity, tenantID string
+	bucket                int64
+}
+
 func (s *InMemoryStorage) SaveUsageEvents(ctx context.Context, events []models.UsageEvent) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.usageEvents = append(s.usageEvents, events...)
+	for _, e := range events {
+		s.appendUsageEvent(e)
+		s.addToRollups(e)
+	}
 	return nil
 }
 
+// appendUsageEvent stores and indexes an event without touching the rollups.
+// Callers must hold the lock.
+func (s *InMemoryStorage) appendUsageEvent(e models.UsageEvent) {
+	s.usageEvents = append(s.usageEvents, e)
+	s.indexUsageEvent(e, len(s.usageEvents)-1)
+}
+
+// indexUsageEvent records the event at index i in the hourly event index and
+// the tenant's usage span. Callers must hold the lock.
+func (s *InMemoryStorage) indexUsageEvent(e models.UsageEvent, i int) {
+	hour := bucketKey{"event", e.TenantID, rollupBucket(e.EventTime, models.RollupHour).Unix()}
+	s.eventsByHour[hour] = append(s.eventsByHour[hour], i)
+
+	span, ok := s.usageSpans[e.TenantID]
+	if !ok || e.EventTime.Before(span[0]) {
+		span[0] = e.EventTime
+	}
+	if !ok || e.EventTime.After(span[1]) {
+		span[1] = e.EventTime
+	}
+	s.usageSpans[e.TenantID] = span
+}
+
+// addToRollups adds an event to its hourly and daily rollups and returns how
+// many rollups it created. Callers must hold the lock.
+func (s *InMemoryStorage) addToRollups(e models.UsageEvent) int {
+	created := 0
+	for _, g := range []string{models.RollupHour, models.RollupDay} {
+		bucket := rollupBucket(e.EventTime, g)
+		k := rollupKey{g, e.TenantID, e.EventType, e.ResourceID, bucket.Unix()}
+		rollup, ok := s.usageRollups[k]
+		if !ok {
+			rollup = &models.UsageRollup{
+				Granularity: g,
+				TenantID:    e.TenantID,
+				EventType:   e.EventType,
+				ResourceID:  e.ResourceID,
+				BucketStart: bucket,
+			}
+			s.usageRollups[k] = rollup
+			bk := bucketKey{g, e.TenantID, bucket.Unix()}
+			s.rollupBuckets[bk] = append(s.rollupBuckets[bk], rollup)
+			created++
+		}
+		rollup.Quantity += e.Quantity
+		rollup.EventCount++
+	}
+	return created
+}
+
+// clampToUsageSpan narrows [start, end] to the tenant's first and last
+// event, reporting false when nothing can match. Callers must hold the lock.
+func (s *InMemoryStorage) clampToUsageSpan(tenantID string, start, end time.Time) (time.Time, time.Time, bool) {
+	span, ok := s.usageSpans[tenantID]
+	if !ok {
+		return start, end, false
+	}
+	if start.Before(span[0]) {
+		start = span[0]
+	}
+	if end.After(span[1]) {
+		end = span[1]
+	}
+	return start, end, !end.Before(start)
+}
+
+// scanEvents calls fn for each of the tenant's raw events in [from, to], or
+// [from, to) when not inclusive, using the hourly event index. Callers must hold the lock.
+func (s *InMemoryStorage) scanEvents(tenantID string, from, to time.Time, inclusive bool, fn func(e models.UsageEvent)) {
+	for h := from.UTC().Truncate(time.Hour); h.Before(to) || (inclusive && h.Equal(to)); h = h.Add(time.Hour) {
+		for _, i := range s.eventsByHour[bucketKey{"event", tenantID, h.Unix()}] {
+			e := s.usageEvents[i]
+			if e.EventTime.Before(from) || e.EventTime.After(to) || (!inclusive && e.EventTime.Equal(to)) {
+				continue
+			}
+			fn(e)
+		}
+	}
+}
+
+// scanUsage calls fn for each of the tenant's usage rows in [start, end],
+// reading whole hours and days from the rollups and only the partial hours
+// at either end from raw events. A row's time is its event time or rollup
+// bucket start. Callers must hold the lock.
+func (s *InMemoryStorage) scanUsage(tenantID string, start, end time.Time, loc *time.Location, fn func(eventType, resourceID string, at time.Time, quantity float64)) {
+	start, end, ok := s.clampToUsageSpan(tenantID, start, end)
+	if !ok {
+		return
+	}
+
+	r := splitUsageRange(start, end, loc)
+
+	raw := func(e models.UsageEvent) {
+		fn(e.EventType, e.ResourceID, e.EventTime, e.Quantity)
+	}
+	rollups := func(g string, from, to time.Time) {
+		step := time.Hour
+		if g == models.RollupDay {
+			step = day
+		}
+		for b := from; b.Before(to); b = b.Add(step) {
+			for _, rollup := range s.rollupBuckets[bucketKey{g, tenantID, b.Unix()}] {
+				fn(rollup.EventType, rollup.ResourceID, rollup.BucketStart, rollup.Quantity)
+			}
+		}
+	}
+
+	s.scanEvents(tenantID, r.start, r.hourStart, false, raw)
+	rollups(models.RollupHour, r.hourStart, r.dayStart)
+	rollups(models.RollupDay, r.dayStart, r.dayEnd)
+	rollups(models.RollupHour, r.dayEnd, r.hourEnd)
+	s.scanEvents(tenantID, r.hourEnd, r.end, true, raw)
+}
+
 func (s *InMemoryStorage) GetUsageSummary(ctx context.Context, tenantID string, start, end time.Time) (map[string]float64, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	
+
 	summary := make(map[string]float64)
-	for _, event := range s.usageEvents {
-		if event.TenantID == tenantID && 
-		   (event.EventTime.After(start) || event.EventTime.Equal(start)) &&
-		   (event.EventTime.Before(end) || event.EventTime.Equal(end)) {
-			summary[event.EventType] += event.Quantity
+	s.scanUsage(tenantID, start, end, time.UTC, func(eventType, resourceID string, at time.Time, quantity float64) {
+		summary[eventType] += quantity
+	})
+	return summary, nil
+}
+
+// GetUsageTimeSeries buckets a tenant's usage in loc. An empty eventType includes all types.
+func (s *InMemoryStorage) GetUsageTimeSeries(ctx context.Context, tenantID, eventType string, start, end time.Time, granularity string, loc *time.Location) ([]models.UsageBucket, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	type key struct {
+		eventType string
+		bucket    int64
+	}
+	totals := make(map[key]float64)
+	s.scanUsage(tenantID, start, end, loc, func(et, resourceID string, at time.Time, quantity float64) {
+		if eventType == "" || et == eventType {
+			totals[key{et, models.UsageBucketStart(at, granularity, loc).Unix()}] += quantity
 		}
+	})
+
+	buckets := make([]models.UsageBucket, 0, len(totals))
+	for k, quantity := range totals {
+		buckets = append(buckets, models.UsageBucket{
+			EventType:   k.eventType,
+			BucketStart: time.Unix(k.bucket, 0).In(loc),
+			Quantity:    quantity,
+		})
 	}
-	return summary, nil
+	return buckets, nil
+}
+
+// GetUsageBreakdown groups a tenant's usage by resource and metadata
+// dimensions, reading raw events only when metadata is involved
+func (s *InMemoryStorage) GetUsageBreakdown(ctx context.Context, q models.UsageBreakdownQuery) ([]models.UsageBreakdownRow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agg := newBreakdownAggregator(q.GroupBy)
+
+	if !q.UsesMetadata() {
+		s.scanUsage(q.TenantID, q.Start, q.End, time.UTC, func(eventType, resourceID string, at time.Time, quantity float64) {
+			if matchesBreakdownFilters(q, eventType, resourceID, nil) {
+				agg.add(eventType, resourceID, nil, quantity)
+			}
+		})
+		return agg.rows(q.Limit), nil
+	}
+
+	start, end, ok := s.clampToUsageSpan(q.TenantID, q.Start, q.End)
+	if !ok {
+		return agg.rows(q.Limit), nil
+	}
+	s.scanEvents(q.TenantID, start, end, true, func(e models.UsageEvent) {
+		if q.EventType != "" && e.EventType != q.EventType {
+			return
+		}
+		var metadata map[string]interface{}
+		json.Unmarshal(e.Metadata, &metadata)
+		if matchesBreakdownFilters(q, e.EventType, e.ResourceID, metadata) {
+			agg.add(e.EventType, e.ResourceID, metadata, e.Quantity)
+		}
+	})
+	return agg.rows(q.Limit), nil
+}
+
+// ExportUsageEvents calls fn for each matching usage event in ingest order.
+// Events are copied out in chunks so the lock is not held while fn writes.
+func (s *InMemoryStorage) ExportUsageEvents(ctx context.Context, q models.UsageExportQuery, fn func(e models.UsageEvent) error) error {
+	const chunkSize = 1000
+
+	for pos := 0; ; {
+		s.mu.RLock()
+		var chunk []models.UsageEvent
+		for ; pos < len(s.usageEvents) && len(chunk) < chunkSize; pos++ {
+			e := s.usageEvents[pos]
+			if (q.TenantID == "" || e.TenantID == q.TenantID) &&
+				(q.EventType == "" || e.EventType == q.EventType) &&
+				!e.EventTime.Before(q.Start) && e.EventTime.Before(q.End) {
+				chunk = append(chunk, e)
+			}
+		}
+		done := pos >= len(s.usageEvents)
+		s.mu.RUnlock()
+
+		for _, e := range chunk {
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+		if done {
+			return ctx.Err()
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+// RebuildUsageRollups recomputes rollups from raw events over whole UTC days
+func (s *InMemoryStorage) RebuildUsageRollups(ctx context.Context, tenantID string, start, end time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !start.IsZero() {
+		start = start.UTC().Truncate(day)
+	}
+	if !end.IsZero() {
+		end = ceilTime(end, day)
+	}
+	matches := func(tenant string, t time.Time) bool {
+		return (tenantID == "" || tenant == tenantID) &&
+			(start.IsZero() || !t.Before(start)) && (end.IsZero() || t.Before(end))
+	}
+
+	for k, rollup := range s.usageRollups {
+		if matches(k.tenantID, rollup.BucketStart) {
+			delete(s.usageRollups, k)
+		}
+	}
+	for k := range s.rollupBuckets {
+		if matches(k.tenantID, time.Unix(k.bucket, 0)) {
+			delete(s.rollupBuckets, k)
+		}
+	}
+
+	rebuilt := 0
+	for _, e := range s.usageEvents {
+		if matches(e.TenantID, e.EventTime) {
+			rebuilt += s.addToRollups(e)
+		}
+	}
+	return rebuilt, nil
+}
+
+// =====================================
+// Usage Retention Operations
+// =====================================
+
+// EnsureUsagePartitions is a no-op; in-memory events are not partitioned
+func (s *InMemoryStorage) EnsureUsagePartitions(ctx context.Context, from, to time.Time) error {
+	return nil
+}
+
+// GetArchivableUsageMonths lists the UTC months ending on or before cutoff
+// that still hold events
+func (s *InMemoryStorage) GetArchivableUsageMonths(ctx context.Context, cutoff time.Time) ([]time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	seen := make(map[time.Time]bool)
+	var months []time.Time
+	for _, e := range s.usageEvents {
+		month := usageMonth(e.EventTime)
+		if !seen[month] && !month.AddDate(0, 1, 0).After(cutoff) {
+			seen[month] = true
+			months = append(months, month)
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months, nil
+}
+
+// ArchiveUsageMonth streams a month's events to write, calls seal, then
+// drops them. Rollups are kept.
+func (s *InMemoryStorage) ArchiveUsageMonth(ctx context.Context, month time.Time, write func(e models.UsageEvent) error, seal func() error) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	month = usageMonth(month)
+	inMonth := func(e models.UsageEvent) bool {
+		return usageMonth(e.EventTime).Equal(month)
+	}
+
+	var archived []models.UsageEvent
+	for _, e := range s.usageEvents {
+		if inMonth(e) {
+			archived = append(archived, e)
+		}
+	}
+	sort.SliceStable(archived, func(i, j int) bool {
+		return archived[i].EventTime.Before(archived[j].EventTime)
+	})
+	for _, e := range archived {
+		if err := write(e); err != nil {
+			return 0, err
+		}
+	}
+	if err := seal(); err != nil {
+		return 0, err
+	}
+
+	kept := make([]models.UsageEvent, 0, len(s.usageEvents)-len(archived))
+	for _, e := range s.usageEvents {
+		if !inMonth(e) {
+			kept = append(kept, e)
+		}
+	}
+	s.usageEvents = kept
+
+	// Event indexes shift, so rebuild them. Usage spans keep covering the
+	// archived month since its rollups still answer summaries.
+	s.eventsByHour = make(map[bucketKey][]int)
+	for i, e := range s.usageEvents {
+		s.indexUsageEvent(e, i)
+	}
+
+	return len(archived), nil
+}
+
+// ImportUsageEvents loads raw events until read returns nil, leaving the
+// rollups alone. Nothing is stored if read fails.
+func (s *InMemoryStorage) ImportUsageEvents(ctx context.Context, read func() (*models.UsageEvent, error)) (int, error) {
+	var events []models.UsageEvent
+	for {
+		e, err := read()
+		if err != nil {
+			return 0, err
+		}
+		if e == nil {
+			break
+		}
+		e.Metadata = normalizeMetadata(e.Metadata)
+		events = append(events, *e)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range events {
+		s.appendUsageEvent(e)
+	}
+	return len(events), nil
 }
 
 // =====================================
@@ -256,7 +753,37 @@ func (s *InMemoryStorage) GetUsageSummary(ctx context.Context, tenantID string,
 func (s *InMemoryStorage) SaveEdgeDevice(ctx context.Context, device *models.EdgeDevice) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	s.devices[device.DeviceID] = device
+	d := *device
+	if existing, ok := s.devices[device.DeviceID]; ok {
+		d.ID = existing.ID
+		d.TenantID = existing.TenantID
+		d.CreatedAt = existing.CreatedAt
+	}
+	s.devices[device.DeviceID] = &d
+	return nil
+}
+
+func (s *InMemoryStorage) RecordDeviceHeartbeat(ctx context.Context, device *models.EdgeDevice) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	existing, ok := s.devices[device.DeviceID]
+	if !ok {
+		d := *device
+		s.devices[device.DeviceID] = &d
+		return nil
+	}
+	if existing.TenantID != device.TenantID {
+		return nil
+	}
+	if existing.Status != models.DeviceStatusSuspended {
+		existing.Status = models.DeviceStatusActive
+	}
+	if device.ManagementTier != "" && !existing.TierLocked {
+		existing.ManagementTier = device.ManagementTier
+	}
+	existing.LastHeartbeat = device.LastHeartbeat
+	existing.ActiveCameraCount = device.ActiveCameraCount
+	existing.UpdatedAt = device.UpdatedAt
 	return nil
 }
 
@@ -264,11 +791,651 @@ func (s *InMemoryStorage) GetEdgeDevice(ctx context.Context, deviceID string) (*
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if d, ok := s.devices[deviceID]; ok {
-		return d, nil
+		device := *d
+		return &device, nil
 	}
 	return nil, nil
 }
 
+func (s *InMemoryStorage) RecordDeviceNonce(ctx context.Context, deviceID, nonce string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.nonceSweep) > time.Minute {
+		for k, expiry := range s.deviceNonces {
+			if now.After(expiry) {
+				delete(s.deviceNonces, k)
+			}
+		}
+		s.nonceSweep = now
+	}
+
+	key := deviceID + "\x00" + nonce
+	if expiry, ok := s.deviceNonces[key]; ok && !now.After(expiry) {
+		return false, nil
+	}
+	s.deviceNonces[key] = expiresAt
+	return true, nil
+}
+
+// =====================================
+// Device Certificate Operations
+// =====================================
+
+func (s *InMemoryStorage) CreateDeviceCertificate(ctx context.Context, cert *models.DeviceCertificate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *cert
+	s.deviceCerts[c.Serial] = &c
+	return nil
+}
+
+func (s *InMemoryStorage) GetDeviceCertificate(ctx context.Context, serial string) (*models.DeviceCertificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if c, ok := s.deviceCerts[serial]; ok {
+		cert := *c
+		return &cert, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) ListDeviceCertificates(ctx context.Context, deviceID string) ([]models.DeviceCertificate, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var certs []models.DeviceCertificate
+	for _, c := range s.deviceCerts {
+		if c.DeviceID == deviceID {
+			certs = append(certs, *c)
+		}
+	}
+	sort.Slice(certs, func(i, j int) bool {
+		return certs[i].CreatedAt.After(certs[j].CreatedAt)
+	})
+	return certs, nil
+}
+
+func (s *InMemoryStorage) RevokeDeviceCertificate(ctx context.Context, serial, reason string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.deviceCerts[serial]; ok && c.RevokedAt == nil {
+		c.RevokedAt = &at
+		c.RevocationReason = &reason
+	}
+	return nil
+}
+
+// =====================================
+// Enrollment Token Operations
+// =====================================
+
+func (s *InMemoryStorage) CreateEnrollmentToken(ctx context.Context, token *models.EnrollmentToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := *token
+	s.enrollTokens[t.ID] = &t
+	return nil
+}
+
+func (s *InMemoryStorage) GetEnrollmentTokenByHash(ctx context.Context, tokenHash string) (*models.EnrollmentToken, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, t := range s.enrollTokens {
+		if t.TokenHash == tokenHash {
+			token := *t
+			return &token, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) RedeemEnrollmentToken(ctx context.Context, tokenID, deviceID string, at time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.enrollTokens[tokenID]
+	if !ok || !t.Redeemable(at) {
+		return false, nil
+	}
+	t.UsedAt = &at
+	t.UsedByDevice = &deviceID
+	return true, nil
+}
+
+// =====================================
+// Payment Operations
+// =====================================
+
+func (s *InMemoryStorage) GetPaymentAccount(ctx context.Context, tenantID string) (*models.PaymentAccount, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.paymentAccts[tenantID]; ok {
+		return a, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) SavePaymentAccount(ctx context.Context, account *models.PaymentAccount) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paymentAccts[account.TenantID] = account
+	return nil
+}
+
+func (s *InMemoryStorage) SavePaymentAttempt(ctx context.Context, attempt *models.PaymentAttempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payments[attempt.ID] = attempt
+	return nil
+}
+
+func (s *InMemoryStorage) GetPaymentAttempt(ctx context.Context, attemptID string) (*models.PaymentAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.payments[attemptID]; ok {
+		return p, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetPaymentAttemptByChargeID(ctx context.Context, provider, chargeID string) (*models.PaymentAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, p := range s.payments {
+		if p.Provider == provider && p.ProviderChargeID != nil && *p.ProviderChargeID == chargeID {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetPaymentAttemptsByTenant(ctx context.Context, tenantID string) ([]models.PaymentAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var attempts []models.PaymentAttempt
+	for _, p := range s.payments {
+		if p.TenantID == tenantID {
+			attempts = append(attempts, *p)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].CreatedAt.After(attempts[j].CreatedAt)
+	})
+	return attempts, nil
+}
+
+func (s *InMemoryStorage) GetPaymentAttemptsInRange(ctx context.Context, start, end time.Time) ([]models.PaymentAttempt, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var attempts []models.PaymentAttempt
+	for _, p := range s.payments {
+		if !p.CreatedAt.Before(start) && !p.CreatedAt.After(end) {
+			attempts = append(attempts, *p)
+		}
+	}
+	return attempts, nil
+}
+
+// =====================================
+// Credit Note Operations
+// =====================================
+
+func (s *InMemoryStorage) SaveCreditNote(ctx context.Context, note *models.CreditNote) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.creditNotes[note.ID] = note
+	return nil
+}
+
+func (s *InMemoryStorage) GetCreditNote(ctx context.Context, noteID string) (*models.CreditNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if n, ok := s.creditNotes[noteID]; ok {
+		return n, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetCreditNotesByTenant(ctx context.Context, tenantID string) ([]models.CreditNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notes []models.CreditNote
+	for _, n := range s.creditNotes {
+		if n.TenantID == tenantID {
+			notes = append(notes, *n)
+		}
+	}
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].IssuedAt.After(notes[j].IssuedAt)
+	})
+	return notes, nil
+}
+
+func (s *InMemoryStorage) GetCreditNotesInRange(ctx context.Context, start, end time.Time) ([]models.CreditNote, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var notes []models.CreditNote
+	for _, n := range s.creditNotes {
+		if !n.IssuedAt.Before(start) && !n.IssuedAt.After(end) {
+			notes = append(notes, *n)
+		}
+	}
+	return notes, nil
+}
+
+// =====================================
+// Wallet Operations
+// =====================================
+
+func (s *InMemoryStorage) GetWallet(ctx context.Context, tenantID string) (*models.Wallet, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if w, ok := s.wallets[tenantID]; ok {
+		return w, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) SaveWallet(ctx context.Context, w *models.Wallet) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wallets[w.TenantID] = w
+	return nil
+}
+
+// activeGrants returns the tenant's spendable grants, soonest expiry first.
+// Callers must hold the lock.
+func (s *InMemoryStorage) activeGrants(tenantID string, now time.Time) []*models.CreditGrant {
+	var grants []*models.CreditGrant
+	for _, g := range s.creditGrants {
+		if g.TenantID == tenantID && g.Remaining > 0 && (g.ExpiresAt == nil || g.ExpiresAt.After(now)) {
+			grants = append(grants, g)
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		a, b := grants[i], grants[j]
+		if (a.ExpiresAt == nil) != (b.ExpiresAt == nil) {
+			return a.ExpiresAt != nil
+		}
+		if a.ExpiresAt != nil && !a.ExpiresAt.Equal(*b.ExpiresAt) {
+			return a.ExpiresAt.Before(*b.ExpiresAt)
+		}
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+	return grants
+}
+
+// walletBalance sums the tenant's spendable credit. Callers must hold the lock.
+func (s *InMemoryStorage) walletBalance(tenantID string, now time.Time) float64 {
+	var balance float64
+	for _, g := range s.activeGrants(tenantID, now) {
+		balance += g.Remaining
+	}
+	return balance
+}
+
+// appendWalletTx assigns an ID and appends a ledger entry. Callers must hold the lock.
+func (s *InMemoryStorage) appendWalletTx(tx models.WalletTransaction) {
+	s.walletTxSeq++
+	tx.ID = s.walletTxSeq
+	s.walletTxs = append(s.walletTxs, tx)
+}
+
+func (s *InMemoryStorage) AddCreditGrant(ctx context.Context, grant *models.CreditGrant) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if grant.PaymentAttemptID != nil {
+		for _, g := range s.creditGrants {
+			if g.PaymentAttemptID != nil && *g.PaymentAttemptID == *grant.PaymentAttemptID {
+				return false, nil
+			}
+		}
+	}
+
+	stored := *grant
+	s.creditGrants[grant.ID] = &stored
+
+	grantID := grant.ID
+	s.appendWalletTx(models.WalletTransaction{
+		TenantID:     grant.TenantID,
+		Type:         grant.Type,
+		Amount:       grant.Amount,
+		BalanceAfter: s.walletBalance(grant.TenantID, grant.CreatedAt),
+		GrantID:      &grantID,
+		Description:  grant.Description,
+		CreatedAt:    grant.CreatedAt,
+	})
+	return true, nil
+}
+
+func (s *InMemoryStorage) DrawdownCredits(ctx context.Context, tenantID string, amount float64, tx models.WalletTransaction) (float64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	remaining := amount
+	for _, g := range s.activeGrants(tenantID, tx.CreatedAt) {
+		if remaining <= 0 {
+			break
+		}
+		take := g.Remaining
+		if take > remaining {
+			take = remaining
+		}
+		g.Remaining -= take
+		remaining -= take
+	}
+
+	drawn := roundCredit(amount - remaining)
+	if drawn > 0 {
+		drawdown := tx
+		drawdown.Amount = -drawn
+		drawdown.BalanceAfter = s.walletBalance(tenantID, tx.CreatedAt)
+		s.appendWalletTx(drawdown)
+	}
+	if shortfall := roundCredit(remaining); shortfall > 0 {
+		overage := overageEntry(tx, shortfall)
+		overage.BalanceAfter = s.walletBalance(tenantID, tx.CreatedAt)
+		s.appendWalletTx(overage)
+	}
+	return drawn, nil
+}
+
+func (s *InMemoryStorage) ExpireCreditGrants(ctx context.Context, tenantID string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, g := range s.creditGrants {
+		if g.TenantID != tenantID || g.Remaining <= 0 || g.ExpiresAt == nil || g.ExpiresAt.After(now) {
+			continue
+		}
+		expired := g.Remaining
+		g.Remaining = 0
+		grantID := g.ID
+		s.appendWalletTx(models.WalletTransaction{
+			TenantID:     tenantID,
+			Type:         models.WalletTxExpiry,
+			Amount:       -expired,
+			BalanceAfter: s.walletBalance(tenantID, now),
+			GrantID:      &grantID,
+			Description:  "Credit grant expired",
+			CreatedAt:    now,
+		})
+	}
+	return nil
+}
+
+func (s *InMemoryStorage) GetWalletBalance(ctx context.Context, tenantID string, now time.Time) (float64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.walletBalance(tenantID, now), nil
+}
+
+func (s *InMemoryStorage) GetActiveCreditGrants(ctx context.Context, tenantID string, now time.Time) ([]models.CreditGrant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var grants []models.CreditGrant
+	for _, g := range s.activeGrants(tenantID, now) {
+		grants = append(grants, *g)
+	}
+	return grants, nil
+}
+
+func (s *InMemoryStorage) GetWalletTransactions(ctx context.Context, tenantID string, limit int) ([]models.WalletTransaction, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var txs []models.WalletTransaction
+	for i := len(s.walletTxs) - 1; i >= 0 && (limit <= 0 || len(txs) < limit); i-- {
+		if s.walletTxs[i].TenantID == tenantID {
+			txs = append(txs, s.walletTxs[i])
+		}
+	}
+	return txs, nil
+}
+
+func (s *InMemoryStorage) SavePendingDrawdown(ctx context.Context, pending *models.PendingDrawdown) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p := *pending
+	s.pendingDraws[p.ID] = &p
+	return nil
+}
+
+func (s *InMemoryStorage) GetPendingDrawdowns(ctx context.Context, limit int) ([]models.PendingDrawdown, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var pending []models.PendingDrawdown
+	for _, p := range s.pendingDraws {
+		pending = append(pending, *p)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].CreatedAt.Equal(pending[j].CreatedAt) {
+			return pending[i].CreatedAt.Before(pending[j].CreatedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	if limit > 0 && len(pending) > limit {
+		pending = pending[:limit]
+	}
+	return pending, nil
+}
+
+func (s *InMemoryStorage) DeletePendingDrawdown(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pendingDraws[id]; !ok {
+		return false, nil
+	}
+	delete(s.pendingDraws, id)
+	return true, nil
+}
+
+// =====================================
+// Billing Period Operations
+// =====================================
+
+func (s *InMemoryStorage) SaveBillingPeriod(ctx context.Context, period *models.BillingPeriod) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.periods[period.ID] = period
+	return nil
+}
+
+func (s *InMemoryStorage) GetBillingPeriod(ctx context.Context, periodID string) (*models.BillingPeriod, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if p, ok := s.periods[periodID]; ok {
+		return p, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetBillingPeriods(ctx context.Context, tenantID string) ([]models.BillingPeriod, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var periods []models.BillingPeriod
+	for _, p := range s.periods {
+		if p.TenantID == tenantID {
+			periods = append(periods, *p)
+		}
+	}
+	sort.Slice(periods, func(i, j int) bool {
+		return periods[i].PeriodStart.After(periods[j].PeriodStart)
+	})
+	return periods, nil
+}
+
+func (s *InMemoryStorage) SaveHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.heldUsage[held.ID] = held
+	return nil
+}
+
+func (s *InMemoryStorage) ReviewHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent, events []models.UsageEvent) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, ok := s.heldUsage[held.ID]
+	if !ok || current.Status != models.HeldUsagePending {
+		return false, nil
+	}
+	for _, e := range events {
+		s.appendUsageEvent(e)
+		s.addToRollups(e)
+	}
+	s.heldUsage[held.ID] = held
+	return true, nil
+}
+
+func (s *InMemoryStorage) GetHeldUsageEvent(ctx context.Context, heldID string) (*models.HeldUsageEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if h, ok := s.heldUsage[heldID]; ok {
+		return h, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetHeldUsageEvents(ctx context.Context, tenantID, status string) ([]models.HeldUsageEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var held []models.HeldUsageEvent
+	for _, h := range s.heldUsage {
+		if (tenantID == "" || h.TenantID == tenantID) && (status == "" || h.Status == status) {
+			held = append(held, *h)
+		}
+	}
+	sort.Slice(held, func(i, j int) bool {
+		return held[i].ReceivedAt.Before(held[j].ReceivedAt)
+	})
+	return held, nil
+}
+
+// =====================================
+// Dunning Operations
+// =====================================
+
+func (s *InMemoryStorage) SaveDunningCase(ctx context.Context, dc *models.DunningCase) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := *dc
+	s.dunningCases[dc.ID] = &stored
+	return nil
+}
+
+func (s *InMemoryStorage) GetOpenDunningCase(ctx context.Context, tenantID string) (*models.DunningCase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, dc := range s.dunningCases {
+		if dc.TenantID == tenantID && dc.Status == models.DunningStatusOpen {
+			found := *dc
+			return &found, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetDueDunningCases(ctx context.Context, before time.Time) ([]models.DunningCase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cases []models.DunningCase
+	for _, dc := range s.dunningCases {
+		if dc.Status == models.DunningStatusOpen && dc.NextActionAt != nil && !dc.NextActionAt.After(before) {
+			cases = append(cases, *dc)
+		}
+	}
+	return cases, nil
+}
+
+func (s *InMemoryStorage) GetDunningCasesByTenant(ctx context.Context, tenantID string) ([]models.DunningCase, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var cases []models.DunningCase
+	for _, dc := range s.dunningCases {
+		if dc.TenantID == tenantID {
+			cases = append(cases, *dc)
+		}
+	}
+	sort.Slice(cases, func(i, j int) bool {
+		return cases[i].StartedAt.After(cases[j].StartedAt)
+	})
+	return cases, nil
+}
+
+// =====================================
+// Admin Principal Operations
+// =====================================
+
+func (s *InMemoryStorage) CreateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := *admin
+	s.admins[a.ID] = &a
+	return nil
+}
+
+func (s *InMemoryStorage) UpdateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a := *admin
+	s.admins[a.ID] = &a
+	return nil
+}
+
+func (s *InMemoryStorage) GetAdminPrincipal(ctx context.Context, adminID string) (*models.AdminPrincipal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if a, ok := s.admins[adminID]; ok {
+		admin := *a
+		return &admin, nil
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) GetAdminPrincipalByKeyHash(ctx context.Context, keyHash string) (*models.AdminPrincipal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, a := range s.admins {
+		if a.KeyHash == keyHash {
+			admin := *a
+			return &admin, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *InMemoryStorage) ListAdminPrincipals(ctx context.Context) ([]models.AdminPrincipal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var admins []models.AdminPrincipal
+	for _, a := range s.admins {
+		admins = append(admins, *a)
+	}
+	sort.Slice(admins, func(i, j int) bool {
+		return admins[i].CreatedAt.Before(admins[j].CreatedAt)
+	})
+	return admins, nil
+}
+
+func (s *InMemoryStorage) CountAdminPrincipals(ctx context.Context) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.admins), nil
+}
+
 // =====================================
 // Statistics
 // =====================================
@@ -297,7 +1464,7 @@ func (s *InMemoryStorage) AddUsageEvents(events []models.UsageEventLegacy) {
 	
 	for _, e := range events {
 		metadata, _ := json.Marshal(e.Metadata)
-		s.usageEvents = append(s.usageEvents, models.UsageEvent{
+		s.appendUsageEvent(models.UsageEvent{
 			TenantID:   e.TenantID,
 			EventType:  e.EventType,
 			ResourceID: e.ResourceID,
@@ -306,6 +1473,7 @@ func (s *InMemoryStorage) AddUsageEvents(events []models.UsageEventLegacy) {
 			Metadata:   metadata,
 			EventTime:  e.EventTime,
 		})
+		s.addToRollups(s.usageEvents[len(s.usageEvents)-1])
 	}
 }
 
@@ -2,9 +2,13 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgx/v4"
@@ -179,9 +183,10 @@ func (s *PostgresStorage) initSchema(ctx context.Context) error {
 		UNIQUE(tenant_id, feature_category, feature_name)
 	);
 
-	-- Usage events
+	-- Usage events, partitioned by month of event_time (see EnsureUsagePartitions).
+	-- Events outside every monthly partition land in the default partition.
 	CREATE TABLE IF NOT EXISTS usage_events (
-		id BIGSERIAL PRIMARY KEY,
+		id BIGSERIAL,
 		tenant_id TEXT NOT NULL,
 		event_type VARCHAR(100) NOT NULL,
 		resource_id VARCHAR(255),
@@ -189,7 +194,21 @@ func (s *PostgresStorage) initSchema(ctx context.Context) error {
 		unit VARCHAR(50) NOT NULL,
 		metadata JSONB DEFAULT '{}',
 		event_time TIMESTAMP WITH TIME ZONE NOT NULL,
-		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (id, event_time)
+	) PARTITION BY RANGE (event_time);
+	CREATE TABLE IF NOT EXISTS usage_events_default PARTITION OF usage_events DEFAULT;
+
+	-- Hourly and daily usage rollups (UTC buckets), maintained at ingest
+	CREATE TABLE IF NOT EXISTS usage_rollups (
+		granularity VARCHAR(10) NOT NULL,
+		tenant_id TEXT NOT NULL,
+		event_type VARCHAR(100) NOT NULL,
+		resource_id VARCHAR(255) NOT NULL DEFAULT '',
+		bucket_start TIMESTAMP WITH TIME ZONE NOT NULL,
+		quantity DECIMAL(20,5) NOT NULL DEFAULT 0,
+		event_count BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (granularity, tenant_id, bucket_start, event_type, resource_id)
 	);
 
 	-- API keys table
@@ -219,6 +238,151 @@ func (s *PostgresStorage) initSchema(ctx context.Context) error {
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 	);
 
+	-- Payment provider customers
+	CREATE TABLE IF NOT EXISTS payment_accounts (
+		tenant_id TEXT PRIMARY KEY REFERENCES tenants(id),
+		provider VARCHAR(50) NOT NULL,
+		customer_id VARCHAR(255) NOT NULL,
+		payment_method_id VARCHAR(255),
+		card_brand VARCHAR(50),
+		card_last4 VARCHAR(4),
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Payment attempts
+	CREATE TABLE IF NOT EXISTS payment_attempts (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		subscription_id TEXT REFERENCES subscriptions(id),
+		provider VARCHAR(50) NOT NULL,
+		provider_charge_id VARCHAR(255),
+		amount DECIMAL(10,2) NOT NULL,
+		refunded_amount DECIMAL(10,2) DEFAULT 0,
+		currency VARCHAR(3) NOT NULL,
+		status VARCHAR(50) NOT NULL,
+		failure_code VARCHAR(100),
+		failure_message TEXT,
+		description TEXT,
+		reference_type VARCHAR(50),
+		reference_id TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Dunning cases for failed payments
+	CREATE TABLE IF NOT EXISTS dunning_cases (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		subscription_id TEXT REFERENCES subscriptions(id),
+		payment_attempt_id TEXT NOT NULL,
+		last_attempt_id TEXT NOT NULL,
+		amount DECIMAL(10,2) NOT NULL,
+		description TEXT,
+		reference_type VARCHAR(50),
+		reference_id TEXT,
+		status VARCHAR(50) NOT NULL DEFAULT 'open',
+		retry_count INTEGER DEFAULT 0,
+		next_action_at TIMESTAMP WITH TIME ZONE,
+		started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		resolved_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Credit notes
+	CREATE TABLE IF NOT EXISTS credit_notes (
+		id TEXT PRIMARY KEY,
+		number VARCHAR(50) NOT NULL UNIQUE,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		reason VARCHAR(50) NOT NULL,
+		method VARCHAR(50) NOT NULL,
+		status VARCHAR(50) NOT NULL,
+		currency VARCHAR(3) NOT NULL,
+		total DECIMAL(10,2) NOT NULL,
+		line_items JSONB NOT NULL DEFAULT '[]',
+		memo TEXT,
+		issued_by VARCHAR(255),
+		issued_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Prepaid credit wallets
+	CREATE TABLE IF NOT EXISTS wallets (
+		tenant_id TEXT PRIMARY KEY REFERENCES tenants(id),
+		currency VARCHAR(3) NOT NULL DEFAULT 'AUD',
+		zero_balance_behavior VARCHAR(50) NOT NULL DEFAULT 'allow_overage',
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS credit_grants (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		type VARCHAR(50) NOT NULL,
+		amount DECIMAL(15,6) NOT NULL,
+		remaining DECIMAL(15,6) NOT NULL,
+		description TEXT,
+		payment_attempt_id TEXT,
+		expires_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS wallet_transactions (
+		id BIGSERIAL PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		type VARCHAR(50) NOT NULL,
+		amount DECIMAL(15,6) NOT NULL,
+		balance_after DECIMAL(15,6) NOT NULL,
+		grant_id TEXT,
+		event_type VARCHAR(100),
+		quantity DECIMAL(15,5),
+		description TEXT,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Covered usage whose wallet drawdown failed, awaiting replay
+	CREATE TABLE IF NOT EXISTS wallet_pending_drawdowns (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL,
+		event_type VARCHAR(100) NOT NULL,
+		events JSONB NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT,
+		created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		updated_at TIMESTAMP WITH TIME ZONE NOT NULL
+	);
+
+	-- Closed billing periods; open periods are not stored
+	CREATE TABLE IF NOT EXISTS billing_periods (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		period_start TIMESTAMP WITH TIME ZONE NOT NULL,
+		period_end TIMESTAMP WITH TIME ZONE NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		usage_totals JSONB NOT NULL DEFAULT '{}',
+		closed_by VARCHAR(255),
+		closed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		locked_at TIMESTAMP WITH TIME ZONE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(tenant_id, period_start)
+	);
+
+	-- Late usage for locked periods awaiting review
+	CREATE TABLE IF NOT EXISTS held_usage_events (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL,
+		period_id TEXT NOT NULL REFERENCES billing_periods(id),
+		event JSONB NOT NULL,
+		status VARCHAR(20) NOT NULL,
+		received_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		reviewed_by VARCHAR(255),
+		reviewed_at TIMESTAMP WITH TIME ZONE,
+		note TEXT
+	);
+
 	-- Create indexes
 	CREATE INDEX IF NOT EXISTS idx_subscriptions_tenant ON subscriptions(tenant_id);
 	CREATE INDEX IF NOT EXISTS idx_growth_packs_tenant ON growth_pack_assignments(tenant_id);
@@ -226,16 +390,228 @@ func (s *PostgresStorage) initSchema(ctx context.Context) error {
 	CREATE INDEX IF NOT EXISTS idx_camera_licenses_camera ON camera_licenses(camera_id);
 	CREATE INDEX IF NOT EXISTS idx_usage_events_tenant ON usage_events(tenant_id, event_time);
 	CREATE INDEX IF NOT EXISTS idx_usage_events_type ON usage_events(event_type, event_time);
+	CREATE INDEX IF NOT EXISTS idx_usage_events_metadata ON usage_events USING GIN (metadata jsonb_path_ops);
+	CREATE INDEX IF NOT EXISTS idx_usage_events_resource ON usage_events(tenant_id, resource_id, event_time);
 	CREATE INDEX IF NOT EXISTS idx_api_keys_tenant ON api_keys(tenant_id);
 	CREATE INDEX IF NOT EXISTS idx_edge_devices_tenant ON edge_devices(tenant_id);
+	CREATE INDEX IF NOT EXISTS idx_payment_attempts_tenant ON payment_attempts(tenant_id, created_at);
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_payment_attempts_charge ON payment_attempts(provider, provider_charge_id);
+	CREATE INDEX IF NOT EXISTS idx_dunning_cases_tenant ON dunning_cases(tenant_id, status);
+	CREATE INDEX IF NOT EXISTS idx_credit_notes_tenant ON credit_notes(tenant_id, issued_at);
+	CREATE INDEX IF NOT EXISTS idx_credit_notes_issued ON credit_notes(issued_at);
+	CREATE INDEX IF NOT EXISTS idx_credit_grants_tenant ON credit_grants(tenant_id) WHERE remaining > 0;
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_credit_grants_payment_attempt ON credit_grants(payment_attempt_id) WHERE payment_attempt_id IS NOT NULL;
+	CREATE INDEX IF NOT EXISTS idx_wallet_transactions_tenant ON wallet_transactions(tenant_id, id);
+	CREATE INDEX IF NOT EXISTS idx_dunning_cases_due ON dunning_cases(next_action_at) WHERE status = 'open';
+	CREATE INDEX IF NOT EXISTS idx_held_usage_events_status ON held_usage_events(status, received_at);
+
+	-- Billing cycle columns (added after initial release)
+	ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS billing_anchor_date TIMESTAMP WITH TIME ZONE;
+	ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS credit_balance DECIMAL(10,2) DEFAULT 0;
+	ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS period_paid_amount DECIMAL(10,2) DEFAULT 0;
+	ALTER TABLE subscriptions ADD COLUMN IF NOT EXISTS period_paid_start TIMESTAMP WITH TIME ZONE;
+
+	-- Edge device credentials (added with request signing)
+	ALTER TABLE edge_devices ADD COLUMN IF NOT EXISTS signing_secret TEXT;
+	ALTER TABLE edge_devices ADD COLUMN IF NOT EXISTS enrolled_at TIMESTAMP WITH TIME ZONE;
+
+	-- Limits from edge device enrollment tokens
+	ALTER TABLE edge_devices ADD COLUMN IF NOT EXISTS max_cameras INTEGER;
+	ALTER TABLE edge_devices ADD COLUMN IF NOT EXISTS tier_locked BOOLEAN DEFAULT false;
+
+	-- Device request signature nonces, shared so a replay fails on every
+	-- instance; rows are kept until their signatures could no longer be accepted
+	CREATE TABLE IF NOT EXISTS device_nonces (
+		device_id VARCHAR(255) NOT NULL,
+		nonce VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		PRIMARY KEY (device_id, nonce)
+	);
+
+	-- Single-use edge device enrollment tokens; only token hashes are stored
+	CREATE TABLE IF NOT EXISTS enrollment_tokens (
+		id TEXT PRIMARY KEY,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		token_prefix VARCHAR(16) NOT NULL,
+		token_hash VARCHAR(64) NOT NULL UNIQUE,
+		management_tier VARCHAR(50),
+		max_cameras INTEGER,
+		created_by VARCHAR(255) NOT NULL,
+		expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		used_at TIMESTAMP WITH TIME ZONE,
+		used_by_device VARCHAR(255),
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Client certificates issued to edge devices by the internal CA
+	CREATE TABLE IF NOT EXISTS device_certificates (
+		serial VARCHAR(64) PRIMARY KEY,
+		device_id VARCHAR(255) NOT NULL,
+		tenant_id TEXT NOT NULL REFERENCES tenants(id),
+		subject TEXT NOT NULL,
+		not_before TIMESTAMP WITH TIME ZONE NOT NULL,
+		not_after TIMESTAMP WITH TIME ZONE NOT NULL,
+		revoked_at TIMESTAMP WITH TIME ZONE,
+		revocation_reason VARCHAR(50),
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+	CREATE INDEX IF NOT EXISTS idx_device_certificates_device ON device_certificates(device_id);
+
+	-- Tenant reporting timezone
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS timezone VARCHAR(64) DEFAULT 'UTC';
+
+	-- Partner keys that may act for other tenants
+	ALTER TABLE tenants ADD COLUMN IF NOT EXISTS cross_tenant BOOLEAN DEFAULT false;
+
+	-- Named admin API users; only key hashes are stored
+	CREATE TABLE IF NOT EXISTS admin_principals (
+		id TEXT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		email VARCHAR(255),
+		roles TEXT[] NOT NULL DEFAULT '{}',
+		status VARCHAR(50) NOT NULL DEFAULT 'active',
+		key_prefix VARCHAR(16) NOT NULL,
+		key_hash VARCHAR(64) NOT NULL UNIQUE,
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+	);
+
+	-- Keyset pagination for admin lists
+	CREATE INDEX IF NOT EXISTS idx_tenants_list ON tenants(created_at, id);
+	CREATE INDEX IF NOT EXISTS idx_subscriptions_list ON subscriptions(created_at, id);
+	CREATE INDEX IF NOT EXISTS idx_camera_licenses_list ON camera_licenses(created_at, id);
+	CREATE INDEX IF NOT EXISTS idx_camera_licenses_validated ON camera_licenses(last_validated);
 	`
 
-	_, err := s.pool.Exec(ctx, schema)
+	migrating, err := s.detachUnpartitionedUsageEvents(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.pool.Exec(ctx, schema)
 	if err != nil {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
+	if migrating {
+		if err := s.migrateUnpartitionedUsageEvents(ctx); err != nil {
+			return err
+		}
+	}
+
+	// Cover the current and next month so new events don't pile up in the
+	// default partition before the retention worker first runs
+	month := usageMonth(time.Now())
+	if err := s.EnsureUsagePartitions(ctx, month, month.AddDate(0, 2, 0)); err != nil {
+		return err
+	}
+
 	log.Printf("[POSTGRES] Schema initialized successfully")
+	return s.backfillUsageRollups(ctx)
+}
+
+// detachUnpartitionedUsageEvents renames a usage_events table created before
+// partitioning out of the way so the schema can recreate it partitioned.
+// It reports whether there is a renamed table to migrate.
+func (s *PostgresStorage) detachUnpartitionedUsageEvents(ctx context.Context) (bool, error) {
+	var kind string
+	err := s.pool.QueryRow(ctx, `
+		SELECT COALESCE((SELECT relkind::text FROM pg_class WHERE oid = to_regclass('usage_events')), '')
+	`).Scan(&kind)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect usage_events: %w", err)
+	}
+
+	if kind == "r" {
+		log.Printf("[POSTGRES] Converting usage_events to a partitioned table...")
+		_, err = s.pool.Exec(ctx, `
+			ALTER TABLE usage_events RENAME TO usage_events_unpartitioned;
+			ALTER TABLE usage_events_unpartitioned DROP CONSTRAINT IF EXISTS usage_events_pkey;
+			DROP INDEX IF EXISTS idx_usage_events_tenant, idx_usage_events_type,
+				idx_usage_events_metadata, idx_usage_events_resource;
+		`)
+		if err != nil {
+			return false, fmt.Errorf("failed to rename unpartitioned usage_events: %w", err)
+		}
+	}
+
+	var exists bool
+	err = s.pool.QueryRow(ctx, `SELECT to_regclass('usage_events_unpartitioned') IS NOT NULL`).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect usage_events: %w", err)
+	}
+	return exists, nil
+}
+
+// migrateUnpartitionedUsageEvents copies events from the pre-partitioning
+// table into monthly partitions and drops the old table
+func (s *PostgresStorage) migrateUnpartitionedUsageEvents(ctx context.Context) error {
+	var first, last *time.Time
+	err := s.pool.QueryRow(ctx, `
+		SELECT MIN(event_time), MAX(event_time) FROM usage_events_unpartitioned
+	`).Scan(&first, &last)
+	if err != nil {
+		return fmt.Errorf("failed to scan unpartitioned usage_events: %w", err)
+	}
+	if first != nil {
+		if err := s.EnsureUsagePartitions(ctx, usageMonth(*first), usageMonth(*last).AddDate(0, 1, 0)); err != nil {
+			return err
+		}
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO usage_events (id, tenant_id, event_type, resource_id, quantity, unit, metadata, event_time, created_at)
+		SELECT id, tenant_id, event_type, resource_id, quantity, unit, metadata, event_time, created_at
+		FROM usage_events_unpartitioned
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to copy usage events into partitions: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		SELECT setval(pg_get_serial_sequence('usage_events', 'id'), COALESCE(MAX(id), 0) + 1, false) FROM usage_events;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to advance usage event ids: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `DROP TABLE usage_events_unpartitioned`); err != nil {
+		return fmt.Errorf("failed to drop unpartitioned usage_events: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit usage_events migration: %w", err)
+	}
+
+	log.Printf("[POSTGRES] Moved %d usage events into monthly partitions", tag.RowsAffected())
+	return nil
+}
+
+// backfillUsageRollups builds rollups for databases that have usage events
+// from before rollups existed
+func (s *PostgresStorage) backfillUsageRollups(ctx context.Context) error {
+	var hasEvents, hasRollups bool
+	err := s.pool.QueryRow(ctx, `
+		SELECT EXISTS (SELECT 1 FROM usage_events), EXISTS (SELECT 1 FROM usage_rollups)
+	`).Scan(&hasEvents, &hasRollups)
+	if err != nil {
+		return fmt.Errorf("failed to check usage rollups: %w", err)
+	}
+	if !hasEvents || hasRollups {
+		return nil
+	}
+
+	log.Printf("[POSTGRES] Backfilling usage rollups from existing events...")
+	n, err := s.RebuildUsageRollups(ctx, "", time.Time{}, time.Time{})
+	if err != nil {
+		return err
+	}
+	log.Printf("[POSTGRES] Backfilled %d usage rollups", n)
 	return nil
 }
 
@@ -246,14 +622,14 @@ func (s *PostgresStorage) initSchema(ctx context.Context) error {
 // GetTenant retrieves a tenant by ID
 func (s *PostgresStorage) GetTenant(ctx context.Context, tenantID string) (*models.Tenant, error) {
 	query := `
-		SELECT id, name, email, api_key, status, created_at, updated_at
+		SELECT id, name, email, api_key, status, COALESCE(timezone, 'UTC'), COALESCE(cross_tenant, false), created_at, updated_at
 		FROM tenants WHERE id = $1
 	`
 
 	var tenant models.Tenant
 	err := s.pool.QueryRow(ctx, query, tenantID).Scan(
 		&tenant.ID, &tenant.Name, &tenant.Email, &tenant.APIKey,
-		&tenant.Status, &tenant.CreatedAt, &tenant.UpdatedAt,
+		&tenant.Status, &tenant.Timezone, &tenant.CrossTenant, &tenant.CreatedAt, &tenant.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -269,14 +645,14 @@ func (s *PostgresStorage) GetTenant(ctx context.Context, tenantID string) (*mode
 // GetTenantByAPIKey retrieves a tenant by API key
 func (s *PostgresStorage) GetTenantByAPIKey(ctx context.Context, apiKey string) (*models.Tenant, error) {
 	query := `
-		SELECT id, name, email, api_key, status, created_at, updated_at
+		SELECT id, name, email, api_key, status, COALESCE(timezone, 'UTC'), COALESCE(cross_tenant, false), created_at, updated_at
 		FROM tenants WHERE api_key = $1
 	`
 
 	var tenant models.Tenant
 	err := s.pool.QueryRow(ctx, query, apiKey).Scan(
 		&tenant.ID, &tenant.Name, &tenant.Email, &tenant.APIKey,
-		&tenant.Status, &tenant.CreatedAt, &tenant.UpdatedAt,
+		&tenant.Status, &tenant.Timezone, &tenant.CrossTenant, &tenant.CreatedAt, &tenant.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -292,13 +668,13 @@ func (s *PostgresStorage) GetTenantByAPIKey(ctx context.Context, apiKey string)
 // CreateTenant creates a new tenant
 func (s *PostgresStorage) CreateTenant(ctx context.Context, tenant *models.Tenant) error {
 	query := `
-		INSERT INTO tenants (id, name, email, api_key, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		INSERT INTO tenants (id, name, email, api_key, status, timezone, cross_tenant, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 	`
 
 	_, err := s.pool.Exec(ctx, query,
 		tenant.ID, tenant.Name, tenant.Email, tenant.APIKey,
-		tenant.Status, tenant.CreatedAt, tenant.UpdatedAt,
+		tenant.Status, tenant.Timezone, tenant.CrossTenant, tenant.CreatedAt, tenant.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create tenant: %w", err)
@@ -310,12 +686,12 @@ func (s *PostgresStorage) CreateTenant(ctx context.Context, tenant *models.Tenan
 // UpdateTenant updates an existing tenant
 func (s *PostgresStorage) UpdateTenant(ctx context.Context, tenant *models.Tenant) error {
 	query := `
-		UPDATE tenants SET name = $2, email = $3, status = $4, updated_at = $5
+		UPDATE tenants SET name = $2, email = $3, status = $4, timezone = $5, updated_at = $6, cross_tenant = $7
 		WHERE id = $1
 	`
 
 	_, err := s.pool.Exec(ctx, query,
-		tenant.ID, tenant.Name, tenant.Email, tenant.Status, time.Now(),
+		tenant.ID, tenant.Name, tenant.Email, tenant.Status, tenant.Timezone, time.Now(), tenant.CrossTenant,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update tenant: %w", err)
@@ -324,6 +700,69 @@ func (s *PostgresStorage) UpdateTenant(ctx context.Context, tenant *models.Tenan
 	return nil
 }
 
+// listCursorArgs splits a list cursor into query arguments. A nil cursor
+// yields a nil time, which the list queries treat as the start of the list.
+func listCursorArgs(c *models.ListCursor) (*time.Time, string) {
+	if c == nil {
+		return nil, ""
+	}
+	createdAt := c.CreatedAt
+	return &createdAt, c.ID
+}
+
+// listLimit maps a non-positive page size to no limit
+func listLimit(limit int) interface{} {
+	if limit <= 0 {
+		return nil
+	}
+	return limit
+}
+
+// likePattern matches s anywhere in a string, with LIKE wildcards in s escaped
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// ListTenants returns a page of tenants in (created_at, id) order
+func (s *PostgresStorage) ListTenants(ctx context.Context, q models.TenantListQuery) ([]models.Tenant, error) {
+	query := `
+		SELECT t.id, t.name, t.email, t.api_key, t.status, COALESCE(t.timezone, 'UTC'), COALESCE(t.cross_tenant, false),
+			   t.created_at, t.updated_at
+		FROM tenants t
+		WHERE ($1::timestamptz IS NULL OR (t.created_at, t.id) > ($1, $2))
+		  AND ($3 = '' OR t.status = $3)
+		  AND ($4 = '' OR (SELECT plan FROM subscriptions WHERE tenant_id = t.id ORDER BY created_at DESC LIMIT 1) = $4)
+		  AND ($5::timestamptz IS NULL OR t.created_at >= $5)
+		  AND ($6::timestamptz IS NULL OR t.created_at < $6)
+		  AND ($7 = '' OR t.name ILIKE $8)
+		ORDER BY t.created_at, t.id
+		LIMIT $9
+	`
+
+	afterTime, afterID := listCursorArgs(q.After)
+	rows, err := s.pool.Query(ctx, query, afterTime, afterID, q.Status, q.Plan,
+		q.CreatedAfter, q.CreatedBefore, q.NameSearch, likePattern(q.NameSearch), listLimit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tenants: %w", err)
+	}
+	defer rows.Close()
+
+	var tenants []models.Tenant
+	for rows.Next() {
+		var tenant models.Tenant
+		err := rows.Scan(
+			&tenant.ID, &tenant.Name, &tenant.Email, &tenant.APIKey,
+			&tenant.Status, &tenant.Timezone, &tenant.CrossTenant, &tenant.CreatedAt, &tenant.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan tenant: %w", err)
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	return tenants, nil
+}
+
 // =====================================
 // Subscription Operations
 // =====================================
@@ -333,7 +772,8 @@ func (s *PostgresStorage) GetSubscription(ctx context.Context, tenantID string)
 	query := `
 		SELECT id, tenant_id, plan, status, cameras_licensed,
 			   trial_start_date, trial_end_date, subscription_start_date, subscription_end_date,
-			   billing_cycle, created_at, updated_at
+			   billing_cycle, billing_anchor_date, COALESCE(credit_balance, 0), COALESCE(period_paid_amount, 0), period_paid_start,
+			   created_at, updated_at
 		FROM subscriptions WHERE tenant_id = $1 ORDER BY created_at DESC LIMIT 1
 	`
 
@@ -341,7 +781,7 @@ func (s *PostgresStorage) GetSubscription(ctx context.Context, tenantID string)
 	err := s.pool.QueryRow(ctx, query, tenantID).Scan(
 		&sub.ID, &sub.TenantID, &sub.Plan, &sub.Status, &sub.CamerasLicensed,
 		&sub.TrialStartDate, &sub.TrialEndDate, &sub.SubscriptionStartDate, &sub.SubscriptionEndDate,
-		&sub.BillingCycle, &sub.CreatedAt, &sub.UpdatedAt,
+		&sub.BillingCycle, &sub.BillingAnchorDate, &sub.CreditBalance, &sub.PeriodPaidAmount, &sub.PeriodPaidStart, &sub.CreatedAt, &sub.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -359,14 +799,14 @@ func (s *PostgresStorage) CreateSubscription(ctx context.Context, sub *models.Su
 	query := `
 		INSERT INTO subscriptions (id, tenant_id, plan, status, cameras_licensed,
 			trial_start_date, trial_end_date, subscription_start_date, subscription_end_date,
-			billing_cycle, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+			billing_cycle, billing_anchor_date, credit_balance, period_paid_amount, period_paid_start, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
 	`
 
 	_, err := s.pool.Exec(ctx, query,
 		sub.ID, sub.TenantID, sub.Plan, sub.Status, sub.CamerasLicensed,
 		sub.TrialStartDate, sub.TrialEndDate, sub.SubscriptionStartDate, sub.SubscriptionEndDate,
-		sub.BillingCycle, sub.CreatedAt, sub.UpdatedAt,
+		sub.BillingCycle, sub.BillingAnchorDate, sub.CreditBalance, sub.PeriodPaidAmount, sub.PeriodPaidStart, sub.CreatedAt, sub.UpdatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create subscription: %w", err)
@@ -379,13 +819,15 @@ func (s *PostgresStorage) CreateSubscription(ctx context.Context, sub *models.Su
 func (s *PostgresStorage) UpdateSubscription(ctx context.Context, sub *models.Subscription) error {
 	query := `
 		UPDATE subscriptions SET plan = $2, status = $3, cameras_licensed = $4,
-			trial_end_date = $5, subscription_end_date = $6, billing_cycle = $7, updated_at = $8
+			trial_end_date = $5, subscription_end_date = $6, billing_cycle = $7, updated_at = $8,
+			billing_anchor_date = $9, credit_balance = $10, period_paid_amount = $11, period_paid_start = $12
 		WHERE id = $1
 	`
 
 	_, err := s.pool.Exec(ctx, query,
 		sub.ID, sub.Plan, sub.Status, sub.CamerasLicensed,
 		sub.TrialEndDate, sub.SubscriptionEndDate, sub.BillingCycle, time.Now(),
+		sub.BillingAnchorDate, sub.CreditBalance, sub.PeriodPaidAmount, sub.PeriodPaidStart,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to update subscription: %w", err)
@@ -394,6 +836,51 @@ func (s *PostgresStorage) UpdateSubscription(ctx context.Context, sub *models.Su
 	return nil
 }
 
+// ListSubscriptions returns a page of tenants' current subscriptions in
+// (created_at, id) order
+func (s *PostgresStorage) ListSubscriptions(ctx context.Context, q models.SubscriptionListQuery) ([]models.Subscription, error) {
+	query := `
+		SELECT id, tenant_id, plan, status, cameras_licensed,
+			   trial_start_date, trial_end_date, subscription_start_date, subscription_end_date,
+			   billing_cycle, billing_anchor_date, COALESCE(credit_balance, 0), COALESCE(period_paid_amount, 0), period_paid_start,
+			   created_at, updated_at
+		FROM subscriptions s
+		WHERE NOT EXISTS (
+				SELECT 1 FROM subscriptions newer
+				WHERE newer.tenant_id = s.tenant_id AND (newer.created_at, newer.id) > (s.created_at, s.id))
+		  AND ($1::timestamptz IS NULL OR (created_at, id) > ($1, $2))
+		  AND ($3 = '' OR plan = $3)
+		  AND ($4 = '' OR status = $4)
+		  AND ($5::timestamptz IS NULL OR
+			   CASE WHEN plan = 'trial' THEN trial_end_date ELSE subscription_end_date END < $5)
+		ORDER BY created_at, id
+		LIMIT $6
+	`
+
+	afterTime, afterID := listCursorArgs(q.After)
+	rows, err := s.pool.Query(ctx, query, afterTime, afterID, q.Plan, q.Status, q.ExpiringBefore, listLimit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.Subscription
+	for rows.Next() {
+		var sub models.Subscription
+		err := rows.Scan(
+			&sub.ID, &sub.TenantID, &sub.Plan, &sub.Status, &sub.CamerasLicensed,
+			&sub.TrialStartDate, &sub.TrialEndDate, &sub.SubscriptionStartDate, &sub.SubscriptionEndDate,
+			&sub.BillingCycle, &sub.BillingAnchorDate, &sub.CreditBalance, &sub.PeriodPaidAmount, &sub.PeriodPaidStart, &sub.CreatedAt, &sub.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	return subs, nil
+}
+
 // =====================================
 // Growth Pack Operations
 // =====================================
@@ -557,6 +1044,47 @@ func (s *PostgresStorage) CountCamerasByTenant(ctx context.Context, tenantID str
 	return count, nil
 }
 
+// ListCameraLicenses returns a page of camera licenses in (created_at, id) order
+func (s *PostgresStorage) ListCameraLicenses(ctx context.Context, q models.CameraLicenseListQuery) ([]models.CameraLicense, error) {
+	query := `
+		SELECT id, camera_id, tenant_id, device_id, license_mode, is_valid, valid_until,
+			   enabled_growth_packs, last_validated, created_at, updated_at
+		FROM camera_licenses
+		WHERE ($1::timestamptz IS NULL OR (created_at, id) > ($1, $2))
+		  AND ($3 = '' OR tenant_id = $3)
+		  AND ($4 = '' OR license_mode = $4)
+		  AND ($5::boolean IS NULL OR is_valid = $5)
+		  AND ($6::timestamptz IS NULL OR last_validated >= $6)
+		  AND ($7::timestamptz IS NULL OR last_validated < $7)
+		ORDER BY created_at, id
+		LIMIT $8
+	`
+
+	afterTime, afterID := listCursorArgs(q.After)
+	rows, err := s.pool.Query(ctx, query, afterTime, afterID, q.TenantID, q.Mode, q.IsValid,
+		q.LastValidatedAfter, q.LastValidatedBefore, listLimit(q.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list camera licenses: %w", err)
+	}
+	defer rows.Close()
+
+	var cameras []models.CameraLicense
+	for rows.Next() {
+		var license models.CameraLicense
+		err := rows.Scan(
+			&license.ID, &license.CameraID, &license.TenantID, &license.DeviceID,
+			&license.LicenseMode, &license.IsValid, &license.ValidUntil,
+			&license.EnabledGrowthPacks, &license.LastValidated, &license.CreatedAt, &license.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan camera: %w", err)
+		}
+		cameras = append(cameras, license)
+	}
+
+	return cameras, nil
+}
+
 // =====================================
 // Entitlement Operations
 // =====================================
@@ -617,6 +1145,26 @@ func (s *PostgresStorage) SaveUsageEvents(ctx context.Context, events []models.U
 		return nil
 	}
 
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := saveUsageEventsTx(ctx, tx, events); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit usage events: %w", err)
+	}
+
+	return nil
+}
+
+// saveUsageEventsTx inserts usage events and folds them into their rollups
+// within tx
+func saveUsageEventsTx(ctx context.Context, tx pgx.Tx, events []models.UsageEvent) error {
 	batch := &pgx.Batch{}
 	query := `
 		INSERT INTO usage_events (tenant_id, event_type, resource_id, quantity, unit, metadata, event_time, created_at)
@@ -628,84 +1176,690 @@ func (s *PostgresStorage) SaveUsageEvents(ctx context.Context, events []models.U
 			event.Quantity, event.Unit, event.Metadata, event.EventTime, time.Now())
 	}
 
-	br := s.pool.SendBatch(ctx, batch)
-	defer br.Close()
+	// Fold the batch into its rollups; sorted so concurrent batches lock rows in the same order
+	rollups := rollupsFromEvents(events)
+	sort.Slice(rollups, func(i, j int) bool {
+		a, b := rollups[i], rollups[j]
+		if a.Granularity != b.Granularity {
+			return a.Granularity < b.Granularity
+		}
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		if !a.BucketStart.Equal(b.BucketStart) {
+			return a.BucketStart.Before(b.BucketStart)
+		}
+		if a.EventType != b.EventType {
+			return a.EventType < b.EventType
+		}
+		return a.ResourceID < b.ResourceID
+	})
+
+	upsert := `
+		INSERT INTO usage_rollups (granularity, tenant_id, event_type, resource_id, bucket_start, quantity, event_count)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (granularity, tenant_id, bucket_start, event_type, resource_id) DO UPDATE SET
+			quantity = usage_rollups.quantity + EXCLUDED.quantity,
+			event_count = usage_rollups.event_count + EXCLUDED.event_count
+	`
+	for _, r := range rollups {
+		batch.Queue(upsert, r.Granularity, r.TenantID, r.EventType, r.ResourceID, r.BucketStart, r.Quantity, r.EventCount)
+	}
+
+	br := tx.SendBatch(ctx, batch)
 
 	for i := 0; i < len(events); i++ {
 		_, err := br.Exec()
 		if err != nil {
+			br.Close()
 			return fmt.Errorf("failed to save usage event %d: %w", i, err)
 		}
 	}
+	for range rollups {
+		if _, err := br.Exec(); err != nil {
+			br.Close()
+			return fmt.Errorf("failed to update usage rollups: %w", err)
+		}
+	}
+
+	if err := br.Close(); err != nil {
+		return fmt.Errorf("failed to save usage events: %w", err)
+	}
 
 	return nil
 }
 
-// GetUsageSummary gets usage summary for a tenant within a time range
-func (s *PostgresStorage) GetUsageSummary(ctx context.Context, tenantID string, start, end time.Time) (map[string]float64, error) {
+// usageUnionQuery selects event_type, resource_id, quantity and row_time for a
+// tenant ($1) over an inclusive range split by splitUsageRange: raw events for
+// the partial hours ($2-$3, $4-$5), hourly rollups ($3-$6, $7-$4) and daily
+// rollups ($6-$7)
+const usageUnionQuery = `
+	SELECT event_type, COALESCE(resource_id, '') AS resource_id, quantity, event_time AS row_time
+	FROM usage_events
+	WHERE tenant_id = $1 AND ((event_time >= $2 AND event_time < $3) OR (event_time >= $4 AND event_time <= $5))
+	UNION ALL
+	SELECT event_type, resource_id, quantity, bucket_start AS row_time
+	FROM usage_rollups
+	WHERE granularity = 'hour' AND tenant_id = $1
+	  AND ((bucket_start >= $3 AND bucket_start < $6) OR (bucket_start >= $7 AND bucket_start < $4))
+	UNION ALL
+	SELECT event_type, resource_id, quantity, bucket_start AS row_time
+	FROM usage_rollups
+	WHERE granularity = 'day' AND tenant_id = $1 AND bucket_start >= $6 AND bucket_start < $7
+`
+
+// usageUnionArgs returns the arguments for usageUnionQuery
+func usageUnionArgs(tenantID string, start, end time.Time, loc *time.Location) []interface{} {
+	r := splitUsageRange(start, end, loc)
+	return []interface{}{tenantID, r.start, r.hourStart, r.hourEnd, r.end, r.dayStart, r.dayEnd}
+}
+
+// GetUsageTimeSeries buckets a tenant's usage by hour, day or month in the
+// given timezone. An empty eventType includes all event types.
+func (s *PostgresStorage) GetUsageTimeSeries(ctx context.Context, tenantID, eventType string, start, end time.Time, granularity string, loc *time.Location) ([]models.UsageBucket, error) {
 	query := `
-		SELECT event_type, SUM(quantity) as total
-		FROM usage_events
-		WHERE tenant_id = $1 AND event_time >= $2 AND event_time <= $3
-		GROUP BY event_type
+		SELECT event_type, date_trunc($8, row_time AT TIME ZONE $9) AT TIME ZONE $9 AS bucket, SUM(quantity)
+		FROM (` + usageUnionQuery + `) u
+		WHERE $10 = '' OR event_type = $10
+		GROUP BY 1, 2
+		ORDER BY 2
 	`
 
-	rows, err := s.pool.Query(ctx, query, tenantID, start, end)
+	args := append(usageUnionArgs(tenantID, start, end, loc), granularity, loc.String(), eventType)
+	rows, err := s.pool.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+		return nil, fmt.Errorf("failed to get usage time series: %w", err)
 	}
 	defer rows.Close()
 
-	summary := make(map[string]float64)
+	var buckets []models.UsageBucket
 	for rows.Next() {
-		var eventType string
-		var total float64
-		if err := rows.Scan(&eventType, &total); err != nil {
-			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		var b models.UsageBucket
+		if err := rows.Scan(&b.EventType, &b.BucketStart, &b.Quantity); err != nil {
+			return nil, fmt.Errorf("failed to scan usage bucket: %w", err)
 		}
-		summary[eventType] = total
+		b.BucketStart = b.BucketStart.In(loc)
+		buckets = append(buckets, b)
 	}
 
-	return summary, nil
+	return buckets, nil
 }
 
-// =====================================
-// Edge Device Operations
-// =====================================
-
-// SaveEdgeDevice creates or updates an edge device
-func (s *PostgresStorage) SaveEdgeDevice(ctx context.Context, device *models.EdgeDevice) error {
-	query := `
-		INSERT INTO edge_devices (id, device_id, tenant_id, name, status, management_tier, last_heartbeat, active_camera_count, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		ON CONFLICT (device_id) DO UPDATE SET
-			status = EXCLUDED.status, last_heartbeat = EXCLUDED.last_heartbeat,
-			active_camera_count = EXCLUDED.active_camera_count, updated_at = EXCLUDED.updated_at
-	`
+// GetUsageBreakdown groups a tenant's usage by resource and metadata
+// dimensions. Queries that only involve event type and resource are served
+// from the rollups; metadata filters use the GIN index via containment.
+func (s *PostgresStorage) GetUsageBreakdown(ctx context.Context, q models.UsageBreakdownQuery) ([]models.UsageBreakdownRow, error) {
+	var args []interface{}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
 
-	now := time.Now()
-	_, err := s.pool.Exec(ctx, query,
-		device.ID, device.DeviceID, device.TenantID, device.Name, device.Status,
-		device.ManagementTier, device.LastHeartbeat, device.ActiveCameraCount, now, now,
-	)
-	if err != nil {
-		return fmt.Errorf("failed to save edge device: %w", err)
+	var from string
+	if q.UsesMetadata() {
+		from = fmt.Sprintf(`(
+			SELECT event_type, COALESCE(resource_id, '') AS resource_id, quantity, metadata
+			FROM usage_events
+			WHERE tenant_id = %s AND event_time >= %s AND event_time <= %s
+		) u`, arg(q.TenantID), arg(q.Start), arg(q.End))
+	} else {
+		args = usageUnionArgs(q.TenantID, q.Start, q.End, time.UTC)
+		from = "(" + usageUnionQuery + ") u"
 	}
 
-	return nil
-}
+	where := []string{"TRUE"}
+	if q.EventType != "" {
+		where = append(where, "event_type = "+arg(q.EventType))
+	}
+	if q.ResourceID != "" {
+		where = append(where, "resource_id = "+arg(q.ResourceID))
+	}
+	if len(q.MetadataFilters) > 0 {
+		filter, _ := json.Marshal(q.MetadataFilters)
+		where = append(where, "metadata @> "+arg(string(filter))+"::jsonb")
+	}
+
+	selects := make([]string, len(q.GroupBy))
+	for i, dim := range q.GroupBy {
+		switch {
+		case dim == models.DimensionEventType:
+			selects[i] = "event_type"
+		case dim == models.DimensionResourceID:
+			selects[i] = "resource_id"
+		case strings.HasPrefix(dim, models.DimensionMetadataPrefix):
+			selects[i] = "COALESCE(metadata->>" + arg(strings.TrimPrefix(dim, models.DimensionMetadataPrefix)) + "::text, '')"
+		default:
+			return nil, fmt.Errorf("unknown breakdown dimension %q", dim)
+		}
+	}
+
+	query := "SELECT "
+	for _, sel := range selects {
+		query += sel + ", "
+	}
+	query += "SUM(quantity) AS total FROM " + from + " WHERE " + strings.Join(where, " AND ")
+	if len(selects) > 0 {
+		groups := make([]string, len(selects))
+		for i := range selects {
+			groups[i] = fmt.Sprintf("%d", i+1)
+		}
+		query += " GROUP BY " + strings.Join(groups, ", ")
+	}
+	query += " ORDER BY total DESC"
+	if q.Limit > 0 {
+		query += " LIMIT " + arg(q.Limit)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage breakdown: %w", err)
+	}
+	defer rows.Close()
+
+	result := []models.UsageBreakdownRow{}
+	for rows.Next() {
+		values := make([]string, len(q.GroupBy))
+		var total *float64
+		dest := make([]interface{}, 0, len(values)+1)
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &total)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan usage breakdown: %w", err)
+		}
+		if total == nil {
+			continue // no matching usage
+		}
+
+		row := models.UsageBreakdownRow{Dimensions: make(map[string]string, len(q.GroupBy)), Quantity: *total}
+		for i, dim := range q.GroupBy {
+			row.Dimensions[dim] = values[i]
+		}
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+// ExportUsageEvents streams matching usage events in event time order
+// through a server-side cursor, fetching a page at a time so memory stays
+// constant however large the export is
+func (s *PostgresStorage) ExportUsageEvents(ctx context.Context, q models.UsageExportQuery, fn func(e models.UsageEvent) error) error {
+	const pageSize = 1000
+
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DECLARE usage_export NO SCROLL CURSOR FOR
+		SELECT tenant_id, event_type, COALESCE(resource_id, ''), quantity, unit, COALESCE(metadata, '{}'), event_time
+		FROM usage_events
+		WHERE ($1 = '' OR tenant_id = $1) AND ($2 = '' OR event_type = $2)
+		  AND event_time >= $3 AND event_time < $4
+		ORDER BY event_time, id
+	`, q.TenantID, q.EventType, q.Start, q.End)
+	if err != nil {
+		return fmt.Errorf("failed to open usage export cursor: %w", err)
+	}
+
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM usage_export", pageSize))
+		if err != nil {
+			return fmt.Errorf("failed to fetch usage events: %w", err)
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var e models.UsageEvent
+			if err := rows.Scan(&e.TenantID, &e.EventType, &e.ResourceID, &e.Quantity, &e.Unit, &e.Metadata, &e.EventTime); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan usage event: %w", err)
+			}
+			fetched++
+			if err := fn(e); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to fetch usage events: %w", err)
+		}
+
+		if fetched < pageSize {
+			return nil
+		}
+	}
+}
+
+// RebuildUsageRollups recomputes the hourly and daily rollups from raw
+// events. An empty tenantID rebuilds every tenant; zero times are unbounded.
+// The range is widened to whole UTC days. Archived months have no raw events
+// left, so callers must keep the range clear of them (see
+// retention.Manager.RebuildRollups).
+func (s *PostgresStorage) RebuildUsageRollups(ctx context.Context, tenantID string, start, end time.Time) (int, error) {
+	var startArg, endArg *time.Time
+	if !start.IsZero() {
+		t := start.UTC().Truncate(day)
+		startArg = &t
+	}
+	if !end.IsZero() {
+		t := ceilTime(end, day)
+		endArg = &t
+	}
+	var tenantArg *string
+	if tenantID != "" {
+		tenantArg = &tenantID
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM usage_rollups
+		WHERE ($1::text IS NULL OR tenant_id = $1)
+		  AND ($2::timestamptz IS NULL OR bucket_start >= $2)
+		  AND ($3::timestamptz IS NULL OR bucket_start < $3)
+	`, tenantArg, startArg, endArg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to clear usage rollups: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO usage_rollups (granularity, tenant_id, event_type, resource_id, bucket_start, quantity, event_count)
+		SELECT g.granularity, e.tenant_id, e.event_type, COALESCE(e.resource_id, ''),
+			   date_trunc(g.granularity, e.event_time AT TIME ZONE 'UTC') AT TIME ZONE 'UTC',
+			   SUM(e.quantity), COUNT(*)
+		FROM usage_events e CROSS JOIN (VALUES ('hour'), ('day')) AS g(granularity)
+		WHERE ($1::text IS NULL OR e.tenant_id = $1)
+		  AND ($2::timestamptz IS NULL OR e.event_time >= $2)
+		  AND ($3::timestamptz IS NULL OR e.event_time < $3)
+		GROUP BY 1, 2, 3, 4, 5
+	`, tenantArg, startArg, endArg)
+	if err != nil {
+		return 0, fmt.Errorf("failed to rebuild usage rollups: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit usage rollups: %w", err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// GetUsageSummary gets usage summary for a tenant within a time range,
+// served from rollups except for partial hours at either end
+func (s *PostgresStorage) GetUsageSummary(ctx context.Context, tenantID string, start, end time.Time) (map[string]float64, error) {
+	query := `
+		SELECT event_type, SUM(quantity) as total
+		FROM (` + usageUnionQuery + `) u
+		GROUP BY event_type
+	`
+
+	rows, err := s.pool.Query(ctx, query, usageUnionArgs(tenantID, start, end, time.UTC)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage summary: %w", err)
+	}
+	defer rows.Close()
+
+	summary := make(map[string]float64)
+	for rows.Next() {
+		var eventType string
+		var total float64
+		if err := rows.Scan(&eventType, &total); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		summary[eventType] = total
+	}
+
+	return summary, nil
+}
+
+// =====================================
+// Usage Retention Operations
+// =====================================
+
+// lockUsagePartitions serializes partition maintenance across server instances
+func lockUsagePartitions(ctx context.Context, tx pgx.Tx) error {
+	_, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext('usage_events_partitions'))`)
+	if err != nil {
+		return fmt.Errorf("failed to lock usage partitions: %w", err)
+	}
+	return nil
+}
+
+// EnsureUsagePartitions creates the monthly usage_events partitions covering
+// [from, to). Events already sitting in the default partition for a new
+// month are moved into it.
+func (s *PostgresStorage) EnsureUsagePartitions(ctx context.Context, from, to time.Time) error {
+	for month := usageMonth(from); month.Before(to); month = month.AddDate(0, 1, 0) {
+		if err := s.ensureUsagePartition(ctx, month); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureUsagePartition creates and attaches a single monthly partition
+func (s *PostgresStorage) ensureUsagePartition(ctx context.Context, month time.Time) error {
+	name := usagePartitionName(month)
+	end := month.AddDate(0, 1, 0)
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUsagePartitions(ctx, tx); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check usage partition %s: %w", name, err)
+	}
+	if exists {
+		return nil
+	}
+
+	// Attaching fails if the default partition holds rows for the new range,
+	// so build the partition standalone, move those rows in, then attach it
+	_, err = tx.Exec(ctx, fmt.Sprintf(`CREATE TABLE %s (LIKE usage_events INCLUDING DEFAULTS)`, name))
+	if err != nil {
+		return fmt.Errorf("failed to create usage partition %s: %w", name, err)
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf(`
+		WITH moved AS (
+			DELETE FROM usage_events_default WHERE event_time >= $1 AND event_time < $2 RETURNING *
+		)
+		INSERT INTO %s SELECT * FROM moved
+	`, name), month, end)
+	if err != nil {
+		return fmt.Errorf("failed to fill usage partition %s: %w", name, err)
+	}
+	_, err = tx.Exec(ctx, fmt.Sprintf(`ALTER TABLE usage_events ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`,
+		name, month.Format(time.RFC3339), end.Format(time.RFC3339)))
+	if err != nil {
+		return fmt.Errorf("failed to attach usage partition %s: %w", name, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit usage partition %s: %w", name, err)
+	}
+
+	log.Printf("[POSTGRES] Created usage partition %s", name)
+	return nil
+}
+
+// GetArchivableUsageMonths lists the UTC months ending on or before cutoff
+// that still have a partition or events in the default partition
+func (s *PostgresStorage) GetArchivableUsageMonths(ctx context.Context, cutoff time.Time) ([]time.Time, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT c.relname FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'usage_events'::regclass
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list usage partitions: %w", err)
+	}
+
+	seen := make(map[time.Time]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan usage partition: %w", err)
+		}
+		if month, ok := parseUsagePartitionName(name); ok {
+			seen[month] = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list usage partitions: %w", err)
+	}
+
+	// Late events for months that no longer have a partition
+	rows, err = s.pool.Query(ctx, `
+		SELECT DISTINCT date_trunc('month', event_time AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+		FROM usage_events_default WHERE event_time < $1
+	`, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list default partition months: %w", err)
+	}
+	for rows.Next() {
+		var month time.Time
+		if err := rows.Scan(&month); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan default partition month: %w", err)
+		}
+		seen[month.UTC()] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list default partition months: %w", err)
+	}
+
+	var months []time.Time
+	for month := range seen {
+		if !month.AddDate(0, 1, 0).After(cutoff) {
+			months = append(months, month)
+		}
+	}
+	sort.Slice(months, func(i, j int) bool { return months[i].Before(months[j]) })
+	return months, nil
+}
+
+// ArchiveUsageMonth streams a month's usage events to write in event time
+// order, calls seal once they have all been written, and then drops them.
+// Rollups are kept so summaries for the month stay available. Inserts into
+// the month's partition wait until the archive commits.
+func (s *PostgresStorage) ArchiveUsageMonth(ctx context.Context, month time.Time, write func(e models.UsageEvent) error, seal func() error) (int, error) {
+	const pageSize = 1000
+	month = usageMonth(month)
+	end := month.AddDate(0, 1, 0)
+	name := usagePartitionName(month)
+
+	// Repeatable read so the delete below only removes events the cursor saw
+	tx, err := s.pool.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead})
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockUsagePartitions(ctx, tx); err != nil {
+		return 0, err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, name).Scan(&exists); err != nil {
+		return 0, fmt.Errorf("failed to check usage partition %s: %w", name, err)
+	}
+	if exists {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`LOCK TABLE %s IN SHARE MODE`, name)); err != nil {
+			return 0, fmt.Errorf("failed to lock usage partition %s: %w", name, err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		DECLARE usage_archive NO SCROLL CURSOR FOR
+		SELECT tenant_id, event_type, COALESCE(resource_id, ''), quantity, unit, COALESCE(metadata, '{}'), event_time
+		FROM usage_events
+		WHERE event_time >= $1 AND event_time < $2
+		ORDER BY event_time, id
+	`, month, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open usage archive cursor: %w", err)
+	}
+
+	archived := 0
+	for {
+		rows, err := tx.Query(ctx, fmt.Sprintf("FETCH FORWARD %d FROM usage_archive", pageSize))
+		if err != nil {
+			return 0, fmt.Errorf("failed to fetch usage events: %w", err)
+		}
+
+		fetched := 0
+		for rows.Next() {
+			var e models.UsageEvent
+			if err := rows.Scan(&e.TenantID, &e.EventType, &e.ResourceID, &e.Quantity, &e.Unit, &e.Metadata, &e.EventTime); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to scan usage event: %w", err)
+			}
+			fetched++
+			if err := write(e); err != nil {
+				rows.Close()
+				return 0, err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, fmt.Errorf("failed to fetch usage events: %w", err)
+		}
+
+		archived += fetched
+		if fetched < pageSize {
+			break
+		}
+	}
+
+	if err := seal(); err != nil {
+		return 0, err
+	}
+
+	if exists {
+		if _, err := tx.Exec(ctx, fmt.Sprintf(`DROP TABLE %s`, name)); err != nil {
+			return 0, fmt.Errorf("failed to drop usage partition %s: %w", name, err)
+		}
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM usage_events_default WHERE event_time >= $1 AND event_time < $2
+	`, month, end)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete archived usage events: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit usage archive: %w", err)
+	}
+
+	return archived, nil
+}
+
+// usageImportSource adapts an event reader to pgx's CopyFromSource
+type usageImportSource struct {
+	read  func() (*models.UsageEvent, error)
+	event *models.UsageEvent
+	err   error
+	now   time.Time
+}
+
+func (src *usageImportSource) Next() bool {
+	src.event, src.err = src.read()
+	return src.err == nil && src.event != nil
+}
+
+func (src *usageImportSource) Values() ([]interface{}, error) {
+	e := src.event
+	return []interface{}{e.TenantID, e.EventType, e.ResourceID, e.Quantity, e.Unit,
+		normalizeMetadata(e.Metadata), e.EventTime, src.now}, nil
+}
+
+func (src *usageImportSource) Err() error {
+	return src.err
+}
+
+// ImportUsageEvents bulk loads raw usage events, e.g. from an archive, until
+// read returns nil. Rollups are left alone since archived events are still
+// counted in them. The import is all or nothing.
+func (s *PostgresStorage) ImportUsageEvents(ctx context.Context, read func() (*models.UsageEvent, error)) (int, error) {
+	columns := []string{"tenant_id", "event_type", "resource_id", "quantity", "unit", "metadata", "event_time", "created_at"}
+	src := &usageImportSource{read: read, now: time.Now()}
+
+	n, err := s.pool.CopyFrom(ctx, pgx.Identifier{"usage_events"}, columns, src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import usage events: %w", err)
+	}
+	return int(n), nil
+}
+
+// =====================================
+// Edge Device Operations
+// =====================================
+
+// SaveEdgeDevice creates or updates an edge device
+func (s *PostgresStorage) SaveEdgeDevice(ctx context.Context, device *models.EdgeDevice) error {
+	query := `
+		INSERT INTO edge_devices (id, device_id, tenant_id, name, status, management_tier, last_heartbeat, active_camera_count,
+			signing_secret, enrolled_at, max_cameras, tier_locked, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, $14)
+		ON CONFLICT (device_id) DO UPDATE SET
+			name = EXCLUDED.name, status = EXCLUDED.status, management_tier = EXCLUDED.management_tier,
+			last_heartbeat = EXCLUDED.last_heartbeat, active_camera_count = EXCLUDED.active_camera_count,
+			signing_secret = EXCLUDED.signing_secret, enrolled_at = EXCLUDED.enrolled_at,
+			max_cameras = EXCLUDED.max_cameras, tier_locked = EXCLUDED.tier_locked, updated_at = EXCLUDED.updated_at
+	`
+
+	now := time.Now()
+	_, err := s.pool.Exec(ctx, query,
+		device.ID, device.DeviceID, device.TenantID, device.Name, device.Status,
+		device.ManagementTier, device.LastHeartbeat, device.ActiveCameraCount,
+		device.SigningSecret, device.EnrolledAt, device.MaxCameras, device.TierLocked, now, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save edge device: %w", err)
+	}
+
+	return nil
+}
+
+// RecordDeviceHeartbeat records a heartbeat, registering unknown devices. It
+// writes only the heartbeat columns, leaving enrollment credentials and
+// limits alone; suspended devices stay suspended and locked tiers locked.
+func (s *PostgresStorage) RecordDeviceHeartbeat(ctx context.Context, device *models.EdgeDevice) error {
+	query := `
+		INSERT INTO edge_devices (id, device_id, tenant_id, status, management_tier, last_heartbeat, active_camera_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $8)
+		ON CONFLICT (device_id) DO UPDATE SET
+			status = CASE WHEN edge_devices.status = $9 THEN edge_devices.status ELSE EXCLUDED.status END,
+			management_tier = CASE WHEN COALESCE(edge_devices.tier_locked, false) OR EXCLUDED.management_tier = ''
+				THEN edge_devices.management_tier ELSE EXCLUDED.management_tier END,
+			last_heartbeat = EXCLUDED.last_heartbeat, active_camera_count = EXCLUDED.active_camera_count,
+			updated_at = EXCLUDED.updated_at
+		WHERE edge_devices.tenant_id = EXCLUDED.tenant_id
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		device.ID, device.DeviceID, device.TenantID, device.Status, device.ManagementTier,
+		device.LastHeartbeat, device.ActiveCameraCount, device.UpdatedAt, models.DeviceStatusSuspended,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record device heartbeat: %w", err)
+	}
+
+	return nil
+}
 
 // GetEdgeDevice retrieves an edge device by device ID
 func (s *PostgresStorage) GetEdgeDevice(ctx context.Context, deviceID string) (*models.EdgeDevice, error) {
 	query := `
-		SELECT id, device_id, tenant_id, name, status, management_tier, last_heartbeat, active_camera_count, created_at, updated_at
+		SELECT id, device_id, tenant_id, name, status, management_tier, last_heartbeat, active_camera_count,
+			COALESCE(signing_secret, ''), enrolled_at, max_cameras, COALESCE(tier_locked, false), created_at, updated_at
 		FROM edge_devices WHERE device_id = $1
 	`
 
 	var device models.EdgeDevice
 	err := s.pool.QueryRow(ctx, query, deviceID).Scan(
 		&device.ID, &device.DeviceID, &device.TenantID, &device.Name, &device.Status,
-		&device.ManagementTier, &device.LastHeartbeat, &device.ActiveCameraCount, &device.CreatedAt, &device.UpdatedAt,
+		&device.ManagementTier, &device.LastHeartbeat, &device.ActiveCameraCount,
+		&device.SigningSecret, &device.EnrolledAt, &device.MaxCameras, &device.TierLocked, &device.CreatedAt, &device.UpdatedAt,
 	)
 
 	if err == pgx.ErrNoRows {
@@ -718,6 +1872,1274 @@ func (s *PostgresStorage) GetEdgeDevice(ctx context.Context, deviceID string) (*
 	return &device, nil
 }
 
+// RecordDeviceNonce records a device's signature nonce until expiresAt,
+// reporting false if it is already recorded and unexpired. Expired nonces of
+// the same device are purged along the way.
+func (s *PostgresStorage) RecordDeviceNonce(ctx context.Context, deviceID, nonce string, expiresAt time.Time) (bool, error) {
+	query := `
+		WITH purged AS (
+			DELETE FROM device_nonces WHERE device_id = $1 AND expires_at < $4 AND nonce <> $2
+		)
+		INSERT INTO device_nonces (device_id, nonce, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (device_id, nonce) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE device_nonces.expires_at < $4
+	`
+
+	tag, err := s.pool.Exec(ctx, query, deviceID, nonce, expiresAt, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to record device nonce: %w", err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// =====================================
+// Device Certificate Operations
+// =====================================
+
+const deviceCertificateColumns = `serial, device_id, tenant_id, subject, not_before, not_after, revoked_at, revocation_reason, created_at`
+
+func scanDeviceCertificate(row pgx.Row) (*models.DeviceCertificate, error) {
+	var c models.DeviceCertificate
+	err := row.Scan(&c.Serial, &c.DeviceID, &c.TenantID, &c.Subject, &c.NotBefore, &c.NotAfter,
+		&c.RevokedAt, &c.RevocationReason, &c.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// CreateDeviceCertificate records a certificate issued to a device
+func (s *PostgresStorage) CreateDeviceCertificate(ctx context.Context, cert *models.DeviceCertificate) error {
+	query := `
+		INSERT INTO device_certificates (` + deviceCertificateColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		cert.Serial, cert.DeviceID, cert.TenantID, cert.Subject, cert.NotBefore, cert.NotAfter,
+		cert.RevokedAt, cert.RevocationReason, cert.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create device certificate: %w", err)
+	}
+
+	return nil
+}
+
+// GetDeviceCertificate retrieves a device certificate by serial number
+func (s *PostgresStorage) GetDeviceCertificate(ctx context.Context, serial string) (*models.DeviceCertificate, error) {
+	query := `SELECT ` + deviceCertificateColumns + ` FROM device_certificates WHERE serial = $1`
+
+	cert, err := scanDeviceCertificate(s.pool.QueryRow(ctx, query, serial))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device certificate: %w", err)
+	}
+
+	return cert, nil
+}
+
+// ListDeviceCertificates lists a device's certificates, newest first
+func (s *PostgresStorage) ListDeviceCertificates(ctx context.Context, deviceID string) ([]models.DeviceCertificate, error) {
+	query := `SELECT ` + deviceCertificateColumns + ` FROM device_certificates WHERE device_id = $1 ORDER BY created_at DESC`
+
+	rows, err := s.pool.Query(ctx, query, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list device certificates: %w", err)
+	}
+	defer rows.Close()
+
+	var certs []models.DeviceCertificate
+	for rows.Next() {
+		cert, err := scanDeviceCertificate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan device certificate: %w", err)
+		}
+		certs = append(certs, *cert)
+	}
+
+	return certs, nil
+}
+
+// RevokeDeviceCertificate revokes a certificate; revoking it again keeps the
+// original time and reason
+func (s *PostgresStorage) RevokeDeviceCertificate(ctx context.Context, serial, reason string, at time.Time) error {
+	query := `
+		UPDATE device_certificates SET revoked_at = $2, revocation_reason = $3
+		WHERE serial = $1 AND revoked_at IS NULL
+	`
+
+	if _, err := s.pool.Exec(ctx, query, serial, at, reason); err != nil {
+		return fmt.Errorf("failed to revoke device certificate: %w", err)
+	}
+
+	return nil
+}
+
+// =====================================
+// Enrollment Token Operations
+// =====================================
+
+// CreateEnrollmentToken stores a new enrollment token
+func (s *PostgresStorage) CreateEnrollmentToken(ctx context.Context, token *models.EnrollmentToken) error {
+	query := `
+		INSERT INTO enrollment_tokens (id, tenant_id, token_prefix, token_hash, management_tier, max_cameras,
+			created_by, expires_at, used_at, used_by_device, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		token.ID, token.TenantID, token.TokenPrefix, token.TokenHash, token.ManagementTier, token.MaxCameras,
+		token.CreatedBy, token.ExpiresAt, token.UsedAt, token.UsedByDevice, token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create enrollment token: %w", err)
+	}
+
+	return nil
+}
+
+// GetEnrollmentTokenByHash retrieves the enrollment token with the given hash
+func (s *PostgresStorage) GetEnrollmentTokenByHash(ctx context.Context, tokenHash string) (*models.EnrollmentToken, error) {
+	query := `
+		SELECT id, tenant_id, token_prefix, token_hash, management_tier, max_cameras,
+			created_by, expires_at, used_at, used_by_device, created_at
+		FROM enrollment_tokens WHERE token_hash = $1
+	`
+
+	var t models.EnrollmentToken
+	err := s.pool.QueryRow(ctx, query, tokenHash).Scan(
+		&t.ID, &t.TenantID, &t.TokenPrefix, &t.TokenHash, &t.ManagementTier, &t.MaxCameras,
+		&t.CreatedBy, &t.ExpiresAt, &t.UsedAt, &t.UsedByDevice, &t.CreatedAt,
+	)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get enrollment token: %w", err)
+	}
+
+	return &t, nil
+}
+
+// RedeemEnrollmentToken marks a token used by a device, reporting false if it
+// was already used or has expired. Only one concurrent redemption succeeds.
+func (s *PostgresStorage) RedeemEnrollmentToken(ctx context.Context, tokenID, deviceID string, at time.Time) (bool, error) {
+	query := `
+		UPDATE enrollment_tokens SET used_at = $3, used_by_device = $2
+		WHERE id = $1 AND used_at IS NULL AND expires_at > $3
+	`
+
+	tag, err := s.pool.Exec(ctx, query, tokenID, deviceID, at)
+	if err != nil {
+		return false, fmt.Errorf("failed to redeem enrollment token: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// =====================================
+// Payment Operations
+// =====================================
+
+// GetPaymentAccount retrieves the payment provider account for a tenant
+func (s *PostgresStorage) GetPaymentAccount(ctx context.Context, tenantID string) (*models.PaymentAccount, error) {
+	query := `
+		SELECT tenant_id, provider, customer_id, payment_method_id, card_brand, card_last4, created_at, updated_at
+		FROM payment_accounts WHERE tenant_id = $1
+	`
+
+	var account models.PaymentAccount
+	err := s.pool.QueryRow(ctx, query, tenantID).Scan(
+		&account.TenantID, &account.Provider, &account.CustomerID, &account.PaymentMethodID,
+		&account.CardBrand, &account.CardLast4, &account.CreatedAt, &account.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment account: %w", err)
+	}
+
+	return &account, nil
+}
+
+// SavePaymentAccount creates or updates the payment provider account for a tenant
+func (s *PostgresStorage) SavePaymentAccount(ctx context.Context, account *models.PaymentAccount) error {
+	query := `
+		INSERT INTO payment_accounts (tenant_id, provider, customer_id, payment_method_id, card_brand, card_last4, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			provider = EXCLUDED.provider, customer_id = EXCLUDED.customer_id,
+			payment_method_id = EXCLUDED.payment_method_id, card_brand = EXCLUDED.card_brand,
+			card_last4 = EXCLUDED.card_last4, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		account.TenantID, account.Provider, account.CustomerID, account.PaymentMethodID,
+		account.CardBrand, account.CardLast4, account.CreatedAt, account.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save payment account: %w", err)
+	}
+
+	return nil
+}
+
+const paymentAttemptColumns = `
+	id, tenant_id, subscription_id, provider, provider_charge_id, amount, refunded_amount, currency,
+	status, failure_code, failure_message, description, reference_type, reference_id, created_at, updated_at
+`
+
+func scanPaymentAttempt(row pgx.Row) (*models.PaymentAttempt, error) {
+	var attempt models.PaymentAttempt
+	var description, referenceType *string
+	err := row.Scan(
+		&attempt.ID, &attempt.TenantID, &attempt.SubscriptionID, &attempt.Provider, &attempt.ProviderChargeID,
+		&attempt.Amount, &attempt.RefundedAmount, &attempt.Currency, &attempt.Status,
+		&attempt.FailureCode, &attempt.FailureMessage, &description, &referenceType,
+		&attempt.ReferenceID, &attempt.CreatedAt, &attempt.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if description != nil {
+		attempt.Description = *description
+	}
+	if referenceType != nil {
+		attempt.ReferenceType = *referenceType
+	}
+	return &attempt, nil
+}
+
+// SavePaymentAttempt creates or updates a payment attempt
+func (s *PostgresStorage) SavePaymentAttempt(ctx context.Context, attempt *models.PaymentAttempt) error {
+	query := `
+		INSERT INTO payment_attempts (` + paymentAttemptColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			provider_charge_id = EXCLUDED.provider_charge_id, refunded_amount = EXCLUDED.refunded_amount,
+			status = EXCLUDED.status, failure_code = EXCLUDED.failure_code,
+			failure_message = EXCLUDED.failure_message, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		attempt.ID, attempt.TenantID, attempt.SubscriptionID, attempt.Provider, attempt.ProviderChargeID,
+		attempt.Amount, attempt.RefundedAmount, attempt.Currency, attempt.Status,
+		attempt.FailureCode, attempt.FailureMessage, attempt.Description, attempt.ReferenceType,
+		attempt.ReferenceID, attempt.CreatedAt, attempt.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save payment attempt: %w", err)
+	}
+
+	return nil
+}
+
+// GetPaymentAttempt retrieves a payment attempt by ID
+func (s *PostgresStorage) GetPaymentAttempt(ctx context.Context, attemptID string) (*models.PaymentAttempt, error) {
+	query := `SELECT ` + paymentAttemptColumns + ` FROM payment_attempts WHERE id = $1`
+
+	attempt, err := scanPaymentAttempt(s.pool.QueryRow(ctx, query, attemptID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment attempt: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// GetPaymentAttemptByChargeID retrieves a payment attempt by the provider's charge ID
+func (s *PostgresStorage) GetPaymentAttemptByChargeID(ctx context.Context, provider, chargeID string) (*models.PaymentAttempt, error) {
+	query := `SELECT ` + paymentAttemptColumns + ` FROM payment_attempts WHERE provider = $1 AND provider_charge_id = $2`
+
+	attempt, err := scanPaymentAttempt(s.pool.QueryRow(ctx, query, provider, chargeID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment attempt by charge: %w", err)
+	}
+
+	return attempt, nil
+}
+
+// GetPaymentAttemptsByTenant gets all payment attempts for a tenant, newest first
+func (s *PostgresStorage) GetPaymentAttemptsByTenant(ctx context.Context, tenantID string) ([]models.PaymentAttempt, error) {
+	query := `SELECT ` + paymentAttemptColumns + ` FROM payment_attempts WHERE tenant_id = $1 ORDER BY created_at DESC`
+
+	rows, err := s.pool.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.PaymentAttempt
+	for rows.Next() {
+		attempt, err := scanPaymentAttempt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment attempt: %w", err)
+		}
+		attempts = append(attempts, *attempt)
+	}
+
+	return attempts, nil
+}
+
+// GetPaymentAttemptsInRange gets payment attempts created within a time range
+func (s *PostgresStorage) GetPaymentAttemptsInRange(ctx context.Context, start, end time.Time) ([]models.PaymentAttempt, error) {
+	query := `SELECT ` + paymentAttemptColumns + ` FROM payment_attempts WHERE created_at >= $1 AND created_at <= $2`
+
+	rows, err := s.pool.Query(ctx, query, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get payment attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.PaymentAttempt
+	for rows.Next() {
+		attempt, err := scanPaymentAttempt(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan payment attempt: %w", err)
+		}
+		attempts = append(attempts, *attempt)
+	}
+
+	return attempts, nil
+}
+
+// =====================================
+// Credit Note Operations
+// =====================================
+
+const creditNoteColumns = `
+	id, number, tenant_id, reason, method, status, currency, total, line_items, memo, issued_by,
+	issued_at, created_at, updated_at
+`
+
+func scanCreditNote(row pgx.Row) (*models.CreditNote, error) {
+	var note models.CreditNote
+	var lineItems []byte
+	err := row.Scan(
+		&note.ID, &note.Number, &note.TenantID, &note.Reason, &note.Method, &note.Status,
+		&note.Currency, &note.Total, &lineItems, &note.Memo, &note.IssuedBy,
+		&note.IssuedAt, &note.CreatedAt, &note.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(lineItems, &note.LineItems); err != nil {
+		return nil, fmt.Errorf("failed to decode credit note line items: %w", err)
+	}
+	return &note, nil
+}
+
+func (s *PostgresStorage) queryCreditNotes(ctx context.Context, query string, args ...interface{}) ([]models.CreditNote, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit notes: %w", err)
+	}
+	defer rows.Close()
+
+	var notes []models.CreditNote
+	for rows.Next() {
+		note, err := scanCreditNote(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit note: %w", err)
+		}
+		notes = append(notes, *note)
+	}
+
+	return notes, nil
+}
+
+// SaveCreditNote creates or updates a credit note
+func (s *PostgresStorage) SaveCreditNote(ctx context.Context, note *models.CreditNote) error {
+	lineItems, err := json.Marshal(note.LineItems)
+	if err != nil {
+		return fmt.Errorf("failed to encode credit note line items: %w", err)
+	}
+
+	query := `
+		INSERT INTO credit_notes (` + creditNoteColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, line_items = EXCLUDED.line_items, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err = s.pool.Exec(ctx, query,
+		note.ID, note.Number, note.TenantID, note.Reason, note.Method, note.Status,
+		note.Currency, note.Total, lineItems, note.Memo, note.IssuedBy,
+		note.IssuedAt, note.CreatedAt, note.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save credit note: %w", err)
+	}
+
+	return nil
+}
+
+// GetCreditNote retrieves a credit note by ID
+func (s *PostgresStorage) GetCreditNote(ctx context.Context, noteID string) (*models.CreditNote, error) {
+	query := `SELECT ` + creditNoteColumns + ` FROM credit_notes WHERE id = $1`
+
+	note, err := scanCreditNote(s.pool.QueryRow(ctx, query, noteID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit note: %w", err)
+	}
+
+	return note, nil
+}
+
+// GetCreditNotesByTenant gets all credit notes for a tenant, newest first
+func (s *PostgresStorage) GetCreditNotesByTenant(ctx context.Context, tenantID string) ([]models.CreditNote, error) {
+	query := `SELECT ` + creditNoteColumns + ` FROM credit_notes WHERE tenant_id = $1 ORDER BY issued_at DESC`
+	return s.queryCreditNotes(ctx, query, tenantID)
+}
+
+// GetCreditNotesInRange gets credit notes issued within a time range
+func (s *PostgresStorage) GetCreditNotesInRange(ctx context.Context, start, end time.Time) ([]models.CreditNote, error) {
+	query := `SELECT ` + creditNoteColumns + ` FROM credit_notes WHERE issued_at >= $1 AND issued_at <= $2`
+	return s.queryCreditNotes(ctx, query, start, end)
+}
+
+// =====================================
+// Wallet Operations
+// =====================================
+
+// GetWallet retrieves a tenant's prepaid wallet settings
+func (s *PostgresStorage) GetWallet(ctx context.Context, tenantID string) (*models.Wallet, error) {
+	query := `
+		SELECT tenant_id, currency, zero_balance_behavior, created_at, updated_at
+		FROM wallets WHERE tenant_id = $1
+	`
+
+	var w models.Wallet
+	err := s.pool.QueryRow(ctx, query, tenantID).Scan(
+		&w.TenantID, &w.Currency, &w.ZeroBalanceBehavior, &w.CreatedAt, &w.UpdatedAt,
+	)
+
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet: %w", err)
+	}
+
+	return &w, nil
+}
+
+// SaveWallet creates or updates a tenant's prepaid wallet settings
+func (s *PostgresStorage) SaveWallet(ctx context.Context, w *models.Wallet) error {
+	query := `
+		INSERT INTO wallets (tenant_id, currency, zero_balance_behavior, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (tenant_id) DO UPDATE SET
+			zero_balance_behavior = EXCLUDED.zero_balance_behavior, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.pool.Exec(ctx, query, w.TenantID, w.Currency, w.ZeroBalanceBehavior, w.CreatedAt, w.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save wallet: %w", err)
+	}
+
+	return nil
+}
+
+const walletBalanceQuery = `
+	SELECT COALESCE(SUM(remaining), 0) FROM credit_grants
+	WHERE tenant_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > $2)
+`
+
+const walletTxInsert = `
+	INSERT INTO wallet_transactions (tenant_id, type, amount, balance_after, grant_id, event_type, quantity, description, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+`
+
+// lockWallet serialises ledger writes for a tenant within a transaction
+func lockWallet(ctx context.Context, tx pgx.Tx, tenantID string) error {
+	_, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('wallet:' || $1))", tenantID)
+	return err
+}
+
+// roundCredit rounds a wallet amount to the precision credit is stored at
+func roundCredit(amount float64) float64 {
+	return math.Round(amount*1e6) / 1e6
+}
+
+// overageEntry is the ledger entry for the part of a drawdown that prepaid
+// credit could not cover. Shared with the in-memory store.
+func overageEntry(drawdown models.WalletTransaction, shortfall float64) models.WalletTransaction {
+	entry := drawdown
+	entry.Type = models.WalletTxOverage
+	entry.Amount = shortfall
+	entry.Quantity = nil
+	entry.Description = drawdown.Description + " not covered by prepaid credit"
+	return entry
+}
+
+// insertWalletTx records a ledger entry with the balance as of the transaction
+func insertWalletTx(ctx context.Context, tx pgx.Tx, entry models.WalletTransaction) error {
+	if err := tx.QueryRow(ctx, walletBalanceQuery, entry.TenantID, entry.CreatedAt).Scan(&entry.BalanceAfter); err != nil {
+		return err
+	}
+	_, err := tx.Exec(ctx, walletTxInsert,
+		entry.TenantID, entry.Type, entry.Amount, entry.BalanceAfter, entry.GrantID,
+		entry.EventType, entry.Quantity, entry.Description, entry.CreatedAt,
+	)
+	return err
+}
+
+// AddCreditGrant adds a credit grant and its ledger entry. It reports false,
+// adding nothing, when the grant's payment attempt has already been credited.
+func (s *PostgresStorage) AddCreditGrant(ctx context.Context, grant *models.CreditGrant) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockWallet(ctx, tx, grant.TenantID); err != nil {
+		return false, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO credit_grants (id, tenant_id, type, amount, remaining, description, payment_attempt_id, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (payment_attempt_id) WHERE payment_attempt_id IS NOT NULL DO NOTHING
+	`, grant.ID, grant.TenantID, grant.Type, grant.Amount, grant.Remaining, grant.Description,
+		grant.PaymentAttemptID, grant.ExpiresAt, grant.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to add credit grant: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	grantID := grant.ID
+	if err := insertWalletTx(ctx, tx, models.WalletTransaction{
+		TenantID:    grant.TenantID,
+		Type:        grant.Type,
+		Amount:      grant.Amount,
+		GrantID:     &grantID,
+		Description: grant.Description,
+		CreatedAt:   grant.CreatedAt,
+	}); err != nil {
+		return false, fmt.Errorf("failed to record credit grant: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit credit grant: %w", err)
+	}
+	return true, nil
+}
+
+// DrawdownCredits consumes up to amount from the tenant's active grants,
+// soonest-expiring first, and returns how much was drawn. The drawdown and
+// an overage entry for any shortfall are recorded in the same transaction.
+func (s *PostgresStorage) DrawdownCredits(ctx context.Context, tenantID string, amount float64, entry models.WalletTransaction) (float64, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockWallet(ctx, tx, tenantID); err != nil {
+		return 0, fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id, remaining FROM credit_grants
+		WHERE tenant_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY expires_at NULLS LAST, created_at
+	`, tenantID, entry.CreatedAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get credit grants: %w", err)
+	}
+
+	type grantBalance struct {
+		id        string
+		remaining float64
+	}
+	var grants []grantBalance
+	for rows.Next() {
+		var g grantBalance
+		if err := rows.Scan(&g.id, &g.remaining); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan credit grant: %w", err)
+		}
+		grants = append(grants, g)
+	}
+	rows.Close()
+
+	remaining := amount
+	for _, g := range grants {
+		if remaining <= 0 {
+			break
+		}
+		take := g.remaining
+		if take > remaining {
+			take = remaining
+		}
+		if _, err := tx.Exec(ctx, "UPDATE credit_grants SET remaining = remaining - $2 WHERE id = $1", g.id, take); err != nil {
+			return 0, fmt.Errorf("failed to draw down credit grant: %w", err)
+		}
+		remaining -= take
+	}
+
+	drawn := roundCredit(amount - remaining)
+	if drawn > 0 {
+		drawdown := entry
+		drawdown.Amount = -drawn
+		if err := insertWalletTx(ctx, tx, drawdown); err != nil {
+			return 0, fmt.Errorf("failed to record drawdown: %w", err)
+		}
+	}
+	if shortfall := roundCredit(remaining); shortfall > 0 {
+		if err := insertWalletTx(ctx, tx, overageEntry(entry, shortfall)); err != nil {
+			return 0, fmt.Errorf("failed to record overage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit drawdown: %w", err)
+	}
+	return drawn, nil
+}
+
+// ExpireCreditGrants zeroes the remaining credit of lapsed grants and records the expiry
+func (s *PostgresStorage) ExpireCreditGrants(ctx context.Context, tenantID string, now time.Time) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := lockWallet(ctx, tx, tenantID); err != nil {
+		return fmt.Errorf("failed to lock wallet: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		UPDATE credit_grants g SET remaining = 0
+		FROM (SELECT id, remaining FROM credit_grants
+		      WHERE tenant_id = $1 AND remaining > 0 AND expires_at <= $2 FOR UPDATE) expired
+		WHERE g.id = expired.id
+		RETURNING g.id, expired.remaining
+	`, tenantID, now)
+	if err != nil {
+		return fmt.Errorf("failed to expire credit grants: %w", err)
+	}
+
+	type expiredGrant struct {
+		id     string
+		amount float64
+	}
+	var expired []expiredGrant
+	for rows.Next() {
+		var e expiredGrant
+		if err := rows.Scan(&e.id, &e.amount); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan expired grant: %w", err)
+		}
+		expired = append(expired, e)
+	}
+	rows.Close()
+
+	for _, e := range expired {
+		grantID := e.id
+		if err := insertWalletTx(ctx, tx, models.WalletTransaction{
+			TenantID:    tenantID,
+			Type:        models.WalletTxExpiry,
+			Amount:      -e.amount,
+			GrantID:     &grantID,
+			Description: "Credit grant expired",
+			CreatedAt:   now,
+		}); err != nil {
+			return fmt.Errorf("failed to record expiry: %w", err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetWalletBalance returns the tenant's spendable credit
+func (s *PostgresStorage) GetWalletBalance(ctx context.Context, tenantID string, now time.Time) (float64, error) {
+	var balance float64
+	if err := s.pool.QueryRow(ctx, walletBalanceQuery, tenantID, now).Scan(&balance); err != nil {
+		return 0, fmt.Errorf("failed to get wallet balance: %w", err)
+	}
+	return balance, nil
+}
+
+// GetActiveCreditGrants gets the tenant's spendable grants, soonest expiry first
+func (s *PostgresStorage) GetActiveCreditGrants(ctx context.Context, tenantID string, now time.Time) ([]models.CreditGrant, error) {
+	query := `
+		SELECT id, tenant_id, type, amount, remaining, COALESCE(description, ''), payment_attempt_id, expires_at, created_at
+		FROM credit_grants
+		WHERE tenant_id = $1 AND remaining > 0 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY expires_at NULLS LAST, created_at
+	`
+
+	rows, err := s.pool.Query(ctx, query, tenantID, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credit grants: %w", err)
+	}
+	defer rows.Close()
+
+	var grants []models.CreditGrant
+	for rows.Next() {
+		var g models.CreditGrant
+		err := rows.Scan(
+			&g.ID, &g.TenantID, &g.Type, &g.Amount, &g.Remaining, &g.Description,
+			&g.PaymentAttemptID, &g.ExpiresAt, &g.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan credit grant: %w", err)
+		}
+		grants = append(grants, g)
+	}
+
+	return grants, nil
+}
+
+// GetWalletTransactions gets the tenant's most recent ledger entries, newest first
+func (s *PostgresStorage) GetWalletTransactions(ctx context.Context, tenantID string, limit int) ([]models.WalletTransaction, error) {
+	query := `
+		SELECT id, tenant_id, type, amount, balance_after, grant_id, event_type, quantity,
+			   COALESCE(description, ''), created_at
+		FROM wallet_transactions WHERE tenant_id = $1 ORDER BY id DESC LIMIT $2
+	`
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.pool.Query(ctx, query, tenantID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get wallet transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var txs []models.WalletTransaction
+	for rows.Next() {
+		var t models.WalletTransaction
+		err := rows.Scan(
+			&t.ID, &t.TenantID, &t.Type, &t.Amount, &t.BalanceAfter, &t.GrantID,
+			&t.EventType, &t.Quantity, &t.Description, &t.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan wallet transaction: %w", err)
+		}
+		txs = append(txs, t)
+	}
+
+	return txs, nil
+}
+
+// SavePendingDrawdown creates or updates a failed drawdown awaiting replay
+func (s *PostgresStorage) SavePendingDrawdown(ctx context.Context, pending *models.PendingDrawdown) error {
+	events, err := json.Marshal(pending.Events)
+	if err != nil {
+		return fmt.Errorf("failed to encode pending drawdown events: %w", err)
+	}
+
+	query := `
+		INSERT INTO wallet_pending_drawdowns (id, tenant_id, event_type, events, attempts, last_error, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (id) DO UPDATE SET
+			attempts = EXCLUDED.attempts, last_error = EXCLUDED.last_error, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err = s.pool.Exec(ctx, query,
+		pending.ID, pending.TenantID, pending.EventType, events, pending.Attempts,
+		pending.LastError, pending.CreatedAt, pending.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save pending drawdown: %w", err)
+	}
+
+	return nil
+}
+
+// GetPendingDrawdowns returns up to limit failed drawdowns, oldest first
+func (s *PostgresStorage) GetPendingDrawdowns(ctx context.Context, limit int) ([]models.PendingDrawdown, error) {
+	query := `
+		SELECT id, tenant_id, event_type, events, attempts, COALESCE(last_error, ''), created_at, updated_at
+		FROM wallet_pending_drawdowns ORDER BY created_at, id LIMIT $1
+	`
+	if limit <= 0 {
+		limit = 100
+	}
+
+	rows, err := s.pool.Query(ctx, query, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending drawdowns: %w", err)
+	}
+	defer rows.Close()
+
+	var pending []models.PendingDrawdown
+	for rows.Next() {
+		var p models.PendingDrawdown
+		var events []byte
+		err := rows.Scan(&p.ID, &p.TenantID, &p.EventType, &events, &p.Attempts, &p.LastError, &p.CreatedAt, &p.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pending drawdown: %w", err)
+		}
+		if err := json.Unmarshal(events, &p.Events); err != nil {
+			return nil, fmt.Errorf("failed to decode pending drawdown events: %w", err)
+		}
+		pending = append(pending, p)
+	}
+
+	return pending, nil
+}
+
+// DeletePendingDrawdown removes a pending drawdown, reporting false when it
+// was already gone, so only one replay claims it
+func (s *PostgresStorage) DeletePendingDrawdown(ctx context.Context, id string) (bool, error) {
+	tag, err := s.pool.Exec(ctx, "DELETE FROM wallet_pending_drawdowns WHERE id = $1", id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete pending drawdown: %w", err)
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+// =====================================
+// Billing Period Operations
+// =====================================
+
+const billingPeriodColumns = `
+	id, tenant_id, period_start, period_end, status, usage_totals, closed_by, closed_at, locked_at,
+	created_at, updated_at
+`
+
+func scanBillingPeriod(row pgx.Row) (*models.BillingPeriod, error) {
+	var p models.BillingPeriod
+	var totals []byte
+	err := row.Scan(
+		&p.ID, &p.TenantID, &p.PeriodStart, &p.PeriodEnd, &p.Status, &totals, &p.ClosedBy,
+		&p.ClosedAt, &p.LockedAt, &p.CreatedAt, &p.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(totals, &p.UsageTotals); err != nil {
+		return nil, fmt.Errorf("failed to decode billing period usage totals: %w", err)
+	}
+	return &p, nil
+}
+
+// SaveBillingPeriod creates or updates a closed billing period
+func (s *PostgresStorage) SaveBillingPeriod(ctx context.Context, period *models.BillingPeriod) error {
+	totals, err := json.Marshal(period.UsageTotals)
+	if err != nil {
+		return fmt.Errorf("failed to encode billing period usage totals: %w", err)
+	}
+
+	query := `
+		INSERT INTO billing_periods (` + billingPeriodColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, usage_totals = EXCLUDED.usage_totals,
+			locked_at = EXCLUDED.locked_at, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err = s.pool.Exec(ctx, query,
+		period.ID, period.TenantID, period.PeriodStart, period.PeriodEnd, period.Status, totals,
+		period.ClosedBy, period.ClosedAt, period.LockedAt, period.CreatedAt, period.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save billing period: %w", err)
+	}
+
+	return nil
+}
+
+// GetBillingPeriod retrieves a closed billing period by ID
+func (s *PostgresStorage) GetBillingPeriod(ctx context.Context, periodID string) (*models.BillingPeriod, error) {
+	query := `SELECT ` + billingPeriodColumns + ` FROM billing_periods WHERE id = $1`
+
+	period, err := scanBillingPeriod(s.pool.QueryRow(ctx, query, periodID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get billing period: %w", err)
+	}
+
+	return period, nil
+}
+
+// GetBillingPeriods gets a tenant's closed billing periods, newest first
+func (s *PostgresStorage) GetBillingPeriods(ctx context.Context, tenantID string) ([]models.BillingPeriod, error) {
+	query := `SELECT ` + billingPeriodColumns + ` FROM billing_periods WHERE tenant_id = $1 ORDER BY period_start DESC`
+
+	rows, err := s.pool.Query(ctx, query, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get billing periods: %w", err)
+	}
+	defer rows.Close()
+
+	var periods []models.BillingPeriod
+	for rows.Next() {
+		period, err := scanBillingPeriod(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan billing period: %w", err)
+		}
+		periods = append(periods, *period)
+	}
+
+	return periods, nil
+}
+
+const heldUsageColumns = `
+	id, tenant_id, period_id, event, status, received_at, reviewed_by, reviewed_at, note
+`
+
+func scanHeldUsageEvent(row pgx.Row) (*models.HeldUsageEvent, error) {
+	var held models.HeldUsageEvent
+	var event []byte
+	err := row.Scan(
+		&held.ID, &held.TenantID, &held.PeriodID, &event, &held.Status, &held.ReceivedAt,
+		&held.ReviewedBy, &held.ReviewedAt, &held.Note,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(event, &held.Event); err != nil {
+		return nil, fmt.Errorf("failed to decode held usage event: %w", err)
+	}
+	return &held, nil
+}
+
+// SaveHeldUsageEvent creates or updates a held late usage event
+func (s *PostgresStorage) SaveHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent) error {
+	event, err := json.Marshal(held.Event)
+	if err != nil {
+		return fmt.Errorf("failed to encode held usage event: %w", err)
+	}
+
+	query := `
+		INSERT INTO held_usage_events (` + heldUsageColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status, reviewed_by = EXCLUDED.reviewed_by,
+			reviewed_at = EXCLUDED.reviewed_at, note = EXCLUDED.note
+	`
+
+	_, err = s.pool.Exec(ctx, query,
+		held.ID, held.TenantID, held.PeriodID, event, held.Status, held.ReceivedAt,
+		held.ReviewedBy, held.ReviewedAt, held.Note,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save held usage event: %w", err)
+	}
+
+	return nil
+}
+
+// ReviewHeldUsageEvent moves a pending held usage event to held.Status and, in
+// the same transaction, saves the events it releases. Returns false, saving
+// nothing, when the event is no longer pending.
+func (s *PostgresStorage) ReviewHeldUsageEvent(ctx context.Context, held *models.HeldUsageEvent, events []models.UsageEvent) (bool, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	query := `
+		UPDATE held_usage_events SET status = $2, reviewed_by = $3, reviewed_at = $4, note = $5
+		WHERE id = $1 AND status = $6
+	`
+	tag, err := tx.Exec(ctx, query, held.ID, held.Status, held.ReviewedBy, held.ReviewedAt, held.Note, models.HeldUsagePending)
+	if err != nil {
+		return false, fmt.Errorf("failed to review held usage event: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if len(events) > 0 {
+		if err := saveUsageEventsTx(ctx, tx, events); err != nil {
+			return false, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit held usage review: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetHeldUsageEvent retrieves a held usage event by ID
+func (s *PostgresStorage) GetHeldUsageEvent(ctx context.Context, heldID string) (*models.HeldUsageEvent, error) {
+	query := `SELECT ` + heldUsageColumns + ` FROM held_usage_events WHERE id = $1`
+
+	held, err := scanHeldUsageEvent(s.pool.QueryRow(ctx, query, heldID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get held usage event: %w", err)
+	}
+
+	return held, nil
+}
+
+// GetHeldUsageEvents lists held usage events oldest first. Empty tenantID or
+// status match all.
+func (s *PostgresStorage) GetHeldUsageEvents(ctx context.Context, tenantID, status string) ([]models.HeldUsageEvent, error) {
+	query := `
+		SELECT ` + heldUsageColumns + ` FROM held_usage_events
+		WHERE ($1 = '' OR tenant_id = $1) AND ($2 = '' OR status = $2)
+		ORDER BY received_at
+	`
+
+	rows, err := s.pool.Query(ctx, query, tenantID, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get held usage events: %w", err)
+	}
+	defer rows.Close()
+
+	var held []models.HeldUsageEvent
+	for rows.Next() {
+		h, err := scanHeldUsageEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan held usage event: %w", err)
+		}
+		held = append(held, *h)
+	}
+
+	return held, nil
+}
+
+// =====================================
+// Dunning Operations
+// =====================================
+
+const dunningCaseColumns = `
+	id, tenant_id, subscription_id, payment_attempt_id, last_attempt_id, amount, description,
+	reference_type, reference_id, status, retry_count, next_action_at, started_at, resolved_at,
+	created_at, updated_at
+`
+
+func scanDunningCase(row pgx.Row) (*models.DunningCase, error) {
+	var dc models.DunningCase
+	var description, referenceType *string
+	err := row.Scan(
+		&dc.ID, &dc.TenantID, &dc.SubscriptionID, &dc.PaymentAttemptID, &dc.LastAttemptID,
+		&dc.Amount, &description, &referenceType, &dc.ReferenceID, &dc.Status, &dc.RetryCount,
+		&dc.NextActionAt, &dc.StartedAt, &dc.ResolvedAt, &dc.CreatedAt, &dc.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if description != nil {
+		dc.Description = *description
+	}
+	if referenceType != nil {
+		dc.ReferenceType = *referenceType
+	}
+	return &dc, nil
+}
+
+func (s *PostgresStorage) queryDunningCases(ctx context.Context, query string, args ...interface{}) ([]models.DunningCase, error) {
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dunning cases: %w", err)
+	}
+	defer rows.Close()
+
+	var cases []models.DunningCase
+	for rows.Next() {
+		dc, err := scanDunningCase(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan dunning case: %w", err)
+		}
+		cases = append(cases, *dc)
+	}
+
+	return cases, nil
+}
+
+// SaveDunningCase creates or updates a dunning case
+func (s *PostgresStorage) SaveDunningCase(ctx context.Context, dc *models.DunningCase) error {
+	query := `
+		INSERT INTO dunning_cases (` + dunningCaseColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		ON CONFLICT (id) DO UPDATE SET
+			last_attempt_id = EXCLUDED.last_attempt_id, status = EXCLUDED.status,
+			retry_count = EXCLUDED.retry_count, next_action_at = EXCLUDED.next_action_at,
+			resolved_at = EXCLUDED.resolved_at, updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		dc.ID, dc.TenantID, dc.SubscriptionID, dc.PaymentAttemptID, dc.LastAttemptID, dc.Amount,
+		dc.Description, dc.ReferenceType, dc.ReferenceID, dc.Status, dc.RetryCount, dc.NextActionAt,
+		dc.StartedAt, dc.ResolvedAt, dc.CreatedAt, dc.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save dunning case: %w", err)
+	}
+
+	return nil
+}
+
+// GetOpenDunningCase retrieves the open dunning case for a tenant, if any
+func (s *PostgresStorage) GetOpenDunningCase(ctx context.Context, tenantID string) (*models.DunningCase, error) {
+	query := `SELECT ` + dunningCaseColumns + ` FROM dunning_cases
+		WHERE tenant_id = $1 AND status = 'open' ORDER BY started_at DESC LIMIT 1`
+
+	dc, err := scanDunningCase(s.pool.QueryRow(ctx, query, tenantID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open dunning case: %w", err)
+	}
+
+	return dc, nil
+}
+
+// GetDueDunningCases gets open dunning cases whose next action is due
+func (s *PostgresStorage) GetDueDunningCases(ctx context.Context, before time.Time) ([]models.DunningCase, error) {
+	query := `SELECT ` + dunningCaseColumns + ` FROM dunning_cases
+		WHERE status = 'open' AND next_action_at <= $1 ORDER BY next_action_at`
+	return s.queryDunningCases(ctx, query, before)
+}
+
+// GetDunningCasesByTenant gets all dunning cases for a tenant, newest first
+func (s *PostgresStorage) GetDunningCasesByTenant(ctx context.Context, tenantID string) ([]models.DunningCase, error) {
+	query := `SELECT ` + dunningCaseColumns + ` FROM dunning_cases
+		WHERE tenant_id = $1 ORDER BY started_at DESC`
+	return s.queryDunningCases(ctx, query, tenantID)
+}
+
+// =====================================
+// Admin Principal Operations
+// =====================================
+
+const adminPrincipalColumns = `id, name, email, roles, status, key_prefix, key_hash, created_at, updated_at`
+
+func scanAdminPrincipal(row pgx.Row) (*models.AdminPrincipal, error) {
+	var a models.AdminPrincipal
+	err := row.Scan(&a.ID, &a.Name, &a.Email, &a.Roles, &a.Status, &a.KeyPrefix, &a.KeyHash, &a.CreatedAt, &a.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// CreateAdminPrincipal creates a named admin
+func (s *PostgresStorage) CreateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error {
+	query := `
+		INSERT INTO admin_principals (` + adminPrincipalColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		admin.ID, admin.Name, admin.Email, admin.Roles, admin.Status,
+		admin.KeyPrefix, admin.KeyHash, admin.CreatedAt, admin.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create admin principal: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAdminPrincipal updates an admin's details, roles, status and key
+func (s *PostgresStorage) UpdateAdminPrincipal(ctx context.Context, admin *models.AdminPrincipal) error {
+	query := `
+		UPDATE admin_principals SET name = $2, email = $3, roles = $4, status = $5,
+			key_prefix = $6, key_hash = $7, updated_at = $8
+		WHERE id = $1
+	`
+
+	_, err := s.pool.Exec(ctx, query,
+		admin.ID, admin.Name, admin.Email, admin.Roles, admin.Status,
+		admin.KeyPrefix, admin.KeyHash, admin.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update admin principal: %w", err)
+	}
+
+	return nil
+}
+
+// GetAdminPrincipal retrieves an admin by ID
+func (s *PostgresStorage) GetAdminPrincipal(ctx context.Context, adminID string) (*models.AdminPrincipal, error) {
+	query := `SELECT ` + adminPrincipalColumns + ` FROM admin_principals WHERE id = $1`
+
+	admin, err := scanAdminPrincipal(s.pool.QueryRow(ctx, query, adminID))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin principal: %w", err)
+	}
+
+	return admin, nil
+}
+
+// GetAdminPrincipalByKeyHash retrieves the admin whose key has the given hash
+func (s *PostgresStorage) GetAdminPrincipalByKeyHash(ctx context.Context, keyHash string) (*models.AdminPrincipal, error) {
+	query := `SELECT ` + adminPrincipalColumns + ` FROM admin_principals WHERE key_hash = $1`
+
+	admin, err := scanAdminPrincipal(s.pool.QueryRow(ctx, query, keyHash))
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get admin principal by key: %w", err)
+	}
+
+	return admin, nil
+}
+
+// ListAdminPrincipals lists all admins, oldest first
+func (s *PostgresStorage) ListAdminPrincipals(ctx context.Context) ([]models.AdminPrincipal, error) {
+	query := `SELECT ` + adminPrincipalColumns + ` FROM admin_principals ORDER BY created_at`
+
+	rows, err := s.pool.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin principals: %w", err)
+	}
+	defer rows.Close()
+
+	var admins []models.AdminPrincipal
+	for rows.Next() {
+		admin, err := scanAdminPrincipal(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan admin principal: %w", err)
+		}
+		admins = append(admins, *admin)
+	}
+
+	return admins, nil
+}
+
+// CountAdminPrincipals counts stored admins
+func (s *PostgresStorage) CountAdminPrincipals(ctx context.Context) (int, error) {
+	var count int
+	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM admin_principals").Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count admin principals: %w", err)
+	}
+	return count, nil
+}
+
 // =====================================
 // Statistics
 // =====================================
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// usageMonth returns the start of the UTC month t falls in. Usage events are
+// partitioned, archived and restored in whole UTC months.
+func usageMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// usagePartitionName names the monthly usage_events partition for month
+func usagePartitionName(month time.Time) string {
+	return fmt.Sprintf("usage_events_p%04d_%02d", month.Year(), int(month.Month()))
+}
+
+// parseUsagePartitionName is the inverse of usagePartitionName
+func parseUsagePartitionName(name string) (time.Time, bool) {
+	var year, month int
+	if n, err := fmt.Sscanf(name, "usage_events_p%04d_%02d", &year, &month); err != nil || n != 2 || month < 1 || month > 12 {
+		return time.Time{}, false
+	}
+	t := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	if usagePartitionName(t) != name {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// normalizeMetadata turns missing metadata into an empty object, as the
+// usage_events column default does
+func normalizeMetadata(metadata json.RawMessage) json.RawMessage {
+	if len(metadata) == 0 || string(metadata) == "null" {
+		return json.RawMessage("{}")
+	}
+	return metadata
+}
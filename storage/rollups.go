@@ -0,0 +1,102 @@
+package storage
+
+import (
+	"time"
+
+	"brinkbyte-billing-server/models"
+)
+
+const day = 24 * time.Hour
+
+// rollupBucket returns the UTC bucket an event time falls in
+func rollupBucket(t time.Time, granularity string) time.Time {
+	if granularity == models.RollupDay {
+		return t.UTC().Truncate(day)
+	}
+	return t.UTC().Truncate(time.Hour)
+}
+
+// ceilTime rounds t up to a multiple of d
+func ceilTime(t time.Time, d time.Duration) time.Time {
+	floor := t.UTC().Truncate(d)
+	if floor.Equal(t) {
+		return floor
+	}
+	return floor.Add(d)
+}
+
+// usageRange splits an inclusive [start, end] query into the parts served
+// from raw events, hourly rollups and daily rollups:
+//
+//	raw [start, hourStart)   hourly [hourStart, dayStart)   daily [dayStart, dayEnd)
+//	hourly [dayEnd, hourEnd) raw [hourEnd, end]
+//
+// Empty parts collapse to zero-length spans.
+type usageRange struct {
+	start, hourStart, dayStart, dayEnd, hourEnd, end time.Time
+}
+
+// splitUsageRange splits [start, end] for rollup lookups. Rollup buckets are
+// UTC, so callers bucketing in another timezone pass it as loc: daily
+// rollups are then skipped, and so are hourly rollups when the zone's offset
+// is not a whole number of hours.
+func splitUsageRange(start, end time.Time, loc *time.Location) usageRange {
+	r := usageRange{start: start, end: end}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+	utc := loc == time.UTC || loc.String() == "UTC"
+	_, startOffset := start.In(loc).Zone()
+	_, endOffset := end.In(loc).Zone()
+	hourAligned := startOffset%3600 == 0 && endOffset%3600 == 0
+
+	r.hourStart = ceilTime(start, time.Hour)
+	r.hourEnd = end.UTC().Truncate(time.Hour)
+	if !hourAligned || !r.hourStart.Before(r.hourEnd) {
+		// No usable whole hours: everything comes from raw events
+		r.hourStart, r.hourEnd = start, start
+		r.dayStart, r.dayEnd = start, start
+		return r
+	}
+
+	r.dayStart = ceilTime(r.hourStart, day)
+	r.dayEnd = r.hourEnd.Truncate(day)
+	if !utc || !r.dayStart.Before(r.dayEnd) {
+		r.dayStart, r.dayEnd = r.hourStart, r.hourStart
+	}
+	return r
+}
+
+// rollupsFromEvents aggregates events into hourly and daily rollups
+func rollupsFromEvents(events []models.UsageEvent) []models.UsageRollup {
+	type key struct {
+		granularity, tenantID, eventType, resourceID string
+		bucket                                       int64
+	}
+	index := make(map[key]int)
+	var rollups []models.UsageRollup
+
+	for _, e := range events {
+		for _, g := range []string{models.RollupHour, models.RollupDay} {
+			bucket := rollupBucket(e.EventTime, g)
+			k := key{g, e.TenantID, e.EventType, e.ResourceID, bucket.Unix()}
+			i, ok := index[k]
+			if !ok {
+				i = len(rollups)
+				index[k] = i
+				rollups = append(rollups, models.UsageRollup{
+					Granularity: g,
+					TenantID:    e.TenantID,
+					EventType:   e.EventType,
+					ResourceID:  e.ResourceID,
+					BucketStart: bucket,
+				})
+			}
+			rollups[i].Quantity += e.Quantity
+			rollups[i].EventCount++
+		}
+	}
+
+	return rollups
+}
@@ -0,0 +1,345 @@
+package wallet
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"brinkbyte-billing-server/models"
+)
+
+// Config holds prepaid wallet configuration
+type Config struct {
+	EventCategories    map[string]string // covered event type -> entitlement category it gates
+	DefaultZeroBalance string            // behaviour for wallets created without an explicit setting
+	DefaultCurrency    string
+}
+
+// DefaultConfig draws LLM token usage from the wallet and allows overage
+func DefaultConfig() Config {
+	return Config{
+		EventCategories:    map[string]string{"llm_tokens": "llm"},
+		DefaultZeroBalance: models.ZeroBalanceAllowOverage,
+		DefaultCurrency:    "AUD",
+	}
+}
+
+// LoadConfigFromEnv loads wallet configuration from environment variables.
+// WALLET_EVENT_TYPES is a comma separated list of event_type:category pairs.
+func LoadConfigFromEnv() Config {
+	config := DefaultConfig()
+
+	if v := os.Getenv("WALLET_EVENT_TYPES"); v != "" {
+		categories := make(map[string]string)
+		for _, pair := range strings.Split(v, ",") {
+			parts := strings.SplitN(strings.TrimSpace(pair), ":", 2)
+			if len(parts) == 2 && parts[0] != "" {
+				categories[parts[0]] = parts[1]
+			}
+		}
+		if len(categories) > 0 {
+			config.EventCategories = categories
+		}
+	}
+
+	if v := os.Getenv("WALLET_ZERO_BALANCE"); v == models.ZeroBalanceAllowOverage || v == models.ZeroBalanceDeny {
+		config.DefaultZeroBalance = v
+	}
+
+	return config
+}
+
+// Storage interface for the wallet ledger (minimal subset)
+type Storage interface {
+	GetWallet(ctx context.Context, tenantID string) (*models.Wallet, error)
+	SaveWallet(ctx context.Context, w *models.Wallet) error
+	AddCreditGrant(ctx context.Context, grant *models.CreditGrant) (bool, error)
+	DrawdownCredits(ctx context.Context, tenantID string, amount float64, tx models.WalletTransaction) (float64, error)
+	ExpireCreditGrants(ctx context.Context, tenantID string, now time.Time) error
+	GetWalletBalance(ctx context.Context, tenantID string, now time.Time) (float64, error)
+	GetActiveCreditGrants(ctx context.Context, tenantID string, now time.Time) ([]models.CreditGrant, error)
+	GetWalletTransactions(ctx context.Context, tenantID string, limit int) ([]models.WalletTransaction, error)
+	SavePendingDrawdown(ctx context.Context, pending *models.PendingDrawdown) error
+	GetPendingDrawdowns(ctx context.Context, limit int) ([]models.PendingDrawdown, error)
+	DeletePendingDrawdown(ctx context.Context, id string) (bool, error)
+}
+
+// Rater prices newly saved usage events of one metered event type
+type Rater func(ctx context.Context, tenantID, eventType string, events []models.UsageEvent) (float64, error)
+
+// Ledger manages prepaid credit and draws it down as usage is rated
+type Ledger struct {
+	config Config
+	store  Storage
+	rate   Rater
+}
+
+// NewLedger creates a wallet ledger
+func NewLedger(config Config, store Storage, rate Rater) *Ledger {
+	return &Ledger{config: config, store: store, rate: rate}
+}
+
+// Config returns the ledger configuration
+func (l *Ledger) Config() Config {
+	return l.config
+}
+
+func roundCredit(amount float64) float64 {
+	return math.Round(amount*1e6) / 1e6
+}
+
+// EnsureWallet returns the tenant's wallet, creating it with default settings
+func (l *Ledger) EnsureWallet(ctx context.Context, tenantID string) (*models.Wallet, error) {
+	w, err := l.store.GetWallet(ctx, tenantID)
+	if err != nil || w != nil {
+		return w, err
+	}
+
+	now := time.Now()
+	w = &models.Wallet{
+		TenantID:            tenantID,
+		Currency:            l.config.DefaultCurrency,
+		ZeroBalanceBehavior: l.config.DefaultZeroBalance,
+		CreatedAt:           now,
+		UpdatedAt:           now,
+	}
+	if err := l.store.SaveWallet(ctx, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// AddCredit adds a top-up or promotional grant to the tenant's wallet. A
+// payment attempt is only ever credited once; crediting it again adds nothing
+// and returns a nil grant.
+func (l *Ledger) AddCredit(ctx context.Context, tenantID, grantType string, amount float64, description string, expiresAt *time.Time, paymentAttemptID *string) (*models.CreditGrant, error) {
+	if amount <= 0 {
+		return nil, fmt.Errorf("credit amount must be positive")
+	}
+	if grantType != models.CreditGrantTopUp && grantType != models.CreditGrantPromo {
+		return nil, fmt.Errorf("unknown credit grant type %q", grantType)
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("expires_at must be in the future")
+	}
+
+	if _, err := l.EnsureWallet(ctx, tenantID); err != nil {
+		return nil, err
+	}
+
+	grant := &models.CreditGrant{
+		ID:               uuid.New().String(),
+		TenantID:         tenantID,
+		Type:             grantType,
+		Amount:           amount,
+		Remaining:        amount,
+		Description:      description,
+		PaymentAttemptID: paymentAttemptID,
+		ExpiresAt:        expiresAt,
+		CreatedAt:        time.Now(),
+	}
+	added, err := l.store.AddCreditGrant(ctx, grant)
+	if err != nil {
+		return nil, err
+	}
+	if !added {
+		log.Printf("[WALLET] Payment attempt %s already credited for tenant %s", *paymentAttemptID, tenantID)
+		return nil, nil
+	}
+
+	log.Printf("[WALLET] Added %s of %.2f for tenant %s", grantType, amount, tenantID)
+	return grant, nil
+}
+
+// Balance returns the tenant's spendable balance after expiring lapsed grants
+func (l *Ledger) Balance(ctx context.Context, tenantID string) (float64, error) {
+	now := time.Now()
+	if err := l.store.ExpireCreditGrants(ctx, tenantID, now); err != nil {
+		return 0, err
+	}
+	return l.store.GetWalletBalance(ctx, tenantID, now)
+}
+
+// ApplyUsage rates covered usage events and draws the cost from each
+// tenant's wallet. Tenants without a wallet are not drawn down. The usage is
+// already saved, so a drawdown that fails is kept as a pending drawdown for
+// ReplayPending rather than lost; only failing to keep it is an error.
+func (l *Ledger) ApplyUsage(ctx context.Context, events []models.UsageEvent) error {
+	type key struct{ tenantID, eventType string }
+	grouped := make(map[key][]models.UsageEvent)
+	var order []key
+
+	for _, event := range events {
+		if _, covered := l.config.EventCategories[event.EventType]; !covered {
+			continue
+		}
+		k := key{event.TenantID, event.EventType}
+		if _, seen := grouped[k]; !seen {
+			order = append(order, k)
+		}
+		grouped[k] = append(grouped[k], event)
+	}
+
+	var failed error
+	for _, k := range order {
+		err := l.drawdown(ctx, k.tenantID, k.eventType, grouped[k])
+		if err == nil {
+			continue
+		}
+
+		now := time.Now()
+		pending := &models.PendingDrawdown{
+			ID:        uuid.New().String(),
+			TenantID:  k.tenantID,
+			EventType: k.eventType,
+			Events:    grouped[k],
+			Attempts:  1,
+			LastError: err.Error(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if saveErr := l.store.SavePendingDrawdown(ctx, pending); saveErr != nil {
+			failed = fmt.Errorf("drawdown for tenant %s failed (%v) and could not be kept: %w", k.tenantID, err, saveErr)
+			continue
+		}
+		log.Printf("[WALLET] Drawdown of %s usage for tenant %s failed, kept as %s for replay: %v",
+			k.eventType, k.tenantID, pending.ID, err)
+	}
+
+	return failed
+}
+
+// drawdown rates one tenant's covered events of one type and draws the cost
+// from their wallet, recording any shortfall as overage
+func (l *Ledger) drawdown(ctx context.Context, tenantID, eventType string, events []models.UsageEvent) error {
+	w, err := l.store.GetWallet(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return nil
+	}
+
+	var quantity float64
+	for _, event := range events {
+		quantity += event.Quantity
+	}
+	cost, err := l.rate(ctx, tenantID, eventType, events)
+	if err != nil {
+		return err
+	}
+	cost = roundCredit(cost)
+	if cost <= 0 {
+		return nil
+	}
+
+	now := time.Now()
+	if err := l.store.ExpireCreditGrants(ctx, tenantID, now); err != nil {
+		return err
+	}
+
+	drawn, err := l.store.DrawdownCredits(ctx, tenantID, cost, models.WalletTransaction{
+		TenantID:    tenantID,
+		Type:        models.WalletTxDrawdown,
+		EventType:   &eventType,
+		Quantity:    &quantity,
+		Description: fmt.Sprintf("%s usage", eventType),
+		CreatedAt:   now,
+	})
+	if err != nil {
+		return err
+	}
+
+	if overage := roundCredit(cost - drawn); overage > 0 {
+		log.Printf("[WALLET] Tenant %s overage of %.4f on %s (behavior=%s)",
+			tenantID, overage, eventType, w.ZeroBalanceBehavior)
+	}
+	return nil
+}
+
+// ReplayPending retries drawdowns that failed, oldest first, and returns how
+// many succeeded. Each is claimed by removing it first, so concurrent replays
+// never draw it down twice; one that fails again is put back.
+func (l *Ledger) ReplayPending(ctx context.Context) (int, error) {
+	pending, err := l.store.GetPendingDrawdowns(ctx, 100)
+	if err != nil {
+		return 0, err
+	}
+
+	replayed := 0
+	for i := range pending {
+		p := &pending[i]
+		claimed, err := l.store.DeletePendingDrawdown(ctx, p.ID)
+		if err != nil {
+			return replayed, err
+		}
+		if !claimed {
+			continue
+		}
+
+		if err := l.drawdown(ctx, p.TenantID, p.EventType, p.Events); err != nil {
+			p.Attempts++
+			p.LastError = err.Error()
+			p.UpdatedAt = time.Now()
+			if err := l.store.SavePendingDrawdown(ctx, p); err != nil {
+				return replayed, fmt.Errorf("failed to put back drawdown %s: %w", p.ID, err)
+			}
+			log.Printf("[WALLET] Replay %d of drawdown %s for tenant %s failed: %s", p.Attempts, p.ID, p.TenantID, p.LastError)
+			continue
+		}
+		replayed++
+		log.Printf("[WALLET] Replayed drawdown %s for tenant %s", p.ID, p.TenantID)
+	}
+	return replayed, nil
+}
+
+// Run replays failed drawdowns every interval until ctx is cancelled
+func (l *Ledger) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	log.Printf("[WALLET] Drawdown replay worker started (interval=%v)", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := l.ReplayPending(ctx); err != nil {
+				log.Printf("[WALLET] Failed to replay pending drawdowns: %v", err)
+			}
+		}
+	}
+}
+
+// AllowsCategory reports whether an entitlement category gated by the wallet
+// is usable. Categories the wallet does not gate are always allowed.
+func (l *Ledger) AllowsCategory(ctx context.Context, tenantID, category string) (bool, error) {
+	gated := false
+	for _, c := range l.config.EventCategories {
+		if c == category {
+			gated = true
+			break
+		}
+	}
+	if !gated {
+		return true, nil
+	}
+
+	w, err := l.store.GetWallet(ctx, tenantID)
+	if err != nil || w == nil || w.ZeroBalanceBehavior != models.ZeroBalanceDeny {
+		return true, err
+	}
+
+	balance, err := l.Balance(ctx, tenantID)
+	if err != nil {
+		return true, err
+	}
+	return balance > 0, nil
+}